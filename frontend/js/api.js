@@ -55,6 +55,11 @@ export async function fetchAPI(path, options = {}) {
     headers,
   });
 
+  // セッション cookie が無効（未ログイン・期限切れ・全デバイスログアウト）の場合はログインページへ
+  if (res.status === 401 && !token) {
+    window.location.href = basePath + 'login';
+  }
+
   if (!res.ok) {
     const text = await res.text().catch(() => '');
     throw new Error(`API error: ${res.status} ${text}`);
@@ -251,19 +256,15 @@ export async function saveFile(session, path, content) {
 
 /**
  * ファイルの raw コンテンツ URL を生成する。
- * 認証トークンをクエリパラメータに付与する（ブラウザの img/iframe 等で使用するため）。
+ * ブラウザの img/iframe 等で使用するため、認証はセッション cookie で行う
+ * （クエリパラメータのトークンは attach エンドポイントでのみ受け付けられる）。
  * @param {string} session - セッション名
  * @param {string} path - ファイルの相対パス
  * @returns {string} raw ファイル URL
  */
 export function getFileRawURL(session, path) {
   const basePath = getBasePath();
-  const token = getToken();
-  let url = `${basePath}api/sessions/${encodeURIComponent(session)}/files?path=${encodeURIComponent(path)}&raw=true`;
-  if (token) {
-    url += `&token=${encodeURIComponent(token)}`;
-  }
-  return url;
+  return `${basePath}api/sessions/${encodeURIComponent(session)}/files?path=${encodeURIComponent(path)}&raw=true`;
 }
 
 /**
@@ -689,3 +690,35 @@ export function getWebSocketURL(session, index) {
   }
   return url;
 }
+
+/**
+ * 共有リンクのトークンでセッションのウィンドウ一覧を取得する。
+ * 共有リンクではウィンドウ一覧と attach のみが許可される。
+ * @param {string} session - セッション名
+ * @param {string} shareToken - 共有リンクのトークン
+ * @returns {Promise<Array<{index: number, name: string, active: boolean}>>}
+ */
+export async function listSharedWindows(session, shareToken) {
+  const basePath = getBasePath();
+  const url = `${basePath}api/sessions/${encodeURIComponent(session)}/windows?share=${encodeURIComponent(shareToken)}`;
+  const res = await fetch(url);
+  if (!res.ok) {
+    const text = await res.text().catch(() => '');
+    throw new Error(`API error: ${res.status} ${text}`);
+  }
+  return res.json();
+}
+
+/**
+ * 共有リンクで読み取り専用の attach をする WebSocket URL を生成する。
+ * @param {string} session - セッション名
+ * @param {number} index - ウィンドウインデックス
+ * @param {string} shareToken - 共有リンクのトークン
+ * @returns {string} WebSocket URL
+ */
+export function getShareWebSocketURL(session, index, shareToken) {
+  const basePath = getBasePath();
+  const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
+  const path = `${basePath}api/sessions/${encodeURIComponent(session)}/windows/${index}/attach`;
+  return `${protocol}//${location.host}${path}?share=${encodeURIComponent(shareToken)}&readonly=1`;
+}
@@ -67,6 +67,11 @@ export class ConnectionManager {
       this._retryCount = 0;
       this._setState('connected');
     });
+
+    // サーバー再起動時はバックオフせず最短の間隔で再接続する
+    this._terminal.setOnServerShutdown(() => {
+      this._retryCount = 0;
+    });
   }
 
   /**
@@ -7,6 +7,18 @@ import { Unicode11Addon } from '@xterm/addon-unicode11';
 import { ClipboardAddon } from '@xterm/addon-clipboard';
 import { uploadImage } from './api.js';
 
+/** pty 出力をバイナリフレームで受け取るための WebSocket サブプロトコル名 */
+const WS_BINARY_PROTOCOL = 'palmux.binary.v1';
+
+/** サーバー側で端末を解釈し、画面の差分（frame メッセージ）を受け取るための WebSocket サブプロトコル名 */
+const WS_STATE_PROTOCOL = 'palmux.state.v1';
+
+/** 状態同期モード（低帯域モード）を使うかどうかを保存する localStorage のキー */
+export const STATE_SYNC_STORAGE_KEY = 'palmux-state-sync';
+
+/** 再接続のために古い WebSocket を閉じるときのクローズコード（サーバーは attach を保持して resume を待つ） */
+const WS_CLOSE_RESUMING = 4000;
+
 function _getTerminalTheme() {
   const isDark = document.documentElement.getAttribute('data-theme') !== 'light';
   return isDark
@@ -35,6 +47,8 @@ export class PalmuxTerminal {
     this._onClientStatus = null;
     /** @type {function|null} 通知更新時のコールバック */
     this._onNotificationUpdate = null;
+    /** @type {function|null} セッション/ウィンドウ一覧の変化時のコールバック */
+    this._onTmuxChanged = null;
     /** @type {import('./toolbar.js').Toolbar|null} */
     this._toolbar = null;
     /** @type {boolean} IME モード有効時は onData ハンドラからの入力送信を抑制する */
@@ -54,6 +68,10 @@ export class PalmuxTerminal {
     this._aliveCheckTimeout = null;
     /** @type {boolean} サーバーからの最後の ping 受信後にフラグをセット */
     this._lastPongReceived = false;
+    /** @type {string|null} サーバー側の attach を引き継ぐための resume トークン */
+    this._resumeToken = null;
+    /** @type {number} 受信済みの出力のストリームオフセット（再接続時に取りこぼした分から再送してもらう） */
+    this._streamOffset = 0;
   }
 
   /**
@@ -205,8 +223,11 @@ export class PalmuxTerminal {
     this.disconnect();
     this._initTerminal();
     this._onDisconnect = onDisconnect || null;
+    this._resumeToken = null;
+    this._streamOffset = 0;
+    this._outputDecoder = new TextDecoder();
 
-    this._ws = new WebSocket(wsUrl);
+    this._openWebSocket(wsUrl);
 
     this._ws.onopen = () => {
       // 接続成功時にリサイズ情報を送信
@@ -217,10 +238,21 @@ export class PalmuxTerminal {
     };
 
     this._ws.onmessage = (event) => {
+      if (event.data instanceof ArrayBuffer) {
+        // バイナリフレーム: pty の生の出力
+        const text = this._decodeOutput(event.data);
+        if (text) {
+          this._term.write(text);
+        }
+        return;
+      }
       try {
         const msg = JSON.parse(event.data);
+        this._trackStream(msg);
         if (msg.type === 'output' && msg.data) {
           this._term.write(msg.data);
+        } else if (msg.type === 'frame') {
+          this._applyFrame(msg, (data, done) => this._term.write(data, done));
         } else if (msg.type === 'ping') {
           // サーバーからの ping に pong で応答（Cloudflare アイドルタイムアウト対策）
           this._lastPongReceived = true;
@@ -233,6 +265,15 @@ export class PalmuxTerminal {
           if (this._onNotificationUpdate) {
             this._onNotificationUpdate(msg.notifications || []);
           }
+        } else if (msg.type === 'tmux_changed') {
+          if (this._onTmuxChanged) {
+            this._onTmuxChanged();
+          }
+        } else if (msg.type === 'server_shutdown') {
+          // サーバーの再起動: 続く切断後に新しいインスタンスへ即座に再接続させる
+          if (this._onServerShutdown) {
+            this._onServerShutdown();
+          }
         }
       } catch (e) {
         console.error('Failed to parse WebSocket message:', e);
@@ -288,26 +329,44 @@ export class PalmuxTerminal {
       this._ws.onmessage = null;
       this._ws.onclose = null;
       this._ws.onerror = null;
-      this._ws.close();
+      this._ws.close(WS_CLOSE_RESUMING, 'reconnecting');
       this._ws = null;
     }
 
     this._onDisconnect = onDisconnect || null;
 
-    // スクロールバックとターミナル状態をリセットし、
-    // attach-session の全バッファ再送出による二重表示を防止する
-    this._term.clear();
-    this._term.reset();
+    // 新しい attach になった場合はターミナルを作り直す
+    const startFresh = () => {
+      // スクロールバックとターミナル状態をリセットし、
+      // attach-session の全バッファ再送出による二重表示を防止する
+      this._term.clear();
+      this._term.reset();
+      this._outputDecoder = new TextDecoder();
+
+      // 再接続時の出力バッファリング:
+      // tmux attach-session の初期バッファ送出をまとめて受け取り、
+      // 一括で xterm.js に書き込むことでスクロールのちらつきを防止する。
+      // バッファリング中はターミナルを非表示にし、描画のちらつきを完全に隠す。
+      this._reconnectBuffer = [];
+      this._reconnectBufferTimer = null;
+      this._container.style.visibility = 'hidden';
+    };
 
-    // 再接続時の出力バッファリング:
-    // tmux attach-session の初期バッファ送出をまとめて受け取り、
-    // 一括で xterm.js に書き込むことでスクロールのちらつきを防止する。
-    // バッファリング中はターミナルを非表示にし、描画のちらつきを完全に隠す。
-    this._reconnectBuffer = [];
-    this._reconnectBufferTimer = null;
-    this._container.style.visibility = 'hidden';
+    // 同じ attach を引き継げたか（ターミナルをそのまま使えるか）は最初の resume メッセージで分かる。
+    // 引き継げた場合は取りこぼした出力だけが再送されるので、リセットせずにそのまま書き込む。
+    let decided = !this._resumeToken;
+    if (decided) {
+      startFresh();
+    }
+    const decide = (resumed) => {
+      if (decided) return;
+      decided = true;
+      if (!resumed) {
+        startFresh();
+      }
+    };
 
-    this._ws = new WebSocket(wsUrl);
+    this._openWebSocket(this._resumeToken ? this._resumeURL(wsUrl) : wsUrl);
 
     this._ws.onopen = () => {
       this._sendResize();
@@ -316,20 +375,41 @@ export class PalmuxTerminal {
       }
     };
 
+    const writeOutput = (data, done) => {
+      if (this._reconnectBuffer) {
+        // バッファリング中: データを溜めてデバウンスタイマーをリセット
+        this._reconnectBuffer.push(data);
+        clearTimeout(this._reconnectBufferTimer);
+        this._reconnectBufferTimer = setTimeout(() => {
+          this._flushReconnectBuffer();
+        }, 80);
+        if (done) done();
+      } else {
+        this._term.write(data, done);
+      }
+    };
+
     this._ws.onmessage = (event) => {
+      if (event.data instanceof ArrayBuffer) {
+        // バイナリフレーム: pty の生の出力
+        decide(false);
+        const text = this._decodeOutput(event.data);
+        if (text) {
+          writeOutput(text);
+        }
+        return;
+      }
       try {
         const msg = JSON.parse(event.data);
+        if (msg.type === 'resume') {
+          decide(msg.resumed);
+        }
+        this._trackStream(msg);
         if (msg.type === 'output' && msg.data) {
-          if (this._reconnectBuffer) {
-            // バッファリング中: データを溜めてデバウンスタイマーをリセット
-            this._reconnectBuffer.push(msg.data);
-            clearTimeout(this._reconnectBufferTimer);
-            this._reconnectBufferTimer = setTimeout(() => {
-              this._flushReconnectBuffer();
-            }, 80);
-          } else {
-            this._term.write(msg.data);
-          }
+          decide(false);
+          writeOutput(msg.data);
+        } else if (msg.type === 'frame') {
+          this._applyFrame(msg, writeOutput);
         } else if (msg.type === 'ping') {
           this._ws.send(JSON.stringify({ type: 'pong' }));
         } else if (msg.type === 'client_status') {
@@ -340,6 +420,15 @@ export class PalmuxTerminal {
           if (this._onNotificationUpdate) {
             this._onNotificationUpdate(msg.notifications || []);
           }
+        } else if (msg.type === 'tmux_changed') {
+          if (this._onTmuxChanged) {
+            this._onTmuxChanged();
+          }
+        } else if (msg.type === 'server_shutdown') {
+          // サーバーの再起動: 続く切断後に新しいインスタンスへ即座に再接続させる
+          if (this._onServerShutdown) {
+            this._onServerShutdown();
+          }
         }
       } catch (e) {
         console.error('Failed to parse WebSocket message:', e);
@@ -391,6 +480,76 @@ export class PalmuxTerminal {
     this._fitAddon = null;
   }
 
+  /**
+   * WebSocket を開く。サーバーが対応していればバイナリプロトコルで出力を受け取る
+   * （未対応の古いサーバーではサブプロトコルなしで接続し、JSON の output メッセージを受け取る）。
+   * 状態同期モードが有効な場合は状態同期プロトコルを優先して提示する（未対応のサーバーではバイナリプロトコルになる）。
+   * @param {string} wsUrl - WebSocket URL
+   * @private
+   */
+  _openWebSocket(wsUrl) {
+    const protocols = localStorage.getItem(STATE_SYNC_STORAGE_KEY) === '1'
+      ? [WS_STATE_PROTOCOL, WS_BINARY_PROTOCOL]
+      : [WS_BINARY_PROTOCOL];
+    this._ws = new WebSocket(wsUrl, protocols);
+    this._ws.binaryType = 'arraybuffer';
+  }
+
+  /**
+   * 状態同期モードの frame メッセージ（画面の差分）を書き込み、描画が終わったら ack を返す。
+   * サーバーは ack を受け取るまで次の frame を送らないため、描画の遅い端末や回線でも差分が溜まらない。
+   * @param {{seq: number, data: string}} msg - frame メッセージ
+   * @param {function(string, function): void} write - 書き込み関数（第 2 引数は描画完了時のコールバック）
+   * @private
+   */
+  _applyFrame(msg, write) {
+    const ws = this._ws;
+    write(msg.data, () => {
+      if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'ack', seq: msg.seq }));
+      }
+    });
+  }
+
+  /**
+   * WebSocket URL に resume トークンと受信済みのストリームオフセットを付ける。
+   * @param {string} wsUrl - WebSocket URL
+   * @returns {string}
+   * @private
+   */
+  _resumeURL(wsUrl) {
+    const url = new URL(wsUrl, window.location.href);
+    url.searchParams.set('resume', this._resumeToken);
+    url.searchParams.set('offset', String(this._streamOffset));
+    return url.toString();
+  }
+
+  /**
+   * サーバーからのメッセージで resume トークンとストリームオフセットを更新する。
+   * @param {object} msg - JSON メッセージ
+   * @private
+   */
+  _trackStream(msg) {
+    if (msg.type === 'resume') {
+      this._resumeToken = msg.token;
+      this._streamOffset = msg.offset;
+    } else if ((msg.type === 'output' || msg.type === 'offset') && typeof msg.offset === 'number') {
+      this._streamOffset = msg.offset;
+    }
+  }
+
+  /**
+   * バイナリフレームの pty 出力を文字列にデコードする。
+   * 末尾の不完全な UTF-8 シーケンスは次回の呼び出しに繰り越す（再接続で引き継いだ場合も同じデコーダーを使う）。
+   * @param {ArrayBuffer} data
+   * @returns {string}
+   * @private
+   */
+  _decodeOutput(data) {
+    this._streamOffset += data.byteLength;
+    return this._outputDecoder.decode(new Uint8Array(data), { stream: true });
+  }
+
   /**
    * 再接続時のバッファリングされた出力を一括で xterm.js に書き込む。
    * デバウンスタイマーから呼ばれ、tmux の初期バッファ送出完了後に実行される。
@@ -668,6 +827,24 @@ export class PalmuxTerminal {
     this._onNotificationUpdate = callback;
   }
 
+  /**
+   * セッション/ウィンドウ一覧の変化時のコールバックを設定する。
+   * サーバーから tmux_changed メッセージ（tmux のセッション・ウィンドウの作成・終了・リネーム）を受信した際に呼ばれる。
+   * @param {function(): void|null} callback
+   */
+  setOnTmuxChanged(callback) {
+    this._onTmuxChanged = callback;
+  }
+
+  /**
+   * サーバーのシャットダウン通知時のコールバックを設定する。
+   * サーバーから server_shutdown メッセージを受信した際（切断の直前）に呼ばれる。
+   * @param {function(): void} callback
+   */
+  setOnServerShutdown(callback) {
+    this._onServerShutdown = callback;
+  }
+
   /**
    * 再接続バッファフラッシュ後のコールバックを設定する。
    * WebSocket 再接続時のバッファ一括書き込み完了後に呼ばれる。
@@ -12,8 +12,19 @@ import '../css/tab.css';
 // Mount root Svelte component
 import { mount } from 'svelte';
 import App from './App.svelte';
+import ShareView from './lib/ShareView.svelte';
+import { parseHash } from './stores/route.svelte.js';
 
-mount(App, { target: document.getElementById('app') });
+// 共有リンク（#share/...）はログイン不要の読み取り専用ページを開く
+const { state: route } = parseHash(location.hash);
+if (route.view === 'share') {
+  mount(ShareView, {
+    target: document.getElementById('app'),
+    props: { shareToken: route.shareToken, session: route.session, window: route.window },
+  });
+} else {
+  mount(App, { target: document.getElementById('app') });
+}
 
 // Service worker registration
 if ('serviceWorker' in navigator) {
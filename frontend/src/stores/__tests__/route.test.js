@@ -50,6 +50,21 @@ describe('parseHash', () => {
     expect(result.state.window).toBe(1);
   });
 
+  it('should parse share hash with window', () => {
+    const result = parseHash('#share/payload.sig/my%20app/2');
+    expect(result.state.view).toBe('share');
+    expect(result.state.shareToken).toBe('payload.sig');
+    expect(result.state.session).toBe('my app');
+    expect(result.state.window).toBe(2);
+  });
+
+  it('should parse share hash without window', () => {
+    const result = parseHash('#share/payload.sig/dev');
+    expect(result.state.view).toBe('share');
+    expect(result.state.session).toBe('dev');
+    expect(result.state.window).toBeUndefined();
+  });
+
   it('should parse split suffix', () => {
     const result = parseHash('#terminal/dev/0&split=terminal/dev/1');
     expect(result.hasSplit).toBe(true);
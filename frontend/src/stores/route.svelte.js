@@ -2,9 +2,10 @@
 
 /**
  * @typedef {object} RouteState
- * @property {'sessions'|'windows'|'terminal'|'files'|'git'} view
+ * @property {'sessions'|'windows'|'terminal'|'files'|'git'|'share'} view
  * @property {string} [session]
  * @property {number} [window]
+ * @property {string} [shareToken] - share view: 共有リンクのトークン
  * @property {string} [filePath]
  * @property {string|null} [previewFile]
  * @property {object|null} [gitState]
@@ -62,6 +63,14 @@ export function parseHash(hash) {
       state.session = decodeURIComponent(parts[1] || '');
       state.window = parseInt(parts[2], 10);
       break;
+    case 'share':
+      // #share/{token}/{session}[/{window}]（共有リンクの読み取り専用ページ）
+      state.shareToken = parts[1] || '';
+      state.session = decodeURIComponent(parts[2] || '');
+      if (parts[3] !== undefined && parts[3] !== '') {
+        state.window = parseInt(parts[3], 10);
+      }
+      break;
   }
 
   state.split = hasSplit;
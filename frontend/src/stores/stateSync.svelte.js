@@ -0,0 +1,23 @@
+// stateSync.svelte.js - State sync (low-bandwidth) mode store
+
+import { STATE_SYNC_STORAGE_KEY } from '../../js/terminal.js';
+
+let enabled = $state(loadStateSync());
+
+function loadStateSync() {
+  try {
+    return localStorage.getItem(STATE_SYNC_STORAGE_KEY) === '1';
+  } catch { /* ignore */ }
+  return false;
+}
+
+export function getStateSync() { return enabled; }
+
+export function setStateSync(on) {
+  enabled = on;
+  try { localStorage.setItem(STATE_SYNC_STORAGE_KEY, on ? '1' : '0'); } catch { /* ignore */ }
+}
+
+export function toggleStateSync() {
+  setStateSync(!enabled);
+}
@@ -22,7 +22,7 @@ self.addEventListener('fetch', (event) => {
   }
 
   // Navigation requests (HTML) use network-first strategy.
-  // index.html contains a dynamic auth token (<meta name="auth-token">),
+  // index.html contains server-injected meta tags (<meta name="base-path"> etc.),
   // so we must always fetch the latest version from the server.
   if (event.request.mode === 'navigate') {
     event.respondWith(
@@ -0,0 +1,472 @@
+// Package config は palmux の設定ファイル（~/.config/palmux/config.toml）と
+// コマンドラインフラグを統合した設定を扱う。
+//
+// 優先順位は「コマンドラインで明示したフラグ > 設定ファイル > デフォルト値」。
+// reload タグが付いたフィールドは稼働中に再読み込み（SIGHUP / POST /api/config/reload）で反映でき、
+// それ以外の変更は再起動が必要になる。
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/lsp"
+)
+
+// Config は palmux の全設定。
+type Config struct {
+	Server        ServerConfig        `toml:"server"`
+	Tmux          TmuxConfig          `toml:"tmux"`
+	TLS           TLSConfig           `toml:"tls"`
+	JWT           JWTConfig           `toml:"jwt"`
+	Audit         AuditConfig         `toml:"audit"`
+	LSP           LSPConfig           `toml:"lsp"`
+	Grep          GrepConfig          `toml:"grep"`
+	Notifications NotificationsConfig `toml:"notifications"`
+	Upload        UploadConfig        `toml:"upload"`
+	Recordings    RecordingsConfig    `toml:"recordings"`
+}
+
+// ServerConfig は待ち受けと認証の設定。
+type ServerConfig struct {
+	Host           string        `toml:"host"`
+	Port           int           `toml:"port"`
+	Listen         string        `toml:"listen"`      // "host:port" または "unix:/path/to.sock"（指定時は host・port より優先）
+	SocketMode     string        `toml:"socket_mode"` // Unix ソケットのパーミッション（8 進数）
+	BasePath       string        `toml:"base_path"`
+	PublicURL      string        `toml:"public_url"` // ブラウザから開く URL（共有リンクの URL に使う）
+	Token          string        `toml:"token"`
+	Password       string        `toml:"password"`
+	SessionTTL     time.Duration `toml:"session_ttl"`
+	MaxConnections int           `toml:"max_connections" reload:"true"`
+	MaxSpectators  int           `toml:"max_spectators" reload:"true"`
+	AllowedOrigins []string      `toml:"allowed_origins" reload:"true"`
+	TrustedProxies []string      `toml:"trusted_proxies"` // 転送ヘッダーのクライアント IP を信頼するプロキシ（IP・CIDR・"unix"）
+}
+
+// TmuxConfig は外部コマンドの設定。
+type TmuxConfig struct {
+	Bin        string `toml:"bin"`
+	ClaudePath string `toml:"claude_path"`
+}
+
+// TLSConfig は TLS・相互 TLS の設定。
+// クライアント証明書の CRL・拒否リストはファイルの更新を検知して自動で再読み込みされる。
+type TLSConfig struct {
+	Cert           string `toml:"cert"`
+	Key            string `toml:"key"`
+	Auto           bool   `toml:"auto"`
+	ClientCA       string `toml:"client_ca"`
+	ClientCRL      string `toml:"client_crl"`
+	ClientDenylist string `toml:"client_denylist"`
+}
+
+// JWTConfig はリバースプロキシの JWT 認証の設定。
+type JWTConfig struct {
+	JWKS      string `toml:"jwks"`
+	Header    string `toml:"header"`
+	Audience  string `toml:"audience"`
+	Issuer    string `toml:"issuer"`
+	UserClaim string `toml:"user_claim"`
+}
+
+// AuditConfig は監査ログの設定。
+type AuditConfig struct {
+	Path       string `toml:"path"`
+	MaxSizeMB  int64  `toml:"max_size_mb"`
+	MaxBackups int    `toml:"max_backups"`
+}
+
+// RecordingsConfig は録画（asciicast v2）の設定。
+type RecordingsConfig struct {
+	Dir       string        `toml:"dir"`
+	Retention time.Duration `toml:"retention"`   // 録画終了からこの期間を過ぎた録画を削除する
+	MaxSizeMB int64         `toml:"max_size_mb"` // 録画の合計サイズの上限（超えた分は古いものから削除する）
+}
+
+// LSPConfig は言語サーバーの設定。
+type LSPConfig struct {
+	AutoDetect bool        `toml:"auto_detect"` // インストール済みの言語サーバーを自動検出する
+	Servers    []LSPServer `toml:"servers"`     // 追加・上書きする言語サーバー（[[lsp.servers]]）
+}
+
+// LSPServer は 1 言語の言語サーバーの設定。
+// 自動検出された同じ言語のサーバーを置き換える。Disabled の場合はその言語の LSP を無効にする。
+type LSPServer struct {
+	Language string   `toml:"language"`
+	Command  string   `toml:"command"`
+	Args     []string `toml:"args"`
+	Disabled bool     `toml:"disabled"`
+}
+
+// GrepConfig はファイル内容検索の設定。
+type GrepConfig struct {
+	Engine     string `toml:"engine" reload:"true"`      // "auto"（rg → grep → builtin）、"ripgrep"、"grep"、"builtin"
+	MaxResults int    `toml:"max_results" reload:"true"` // 1 回の検索で返す最大件数の上限
+}
+
+// NotificationsConfig は通知の設定。
+type NotificationsConfig struct {
+	TTL time.Duration `toml:"ttl" reload:"true"` // 通知が自動で消えるまでの時間
+}
+
+// UploadConfig は画像アップロードの設定。
+type UploadConfig struct {
+	MaxSizeMB int64 `toml:"max_size_mb" reload:"true"`
+}
+
+// grepEngines は GrepConfig.Engine に指定できる値。
+var grepEngines = map[string]bool{"auto": true, "ripgrep": true, "grep": true, "builtin": true}
+
+// Dir は設定ディレクトリ（~/.config/palmux）を返す。
+// ホームディレクトリが取得できない場合は空文字列を返す。
+func Dir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".config", "palmux")
+}
+
+// DefaultPath はデフォルトの設定ファイルのパスを返す。
+func DefaultPath() string {
+	if dir := Dir(); dir != "" {
+		return filepath.Join(dir, "config.toml")
+	}
+	return ""
+}
+
+// Default はデフォルト値の Config を返す。
+func Default() *Config {
+	auditPath, recordingsDir := "", ""
+	if dir := Dir(); dir != "" {
+		auditPath = filepath.Join(dir, "audit.log")
+		recordingsDir = filepath.Join(dir, "recordings")
+	}
+	return &Config{
+		Server: ServerConfig{
+			Host:           "0.0.0.0",
+			Port:           8080,
+			SocketMode:     "0660",
+			BasePath:       "/",
+			SessionTTL:     30 * 24 * time.Hour,
+			MaxConnections: 5,
+			MaxSpectators:  20,
+		},
+		Tmux: TmuxConfig{
+			Bin:        "tmux",
+			ClaudePath: "claude",
+		},
+		JWT: JWTConfig{
+			Header:    "Cf-Access-Jwt-Assertion",
+			UserClaim: "email",
+		},
+		Audit: AuditConfig{
+			Path:       auditPath,
+			MaxSizeMB:  10,
+			MaxBackups: 5,
+		},
+		LSP: LSPConfig{
+			AutoDetect: true,
+		},
+		Grep: GrepConfig{
+			Engine:     "auto",
+			MaxResults: 500,
+		},
+		Notifications: NotificationsConfig{
+			TTL: 30 * time.Minute,
+		},
+		Upload: UploadConfig{
+			MaxSizeMB: 10,
+		},
+		Recordings: RecordingsConfig{
+			Dir:       recordingsDir,
+			Retention: 7 * 24 * time.Hour,
+			MaxSizeMB: 1024,
+		},
+	}
+}
+
+// RegisterFlags は c のフィールドに対応するコマンドラインフラグを fs に登録する。
+// フラグのデフォルト値は c の現在の値になる。
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.Server.Port, "port", c.Server.Port, "Listen port")
+	fs.StringVar(&c.Server.Host, "host", c.Server.Host, "Listen address")
+	fs.StringVar(&c.Server.Listen, "listen", c.Server.Listen, "Listen on host:port or unix:/path/to.sock (overrides --host and --port)")
+	fs.StringVar(&c.Server.SocketMode, "socket-mode", c.Server.SocketMode, "Permissions of the unix socket (octal)")
+	fs.StringVar(&c.Tmux.Bin, "tmux", c.Tmux.Bin, "tmux binary path")
+	fs.StringVar(&c.Tmux.ClaudePath, "claude-path", c.Tmux.ClaudePath, "claude command path or wrapper script")
+	fs.StringVar(&c.TLS.Cert, "tls-cert", c.TLS.Cert, "TLS certificate file")
+	fs.StringVar(&c.TLS.Key, "tls-key", c.TLS.Key, "TLS private key file")
+	fs.BoolVar(&c.TLS.Auto, "tls-auto", c.TLS.Auto, "Serve TLS with a self-signed certificate from an auto-generated local CA (~/.config/palmux/tls)")
+	fs.StringVar(&c.TLS.ClientCA, "tls-client-ca", c.TLS.ClientCA, "CA certificate (PEM) for client certificates (enables mutual TLS)")
+	fs.StringVar(&c.TLS.ClientCRL, "tls-client-crl", c.TLS.ClientCRL, "Client certificate revocation list (PEM or DER, reloaded on change)")
+	fs.StringVar(&c.TLS.ClientDenylist, "tls-client-denylist", c.TLS.ClientDenylist, "File of denied client certificate serials or SHA-256 fingerprints (reloaded on change)")
+	fs.StringVar(&c.Server.Token, "token", c.Server.Token, "Fixed auth token (auto-generated if empty)")
+	fs.StringVar(&c.Server.Password, "password", c.Server.Password, "Additional password accepted on the login page")
+	fs.DurationVar(&c.Server.SessionTTL, "session-ttl", c.Server.SessionTTL, "Login session cookie lifetime")
+	fs.StringVar(&c.Server.BasePath, "base-path", c.Server.BasePath, "Base path")
+	fs.StringVar(&c.Server.PublicURL, "public-url", c.Server.PublicURL, "URL browsers use to open Palmux, used for share links (e.g. https://palmux.example.com/; derived from the listen address if empty)")
+	fs.IntVar(&c.Server.MaxConnections, "max-connections", c.Server.MaxConnections, "Max simultaneous connections per session")
+	fs.IntVar(&c.Server.MaxSpectators, "max-spectators", c.Server.MaxSpectators, "Max simultaneous read-only spectator connections per session")
+	fs.StringVar(&c.JWT.JWKS, "jwt-jwks", c.JWT.JWKS, "JWKS file path or URL used to verify reverse-proxy JWTs (enables JWT auth)")
+	fs.StringVar(&c.JWT.Header, "jwt-header", c.JWT.Header, "Request header carrying the reverse-proxy JWT")
+	fs.StringVar(&c.JWT.Audience, "jwt-audience", c.JWT.Audience, "Expected JWT audience (aud) claim (required with --jwt-jwks)")
+	fs.StringVar(&c.JWT.Issuer, "jwt-issuer", c.JWT.Issuer, "Expected JWT issuer (iss) claim")
+	fs.StringVar(&c.JWT.UserClaim, "jwt-user-claim", c.JWT.UserClaim, "JWT claim used as the user identity (falls back to sub)")
+	fs.StringVar(&c.Audit.Path, "audit-log", c.Audit.Path, "Audit log file (JSONL, empty to disable)")
+	fs.Int64Var(&c.Audit.MaxSizeMB, "audit-log-max-size", c.Audit.MaxSizeMB, "Audit log size in MB before rotation")
+	fs.IntVar(&c.Audit.MaxBackups, "audit-log-max-backups", c.Audit.MaxBackups, "Number of rotated audit log files to keep")
+	fs.StringVar(&c.Recordings.Dir, "recordings-dir", c.Recordings.Dir, "Directory for asciicast session recordings (empty to disable recording)")
+	fs.DurationVar(&c.Recordings.Retention, "recordings-retention", c.Recordings.Retention, "Delete recordings this long after they end")
+	fs.Int64Var(&c.Recordings.MaxSizeMB, "recordings-max-size", c.Recordings.MaxSizeMB, "Total size of recordings in MB before the oldest are deleted")
+	fs.Var((*stringList)(&c.Server.AllowedOrigins), "allowed-origins", "Comma-separated browser origins allowed besides same-origin (e.g. https://app.example.com,*.example.com; * allows all)")
+	fs.Var((*stringList)(&c.Server.TrustedProxies), "trusted-proxies", "Comma-separated reverse proxies (IPs, CIDRs or unix) whose X-Forwarded-For / X-Real-IP / X-Forwarded-Proto / X-Forwarded-Host headers are trusted")
+}
+
+// stringList はカンマ区切りで指定する文字列リストのフラグ値。
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return joinNonEmpty(*l)
+}
+
+func (l *stringList) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// Overrides はコマンドラインで明示されたフラグの名前と値を返す。
+// Load に渡すと、設定ファイルより優先して適用される。
+func Overrides(fs *flag.FlagSet) map[string]string {
+	overrides := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		overrides[f.Name] = f.Value.String()
+	})
+	return overrides
+}
+
+// Load はデフォルト値に設定ファイル path の内容を重ね、さらに overrides（明示されたフラグ）を適用した Config を返す。
+// path が空またはファイルが存在しない場合は設定ファイルなしとして扱う。
+// overrides のうち設定に対応しないフラグ（--version 等）は無視する。
+func Load(path string, overrides map[string]string) (*Config, error) {
+	c := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			table, err := parseTOML(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+			if err := decode(table, c); err != nil {
+				return nil, fmt.Errorf("load %s: %w", path, err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+	}
+
+	fs := flag.NewFlagSet("palmux", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	for name, value := range overrides {
+		if fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("flag --%s: %w", name, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate は設定の整合性を検査する。
+func (c *Config) Validate() error {
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", c.Server.Port)
+	}
+	if _, err := parseSocketMode(c.Server.SocketMode); err != nil {
+		return err
+	}
+	if c.Server.Listen == "unix:" {
+		return fmt.Errorf("unix socket path is required in --listen")
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		return fmt.Errorf("both --tls-cert and --tls-key must be specified together")
+	}
+	if c.TLS.Auto && c.TLS.Cert != "" {
+		return fmt.Errorf("--tls-auto cannot be combined with --tls-cert and --tls-key")
+	}
+	if c.TLS.ClientCA != "" && c.TLS.Cert == "" && !c.TLS.Auto {
+		return fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key or --tls-auto")
+	}
+	if (c.TLS.ClientCRL != "" || c.TLS.ClientDenylist != "") && c.TLS.ClientCA == "" {
+		return fmt.Errorf("--tls-client-crl and --tls-client-denylist require --tls-client-ca")
+	}
+	if c.Server.MaxConnections < 0 || c.Server.MaxSpectators < 0 {
+		return fmt.Errorf("max connections must not be negative")
+	}
+	if c.Server.PublicURL != "" {
+		u, err := url.Parse(c.Server.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid public url %q (http or https URL without query or fragment)", c.Server.PublicURL)
+		}
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if !validTrustedProxy(p) {
+			return fmt.Errorf("invalid trusted proxy %q (IP address, CIDR or unix)", p)
+		}
+	}
+	if !grepEngines[c.Grep.Engine] {
+		return fmt.Errorf("invalid grep engine %q (auto, ripgrep, grep or builtin)", c.Grep.Engine)
+	}
+	if c.Grep.MaxResults < 0 {
+		return fmt.Errorf("grep max_results must not be negative")
+	}
+	if c.Notifications.TTL < 0 {
+		return fmt.Errorf("notifications ttl must not be negative")
+	}
+	if c.Upload.MaxSizeMB < 0 {
+		return fmt.Errorf("upload max_size_mb must not be negative")
+	}
+	if c.Recordings.Retention < 0 || c.Recordings.MaxSizeMB < 0 {
+		return fmt.Errorf("recordings retention and max_size_mb must not be negative")
+	}
+	for i, s := range c.LSP.Servers {
+		if s.Language == "" {
+			return fmt.Errorf("lsp.servers[%d]: language is required", i)
+		}
+		if s.Command == "" && !s.Disabled {
+			return fmt.Errorf("lsp.servers[%d]: command is required", i)
+		}
+	}
+	return nil
+}
+
+// validTrustedProxy は信頼するプロキシの指定（IP アドレス・CIDR・"unix"）が正しいかを返す。
+func validTrustedProxy(s string) bool {
+	if s == "unix" {
+		return true
+	}
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// ListenAddr は待ち受けアドレスを返す。Listen が空の場合は Host と Port から組み立てる。
+func (c *Config) ListenAddr() string {
+	if c.Server.Listen != "" {
+		return c.Server.Listen
+	}
+	return net.JoinHostPort(c.Server.Host, strconv.Itoa(c.Server.Port))
+}
+
+// PublicURL はブラウザから開く URL を返す。public_url が空の場合は、特定のホストで待ち受けていれば
+// 待ち受けアドレスとベースパスから組み立て、全アドレス・Unix ソケットで待ち受ける場合は空を返す。
+func (c *Config) PublicURL() string {
+	if c.Server.PublicURL != "" {
+		return c.Server.PublicURL
+	}
+	if c.Server.Listen != "" && strings.HasPrefix(c.Server.Listen, "unix:") {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(c.ListenAddr())
+	if err != nil || host == "" {
+		return ""
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && ip.IsUnspecified() {
+		return ""
+	}
+	scheme := "http"
+	if c.TLS.Cert != "" || c.TLS.Auto {
+		scheme = "https"
+	}
+	basePath := "/"
+	if p := strings.Trim(c.Server.BasePath, "/"); p != "" {
+		basePath = "/" + p + "/"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + basePath
+}
+
+// SocketFileMode は Unix ソケットのパーミッションを返す（Validate 済みであること）。
+func (c *Config) SocketFileMode() os.FileMode {
+	mode, _ := parseSocketMode(c.Server.SocketMode)
+	return mode
+}
+
+// parseSocketMode は "0660" のような 8 進数のパーミッションを解釈する。
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %q (octal permissions such as 0660)", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// RestartRequired は old から next への変更のうち、再読み込みでは反映されず再起動が必要な
+// 設定キー（例: "server.port"）を返す。
+func RestartRequired(old, next *Config) []string {
+	return diffFields(reflect.ValueOf(*old), reflect.ValueOf(*next), "")
+}
+
+// LSPServers は自動検出された言語サーバーに設定ファイルの [[lsp.servers]] を適用した一覧を返す。
+// AutoDetect が false の場合は detected を使わない。
+func (c *Config) LSPServers(detected []lsp.ServerConfig) []lsp.ServerConfig {
+	var base []lsp.ServerConfig
+	if c.LSP.AutoDetect {
+		base = detected
+	}
+
+	overridden := make(map[string]bool)
+	for _, s := range c.LSP.Servers {
+		overridden[s.Language] = true
+	}
+
+	var servers []lsp.ServerConfig
+	for _, s := range base {
+		if !overridden[s.Language] {
+			servers = append(servers, s)
+		}
+	}
+	for _, s := range c.LSP.Servers {
+		if s.Disabled {
+			continue
+		}
+		args := s.Args
+		if args == nil {
+			args = []string{}
+		}
+		servers = append(servers, lsp.ServerConfig{
+			Language: s.Language,
+			Command:  s.Command,
+			Args:     args,
+			Enabled:  true,
+		})
+	}
+	return servers
+}
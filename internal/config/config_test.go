@@ -0,0 +1,294 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/lsp"
+)
+
+// writeConfig はテスト用の設定ファイルを書き出してパスを返す。
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+[server]
+port = 9000
+host = "127.0.0.1"
+session_ttl = "12h"
+allowed_origins = ["https://app.example.com"]
+trusted_proxies = ["10.0.0.0/8", "unix"]
+
+[tmux]
+claude_path = "/opt/claude"
+
+[grep]
+engine = "builtin"
+max_results = 100
+
+[notifications]
+ttl = "5m"
+
+[upload]
+max_size_mb = 25
+
+[recordings]
+dir = "/var/lib/palmux/recordings"
+retention = "72h"
+
+[[lsp.servers]]
+language = "go"
+command = "gopls"
+args = ["serve", "-rpc.trace"]
+`)
+
+	cfg, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Server.Port != 9000 || cfg.Server.Host != "127.0.0.1" {
+		t.Errorf("server = %+v", cfg.Server)
+	}
+	if cfg.Server.SessionTTL != 12*time.Hour {
+		t.Errorf("session_ttl = %v, want 12h", cfg.Server.SessionTTL)
+	}
+	if !reflect.DeepEqual(cfg.Server.AllowedOrigins, []string{"https://app.example.com"}) {
+		t.Errorf("allowed_origins = %v", cfg.Server.AllowedOrigins)
+	}
+	if !reflect.DeepEqual(cfg.Server.TrustedProxies, []string{"10.0.0.0/8", "unix"}) {
+		t.Errorf("trusted_proxies = %v", cfg.Server.TrustedProxies)
+	}
+	if cfg.Tmux.ClaudePath != "/opt/claude" || cfg.Tmux.Bin != "tmux" {
+		t.Errorf("tmux = %+v (unset keys should keep defaults)", cfg.Tmux)
+	}
+	if cfg.Grep.Engine != "builtin" || cfg.Grep.MaxResults != 100 {
+		t.Errorf("grep = %+v", cfg.Grep)
+	}
+	if cfg.Notifications.TTL != 5*time.Minute {
+		t.Errorf("notifications.ttl = %v", cfg.Notifications.TTL)
+	}
+	if cfg.Upload.MaxSizeMB != 25 {
+		t.Errorf("upload.max_size_mb = %d", cfg.Upload.MaxSizeMB)
+	}
+	if cfg.Recordings.Dir != "/var/lib/palmux/recordings" || cfg.Recordings.Retention != 72*time.Hour || cfg.Recordings.MaxSizeMB != 1024 {
+		t.Errorf("recordings = %+v", cfg.Recordings)
+	}
+	if len(cfg.LSP.Servers) != 1 || cfg.LSP.Servers[0].Args[1] != "-rpc.trace" {
+		t.Errorf("lsp.servers = %+v", cfg.LSP.Servers)
+	}
+}
+
+func TestLoad_FlagsOverrideFile(t *testing.T) {
+	path := writeConfig(t, `
+[server]
+port = 9000
+max_connections = 3
+allowed_origins = ["https://file.example.com"]
+`)
+
+	defaults := Default()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("version", false, "")
+	defaults.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--port", "7000", "--allowed-origins", "https://a.example.com, https://b.example.com", "--version"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	cfg, err := Load(path, Overrides(fs))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 7000 {
+		t.Errorf("port = %d, want flag value 7000", cfg.Server.Port)
+	}
+	if cfg.Server.MaxConnections != 3 {
+		t.Errorf("max_connections = %d, want file value 3", cfg.Server.MaxConnections)
+	}
+	want := []string{"https://a.example.com", "https://b.example.com"}
+	if !reflect.DeepEqual(cfg.Server.AllowedOrigins, want) {
+		t.Errorf("allowed_origins = %v, want %v", cfg.Server.AllowedOrigins, want)
+	}
+}
+
+func TestLoad_MissingFileUsesDefaults(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.toml"), nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Load() = %+v, want defaults", cfg)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "未知のキー", content: "[server]\nprot = 1", wantErr: `unknown key "server.prot"`},
+		{name: "型の不一致", content: "[server]\nport = \"80\"", wantErr: "server.port: expected integer, got string"},
+		{name: "不正な期間", content: "[notifications]\nttl = \"soon\"", wantErr: "notifications.ttl"},
+		{name: "不正な grep エンジン", content: "[grep]\nengine = \"ag\"", wantErr: "invalid grep engine"},
+		{name: "不正な信頼するプロキシ", content: "[server]\ntrusted_proxies = [\"proxy.local\"]", wantErr: "invalid trusted proxy"},
+		{name: "不正な公開 URL", content: "[server]\npublic_url = \"palmux.example.com\"", wantErr: "invalid public url"},
+		{name: "不正なソケットのパーミッション", content: "[server]\nsocket_mode = \"rw\"", wantErr: "invalid socket mode"},
+		{name: "ソケットのパスなし", content: "[server]\nlisten = \"unix:\"", wantErr: "unix socket path"},
+		{name: "TLS 鍵の片方だけ", content: "[tls]\ncert = \"a.pem\"", wantErr: "tls-key"},
+		{name: "負の録画の保持期間", content: "[recordings]\nretention = \"-1h\"", wantErr: "recordings retention"},
+		{name: "LSP のコマンドなし", content: "[[lsp.servers]]\nlanguage = \"go\"", wantErr: "command is required"},
+		{name: "構文エラー", content: "[server\n", wantErr: "parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_ListenAddr(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   ServerConfig
+		wantAddr string
+		wantMode os.FileMode
+	}{
+		{name: "host と port", server: ServerConfig{Host: "127.0.0.1", Port: 9000, SocketMode: "0660"}, wantAddr: "127.0.0.1:9000", wantMode: 0660},
+		{name: "IPv6", server: ServerConfig{Host: "::1", Port: 9000, SocketMode: "0660"}, wantAddr: "[::1]:9000", wantMode: 0660},
+		{name: "Unix ソケット", server: ServerConfig{Host: "0.0.0.0", Port: 8080, Listen: "unix:/run/palmux.sock", SocketMode: "0o600"}, wantAddr: "unix:/run/palmux.sock", wantMode: 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Server = tt.server
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if got := cfg.ListenAddr(); got != tt.wantAddr {
+				t.Errorf("ListenAddr() = %q, want %q", got, tt.wantAddr)
+			}
+			if got := cfg.SocketFileMode(); got != tt.wantMode {
+				t.Errorf("SocketFileMode() = %o, want %o", got, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestConfig_PublicURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		server ServerConfig
+		tls    TLSConfig
+		want   string
+	}{
+		{name: "public_url を優先", server: ServerConfig{Host: "127.0.0.1", Port: 9000, PublicURL: "https://palmux.example.com/tools/"}, want: "https://palmux.example.com/tools/"},
+		{name: "特定のホスト", server: ServerConfig{Host: "192.168.1.10", Port: 9000, BasePath: "palmux"}, want: "http://192.168.1.10:9000/palmux/"},
+		{name: "IPv6 と TLS", server: ServerConfig{Host: "::1", Port: 8443, BasePath: "/"}, tls: TLSConfig{Auto: true}, want: "https://[::1]:8443/"},
+		{name: "listen のホスト名", server: ServerConfig{Listen: "tablet.local:8080"}, want: "http://tablet.local:8080/"},
+		{name: "全アドレス", server: ServerConfig{Host: "0.0.0.0", Port: 8080}, want: ""},
+		{name: "IPv6 の全アドレス", server: ServerConfig{Listen: "[::]:8080"}, want: ""},
+		{name: "ホストなし", server: ServerConfig{Listen: ":8080"}, want: ""},
+		{name: "Unix ソケット", server: ServerConfig{Listen: "unix:/run/palmux.sock"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Server = tt.server
+			cfg.TLS = tt.tls
+			if got := cfg.PublicURL(); got != tt.want {
+				t.Errorf("PublicURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := Default()
+	next := Default()
+	next.Server.MaxConnections = 10
+	next.Server.AllowedOrigins = []string{"*"}
+	next.Grep.Engine = "builtin"
+	next.Notifications.TTL = time.Minute
+	next.Upload.MaxSizeMB = 50
+
+	if got := RestartRequired(old, next); len(got) != 0 {
+		t.Errorf("RestartRequired() = %v, want none for reloadable settings", got)
+	}
+
+	next.Server.Port = 9999
+	next.LSP.Servers = []LSPServer{{Language: "go", Command: "gopls"}}
+	want := []string{"server.port", "lsp.servers"}
+	if got := RestartRequired(old, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("RestartRequired() = %v, want %v", got, want)
+	}
+}
+
+func TestConfig_LSPServers(t *testing.T) {
+	detected := []lsp.ServerConfig{
+		{Language: "go", Command: "gopls", Args: []string{"serve"}, Enabled: true},
+		{Language: "python", Command: "pyright-langserver", Args: []string{"--stdio"}, Enabled: true},
+		{Language: "rust", Command: "rust-analyzer", Args: []string{}, Enabled: true},
+	}
+
+	tests := []struct {
+		name       string
+		lsp        LSPConfig
+		wantLangs  []string
+		wantGoArgs []string
+	}{
+		{
+			name:       "自動検出のみ",
+			lsp:        LSPConfig{AutoDetect: true},
+			wantLangs:  []string{"go", "python", "rust"},
+			wantGoArgs: []string{"serve"},
+		},
+		{
+			name: "上書きと無効化",
+			lsp: LSPConfig{AutoDetect: true, Servers: []LSPServer{
+				{Language: "go", Command: "gopls", Args: []string{"serve", "-rpc.trace"}},
+				{Language: "python", Disabled: true},
+			}},
+			wantLangs:  []string{"rust", "go"},
+			wantGoArgs: []string{"serve", "-rpc.trace"},
+		},
+		{
+			name:      "自動検出なし",
+			lsp:       LSPConfig{AutoDetect: false, Servers: []LSPServer{{Language: "zig", Command: "zls"}}},
+			wantLangs: []string{"zig"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.LSP = tt.lsp
+			servers := cfg.LSPServers(detected)
+
+			var langs []string
+			for _, s := range servers {
+				langs = append(langs, s.Language)
+				if s.Language == "go" && !reflect.DeepEqual(s.Args, tt.wantGoArgs) {
+					t.Errorf("go args = %v, want %v", s.Args, tt.wantGoArgs)
+				}
+			}
+			if !reflect.DeepEqual(langs, tt.wantLangs) {
+				t.Errorf("languages = %v, want %v", langs, tt.wantLangs)
+			}
+		})
+	}
+}
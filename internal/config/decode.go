@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decode は parseTOML の結果を toml タグに従って構造体に格納する。
+// 未知のキーや型の合わない値はキーのパスを含むエラーにする（設定ミスを黙って無視しない）。
+// ファイルに現れないキーのフィールドは変更しない。
+func decode(table map[string]interface{}, out interface{}) error {
+	return decodeStruct(table, reflect.ValueOf(out).Elem(), "")
+}
+
+func decodeStruct(table map[string]interface{}, v reflect.Value, prefix string) error {
+	fields := make(map[string]reflect.Value)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("toml"); tag != "" {
+			fields[tag] = v.Field(i)
+		}
+	}
+
+	// エラーメッセージを安定させるためキー順に処理する
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := prefix + k
+		field, ok := fields[k]
+		if !ok {
+			return fmt.Errorf("unknown key %q", path)
+		}
+		if err := decodeValue(table[k], field, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeValue(raw interface{}, v reflect.Value, path string) error {
+	mismatch := func(want string) error {
+		return fmt.Errorf("%s: expected %s, got %s", path, want, tomlTypeName(raw))
+	}
+
+	if v.Type() == durationType {
+		s, ok := raw.(string)
+		if !ok {
+			return mismatch(`duration string (e.g. "30m")`)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return mismatch("string")
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return mismatch("boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, ok := raw.(int64)
+		if !ok {
+			return mismatch("integer")
+		}
+		if v.Kind() == reflect.Int && (n > math.MaxInt32 || n < math.MinInt32) {
+			return fmt.Errorf("%s: %d is out of range", path, n)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		switch n := raw.(type) {
+		case float64:
+			v.SetFloat(n)
+		case int64:
+			v.SetFloat(float64(n))
+		default:
+			return mismatch("number")
+		}
+	case reflect.Struct:
+		table, ok := raw.(map[string]interface{})
+		if !ok {
+			return mismatch("table")
+		}
+		return decodeStruct(table, v, path+".")
+	case reflect.Slice:
+		arr, ok := raw.([]interface{})
+		if !ok {
+			return mismatch("array")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, elem := range arr {
+			if err := decodeValue(elem, slice.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("%s: unsupported field type %s", path, v.Type())
+	}
+	return nil
+}
+
+// tomlTypeName はエラーメッセージ用に TOML の値の型名を返す。
+func tomlTypeName(raw interface{}) string {
+	switch raw.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "table"
+	}
+	return fmt.Sprintf("%T", raw)
+}
+
+// diffFields は a と b で値が異なるフィールドのうち、reload タグが付いていないものの
+// toml キーのパスを返す。構造体は再帰的に比較し、スライス等はフィールド単位で比較する。
+func diffFields(a, b reflect.Value, prefix string) []string {
+	var diffs []string
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("toml")
+		if tag == "" {
+			continue
+		}
+		path := prefix + tag
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			diffs = append(diffs, diffFields(a.Field(i), b.Field(i), path+".")...)
+			continue
+		}
+		if f.Tag.Get("reload") == "true" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			diffs = append(diffs, path)
+		}
+	}
+	return diffs
+}
+
+// joinNonEmpty は空でない要素をカンマで連結する（フラグ値の表示用）。
+func joinNonEmpty(list []string) string {
+	var out []string
+	for _, s := range list {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, ",")
+}
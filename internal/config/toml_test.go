@@ -0,0 +1,101 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	input := `
+# コメント
+title = "palmux" # 行末コメント
+literal = 'C:\path'
+escaped = "a\"b\\c\n\u00e9"
+count = 1_000
+hex = 0xff
+ratio = 0.5
+enabled = true
+disabled = false
+list = [
+  "a", # 要素のコメント
+  "b",
+]
+empty = []
+dotted.key = 1
+"quoted key" = 2
+inline = { a = 1, b = "x" }
+
+[server]
+port = 8080
+
+[server.tls]
+auto = true
+
+[[lsp.servers]]
+language = "go"
+args = ["serve"]
+
+[[lsp.servers]]
+language = "python"
+`
+	got, err := parseTOML(input)
+	if err != nil {
+		t.Fatalf("parseTOML() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"title":      "palmux",
+		"literal":    `C:\path`,
+		"escaped":    "a\"b\\c\né",
+		"count":      int64(1000),
+		"hex":        int64(255),
+		"ratio":      0.5,
+		"enabled":    true,
+		"disabled":   false,
+		"list":       []interface{}{"a", "b"},
+		"empty":      []interface{}{},
+		"dotted":     map[string]interface{}{"key": int64(1)},
+		"quoted key": int64(2),
+		"inline":     map[string]interface{}{"a": int64(1), "b": "x"},
+		"server": map[string]interface{}{
+			"port": int64(8080),
+			"tls":  map[string]interface{}{"auto": true},
+		},
+		"lsp": map[string]interface{}{
+			"servers": []interface{}{
+				map[string]interface{}{"language": "go", "args": []interface{}{"serve"}},
+				map[string]interface{}{"language": "python"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "重複キー", input: "a = 1\na = 2", wantErr: "line 2: duplicate key"},
+		{name: "= がない", input: "a 1", wantErr: "expected '='"},
+		{name: "閉じていない文字列", input: `a = "x`, wantErr: "unterminated string"},
+		{name: "閉じていない配列", input: "a = [1, 2", wantErr: "expected"},
+		{name: "値の後の余分な文字", input: "a = 1 2", wantErr: "unexpected"},
+		{name: "不正な値", input: "a = yes", wantErr: "invalid number"},
+		{name: "テーブルとして使えないキー", input: "a = 1\n[a.b]", wantErr: "not a table"},
+		{name: "閉じていないヘッダー", input: "[server", wantErr: `expected "]"`},
+		{name: "複数行文字列は未対応", input: `a = """x"""`, wantErr: "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTOML() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
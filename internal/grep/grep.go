@@ -63,6 +63,28 @@ func NewSearcher() Searcher {
 	return &BuiltinSearcher{}
 }
 
+// NewSearcherByName は名前で指定された検索エンジンを返す。
+// "auto" は NewSearcher と同じ自動検出。"ripgrep" / "grep" は外部コマンドが見つからなければエラーを返す。
+func NewSearcherByName(name string) (Searcher, error) {
+	switch name {
+	case "", "auto":
+		return NewSearcher(), nil
+	case "ripgrep":
+		if _, err := exec.LookPath("rg"); err != nil {
+			return nil, fmt.Errorf("ripgrep (rg) not found: %w", err)
+		}
+		return &RipgrepSearcher{}, nil
+	case "grep":
+		if _, err := exec.LookPath("grep"); err != nil {
+			return nil, fmt.Errorf("grep not found: %w", err)
+		}
+		return &GrepSearcher{}, nil
+	case "builtin":
+		return &BuiltinSearcher{}, nil
+	}
+	return nil, fmt.Errorf("unknown grep engine: %q", name)
+}
+
 // BuildResponse は検索結果からResponseを構築する。
 // maxResults が 0 の場合はデフォルト値（500）を使用する。
 // 結果数が maxResults を超える場合は切り詰めて Truncated=true にする。
@@ -397,7 +419,7 @@ func (s *BuiltinSearcher) Search(ctx context.Context, query string, dir string,
 	}
 
 	// マッチ関数を準備
-	matcher, err := s.buildMatcher(query, opts)
+	matcher, err := NewMatcher(query, opts)
 	if err != nil {
 		return nil, fmt.Errorf("invalid pattern: %w", err)
 	}
@@ -478,11 +500,13 @@ func (s *BuiltinSearcher) Search(ctx context.Context, query string, dir string,
 	return results, nil
 }
 
-// matchFunc は1行に対してマッチ判定を行い、(matched, matchStart, matchEnd) を返す。
-type matchFunc func(line string) (bool, int, int)
+// Matcher は1行に対してマッチ判定を行い、(matched, matchStart, matchEnd) を返す。
+// matchStart と matchEnd はバイトオフセット。
+type Matcher func(line string) (bool, int, int)
 
-// buildMatcher は検索オプションに基づいてマッチ関数を構築する。
-func (s *BuiltinSearcher) buildMatcher(query string, opts Options) (matchFunc, error) {
+// NewMatcher は検索オプション（CaseSensitive・Regex）に基づいてマッチ関数を構築する。
+// 検索エンジンを使わずにファイル以外のテキストを検索する場合も、同じ意味でオプションを解釈するために使う。
+func NewMatcher(query string, opts Options) (Matcher, error) {
 	if opts.Regex {
 		pattern := query
 		if !opts.CaseSensitive {
@@ -545,7 +569,7 @@ func (s *BuiltinSearcher) isBinary(path string) bool {
 }
 
 // searchFile は1ファイルを行ごとにスキャンしてマッチ結果を返す。
-func (s *BuiltinSearcher) searchFile(path, relPath string, matcher matchFunc, limit int) []Result {
+func (s *BuiltinSearcher) searchFile(path, relPath string, matcher Matcher, limit int) []Result {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil
@@ -388,8 +388,75 @@ func TestNewSearcher_FunctionalSearch(t *testing.T) {
 	}
 }
 
+func TestNewSearcherByName(t *testing.T) {
+	tests := []struct {
+		name     string
+		engine   string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "builtin を指定", engine: "builtin", wantName: "builtin"},
+		{name: "auto は自動検出", engine: "auto", wantName: NewSearcher().Name()},
+		{name: "空は auto と同じ", engine: "", wantName: NewSearcher().Name()},
+		{name: "未知のエンジン", engine: "ag", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSearcherByName(tt.engine)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewSearcherByName(%q) error = nil, want error", tt.engine)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSearcherByName(%q) error = %v", tt.engine, err)
+			}
+			if s.Name() != tt.wantName {
+				t.Errorf("Name() = %q, want %q", s.Name(), tt.wantName)
+			}
+		})
+	}
+}
+
 // --- BuildResponse テスト ---
 
+func TestNewMatcher(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		opts      Options
+		line      string
+		wantMatch bool
+		wantStart int
+		wantEnd   int
+		wantErr   bool
+	}{
+		{name: "固定文字列: 大文字小文字を区別しない", query: "panic", line: "PANIC: boom", wantMatch: true, wantStart: 0, wantEnd: 5},
+		{name: "固定文字列: 大文字小文字を区別する", query: "panic", opts: Options{CaseSensitive: true}, line: "PANIC: boom"},
+		{name: "固定文字列: 正規表現の記号はそのまま", query: "a.b", line: "axb a.b", wantMatch: true, wantStart: 4, wantEnd: 7},
+		{name: "正規表現", query: `err(or)?:\s`, opts: Options{Regex: true}, line: "x ERROR: y", wantMatch: true, wantStart: 2, wantEnd: 9},
+		{name: "正規表現: 大文字小文字を区別する", query: "^Panic", opts: Options{Regex: true, CaseSensitive: true}, line: "panic"},
+		{name: "正規表現: 不正なパターン", query: "(", opts: Options{Regex: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.query, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			matched, start, end := m(tt.line)
+			if matched != tt.wantMatch || start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("match = (%v, %d, %d), want (%v, %d, %d)", matched, start, end, tt.wantMatch, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
 func TestBuildResponse(t *testing.T) {
 	tests := []struct {
 		name          string
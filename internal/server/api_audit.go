@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleQueryAudit は GET /api/audit のハンドラ。
+// クエリパラメータ since / until（RFC 3339）、session、limit で監査ログを検索し、
+// 一致したエントリを古い順に JSON 配列で返す。監査ログが無効な場合は空配列を返す。
+func (s *Server) handleQueryAudit() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+
+		var q AuditQuery
+		query := r.URL.Query()
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{
+			{"since", &q.Since},
+			{"until", &q.Until},
+		} {
+			if v := query.Get(p.name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, p.name+" must be an RFC 3339 timestamp")
+					return
+				}
+				*p.dst = t
+			}
+		}
+		q.Session = query.Get("session")
+		if v := query.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				writeError(w, http.StatusBadRequest, "limit must be a non-negative number")
+				return
+			}
+			q.Limit = limit
+		}
+
+		entries, err := s.audit.Query(q)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+	})
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// newTestServerWithAudit は監査ログ付きのテスト用 Server を作成するヘルパー。
+func newTestServerWithAudit(t *testing.T, mock TmuxManager) (*Server, *AuditLog, string) {
+	t.Helper()
+	a, err := OpenAuditLog(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	if err != nil {
+		t.Fatalf("OpenAuditLog() error = %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	const token = "test-token"
+	srv := NewServer(Options{
+		Tmux:     mock,
+		Token:    token,
+		Audit:    a,
+		BasePath: "/",
+	})
+	return srv, a, token
+}
+
+func TestAuditMiddleware_RecordsMutatingRequests(t *testing.T) {
+	mock := &configurableMock{projectDir: t.TempDir()}
+	srv, a, token := newTestServerWithAudit(t, mock)
+	handler := srv.Handler()
+
+	doRequest(t, handler, http.MethodGet, "/api/sessions", token, "")
+	doRequest(t, handler, http.MethodDelete, "/api/sessions/main", token, "")
+	doRequest(t, handler, http.MethodPut, "/api/sessions/dev/files?path=notes.txt", token, `{"content":"top secret"}`)
+	doRequest(t, handler, http.MethodPost, "/api/sessions", token, `{"name":"work"}`)
+
+	entries, err := a.Query(AuditQuery{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3 (GET must not be recorded): %+v", len(entries), entries)
+	}
+
+	del := entries[0]
+	if del.Actor != "master" || del.Method != http.MethodDelete || del.Endpoint != "/api/sessions/main" ||
+		del.Session != "main" || del.Status != http.StatusNoContent || del.Result != "ok" || del.RemoteIP == "" {
+		t.Errorf("unexpected delete entry: %+v", del)
+	}
+
+	put := entries[1]
+	if put.Session != "dev" || put.Params["path"] != "notes.txt" {
+		t.Errorf("unexpected put entry: %+v", put)
+	}
+	if put.Params["content"] != "[redacted]" {
+		t.Errorf("file content should be redacted, got %v", put.Params["content"])
+	}
+
+	if entries[2].Session != "work" {
+		t.Errorf("create session entry session = %q, want %q", entries[2].Session, "work")
+	}
+}
+
+func TestAuditMiddleware_RecordsFailures(t *testing.T) {
+	srv, a, token := newTestServerWithAudit(t, &configurableMock{})
+	doRequest(t, srv.Handler(), http.MethodDelete, "/api/ghq/repos", token, "")
+
+	entries, _ := a.Query(AuditQuery{})
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if entries[0].Status != http.StatusBadRequest || entries[0].Result == "ok" {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+}
+
+func TestHandleQueryAudit(t *testing.T) {
+	srv, _, token := newTestServerWithAudit(t, &configurableMock{})
+	handler := srv.Handler()
+
+	doRequest(t, handler, http.MethodDelete, "/api/sessions/main", token, "")
+	doRequest(t, handler, http.MethodDelete, "/api/sessions/dev", token, "")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantCount  int
+	}{
+		{name: "全件", path: "/api/audit", wantStatus: http.StatusOK, wantCount: 2},
+		{name: "セッションで絞り込み", path: "/api/audit?session=dev", wantStatus: http.StatusOK, wantCount: 1},
+		{name: "未来の since", path: "/api/audit?since=2999-01-01T00:00:00Z", wantStatus: http.StatusOK, wantCount: 0},
+		{name: "不正な since: 400", path: "/api/audit?since=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "不正な limit: 400", path: "/api/audit?limit=-1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, handler, http.MethodGet, tt.path, token, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var entries []AuditEntry
+			if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(entries) != tt.wantCount {
+				t.Errorf("got %d entries, want %d", len(entries), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestHandleQueryAudit_RequiresAdmin(t *testing.T) {
+	srv, _, _ := newTestServerWithAudit(t, &configurableMock{})
+	if _, err := srv.users.Put(User{Name: "op", Role: RoleOperator}, "pw"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	cookie := loginAsUser(t, srv.Handler(), "op", "pw")
+
+	rec := doCookieRequest(srv.Handler(), http.MethodGet, "/api/audit", cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandleAttach_RecordsAttachAndDetach(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, a, token := newTestServerWithAudit(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, _, cancel := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	// pty を閉じると detach される
+	pts.Close()
+	conn.Close(websocket.StatusNormalClosure, "")
+
+	var entries []AuditEntry
+	for i := 0; i < 50; i++ {
+		entries, _ = a.Query(AuditQuery{Session: "main"})
+		if len(entries) >= 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].Event != AuditEventAttach || entries[0].Actor != "master" || entries[0].Result != "ok" {
+		t.Errorf("unexpected attach entry: %+v", entries[0])
+	}
+	if entries[1].Event != AuditEventDetach {
+		t.Errorf("unexpected detach entry: %+v", entries[1])
+	}
+	if _, ok := entries[1].Params["duration_sec"]; !ok {
+		t.Error("detach entry should record duration_sec")
+	}
+}
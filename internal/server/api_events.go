@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// eventsLSPInterval はイベントストリームで言語サーバーの状態を確認する間隔。テスト時に上書き可能。
+var eventsLSPInterval = 5 * time.Second
+
+// wsSubscribeMessage はクライアントが購読条件を変更するメッセージ。
+type wsSubscribeMessage struct {
+	Type     string   `json:"type"` // "subscribe"
+	Types    []string `json:"types"`
+	Sessions []string `json:"sessions"`
+}
+
+// wsSubscribedMessage は有効な購読条件を知らせるメッセージ。接続直後と購読条件の変更時に送る。
+type wsSubscribedMessage struct {
+	Type string `json:"type"` // "subscribed"
+	*eventFilter
+}
+
+// wsEventsErrorMessage は不正な購読条件等のエラーを知らせるメッセージ。購読条件は変更しない。
+type wsEventsErrorMessage struct {
+	Type  string `json:"type"` // "error"
+	Error string `json:"error"`
+}
+
+// splitQueryList はカンマ区切りのクエリパラメータを分割する。空の場合は nil を返す。
+func splitQueryList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// handleEvents は GET /api/events のハンドラ。
+// WebSocket でサーバー全体のイベント（セッション・ウィンドウの作成・終了・リネーム、通知の設定・解除、
+// 接続の開始・終了、ghq リポジトリのクローンの進捗、言語サーバーの状態の変化）を ServerEvent の JSON で配信する。
+// クエリパラメータ types（種類または "session" のような分類。カンマ区切り）と sessions（セッション名。カンマ区切り）で
+// 購読条件を指定でき、接続後も subscribe メッセージで変更できる。不正な types の場合は 400 Bad Request を返す。
+// アクセスできないセッションのイベントは配信しない。
+// Origin ヘッダーが許可されていない場合（--allowed-origins）は 403 Forbidden を、シャットダウン中は 503 を返す。
+func (s *Server) handleEvents() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// クロスサイト WebSocket ハイジャック対策（アップグレードの前に検査する）
+		if !s.origins.allowed(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		query := r.URL.Query()
+		initial, err := newEventFilter(splitQueryList(query.Get("types")), splitQueryList(query.Get("sessions")))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if !s.beginAttach() {
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer s.attachWG.Done()
+
+		// Origin は s.origins で検査済みのため、websocket パッケージの同一オリジン検査は行わない
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+		if err != nil {
+			log.Printf("websocket accept error: %v", err)
+			return
+		}
+		defer conn.Close(websocket.StatusInternalError, "internal error")
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		var wsMu sync.Mutex
+		writeWS := func(ctx context.Context, data []byte) error {
+			wsMu.Lock()
+			defer wsMu.Unlock()
+			return conn.Write(ctx, websocket.MessageText, data)
+		}
+		writeMsg := func(v any) error {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			return writeWS(ctx, data)
+		}
+
+		p, _ := PrincipalFromContext(r.Context())
+		var filter atomic.Pointer[eventFilter]
+		filter.Store(initial)
+
+		// send は購読条件とアクセス範囲に合うイベントを送信する。書き込みに失敗した場合は接続を終了する
+		send := func(ev ServerEvent) bool {
+			ev, ok := visibleEvent(p, filter.Load(), ev)
+			if !ok {
+				return true
+			}
+			if err := writeMsg(ev); err != nil {
+				cancel()
+				return false
+			}
+			return true
+		}
+
+		// subscribed を送る時点で購読を始めておく（それ以降のイベントを取りこぼさない）
+		busCh := s.events.Subscribe()
+		defer s.events.Unsubscribe(busCh)
+		notifyCh := s.notifications.Subscribe()
+		defer s.notifications.Unsubscribe(notifyCh)
+
+		if err := writeMsg(wsSubscribedMessage{Type: "subscribed", eventFilter: initial}); err != nil {
+			return
+		}
+
+		// 接続ごとの goroutine は接続を閉じる前に終了を待つ（閉じた接続に書き込まない）
+		var g connGoroutines
+		defer func() {
+			cancel()
+			g.wait()
+		}()
+		g.spawn(func() { s.wsPing(ctx, writeWS, cancel) })
+		g.spawn(func() { s.watchShutdown(ctx, writeWS, conn, cancel) })
+		g.spawn(func() { streamBusEvents(ctx, busCh, send) })
+		g.spawn(func() { streamNotificationEvents(ctx, notifyCh, send) })
+
+		// セッション・ウィンドウ・言語サーバーの変化は全購読者で共有する監視が eventBus に配信する
+		defer s.tmuxEvents.acquire(s.produceTmuxEvents)()
+		if s.lsp != nil {
+			defer s.lspEvents.acquire(s.produceLSPEvents)()
+		}
+
+		// クライアント → サーバー（購読条件の変更）
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			var msg wsSubscribeMessage
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "subscribe" {
+				continue
+			}
+			f, err := newEventFilter(msg.Types, msg.Sessions)
+			if err != nil {
+				err = writeMsg(wsEventsErrorMessage{Type: "error", Error: err.Error()})
+			} else {
+				filter.Store(f)
+				err = writeMsg(wsSubscribedMessage{Type: "subscribed", eventFilter: f})
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
+
+// streamBusEvents は eventBus のイベント（接続・クローン・セッション・ウィンドウ・言語サーバー）を配信する。
+func streamBusEvents(ctx context.Context, ch chan ServerEvent, send func(ServerEvent) bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ch:
+			if !ok || !send(ev) {
+				return
+			}
+		}
+	}
+}
+
+// streamNotificationEvents は NotificationStore の変更を notification.set・notification.clear として配信する。
+func streamNotificationEvents(ctx context.Context, ch chan NotificationEvent, send func(ServerEvent) bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			typ := EventNotificationSet
+			if event.Action == "clear" {
+				typ = EventNotificationClear
+			}
+			if !send(ServerEvent{Type: typ, Time: time.Now(), Session: event.Session, Notifications: event.Notifications}) {
+				return
+			}
+		}
+	}
+}
+
+// sharedProducer は購読者がいる間だけ動かす共有のイベント生成処理。
+// 最初の acquire で開始し、全ての acquire が解放されたら停止する。
+type sharedProducer struct {
+	mu     sync.Mutex
+	refs   int
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// acquire は必要なら run を開始し、解放する関数を返す。
+// 停止中の前回の run がある場合は、その終了を待ってから次の run を開始する（イベントを重複させない）。
+func (sp *sharedProducer) acquire(run func(ctx context.Context)) func() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.refs++
+	if sp.refs == 1 {
+		ctx, cancel := context.WithCancel(context.Background())
+		prev, done := sp.done, make(chan struct{})
+		sp.cancel, sp.done = cancel, done
+		go func() {
+			defer close(done)
+			if prev != nil {
+				<-prev
+			}
+			run(ctx)
+		}()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sp.mu.Lock()
+			defer sp.mu.Unlock()
+			sp.refs--
+			if sp.refs == 0 {
+				sp.cancel()
+			}
+		})
+	}
+}
+
+// produceTmuxEvents はセッション・ウィンドウの一覧の変化を session.*・window.* として eventBus に配信する。
+// コントロールモードが使える場合は一覧を変える tmux の通知のたびに、使えない場合はポーリングで一覧を取り直して比較する。
+// 一覧の取得と比較は購読者の数によらず 1 回だけ行い、アクセス範囲と購読条件は各購読者が visibleEvent で絞り込む。
+func (s *Server) produceTmuxEvents(ctx context.Context) {
+	w := s.newTmuxWatch(tmuxChangedEvents...)
+	defer w.stop()
+
+	snap, err := s.snapshotTmux()
+	if err != nil {
+		snap = tmuxSnapshot{}
+	}
+	for w.wait(ctx) {
+		if !w.polling() {
+			// 続けて届く通知をまとめる
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wsTmuxChangedDelay):
+			}
+			for len(w.events) > 0 {
+				<-w.events
+			}
+		}
+
+		cur, err := s.snapshotTmux()
+		if err != nil {
+			continue
+		}
+		for _, ev := range diffTmuxSnapshot(snap, cur) {
+			s.events.Publish(ev)
+		}
+		snap = cur
+	}
+}
+
+// produceLSPEvents は eventsLSPInterval ごとに言語サーバーの状態を確認し、変化を lsp.status として eventBus に配信する。
+func (s *Server) produceLSPEvents(ctx context.Context) {
+	ticker := time.NewTicker(eventsLSPInterval)
+	defer ticker.Stop()
+
+	prev := s.lsp.Status()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cur := s.lsp.Status()
+			for _, ev := range diffLSPStatus(prev, cur) {
+				// 購読者ごとのアクセス制御に使うプロジェクトは共有の監視で 1 回だけ求める
+				// （求められない場合は空のままにし、プロジェクトを制限されたユーザーには配信しない）
+				ev.project, _ = s.ghqProjectName(ev.LSP.RootDir)
+				s.events.Publish(ev)
+			}
+			prev = cur
+		}
+	}
+}
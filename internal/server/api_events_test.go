@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/tmux"
+	"nhooyr.io/websocket"
+)
+
+// dialEvents はイベントストリームに接続し、最初の subscribed メッセージを返すヘルパー。
+func dialEvents(t *testing.T, tsURL, query, token string) (*websocket.Conn, context.Context, context.CancelFunc, map[string]any) {
+	t.Helper()
+
+	wsURL := "ws" + strings.TrimPrefix(tsURL, "http") + "/api/events" + query
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{"Bearer " + token},
+		},
+	})
+	if err != nil {
+		cancel()
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	return conn, ctx, cancel, readEvent(t, ctx, conn)
+}
+
+// readEvent は ping 以外の次のメッセージを読む。
+func readEvent(t *testing.T, ctx context.Context, conn *websocket.Conn) map[string]any {
+	t.Helper()
+
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid message %s: %v", data, err)
+		}
+		if msg["type"] != "ping" {
+			return msg
+		}
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	mock := &configurableMock{
+		cloneGhqRepo: &tmux.GhqRepo{Name: "utils", Path: "github.com/alice/utils", FullPath: "/ghq/github.com/alice/utils"},
+	}
+	srv, token := newTestServer(mock)
+	handler := srv.Handler()
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	conn, ctx, cancel, subscribed := dialEvents(t, ts.URL, "?types=notification,connection", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	if subscribed["type"] != "subscribed" || len(subscribed["types"].([]any)) != 2 {
+		t.Fatalf("first message = %v, want subscribed with 2 types", subscribed)
+	}
+
+	// 通知の設定
+	rr := doRequest(t, handler, http.MethodPost, "/api/notifications", token, `{"session":"main","window_index":1,"type":"bell"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("post notification status = %d", rr.Code)
+	}
+	msg := readEvent(t, ctx, conn)
+	if msg["type"] != EventNotificationSet {
+		t.Fatalf("event = %v, want %s", msg, EventNotificationSet)
+	}
+	if n := msg["notifications"].([]any); len(n) != 1 || n[0].(map[string]any)["session"] != "main" {
+		t.Errorf("notifications = %v", msg["notifications"])
+	}
+
+	// 接続の開始・終了
+	id, err := srv.connTracker.add("main", "192.0.2.1:1234", "master")
+	if err != nil {
+		t.Fatalf("add connection: %v", err)
+	}
+	msg = readEvent(t, ctx, conn)
+	if msg["type"] != EventConnectionOpen || msg["session"] != "main" || msg["connection"].(map[string]any)["remote_ip"] != "192.0.2.1:1234" {
+		t.Errorf("event = %v, want %s", msg, EventConnectionOpen)
+	}
+	srv.connTracker.remove(id)
+	if msg = readEvent(t, ctx, conn); msg["type"] != EventConnectionClose {
+		t.Errorf("event = %v, want %s", msg, EventConnectionClose)
+	}
+
+	// 購読条件の変更（クローンのみ）
+	if err := conn.Write(ctx, websocket.MessageText, []byte(`{"type":"subscribe","types":["clone"]}`)); err != nil {
+		t.Fatalf("write subscribe: %v", err)
+	}
+	if msg = readEvent(t, ctx, conn); msg["type"] != "subscribed" {
+		t.Fatalf("event = %v, want subscribed", msg)
+	}
+
+	// 購読していない種類は配信しない
+	doRequest(t, handler, http.MethodDelete, "/api/notifications?session=main&window=1", token, "")
+
+	rr = doRequest(t, handler, http.MethodPost, "/api/ghq/repos", token, `{"url":"https://github.com/alice/utils"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("clone status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	for _, want := range []string{CloneStarted, CloneDone} {
+		msg = readEvent(t, ctx, conn)
+		if msg["type"] != EventCloneProgress {
+			t.Fatalf("event = %v, want %s", msg, EventCloneProgress)
+		}
+		if clone := msg["clone"].(map[string]any); clone["status"] != want || clone["url"] != "https://github.com/alice/utils" {
+			t.Errorf("clone = %v, want status %s", clone, want)
+		}
+	}
+
+	// 不正な購読条件はエラーを返し、条件を変えない
+	if err := conn.Write(ctx, websocket.MessageText, []byte(`{"type":"subscribe","types":["bogus"]}`)); err != nil {
+		t.Fatalf("write subscribe: %v", err)
+	}
+	if msg = readEvent(t, ctx, conn); msg["type"] != "error" {
+		t.Errorf("event = %v, want error", msg)
+	}
+}
+
+func TestHandleEvents_InvalidTypes(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+
+	rr := doRequest(t, srv.Handler(), http.MethodGet, "/api/events?types=session,bogus", token, "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// eventsTmuxMock はセッション一覧をテストから安全に差し替えられる wsMock。
+type eventsTmuxMock struct {
+	*wsMock
+	listMu       sync.Mutex
+	sessionList  []tmux.Session
+	listSessions int // ListSessions の呼び出し回数
+}
+
+func (m *eventsTmuxMock) setSessions(sessions ...tmux.Session) {
+	m.listMu.Lock()
+	defer m.listMu.Unlock()
+	m.sessionList = sessions
+}
+
+func (m *eventsTmuxMock) ListSessions() ([]tmux.Session, error) {
+	m.listMu.Lock()
+	defer m.listMu.Unlock()
+	m.listSessions++
+	return m.sessionList, nil
+}
+
+func (m *eventsTmuxMock) ListWindows(session string) ([]tmux.Window, error) {
+	return []tmux.Window{{Index: 0, Name: "bash"}}, nil
+}
+
+func TestHandleEvents_SharedTmuxProducer(t *testing.T) {
+	origDelay := wsTmuxChangedDelay
+	wsTmuxChangedDelay = 10 * time.Millisecond
+	defer func() { wsTmuxChangedDelay = origDelay }()
+
+	mock := &eventsTmuxMock{wsMock: &wsMock{eventsEnabled: true}}
+	mock.setSessions(tmux.Session{Name: "main", Created: time.Unix(1700000000, 0)})
+	const token = "test-token"
+	srv := NewServer(Options{Tmux: mock, Token: token, BasePath: "/"})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn1, ctx1, cancel1, _ := dialEvents(t, ts.URL, "?types=session", token)
+	defer cancel1()
+	conn2, ctx2, cancel2, _ := dialEvents(t, ts.URL, "?types=session", token)
+	defer cancel2()
+
+	// 購読者が複数でも tmux の監視は 1 つ（最初の一覧の取得まで待つ）
+	listed := func() int {
+		mock.listMu.Lock()
+		defer mock.listMu.Unlock()
+		return mock.listSessions
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for mock.subscriberCount() != 1 || listed() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("tmux subscribers = %d, want 1", mock.subscriberCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	before := listed()
+
+	mock.setSessions(
+		tmux.Session{Name: "main", Created: time.Unix(1700000000, 0)},
+		tmux.Session{Name: "dev", Created: time.Unix(1700000100, 0)},
+	)
+	mock.publishEvent(tmux.Event{Type: "sessions-changed"})
+
+	for _, c := range []struct {
+		ctx  context.Context
+		conn *websocket.Conn
+	}{{ctx1, conn1}, {ctx2, conn2}} {
+		if msg := readEvent(t, c.ctx, c.conn); msg["type"] != EventSessionCreated || msg["session"] != "dev" {
+			t.Errorf("event = %v, want %s dev", msg, EventSessionCreated)
+		}
+	}
+
+	// 一覧の取得は購読者の数によらず 1 回
+	if calls := listed() - before; calls != 1 {
+		t.Errorf("ListSessions calls = %d, want 1", calls)
+	}
+
+	// 全ての購読者が切断すると監視を止める
+	conn1.Close(websocket.StatusNormalClosure, "")
+	conn2.Close(websocket.StatusNormalClosure, "")
+	for mock.subscriberCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("tmux subscribers = %d, want 0", mock.subscriberCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -231,9 +231,10 @@ func (s *Server) handleGrepSearch() http.Handler {
 		regex := r.URL.Query().Get("regex") == "true"
 		glob := r.URL.Query().Get("glob")
 
-		limit := 500
+		// limit の指定は設定の上限（grep.max_results）までに制限する
+		limit := s.grepMaxResultsLimit()
 		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-			if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 {
+			if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed < limit {
 				limit = parsed
 			}
 		}
@@ -245,13 +246,14 @@ func (s *Server) handleGrepSearch() http.Handler {
 			MaxResults:    limit,
 		}
 
-		results, err := s.searcher.Search(r.Context(), query, searchDir, opts)
+		searcher := s.currentSearcher()
+		results, err := searcher.Search(r.Context(), query, searchDir, opts)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		resp := grep.BuildResponse(query, s.searcher.Name(), results, limit)
+		resp := grep.BuildResponse(query, searcher.Name(), results, limit)
 		writeJSON(w, http.StatusOK, resp)
 	})
 }
@@ -3,21 +3,28 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"path"
+	"path/filepath"
 
 	"github.com/tjst-t/palmux/internal/tmux"
 )
 
 // handleListGhqRepos は GET /api/ghq/repos のハンドラ。
 // ghq リポジトリ一覧を JSON 配列で返す。
+// ユーザーアカウントの場合はアクセスできるプロジェクトのみを返す。
 func (s *Server) handleListGhqRepos() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		repos, err := s.tmux.ListGhqRepos()
+		all, err := s.tmux.ListGhqRepos()
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		if repos == nil {
-			repos = []tmux.GhqRepo{}
+		p, _ := PrincipalFromContext(r.Context())
+		repos := []tmux.GhqRepo{}
+		for _, repo := range all {
+			if p.CanAccessProject(repo.Name) {
+				repos = append(repos, repo)
+			}
 		}
 		writeJSON(w, http.StatusOK, repos)
 	})
@@ -25,6 +32,8 @@ func (s *Server) handleListGhqRepos() http.Handler {
 
 // handleCloneGhqRepo は POST /api/ghq/repos のハンドラ。
 // ghq get でリポジトリをクローンし、クローンされたリポジトリ情報を返す。
+// クローンの開始と完了（失敗）は clone.progress イベントとして配信する。
+// URL から推定したプロジェクト名にアクセスできない場合は 404 Not Found を返す（一覧と同様に存在を明かさない）。
 func (s *Server) handleCloneGhqRepo() http.Handler {
 	type request struct {
 		URL string `json:"url"`
@@ -42,27 +51,63 @@ func (s *Server) handleCloneGhqRepo() http.Handler {
 			return
 		}
 
+		p, _ := PrincipalFromContext(r.Context())
+		if !p.CanAccessProject(path.Base(tmux.GhqRepoPath(req.URL))) {
+			writeError(w, http.StatusNotFound, "project not found")
+			return
+		}
+
+		s.events.Publish(ServerEvent{
+			Type:  EventCloneProgress,
+			Clone: &cloneProgress{URL: req.URL, Status: CloneStarted},
+			actor: p.Name,
+		})
+
 		repo, err := s.tmux.CloneGhqRepo(req.URL)
 		if err != nil {
+			s.events.Publish(ServerEvent{
+				Type:  EventCloneProgress,
+				Clone: &cloneProgress{URL: req.URL, Status: CloneFailed, Error: err.Error()},
+				actor: p.Name,
+			})
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
+		s.events.Publish(ServerEvent{
+			Type:    EventCloneProgress,
+			Clone:   &cloneProgress{URL: req.URL, Status: CloneDone, Repo: repo},
+			project: repo.Name,
+			actor:   p.Name,
+		})
+
 		writeJSON(w, http.StatusCreated, repo)
 	})
 }
 
 // handleDeleteGhqRepo は DELETE /api/ghq/repos のハンドラ。
 // クエリパラメータ path で指定されたリポジトリを削除する。
+// リポジトリのプロジェクトにアクセスできない場合は 404 Not Found を返す。
 func (s *Server) handleDeleteGhqRepo() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Query().Get("path")
-		if path == "" {
+		fullPath := r.URL.Query().Get("path")
+		if fullPath == "" {
 			writeError(w, http.StatusBadRequest, "path query parameter is required")
 			return
 		}
 
-		if err := s.tmux.DeleteGhqRepo(path); err != nil {
+		project, err := s.ghqProjectName(fullPath)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		p, _ := PrincipalFromContext(r.Context())
+		if !p.CanAccessProject(project) {
+			writeError(w, http.StatusNotFound, "project not found")
+			return
+		}
+
+		if err := s.tmux.DeleteGhqRepo(fullPath); err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -70,3 +115,19 @@ func (s *Server) handleDeleteGhqRepo() http.Handler {
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+// ghqProjectName はリポジトリのフルパスに対応するプロジェクト名（一覧の Name）を返す。
+// 一覧にないパスの場合はパスのベースネームを返す。
+func (s *Server) ghqProjectName(fullPath string) (string, error) {
+	repos, err := s.tmux.ListGhqRepos()
+	if err != nil {
+		return "", err
+	}
+	cleaned := filepath.Clean(fullPath)
+	for _, repo := range repos {
+		if filepath.Clean(repo.FullPath) == cleaned {
+			return repo.Name, nil
+		}
+	}
+	return filepath.Base(cleaned), nil
+}
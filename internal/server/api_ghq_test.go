@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -302,3 +303,48 @@ func TestHandleListGhqRepos_WithBasePath(t *testing.T) {
 		t.Error("ListGhqRepos was not called")
 	}
 }
+
+func TestGhqRepos_ProjectAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "許可プロジェクトのクローン", method: http.MethodPost, path: "/api/ghq/repos", body: `{"url":"https://github.com/alice/palmux"}`, wantStatus: http.StatusCreated},
+		{name: "非許可プロジェクトのクローンは404", method: http.MethodPost, path: "/api/ghq/repos", body: `{"url":"git@github.com:alice/utils.git"}`, wantStatus: http.StatusNotFound},
+		{name: "許可プロジェクトの削除", method: http.MethodDelete, path: "/api/ghq/repos?path=/ghq/github.com/alice/palmux", wantStatus: http.StatusNoContent},
+		{name: "非許可プロジェクトの削除は404", method: http.MethodDelete, path: "/api/ghq/repos?path=/ghq/github.com/alice/utils", wantStatus: http.StatusNotFound},
+		{name: "一覧にないパスはベースネームで判定", method: http.MethodDelete, path: "/api/ghq/repos?path=/ghq/github.com/bob/secret", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &configurableMock{
+				ghqRepos: []tmux.GhqRepo{
+					{Name: "palmux", Path: "github.com/alice/palmux", FullPath: "/ghq/github.com/alice/palmux"},
+					{Name: "utils", Path: "github.com/alice/utils", FullPath: "/ghq/github.com/alice/utils"},
+				},
+				cloneGhqRepo: &tmux.GhqRepo{Name: "palmux", Path: "github.com/alice/palmux", FullPath: "/ghq/github.com/alice/palmux"},
+			}
+			srv, us := newTestServerWithUsers(t, mock)
+			handler := srv.Handler()
+			if _, err := us.Put(User{Name: "bob", Role: RoleOperator, Projects: []string{"palmux"}}, "pw"); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			cookie := loginAsUser(t, handler, "bob", "pw")
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.AddCookie(cookie)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusNotFound && (mock.calledCloneGhqRepo != "" || mock.calledDeleteGhqRepo != "") {
+				t.Errorf("clone/delete should not be called, got clone %q, delete %q", mock.calledCloneGhqRepo, mock.calledDeleteGhqRepo)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 )
 
 // handlePostNotification は POST /api/notifications のハンドラ。
+// アクセスできないセッションへの通知は 403 Forbidden を返す。
 func (s *Server) handlePostNotification() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
@@ -26,12 +27,17 @@ func (s *Server) handlePostNotification() http.Handler {
 			writeError(w, http.StatusBadRequest, "type is required")
 			return
 		}
+		if p, _ := PrincipalFromContext(r.Context()); !p.CanAccessSession(req.Session) {
+			writeError(w, http.StatusForbidden, "session not accessible")
+			return
+		}
 		s.notifications.Set(req.Session, req.WindowIndex, req.Type)
 		w.WriteHeader(http.StatusCreated)
 	})
 }
 
 // handleDeleteNotification は DELETE /api/notifications のハンドラ。
+// アクセスできないセッションの通知の解除は 403 Forbidden を返す。
 func (s *Server) handleDeleteNotification() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		session := r.URL.Query().Get("session")
@@ -49,18 +55,31 @@ func (s *Server) handleDeleteNotification() http.Handler {
 			writeError(w, http.StatusBadRequest, "window must be a number")
 			return
 		}
+		if p, _ := PrincipalFromContext(r.Context()); !p.CanAccessSession(session) {
+			writeError(w, http.StatusForbidden, "session not accessible")
+			return
+		}
 		s.notifications.Clear(session, windowIndex)
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
 
 // handleGetNotifications は GET /api/notifications のハンドラ。
+// アクセスできるセッションの通知のみを返す。
 func (s *Server) handleGetNotifications() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		notifications := s.notifications.List()
-		if notifications == nil {
-			notifications = []Notification{}
-		}
-		writeJSON(w, http.StatusOK, notifications)
+		p, _ := PrincipalFromContext(r.Context())
+		writeJSON(w, http.StatusOK, visibleNotifications(p, s.notifications.List()))
 	})
 }
+
+// visibleNotifications は notifications のうち p がアクセスできるセッションの通知を返す（nil は返さない）。
+func visibleNotifications(p Principal, notifications []Notification) []Notification {
+	visible := []Notification{}
+	for _, n := range notifications {
+		if p.CanAccessSession(n.Session) {
+			visible = append(visible, n)
+		}
+	}
+	return visible
+}
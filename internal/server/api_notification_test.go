@@ -237,3 +237,67 @@ func TestHandleNotification_AuthRequired(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleGetNotifications_RestrictedUser(t *testing.T) {
+	srv, us := newTestServerWithUsers(t, &configurableMock{})
+	handler := srv.Handler()
+	if _, err := us.Put(User{Name: "bob", Role: RoleOperator, Sessions: []string{"dev-*"}}, "pw"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	srv.notifications.Set("dev-api", 0, "bell")
+	srv.notifications.Set("main", 1, "stop")
+
+	// アクセスできないセッションの通知は返さない
+	rec := doCookieRequest(handler, http.MethodGet, "/api/notifications", loginAsUser(t, handler, "bob", "pw"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var notifications []Notification
+	if err := json.NewDecoder(rec.Body).Decode(&notifications); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Session != "dev-api" {
+		t.Errorf("notifications = %+v, want dev-api only", notifications)
+	}
+}
+
+func TestHandleNotification_RestrictedUserWrites(t *testing.T) {
+	srv, us := newTestServerWithUsers(t, &configurableMock{})
+	handler := srv.Handler()
+	if _, err := us.Put(User{Name: "bob", Role: RoleOperator, Sessions: []string{"dev-*"}}, "pw"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	cookie := loginAsUser(t, handler, "bob", "pw")
+	srv.notifications.Set("main", 1, "stop")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "アクセスできるセッションに通知できる", method: http.MethodPost, path: "/api/notifications", body: `{"session":"dev-api","window_index":0,"type":"bell"}`, wantStatus: http.StatusCreated},
+		{name: "アクセスできないセッションには通知できない", method: http.MethodPost, path: "/api/notifications", body: `{"session":"main","window_index":0,"type":"bell"}`, wantStatus: http.StatusForbidden},
+		{name: "アクセスできるセッションの通知を解除できる", method: http.MethodDelete, path: "/api/notifications?session=dev-api&window=0", wantStatus: http.StatusNoContent},
+		{name: "アクセスできないセッションの通知は解除できない", method: http.MethodDelete, path: "/api/notifications?session=main&window=1", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.AddCookie(cookie)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	// 拒否された操作は通知ストアを変更しない
+	list := srv.notifications.List()
+	if len(list) != 1 || list[0].Session != "main" || list[0].WindowIndex != 1 || list[0].Type != "stop" {
+		t.Errorf("notifications = %+v, want only main:1 stop", list)
+	}
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/tjst-t/palmux/internal/tmux"
+)
+
+// parsePaneTarget はパスパラメータの session・index・pane（ルートに {pane} がある場合のみ）を取り出す。
+// pane は先頭の % を省略した形式（"12"）も受け付け、"%12" に正規化する。
+// 不正な値の場合は 400 を書き込んで false を返す。
+func parsePaneTarget(w http.ResponseWriter, r *http.Request) (session string, index int, pane string, ok bool) {
+	session = r.PathValue("session")
+	indexStr := r.PathValue("index")
+
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 {
+		writeError(w, http.StatusBadRequest, "invalid window index: "+indexStr)
+		return "", 0, "", false
+	}
+
+	if v := r.PathValue("pane"); v != "" {
+		pane, err = tmux.ParsePaneID(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return "", 0, "", false
+		}
+	}
+
+	return session, index, pane, true
+}
+
+// handleListPanes は GET /api/sessions/{session}/windows/{index}/panes のハンドラ。
+// ウィンドウの pane 一覧（位置・大きさ・実行中のコマンド・カレントディレクトリ・PID）を返す。
+func (s *Server) handleListPanes() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, _, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		panes, err := s.tmux.ListPanes(session, index)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, panes)
+	})
+}
+
+// handleSplitPane は POST /api/sessions/{session}/windows/{index}/panes のハンドラ。
+// リクエストボディの JSON の pane（分割元。省略時はアクティブ pane）を direction（horizontal: 左右、vertical: 上下。
+// 省略時は vertical）に分割し、command（省略時はデフォルトシェル）を実行する新しい pane を 201 Created で返す。
+func (s *Server) handleSplitPane() http.Handler {
+	type splitPaneRequest struct {
+		Pane      string `json:"pane"`
+		Direction string `json:"direction"`
+		Command   string `json:"command"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, _, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		var req splitPaneRequest
+
+		// ボディがある場合のみデコードする（全フィールド省略可）
+		if r.Body != nil && r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+				return
+			}
+		}
+
+		var pane string
+		if req.Pane != "" {
+			var err error
+			pane, err = tmux.ParsePaneID(req.Pane)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		var horizontal bool
+		switch req.Direction {
+		case "", "vertical":
+		case "horizontal":
+			horizontal = true
+		default:
+			writeError(w, http.StatusBadRequest, "direction must be horizontal or vertical")
+			return
+		}
+
+		// Claude Code モード: shell のみ許可（コマンド付き pane 不可）
+		if s.tmux.IsGhqSession(session) && req.Command != "" {
+			writeError(w, http.StatusForbidden, "only shell panes can be created in Claude Code mode")
+			return
+		}
+
+		created, err := s.tmux.SplitPane(session, index, pane, horizontal, req.Command)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, created)
+	})
+}
+
+// handleSelectPane は POST /api/sessions/{session}/windows/{index}/panes/{pane}/select のハンドラ。
+// pane をウィンドウのアクティブ pane にし、204 No Content を返す。
+func (s *Server) handleSelectPane() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, pane, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.tmux.SelectPane(session, index, pane); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleDeletePane は DELETE /api/sessions/{session}/windows/{index}/panes/{pane} のハンドラ。
+// pane を終了し、204 No Content を返す。ウィンドウの最後の pane の場合はウィンドウも閉じる。
+func (s *Server) handleDeletePane() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, pane, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.tmux.KillPane(session, index, pane); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleZoomPane は POST /api/sessions/{session}/windows/{index}/panes/{pane}/zoom のハンドラ。
+// pane のズームを切り替え（ズーム中なら解除し）、204 No Content を返す。
+func (s *Server) handleZoomPane() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, pane, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.tmux.ZoomPane(session, index, pane); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleResizePane は POST /api/sessions/{session}/windows/{index}/panes/{pane}/resize のハンドラ。
+// リクエストボディの JSON の width（列数）・height（行数）に pane の大きさを変え、204 No Content を返す。
+// 省略した（0 の）方向は変えない。
+func (s *Server) handleResizePane() http.Handler {
+	type resizePaneRequest struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, pane, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		var req resizePaneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+
+		if req.Width < 0 || req.Height < 0 || (req.Width == 0 && req.Height == 0) {
+			writeError(w, http.StatusBadRequest, "width or height must be positive")
+			return
+		}
+
+		if err := s.tmux.ResizePane(session, index, pane, req.Width, req.Height); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleSwapPane は POST /api/sessions/{session}/windows/{index}/panes/{pane}/swap のハンドラ。
+// リクエストボディの JSON の target（同じウィンドウの pane ID）と pane の位置を入れ替え、204 No Content を返す。
+func (s *Server) handleSwapPane() http.Handler {
+	type swapPaneRequest struct {
+		Target string `json:"target"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, pane, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		var req swapPaneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+
+		target, err := tmux.ParsePaneID(req.Target)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := s.tmux.SwapPane(session, index, pane, target); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleSendPaneKeys は POST /api/sessions/{session}/windows/{index}/panes/{pane}/keys のハンドラ。
+// リクエストボディの JSON の keys（tmux send-keys のキー名。例: ["ls", "Enter"]）を pane に送り、204 No Content を返す。
+func (s *Server) handleSendPaneKeys() http.Handler {
+	type sendKeysRequest struct {
+		Keys []string `json:"keys"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, index, pane, ok := parsePaneTarget(w, r)
+		if !ok {
+			return
+		}
+
+		var req sendKeysRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+
+		if len(req.Keys) == 0 {
+			writeError(w, http.StatusBadRequest, "keys must not be empty")
+			return
+		}
+
+		if err := s.tmux.SendKeys(session, index, pane, req.Keys...); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
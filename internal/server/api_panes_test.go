@@ -0,0 +1,260 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tjst-t/palmux/internal/tmux"
+)
+
+// paneMock は pane 操作の呼び出しを記録する TmuxManager モック。
+type paneMock struct {
+	configurableMock
+	panes []tmux.Pane
+	err   error
+	calls []string // 呼び出された操作と引数
+}
+
+func (m *paneMock) record(format string, args ...any) error {
+	m.calls = append(m.calls, fmt.Sprintf(format, args...))
+	return m.err
+}
+
+func (m *paneMock) ListPanes(session string, windowIndex int) ([]tmux.Pane, error) {
+	return m.panes, m.record("list %s:%d", session, windowIndex)
+}
+
+func (m *paneMock) SplitPane(session string, windowIndex int, pane string, horizontal bool, command string) (*tmux.Pane, error) {
+	if err := m.record("split %s:%d %q horizontal=%v %q", session, windowIndex, pane, horizontal, command); err != nil {
+		return nil, err
+	}
+	return &tmux.Pane{ID: "%9", Index: 1, Active: true, Width: 40, Height: 24, Command: "bash"}, nil
+}
+
+func (m *paneMock) SelectPane(session string, windowIndex int, pane string) error {
+	return m.record("select %s:%d %s", session, windowIndex, pane)
+}
+
+func (m *paneMock) KillPane(session string, windowIndex int, pane string) error {
+	return m.record("kill %s:%d %s", session, windowIndex, pane)
+}
+
+func (m *paneMock) ZoomPane(session string, windowIndex int, pane string) error {
+	return m.record("zoom %s:%d %s", session, windowIndex, pane)
+}
+
+func (m *paneMock) ResizePane(session string, windowIndex int, pane string, width, height int) error {
+	return m.record("resize %s:%d %s %dx%d", session, windowIndex, pane, width, height)
+}
+
+func (m *paneMock) SwapPane(session string, windowIndex int, src, dst string) error {
+	return m.record("swap %s:%d %s %s", session, windowIndex, src, dst)
+}
+
+func (m *paneMock) SendKeys(session string, index int, pane string, keys ...string) error {
+	return m.record("keys %s:%d %s %q", session, index, pane, keys)
+}
+
+func TestHandlePanes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		ghq        bool
+		err        error
+		wantStatus int
+		wantCall   string // 空の場合は tmux を呼ばないこと
+	}{
+		{
+			name:       "一覧",
+			method:     http.MethodGet,
+			path:       "/api/sessions/main/windows/1/panes",
+			wantStatus: http.StatusOK,
+			wantCall:   "list main:1",
+		},
+		{
+			name:       "分割: ボディ省略時はアクティブ pane を上下に分割",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes",
+			wantStatus: http.StatusCreated,
+			wantCall:   `split main:1 "" horizontal=false ""`,
+		},
+		{
+			name:       "分割: pane と方向とコマンドを指定",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes",
+			body:       `{"pane":"3","direction":"horizontal","command":"htop"}`,
+			wantStatus: http.StatusCreated,
+			wantCall:   `split main:1 "%3" horizontal=true "htop"`,
+		},
+		{
+			name:       "分割: 不正な方向",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes",
+			body:       `{"direction":"diagonal"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "分割: Claude Code モードではコマンド付きの pane は作れない",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes",
+			body:       `{"command":"htop"}`,
+			ghq:        true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "選択",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/select",
+			wantStatus: http.StatusNoContent,
+			wantCall:   "select main:1 %3",
+		},
+		{
+			name:       "選択: % をエスケープした pane ID",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/%253/select",
+			wantStatus: http.StatusNoContent,
+			wantCall:   "select main:1 %3",
+		},
+		{
+			name:       "終了",
+			method:     http.MethodDelete,
+			path:       "/api/sessions/main/windows/1/panes/3",
+			wantStatus: http.StatusNoContent,
+			wantCall:   "kill main:1 %3",
+		},
+		{
+			name:       "ズーム",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/zoom",
+			wantStatus: http.StatusNoContent,
+			wantCall:   "zoom main:1 %3",
+		},
+		{
+			name:       "リサイズ: 幅のみ",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/resize",
+			body:       `{"width":100}`,
+			wantStatus: http.StatusNoContent,
+			wantCall:   "resize main:1 %3 100x0",
+		},
+		{
+			name:       "リサイズ: 大きさの指定なし",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/resize",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "入れ替え",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/swap",
+			body:       `{"target":"%5"}`,
+			wantStatus: http.StatusNoContent,
+			wantCall:   "swap main:1 %3 %5",
+		},
+		{
+			name:       "入れ替え: 不正な target",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/swap",
+			body:       `{"target":"main:0.1"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "キー送信",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/keys",
+			body:       `{"keys":["ls","Enter"]}`,
+			wantStatus: http.StatusNoContent,
+			wantCall:   `keys main:1 %3 ["ls" "Enter"]`,
+		},
+		{
+			name:       "キー送信: キーなし",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/keys",
+			body:       `{"keys":[]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "不正な pane ID",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/main.1/select",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "不正なウィンドウ番号",
+			method:     http.MethodGet,
+			path:       "/api/sessions/main/windows/abc/panes",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "tmux のエラー",
+			method:     http.MethodPost,
+			path:       "/api/sessions/main/windows/1/panes/3/select",
+			err:        errors.New("can't find pane: %3"),
+			wantStatus: http.StatusInternalServerError,
+			wantCall:   "select main:1 %3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &paneMock{
+				configurableMock: configurableMock{isGhqSession: tt.ghq},
+				panes:            []tmux.Pane{{ID: "%3", Index: 0, Active: true, Width: 80, Height: 24, PID: 100, Command: "bash", Cwd: "/home/user"}},
+				err:              tt.err,
+			}
+			srv, token := newTestServer(mock)
+
+			rr := doRequest(t, srv.Handler(), tt.method, tt.path, token, tt.body)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			var want []string
+			if tt.wantCall != "" {
+				want = []string{tt.wantCall}
+			}
+			if strings.Join(mock.calls, "|") != strings.Join(want, "|") {
+				t.Errorf("calls = %q, want %q", mock.calls, want)
+			}
+		})
+	}
+}
+
+func TestHandlePanes_ResponseBody(t *testing.T) {
+	mock := &paneMock{
+		panes: []tmux.Pane{
+			{ID: "%3", Index: 0, Active: true, Width: 80, Height: 24, PID: 100, Command: "bash", Cwd: "/home/user"},
+			{ID: "%5", Index: 1, Left: 81, Width: 40, Height: 24, PID: 200, Command: "vim", Cwd: "/tmp"},
+		},
+	}
+	srv, token := newTestServer(mock)
+	handler := srv.Handler()
+
+	rr := doRequest(t, handler, http.MethodGet, "/api/sessions/main/windows/0/panes", token, "")
+	var panes []tmux.Pane
+	if err := json.Unmarshal(rr.Body.Bytes(), &panes); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(panes) != 2 || panes[1] != mock.panes[1] {
+		t.Errorf("panes = %+v, want %+v", panes, mock.panes)
+	}
+	if !strings.Contains(rr.Body.String(), `"cwd":"/tmp"`) || !strings.Contains(rr.Body.String(), `"pid":200`) {
+		t.Errorf("body = %s", rr.Body.String())
+	}
+
+	rr = doRequest(t, handler, http.MethodPost, "/api/sessions/main/windows/0/panes", token, `{"direction":"vertical"}`)
+	var created tmux.Pane
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.ID != "%9" || !created.Active {
+		t.Errorf("created pane = %+v", created)
+	}
+}
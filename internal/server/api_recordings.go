@@ -0,0 +1,152 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// handleListRecordings は GET /api/recordings のハンドラ。
+// 保存されている録画（録画中のものを含む）を新しい順に返す（アクセスできないセッションの録画は除外する）。
+func (s *Server) handleListRecordings() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		recs, err := s.recordings.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		visible := recs[:0]
+		for _, rec := range recs {
+			if p.CanAccessSession(rec.Session) {
+				visible = append(visible, rec)
+			}
+		}
+		writeJSON(w, http.StatusOK, visible)
+	})
+}
+
+// accessibleRecording はパスの {id} の録画を返す。
+// 存在しない、またはアクセスできないセッションの録画の場合は 404 Not Found を書き込んで false を返す。
+func (s *Server) accessibleRecording(w http.ResponseWriter, r *http.Request) (Recording, bool) {
+	rec, err := s.recordings.Get(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, errRecordingNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return Recording{}, false
+	}
+	p, _ := PrincipalFromContext(r.Context())
+	if !p.CanAccessSession(rec.Session) {
+		writeError(w, http.StatusNotFound, errRecordingNotFound.Error())
+		return Recording{}, false
+	}
+	return rec, true
+}
+
+// handleGetRecording は GET /api/recordings/{id} のハンドラ。
+// 録画ファイル（asciicast v2）をダウンロードさせる。録画中の場合はその時点までの内容を返す。
+func (s *Server) handleGetRecording() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := s.accessibleRecording(w, r)
+		if !ok {
+			return
+		}
+		f, err := s.recordings.Open(rec.ID)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-asciicast")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+rec.ID+`.cast"`)
+		http.ServeContent(w, r, rec.ID+".cast", info.ModTime(), f)
+	})
+}
+
+// handleDeleteRecording は DELETE /api/recordings/{id} のハンドラ。
+// 録画を削除する。録画中の場合は録画を止めてから削除する。
+func (s *Server) handleDeleteRecording() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := s.accessibleRecording(w, r)
+		if !ok {
+			return
+		}
+		if err := s.recordings.Delete(rec.ID); err != nil {
+			if errors.Is(err, errRecordingNotFound) {
+				writeError(w, http.StatusNotFound, err.Error())
+			} else {
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// recordingWindowIndex はパスの {index} を読み取る。不正な場合は 400 Bad Request を書き込んで false を返す。
+func recordingWindowIndex(w http.ResponseWriter, r *http.Request) (int, bool) {
+	indexStr := r.PathValue("index")
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 {
+		writeError(w, http.StatusBadRequest, "invalid window index: "+indexStr)
+		return 0, false
+	}
+	return index, true
+}
+
+// handleStartRecording は POST /api/sessions/{session}/windows/{index}/recording のハンドラ。
+// ウィンドウ（のアクティブ pane）の録画を開始し、201 Created で録画のメタデータを返す。
+// 録画はウィンドウが終了すると自動的に終わる。すでに録画中の場合は 409 Conflict を返す。
+func (s *Server) handleStartRecording() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.PathValue("session")
+		index, ok := recordingWindowIndex(w, r)
+		if !ok {
+			return
+		}
+
+		p, _ := PrincipalFromContext(r.Context())
+		rec, err := s.startWindowRecording(session, index, p.Name)
+		if err != nil {
+			if errors.Is(err, errRecordingActive) {
+				writeError(w, http.StatusConflict, err.Error())
+			} else {
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		writeJSON(w, http.StatusCreated, rec)
+	})
+}
+
+// handleStopRecording は DELETE /api/sessions/{session}/windows/{index}/recording のハンドラ。
+// ウィンドウの録画を止め、録画のメタデータを返す。録画中でない場合は 404 Not Found を返す。
+func (s *Server) handleStopRecording() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.PathValue("session")
+		index, ok := recordingWindowIndex(w, r)
+		if !ok {
+			return
+		}
+
+		rec, err := s.stopWindowRecording(session, index)
+		if err != nil {
+			if errors.Is(err, errRecordingNotFound) {
+				writeError(w, http.StatusNotFound, "window is not being recorded")
+			} else {
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, rec)
+	})
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// pipePaneMock は pipe-pane のコマンド（cat）の代わりにテストから FIFO に書き込むための TmuxManager モック。
+type pipePaneMock struct {
+	configurableMock
+
+	mu         sync.Mutex
+	cols, rows int
+	noPipe     bool     // true の場合は FIFO を開かない（コマンドが起動しなかった状態）
+	writer     *os.File // FIFO の書き込み側
+	commands   []string // PipePane に渡されたコマンド
+}
+
+func (m *pipePaneMock) GetPaneSize(session string, windowIndex int) (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cols, m.rows, nil
+}
+
+func (m *pipePaneMock) PipePane(session string, windowIndex int, command string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, command)
+	if command == "" {
+		if m.writer != nil {
+			m.writer.Close()
+			m.writer = nil
+		}
+		return nil
+	}
+	if m.noPipe {
+		return nil
+	}
+	// "exec cat > '<fifo>'" の FIFO を書き込み用に開く
+	path := strings.Trim(strings.TrimPrefix(command, "exec cat > "), "'")
+	w, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	m.writer = w
+	return nil
+}
+
+// write は pane の出力を FIFO に書き込む。
+func (m *pipePaneMock) write(t *testing.T, s string) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.writer.Write([]byte(s)); err != nil {
+		t.Fatalf("write to fifo: %v", err)
+	}
+}
+
+// setSize は pane の大きさを変える。
+func (m *pipePaneMock) setSize(cols, rows int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cols, m.rows = cols, rows
+}
+
+// newTestServerWithRecordings は録画機能付きのテスト用 Server を作成するヘルパー。
+func newTestServerWithRecordings(t *testing.T, mock TmuxManager) (*Server, string) {
+	t.Helper()
+	st, err := OpenRecordingStore(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("OpenRecordingStore() error = %v", err)
+	}
+
+	const token = "test-token"
+	srv := NewServer(Options{
+		Tmux:       mock,
+		Token:      token,
+		Recordings: st,
+		BasePath:   "/",
+	})
+	return srv, token
+}
+
+// waitRecordingDone は録画が終わるまで待つヘルパー。
+func waitRecordingDone(t *testing.T, st *RecordingStore, id string) Recording {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		rec, err := st.Get(id)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if !rec.Active {
+			return rec
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("recording %s is still active", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitCastEvents は録画ファイルにイベントが n 個以上書き込まれるまで待ち、イベントを返すヘルパー。
+func waitCastEvents(t *testing.T, path string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		_, events := readCast(t, path)
+		if len(events) >= n || time.Now().After(deadline) {
+			return castEvents(events)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWindowRecording(t *testing.T) {
+	origInterval := recordingResizeInterval
+	recordingResizeInterval = 0
+	defer func() { recordingResizeInterval = origInterval }()
+
+	mock := &pipePaneMock{cols: 80, rows: 24}
+	srv, token := newTestServerWithRecordings(t, mock)
+	handler := srv.Handler()
+
+	rr := doRequest(t, handler, http.MethodPost, "/api/sessions/main/windows/1/recording", token, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("start status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var rec Recording
+	json.Unmarshal(rr.Body.Bytes(), &rec)
+	if rec.ID == "" || !rec.Active || rec.Source != RecordingSourceWindow || rec.Session != "main" || rec.Window != 1 || rec.Actor != "master" {
+		t.Fatalf("started recording = %+v", rec)
+	}
+
+	// 同じウィンドウは二重に録画しない
+	if rr := doRequest(t, handler, http.MethodPost, "/api/sessions/main/windows/1/recording", token, ""); rr.Code != http.StatusConflict {
+		t.Errorf("second start status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	mock.write(t, "$ make deploy\r\n")
+	path := srv.recordings.path(rec.ID)
+	waitCastEvents(t, path, 1)
+	mock.setSize(120, 40)
+	mock.write(t, "done\r\n")
+
+	// ウィンドウが終了すると（tmux がパイプを閉じると）録画も終わる
+	mock.mu.Lock()
+	mock.writer.Close()
+	mock.mu.Unlock()
+	waitRecordingDone(t, srv.recordings, rec.ID)
+
+	_, events := readCast(t, path)
+	want := []string{"o:$ make deploy\r\n", "r:120x40", "o:done\r\n"}
+	if got := castEvents(events); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if fifos, _ := filepath.Glob(filepath.Join(srv.recordings.dir, "*.fifo")); len(fifos) != 0 {
+		t.Errorf("fifo left behind: %v", fifos)
+	}
+
+	// 一覧・ダウンロード・削除
+	rr = doRequest(t, handler, http.MethodGet, "/api/recordings", token, "")
+	var recs []Recording
+	json.Unmarshal(rr.Body.Bytes(), &recs)
+	if rr.Code != http.StatusOK || len(recs) != 1 || recs[0].ID != rec.ID || recs[0].Active {
+		t.Fatalf("list status = %d, recordings = %+v", rr.Code, recs)
+	}
+
+	rr = doRequest(t, handler, http.MethodGet, "/api/recordings/"+rec.ID, token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("download status = %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-asciicast" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, rec.ID+".cast") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if !strings.Contains(rr.Body.String(), `"o", "done\r\n"`) {
+		t.Errorf("downloaded recording = %q", rr.Body.String())
+	}
+
+	if rr := doRequest(t, handler, http.MethodDelete, "/api/recordings/"+rec.ID, token, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", rr.Code)
+	}
+	if rr := doRequest(t, handler, http.MethodGet, "/api/recordings/"+rec.ID, token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("download after delete status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestWindowRecording_Stop(t *testing.T) {
+	mock := &pipePaneMock{cols: 80, rows: 24}
+	srv, token := newTestServerWithRecordings(t, mock)
+	handler := srv.Handler()
+
+	rr := doRequest(t, handler, http.MethodPost, "/api/sessions/main/windows/0/recording", token, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("start status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	mock.write(t, "hello")
+
+	rr = doRequest(t, handler, http.MethodDelete, "/api/sessions/main/windows/0/recording", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("stop status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var rec Recording
+	json.Unmarshal(rr.Body.Bytes(), &rec)
+	if rec.Active {
+		t.Errorf("stopped recording = %+v, want inactive", rec)
+	}
+	_, events := readCast(t, srv.recordings.path(rec.ID))
+	if got := castEvents(events); len(got) != 1 || got[0] != "o:hello" {
+		t.Errorf("events = %q, want [o:hello]", got)
+	}
+	mock.mu.Lock()
+	commands := append([]string(nil), mock.commands...)
+	mock.mu.Unlock()
+	if len(commands) != 2 || !strings.HasPrefix(commands[0], "exec cat > ") || commands[1] != "" {
+		t.Errorf("pipe-pane commands = %q, want start and stop", commands)
+	}
+
+	if rr := doRequest(t, handler, http.MethodDelete, "/api/sessions/main/windows/0/recording", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("second stop status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestWindowRecording_PipeNotOpened(t *testing.T) {
+	origTimeout := recordingPipeTimeout
+	recordingPipeTimeout = 50 * time.Millisecond
+	defer func() { recordingPipeTimeout = origTimeout }()
+
+	mock := &pipePaneMock{cols: 80, rows: 24, noPipe: true}
+	srv, token := newTestServerWithRecordings(t, mock)
+
+	rr := doRequest(t, srv.Handler(), http.MethodPost, "/api/sessions/main/windows/0/recording", token, "")
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("start status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if files, _ := filepath.Glob(filepath.Join(srv.recordings.dir, "*")); len(files) != 0 {
+		t.Errorf("files left behind: %v", files)
+	}
+	if srv.recordings.window("main", 0) != nil {
+		t.Error("failed recording is still registered")
+	}
+}
+
+func TestRecordings_Disabled(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+	if rr := doRequest(t, srv.Handler(), http.MethodGet, "/api/recordings", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d when recording is disabled", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleAttach_Record(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithRecordings(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWS(t, ts.URL, "/api/sessions/main/windows/2/attach?record=1", token)
+	defer cancel()
+
+	resize, _ := json.Marshal(wsInputMessage{Type: "resize", Cols: 100, Rows: 30})
+	if err := conn.Write(ctx, websocket.MessageText, resize); err != nil {
+		t.Fatalf("failed to send resize: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := pts.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+
+	recs, _ := srv.recordings.List()
+	if len(recs) != 1 || !recs[0].Active || recs[0].Source != RecordingSourceAttach || recs[0].Window != 2 {
+		t.Fatalf("recordings = %+v, want one active attach recording", recs)
+	}
+	waitCastEvents(t, srv.recordings.path(recs[0].ID), 2)
+
+	// 明示的に閉じると attach と一緒に録画も終わる
+	conn.Close(websocket.StatusNormalClosure, "")
+	waitRecordingDone(t, srv.recordings, recs[0].ID)
+
+	_, events := readCast(t, srv.recordings.path(recs[0].ID))
+	want := []string{"r:100x30", "o:hello"}
+	if got := castEvents(events); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tjst-t/palmux/internal/grep"
+)
+
+// スクロールバック検索の結果の前後に含める行数（デフォルトと上限）。
+const (
+	scrollbackDefaultContext = 2
+	scrollbackMaxContext     = 10
+)
+
+// scrollbackMatch はスクロールバック検索の結果の 1 行を表す。
+type scrollbackMatch struct {
+	Window     int      `json:"window"`
+	WindowName string   `json:"window_name"`
+	LineNumber int      `json:"line_number"` // スクロールバックの先頭からの行番号（1 始まり）
+	Offset     int      `json:"offset"`      // 画面の最下行から数えた行数（0 が最下行）
+	LineText   string   `json:"line_text"`
+	MatchStart int      `json:"match_start"` // 文字（ルーン）オフセット
+	MatchEnd   int      `json:"match_end"`
+	Before     []string `json:"before"`
+	After      []string `json:"after"`
+}
+
+// scrollbackResponse はスクロールバック検索のレスポンス全体を表す。
+type scrollbackResponse struct {
+	Query     string            `json:"query"`
+	Results   []scrollbackMatch `json:"results"`
+	Truncated bool              `json:"truncated"`
+}
+
+// searchScrollback は capture-pane の出力 text を行ごとに検索し、前後 opts.ContextLines 行を付けた結果を返す。
+// 結果が limit 件に達したら打ち切り、打ち切ったかどうかも返す。
+func searchScrollback(text string, matcher grep.Matcher, opts grep.Options, limit int) ([]scrollbackMatch, bool) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var results []scrollbackMatch
+	for i, line := range lines {
+		matched, start, end := matcher(line)
+		if !matched {
+			continue
+		}
+		if len(results) >= limit {
+			return results, true
+		}
+		results = append(results, scrollbackMatch{
+			LineNumber: i + 1,
+			Offset:     len(lines) - 1 - i,
+			LineText:   line,
+			MatchStart: utf8.RuneCountInString(line[:start]),
+			MatchEnd:   utf8.RuneCountInString(line[:end]),
+			Before:     append([]string{}, lines[max(i-opts.ContextLines, 0):i]...),
+			After:      append([]string{}, lines[i+1:min(i+1+opts.ContextLines, len(lines))]...),
+		})
+	}
+	return results, false
+}
+
+// handleSearchScrollback は GET /api/sessions/{session}/scrollback/search のハンドラ。
+// セッションの各ウィンドウのスクロールバック全体（tmux capture-pane -S -）をクエリパラメータ q で検索し、
+// マッチした行をウィンドウ・行の位置・前後の行とともに返す。
+// オプション: windows（対象のウィンドウ番号。カンマ区切り、省略時は全ウィンドウ）、case（大文字小文字区別）、
+// regex（正規表現）、context（前後に含める行数、最大 scrollbackMaxContext）、limit（最大件数）。
+// case・regex・limit はファイルの全文検索（files/grep）と同じ意味で解釈する。
+func (s *Server) handleSearchScrollback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.PathValue("session")
+		q := r.URL.Query()
+
+		query := q.Get("q")
+		if query == "" {
+			writeError(w, http.StatusBadRequest, "q parameter is required")
+			return
+		}
+
+		var selected map[int]bool
+		if v := q.Get("windows"); v != "" {
+			selected = make(map[int]bool)
+			for _, idx := range strings.Split(v, ",") {
+				index, err := strconv.Atoi(strings.TrimSpace(idx))
+				if err != nil || index < 0 {
+					writeError(w, http.StatusBadRequest, "invalid window index: "+idx)
+					return
+				}
+				selected[index] = true
+			}
+		}
+
+		contextLines := scrollbackDefaultContext
+		if v := q.Get("context"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, "invalid context: "+v)
+				return
+			}
+			contextLines = min(n, scrollbackMaxContext)
+		}
+
+		// limit の指定は設定の上限（grep.max_results）までに制限する
+		limit := s.grepMaxResultsLimit()
+		if limitStr := q.Get("limit"); limitStr != "" {
+			if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed < limit {
+				limit = parsed
+			}
+		}
+
+		opts := grep.Options{
+			CaseSensitive: q.Get("case") == "true",
+			Regex:         q.Get("regex") == "true",
+			MaxResults:    limit,
+			ContextLines:  contextLines,
+		}
+		matcher, err := grep.NewMatcher(query, opts)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid regex: "+err.Error())
+			return
+		}
+
+		windows, err := s.tmux.ListWindows(session)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		resp := scrollbackResponse{Query: query, Results: []scrollbackMatch{}}
+		for _, win := range windows {
+			if selected != nil && !selected[win.Index] {
+				continue
+			}
+			if r.Context().Err() != nil {
+				return
+			}
+			// 一覧の取得後に閉じられたウィンドウは飛ばす
+			text, err := s.tmux.CapturePane(session, win.Index, "", false, -1)
+			if err != nil {
+				continue
+			}
+			matches, truncated := searchScrollback(text, matcher, opts, limit-len(resp.Results))
+			for _, m := range matches {
+				m.Window = win.Index
+				m.WindowName = win.Name
+				resp.Results = append(resp.Results, m)
+			}
+			if truncated {
+				resp.Truncated = true
+				break
+			}
+		}
+
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tjst-t/palmux/internal/grep"
+	"github.com/tjst-t/palmux/internal/tmux"
+)
+
+// scrollbackMock はウィンドウごとに異なるスクロールバックを返す TmuxManager モック。
+type scrollbackMock struct {
+	configurableMock
+	captures map[int]string
+	captured []int // CapturePane で取得したウィンドウ
+}
+
+func (m *scrollbackMock) CapturePane(session string, windowIndex int, pane string, escapes bool, history int) (string, error) {
+	if escapes || history >= 0 {
+		return "", nil
+	}
+	m.captured = append(m.captured, windowIndex)
+	return m.captures[windowIndex], nil
+}
+
+func TestSearchScrollback(t *testing.T) {
+	text := "line1\nerror: a\nline3\nline4\nERROR: b\n\n"
+	matcher, _ := grep.NewMatcher("error", grep.Options{})
+
+	results, truncated := searchScrollback(text, matcher, grep.Options{ContextLines: 1}, 10)
+	if truncated || len(results) != 2 {
+		t.Fatalf("results = %+v, truncated = %v", results, truncated)
+	}
+	got := results[0]
+	if got.LineNumber != 2 || got.Offset != 4 || got.LineText != "error: a" || got.MatchStart != 0 || got.MatchEnd != 5 ||
+		strings.Join(got.Before, "|") != "line1" || strings.Join(got.After, "|") != "line3" {
+		t.Errorf("results[0] = %+v", got)
+	}
+	// 末尾の前後の行は範囲内で切り詰める
+	if got := results[1]; got.LineNumber != 5 || got.Offset != 1 || strings.Join(got.Before, "|") != "line4" || len(got.After) != 1 {
+		t.Errorf("results[1] = %+v", got)
+	}
+
+	if results, truncated := searchScrollback(text, matcher, grep.Options{}, 1); !truncated || len(results) != 1 || len(results[0].Before) != 0 {
+		t.Errorf("limited results = %+v, truncated = %v", results, truncated)
+	}
+}
+
+func TestHandleSearchScrollback(t *testing.T) {
+	newMock := func() *scrollbackMock {
+		return &scrollbackMock{
+			configurableMock: configurableMock{
+				windows: []tmux.Window{{Index: 0, Name: "shell"}, {Index: 1, Name: "server"}, {Index: 3, Name: "日本語"}},
+			},
+			captures: map[int]string{
+				0: "$ go test\nok\n",
+				1: "listening\npanic: runtime error\ngoroutine 1 [running]:\nmain.main()\n",
+				3: "ログ: Panic発生\n",
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		wantStatus    int
+		wantMatches   []string // "ウィンドウ:行番号"
+		wantCaptured  []int
+		wantTruncated bool
+	}{
+		{
+			name:         "正常系: 全ウィンドウから探す",
+			query:        "q=panic",
+			wantStatus:   http.StatusOK,
+			wantMatches:  []string{"1:2", "3:1"},
+			wantCaptured: []int{0, 1, 3},
+		},
+		{
+			name:         "正常系: 大文字小文字を区別する",
+			query:        "q=panic&case=true",
+			wantStatus:   http.StatusOK,
+			wantMatches:  []string{"1:2"},
+			wantCaptured: []int{0, 1, 3},
+		},
+		{
+			name:         "正常系: 正規表現とウィンドウの指定",
+			query:        "q=" + "%5E%28ok%7Cmain%29" + "&regex=true&windows=0,1",
+			wantStatus:   http.StatusOK,
+			wantMatches:  []string{"0:2", "1:4"},
+			wantCaptured: []int{0, 1},
+		},
+		{
+			name:          "正常系: limit で打ち切る",
+			query:         "q=n&limit=2",
+			wantStatus:    http.StatusOK,
+			wantMatches:   []string{"1:1", "1:2"},
+			wantCaptured:  []int{0, 1},
+			wantTruncated: true,
+		},
+		{name: "異常系: q がない", query: "", wantStatus: http.StatusBadRequest},
+		{name: "異常系: 不正な正規表現", query: "q=(&regex=true", wantStatus: http.StatusBadRequest},
+		{name: "異常系: 不正なウィンドウ番号", query: "q=a&windows=1,x", wantStatus: http.StatusBadRequest},
+		{name: "異常系: 不正な context", query: "q=a&context=-1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMock()
+			srv, token := newTestServer(mock)
+			rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/sessions/main/scrollback/search?"+tt.query, token, "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body = %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp scrollbackResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			var got []string
+			for _, m := range resp.Results {
+				got = append(got, fmt.Sprintf("%d:%d", m.Window, m.LineNumber))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantMatches, ",") {
+				t.Errorf("matches = %v, want %v", got, tt.wantMatches)
+			}
+			if resp.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", resp.Truncated, tt.wantTruncated)
+			}
+			if fmt.Sprint(mock.captured) != fmt.Sprint(tt.wantCaptured) {
+				t.Errorf("captured windows = %v, want %v", mock.captured, tt.wantCaptured)
+			}
+		})
+	}
+}
+
+func TestHandleSearchScrollback_ResultFields(t *testing.T) {
+	mock := &scrollbackMock{
+		configurableMock: configurableMock{windows: []tmux.Window{{Index: 2, Name: "logs"}}},
+		captures:         map[int]string{2: "a\nb\nログ: Panic発生\nc\n\n"},
+	}
+	srv, token := newTestServer(mock)
+	rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/sessions/main/scrollback/search?q=panic&context=1", token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp scrollbackResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Query != "panic" || len(resp.Results) != 1 {
+		t.Fatalf("response = %+v", resp)
+	}
+	got := resp.Results[0]
+	want := scrollbackMatch{
+		Window: 2, WindowName: "logs", LineNumber: 3, Offset: 2, LineText: "ログ: Panic発生",
+		MatchStart: 4, MatchEnd: 9, Before: []string{"b"}, After: []string{"c"},
+	}
+	if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", want) {
+		t.Errorf("result = %+v, want %+v", got, want)
+	}
+}
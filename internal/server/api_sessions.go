@@ -24,6 +24,7 @@ func writeError(w http.ResponseWriter, status int, message string) {
 
 // handleListSessions は GET /api/sessions のハンドラ。
 // tmux セッション一覧を JSON 配列で返す。
+// ユーザーアカウントの場合はアクセスできるセッションのみを返す。
 func (s *Server) handleListSessions() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		sessions, err := s.tmux.ListSessions()
@@ -32,10 +33,14 @@ func (s *Server) handleListSessions() http.Handler {
 			return
 		}
 
-		// nil の場合は空配列を返す
-		if sessions == nil {
-			sessions = []tmux.Session{}
+		p, _ := PrincipalFromContext(r.Context())
+		visible := []tmux.Session{}
+		for _, sess := range sessions {
+			if p.CanAccessSession(sess.Name) {
+				visible = append(visible, sess)
+			}
 		}
+		sessions = visible
 
 		writeJSON(w, http.StatusOK, sessions)
 	})
@@ -66,6 +71,11 @@ func (s *Server) handleCreateSession() http.Handler {
 			return
 		}
 
+		if p, _ := PrincipalFromContext(r.Context()); !p.CanAccessSession(req.Name) {
+			writeError(w, http.StatusForbidden, "session not allowed")
+			return
+		}
+
 		session, err := s.tmux.NewSession(req.Name)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
@@ -68,6 +68,16 @@ type configurableMock struct {
 	replaceClaudeWindow       *tmux.Window
 	replaceClaudeWindowErr    error
 	calledReplaceClaudeWindow struct{ session, name, command string }
+	capture                   string // CapturePane が escapes なしで返す内容
+	captureANSI               string // CapturePane が escapes ありで返す内容
+	captureErr                error
+	calledCapturePane         struct {
+		session string
+		index   int
+		pane    string
+		escapes bool
+		history int
+	}
 
 	// project/worktree 関連
 	projectWorktrees           []tmux.ProjectWorktree
@@ -132,7 +142,7 @@ func (m *configurableMock) KillWindow(session string, index int) error {
 	return m.killWinErr
 }
 
-func (m *configurableMock) SendKeys(session string, index int, key string) error {
+func (m *configurableMock) SendKeys(session string, index int, pane string, keys ...string) error {
 	return nil
 }
 
@@ -145,7 +155,7 @@ func (m *configurableMock) RenameWindow(session string, index int, name string)
 	return m.renameWinErr
 }
 
-func (m *configurableMock) Attach(session string, windowIndex int) (*os.File, *exec.Cmd, error) {
+func (m *configurableMock) Attach(session string, windowIndex int, readOnly bool) (*os.File, *exec.Cmd, error) {
 	return nil, nil, nil
 }
 
@@ -189,10 +199,75 @@ func (m *configurableMock) GetClientSessionWindow(tty string) (string, int, erro
 	return "", -1, fmt.Errorf("not implemented")
 }
 
+func (m *configurableMock) RefreshClient(tty string) error {
+	return nil
+}
+
 func (m *configurableMock) GetPaneCommand(session string, windowIndex int) (string, error) {
 	return "bash", nil
 }
 
+func (m *configurableMock) GetPaneSize(session string, windowIndex int) (int, int, error) {
+	return 80, 24, nil
+}
+
+func (m *configurableMock) PipePane(session string, windowIndex int, command string) error {
+	return nil
+}
+
+func (m *configurableMock) CapturePane(session string, windowIndex int, pane string, escapes bool, history int) (string, error) {
+	m.calledCapturePane.session = session
+	m.calledCapturePane.index = windowIndex
+	m.calledCapturePane.pane = pane
+	m.calledCapturePane.escapes = escapes
+	m.calledCapturePane.history = history
+	if m.captureErr != nil {
+		return "", m.captureErr
+	}
+	if escapes {
+		return m.captureANSI, nil
+	}
+	return m.capture, nil
+}
+
+func (m *configurableMock) ListPanes(session string, windowIndex int) ([]tmux.Pane, error) {
+	return nil, nil
+}
+
+func (m *configurableMock) SplitPane(session string, windowIndex int, pane string, horizontal bool, command string) (*tmux.Pane, error) {
+	return &tmux.Pane{}, nil
+}
+
+func (m *configurableMock) SelectPane(session string, windowIndex int, pane string) error {
+	return nil
+}
+
+func (m *configurableMock) KillPane(session string, windowIndex int, pane string) error {
+	return nil
+}
+
+func (m *configurableMock) ZoomPane(session string, windowIndex int, pane string) error {
+	return nil
+}
+
+func (m *configurableMock) ResizePane(session string, windowIndex int, pane string, width, height int) error {
+	return nil
+}
+
+func (m *configurableMock) SwapPane(session string, windowIndex int, src, dst string) error {
+	return nil
+}
+
+func (m *configurableMock) GetClientPane(tty string) (string, error) {
+	return "", nil
+}
+
+func (m *configurableMock) SubscribeEvents() chan tmux.Event {
+	return nil
+}
+
+func (m *configurableMock) UnsubscribeEvents(ch chan tmux.Event) {}
+
 func (m *configurableMock) IsGhqSession(session string) bool {
 	m.calledIsGhqSession = session
 	return m.isGhqSession
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleListShares は GET /api/shares のハンドラ。
+// 有効な共有リンクの一覧を返す（リンク用トークンは含まない。アクセスできないセッションのリンクは除外する）。
+func (s *Server) handleListShares() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+		p, _ := PrincipalFromContext(r.Context())
+		shares := s.shares.List()
+		visible := shares[:0]
+		for _, sh := range shares {
+			if p.CanAccessSession(sh.Session) {
+				visible = append(visible, sh)
+			}
+		}
+		writeJSON(w, http.StatusOK, visible)
+	})
+}
+
+// handleCreateShare は POST /api/shares のハンドラ。
+// リクエストボディの session / window / read_only / ttl から共有リンクを発行する。
+// window を省略するとセッション内の全ウィンドウ、ttl を省略すると 1 時間有効なリンクになる。
+// レスポンスの token と url（ブラウザで開く共有ページ）はこの時点でしか取得できない。
+func (s *Server) handleCreateShare() http.Handler {
+	type createShareRequest struct {
+		Session  string `json:"session"`
+		Window   *int   `json:"window"`
+		ReadOnly bool   `json:"read_only"`
+		TTL      string `json:"ttl"` // time.ParseDuration 形式（例: "30m", "2h"）
+	}
+	type createShareResponse struct {
+		Share
+		Token string `json:"token"`
+		URL   string `json:"url"` // ブラウザで開く共有ページの URL（読み取り専用で attach する）
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+
+		var req createShareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if req.Session == "" {
+			writeError(w, http.StatusBadRequest, "session is required")
+			return
+		}
+
+		var ttl time.Duration
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid ttl: "+req.TTL)
+				return
+			}
+			ttl = d
+		}
+
+		p, _ := PrincipalFromContext(r.Context())
+		if !p.CanAccessSession(req.Session) {
+			writeError(w, http.StatusForbidden, "session not accessible")
+			return
+		}
+
+		share, token, err := s.shares.Create(req.Session, req.Window, req.ReadOnly, ttl, p.Name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, createShareResponse{Share: share, Token: token, URL: s.shareURL(r, share, token)})
+	})
+}
+
+// handleRevokeShare は DELETE /api/shares/{id} のハンドラ。
+// 指定 ID の共有リンクを即座に無効化し、204 No Content を返す。
+// このリンクで接続中の WebSocket も shareCheckInterval 以内に切断される。
+func (s *Server) handleRevokeShare() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+
+		id := r.PathValue("id")
+		p, _ := PrincipalFromContext(r.Context())
+		if sh, ok := s.shares.Get(id); ok && !p.CanAccessSession(sh.Session) {
+			writeError(w, http.StatusNotFound, "share not found")
+			return
+		}
+		if !s.shares.Revoke(id) {
+			writeError(w, http.StatusNotFound, "share not found")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// shareURL は共有リンクをブラウザで開く URL を返す。
+// フロントエンドの共有ページ（{basePath}#share/{token}/{session}[/{window}]）が読み取り専用で attach する。
+// トークンはフラグメントに入れ、ページの取得時にはサーバーやプロキシのログに残さない。
+func (s *Server) shareURL(r *http.Request, share Share, token string) string {
+	fragment := "share/" + token + "/" + url.PathEscape(share.Session)
+	if share.Window != nil {
+		fragment += "/" + strconv.Itoa(*share.Window)
+	}
+	return s.browserURL(r) + "#" + fragment
+}
+
+// browserURL はブラウザから開く Palmux の URL（"/" で終わる）を返す。
+// 公開 URL（--public-url、または特定のホストでの待ち受けアドレス）が設定されていればそれを使う。
+// 設定されていない場合はリクエストの Host から組み立て、X-Forwarded-Proto・X-Forwarded-Host は
+// 信頼するプロキシから届いたリクエストでのみ参照する。
+func (s *Server) browserURL(r *http.Request) string {
+	if s.publicURL != "" {
+		return strings.TrimSuffix(s.publicURL, "/") + "/"
+	}
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if viaTrustedProxy(r) {
+		if r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		if fwd, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); strings.TrimSpace(fwd) != "" {
+			host = strings.TrimSpace(fwd)
+		}
+	}
+	return scheme + "://" + host + s.basePath
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// createTestShare は POST /api/shares で共有リンクを発行し、ID とトークンを返すヘルパー。
+func createTestShare(t *testing.T, handler http.Handler, token, body string) (string, string) {
+	t.Helper()
+	rec := doRequest(t, handler, http.MethodPost, "/api/shares", token, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create share status = %d, want %d, body = %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var resp struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp.ID, resp.Token
+}
+
+func TestHandleCreateShare(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantTarget string // URL のトークンに続くセッション・ウィンドウ
+	}{
+		{name: "正常系: ウィンドウ指定", body: `{"session":"main","window":1,"read_only":true,"ttl":"30m"}`, wantStatus: http.StatusCreated, wantTarget: "/main/1"},
+		{name: "正常系: セッション全体", body: `{"session":"main"}`, wantStatus: http.StatusCreated, wantTarget: "/main"},
+		{name: "正常系: セッション名のエスケープ", body: `{"session":"my app"}`, wantStatus: http.StatusCreated, wantTarget: "/my%20app"},
+		{name: "sessionなし: 400", body: `{"window":1}`, wantStatus: http.StatusBadRequest},
+		{name: "不正なttl: 400", body: `{"session":"main","ttl":"soon"}`, wantStatus: http.StatusBadRequest},
+		{name: "長すぎるttl: 400", body: `{"session":"main","ttl":"1000h"}`, wantStatus: http.StatusBadRequest},
+		{name: "不正なJSON: 400", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, token := newTestServer(&configurableMock{})
+			rec := doRequest(t, srv.Handler(), http.MethodPost, "/api/shares", token, tt.body)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp struct {
+				ID        string `json:"id"`
+				Token     string `json:"token"`
+				URL       string `json:"url"`
+				CreatedBy string `json:"created_by"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.ID == "" || resp.Token == "" || resp.CreatedBy != "master" {
+				t.Errorf("unexpected response: %+v", resp)
+			}
+			// ブラウザで開く共有ページの URL
+			if want := "http://example.com/#share/" + resp.Token + tt.wantTarget; resp.URL != want {
+				t.Errorf("url = %q, want %q", resp.URL, want)
+			}
+		})
+	}
+}
+
+func TestHandleListAndRevokeShare(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+	handler := srv.Handler()
+
+	id, _ := createTestShare(t, handler, token, `{"session":"main"}`)
+
+	rec := doRequest(t, handler, http.MethodGet, "/api/shares", token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var shares []Share
+	if err := json.NewDecoder(rec.Body).Decode(&shares); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(shares) != 1 || shares[0].ID != id {
+		t.Fatalf("shares = %+v, want [%s]", shares, id)
+	}
+	if strings.Contains(rec.Body.String(), "token") {
+		t.Error("share list must not contain link tokens")
+	}
+
+	rec = doRequest(t, handler, http.MethodDelete, "/api/shares/"+id, token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	rec = doRequest(t, handler, http.MethodDelete, "/api/shares/"+id, token, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second revoke status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestShareLink_Access(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+	handler := srv.Handler()
+
+	id, shareToken := createTestShare(t, handler, token, `{"session":"main","window":1,"read_only":true}`)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "対象セッションのウィンドウ一覧: 200", method: http.MethodGet, path: "/api/sessions/main/windows", wantStatus: http.StatusOK},
+		{name: "別セッション: 403", method: http.MethodGet, path: "/api/sessions/other/windows", wantStatus: http.StatusForbidden},
+		{name: "セッション一覧: 403", method: http.MethodGet, path: "/api/sessions", wantStatus: http.StatusForbidden},
+		{name: "ウィンドウ作成: 403", method: http.MethodPost, path: "/api/sessions/main/windows", wantStatus: http.StatusForbidden},
+		{name: "共有リンク発行: 403", method: http.MethodPost, path: "/api/shares", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path+"?share="+shareToken, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	// 失効後は 401
+	srv.shares.Revoke(id)
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions/main/windows?share="+shareToken, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status after revoke = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestShareLink_AttachReadOnlyAndRevoke(t *testing.T) {
+	orig := shareCheckInterval
+	shareCheckInterval = 50 * time.Millisecond
+	defer func() { shareCheckInterval = orig }()
+
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+	_ = pts
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	id, shareToken := createTestShare(t, srv.Handler(), token, `{"session":"main","window":0,"read_only":true}`)
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/sessions/main/windows/0/attach?share=" + shareToken
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	time.Sleep(100 * time.Millisecond)
+	mock.mu.Lock()
+	readOnly := mock.calledReadOnly
+	mock.mu.Unlock()
+	if !readOnly {
+		t.Error("read-only share should attach with readOnly = true")
+	}
+
+	// 失効させると接続が閉じられる
+	srv.shares.Revoke(id)
+	for {
+		if _, _, err := conn.Read(ctx); err != nil {
+			if websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+				t.Errorf("close status = %v, want %v", websocket.CloseStatus(err), websocket.StatusPolicyViolation)
+			}
+			break
+		}
+	}
+}
+
+func TestShareLink_AttachNotificationsFiltered(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	_, shareToken := createTestShare(t, srv.Handler(), token, `{"session":"main","read_only":true}`)
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/sessions/main/windows/0/attach?share=" + shareToken
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	time.Sleep(100 * time.Millisecond)
+	srv.notifications.Set("other", 1, "bell")
+	srv.notifications.Set("main", 0, "bell")
+
+	// 共有対象外のセッションの変更は知らせず、通知の一覧にも含めない
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		var msg wsNotificationMessage
+		if json.Unmarshal(data, &msg) != nil || msg.Type != "notification_update" {
+			continue
+		}
+		if len(msg.Notifications) != 1 || msg.Notifications[0].Session != "main" {
+			t.Errorf("update = %+v, want main only", msg.Notifications)
+		}
+		break
+	}
+}
+
+func TestShareURL(t *testing.T) {
+	window := 2
+	tests := []struct {
+		name       string
+		publicURL  string
+		proxies    []string
+		remoteAddr string
+		host       string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name: "公開 URL を優先", publicURL: "https://palmux.example.com/tools", remoteAddr: "192.0.2.1:1234", host: "evil.example.com",
+			want: "https://palmux.example.com/tools/#share/payload.sig/main/2",
+		},
+		{
+			name: "公開 URL なし: Host とベースパス", remoteAddr: "192.0.2.1:1234", host: "tablet.local:8443",
+			want: "http://tablet.local:8443/palmux/#share/payload.sig/main/2",
+		},
+		{
+			name: "信頼しない接続元の転送ヘッダーは無視", remoteAddr: "192.0.2.1:1234", host: "tablet.local:8443",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.com"},
+			want:    "http://tablet.local:8443/palmux/#share/payload.sig/main/2",
+		},
+		{
+			name: "信頼するプロキシの転送ヘッダー", proxies: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:1234", host: "127.0.0.1:8080",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "palmux.example.com, 127.0.0.1:8080"},
+			want:    "https://palmux.example.com/palmux/#share/payload.sig/main/2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(Options{Tmux: &configurableMock{}, Token: "test-token", BasePath: "/palmux/", PublicURL: tt.publicURL})
+
+			req := httptest.NewRequest(http.MethodPost, "/palmux/api/shares", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Host = tt.host
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			var got string
+			newTrustedProxies(tt.proxies).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = srv.shareURL(r, Share{Session: "main", Window: &window}, "payload.sig")
+			})).ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("shareURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
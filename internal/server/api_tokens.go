@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// requireFullScope はフルアクセス以外の Principal からのリクエストを 403 で拒否する。
+// 拒否した場合は false を返す。
+func requireFullScope(w http.ResponseWriter, r *http.Request) bool {
+	p, ok := PrincipalFromContext(r.Context())
+	if !ok || p.Scope != ScopeFull {
+		writeError(w, http.StatusForbidden, "full access token required")
+		return false
+	}
+	return true
+}
+
+// handleListTokens は GET /api/tokens のハンドラ。
+// 名前付き API トークンのメタデータ一覧を返す（トークン文字列は含まない）。
+func (s *Server) handleListTokens() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+		writeJSON(w, http.StatusOK, s.tokens.List())
+	})
+}
+
+// handleCreateToken は POST /api/tokens のハンドラ。
+// リクエストボディの name と scope から新しいトークンを発行する。
+// レスポンスの token フィールドはこの時点でしか取得できない。
+func (s *Server) handleCreateToken() http.Handler {
+	type createTokenRequest struct {
+		Name  string     `json:"name"`
+		Scope TokenScope `json:"scope"`
+	}
+	type createTokenResponse struct {
+		APIToken
+		Token string `json:"token"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+
+		var req createTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if req.Name == "" {
+			writeError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		if !req.Scope.Valid() {
+			writeError(w, http.StatusBadRequest, "scope must be one of: full, read, notify")
+			return
+		}
+
+		token, secret, err := s.tokens.Create(req.Name, req.Scope)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, createTokenResponse{APIToken: token, Token: secret})
+	})
+}
+
+// handleRevokeToken は DELETE /api/tokens/{id} のハンドラ。
+// 指定 ID のトークンを即座に無効化し、204 No Content を返す。
+func (s *Server) handleRevokeToken() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+
+		found, err := s.tokens.Revoke(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "token not found")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// newTestServerWithTokens は名前付きトークンストア付きのテスト用 Server を作成するヘルパー。
+func newTestServerWithTokens(t *testing.T) (*Server, *TokenStore, string) {
+	t.Helper()
+	const token = "test-token"
+	ts, err := NewTokenStore("")
+	if err != nil {
+		t.Fatalf("NewTokenStore() error = %v", err)
+	}
+	srv := NewServer(Options{
+		Tmux:     &configurableMock{},
+		Token:    token,
+		Tokens:   ts,
+		BasePath: "/",
+	})
+	return srv, ts, token
+}
+
+func TestHandleCreateToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "正常系: readトークンを発行",
+			body:       `{"name":"dashboard","scope":"read"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "nameなし: 400",
+			body:       `{"scope":"read"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "不正なscope: 400",
+			body:       `{"name":"x","scope":"root"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "不正なJSON: 400",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _, token := newTestServerWithTokens(t)
+			rec := doRequest(t, srv.Handler(), http.MethodPost, "/api/tokens", token, tt.body)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp struct {
+				ID    string `json:"id"`
+				Name  string `json:"name"`
+				Scope string `json:"scope"`
+				Token string `json:"token"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.ID == "" || resp.Token == "" || resp.Name != "dashboard" || resp.Scope != "read" {
+				t.Errorf("unexpected response: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestNamedToken_ScopeEnforced(t *testing.T) {
+	srv, ts, _ := newTestServerWithTokens(t)
+	handler := srv.Handler()
+
+	_, readToken, _ := ts.Create("dashboard", ScopeRead)
+	_, notifyToken, _ := ts.Create("hooks", ScopeNotify)
+	_, fullToken, _ := ts.Create("ci", ScopeFull)
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "read: セッション一覧を取得できる", token: readToken, method: http.MethodGet, path: "/api/sessions", wantStatus: http.StatusOK},
+		{name: "read: セッション削除は403", token: readToken, method: http.MethodDelete, path: "/api/sessions/main", wantStatus: http.StatusForbidden},
+		{name: "read: トークン一覧は403", token: readToken, method: http.MethodGet, path: "/api/tokens", wantStatus: http.StatusForbidden},
+		{name: "notify: 通知を送れる", token: notifyToken, method: http.MethodPost, path: "/api/notifications", body: `{"session":"main","window_index":0,"type":"stop"}`, wantStatus: http.StatusCreated},
+		{name: "notify: セッション一覧は403", token: notifyToken, method: http.MethodGet, path: "/api/sessions", wantStatus: http.StatusForbidden},
+		{name: "full: トークン一覧を取得できる", token: fullToken, method: http.MethodGet, path: "/api/tokens", wantStatus: http.StatusOK},
+		{name: "不明なトークン: 401", token: "unknown", method: http.MethodGet, path: "/api/sessions", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, handler, tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleListTokens_HidesSecrets(t *testing.T) {
+	srv, ts, token := newTestServerWithTokens(t)
+	ts.Create("dashboard", ScopeRead)
+
+	rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/tokens", token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var tokens []map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&tokens); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("len(tokens) = %d, want 1", len(tokens))
+	}
+	for _, key := range []string{"token", "secret_hash"} {
+		if _, ok := tokens[0][key]; ok {
+			t.Errorf("list response must not contain %q", key)
+		}
+	}
+	if _, ok := tokens[0]["created_at"]; !ok {
+		t.Error("list response should contain created_at")
+	}
+}
+
+func TestHandleRevokeToken(t *testing.T) {
+	srv, ts, token := newTestServerWithTokens(t)
+	handler := srv.Handler()
+	created, secret, _ := ts.Create("dashboard", ScopeRead)
+
+	rec := doRequest(t, handler, http.MethodDelete, "/api/tokens/"+created.ID, token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	// 無効化したトークンは即座に使えなくなる
+	rec = doRequest(t, handler, http.MethodGet, "/api/sessions", secret, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = doRequest(t, handler, http.MethodDelete, "/api/tokens/"+created.ID, token, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second revoke status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
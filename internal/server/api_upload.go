@@ -10,8 +10,6 @@ import (
 	"path/filepath"
 )
 
-const maxUploadSize = 10 << 20 // 10MB
-
 // allowedImageTypes は許可する MIME タイプと対応する拡張子のマッピング。
 var allowedImageTypes = map[string]string{
 	"image/png":  ".png",
@@ -26,12 +24,14 @@ var allowedImageTypes = map[string]string{
 func (s *Server) handleUploadImage() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// リクエストボディのサイズ制限
-		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		maxSize := s.uploadSizeLimit()
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		tooLarge := fmt.Sprintf("file too large (max %dMB)", maxSize>>20)
 
 		file, _, err := r.FormFile("file")
 		if err != nil {
 			if err.Error() == "http: request body too large" {
-				writeError(w, http.StatusRequestEntityTooLarge, "file too large (max 10MB)")
+				writeError(w, http.StatusRequestEntityTooLarge, tooLarge)
 				return
 			}
 			writeError(w, http.StatusBadRequest, "file field is required")
@@ -43,7 +43,7 @@ func (s *Server) handleUploadImage() http.Handler {
 		data, err := io.ReadAll(file)
 		if err != nil {
 			if err.Error() == "http: request body too large" {
-				writeError(w, http.StatusRequestEntityTooLarge, "file too large (max 10MB)")
+				writeError(w, http.StatusRequestEntityTooLarge, tooLarge)
 				return
 			}
 			writeError(w, http.StatusInternalServerError, "failed to read file")
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleListUsers は GET /api/users のハンドラ。
+// ユーザーアカウントの一覧を返す（パスワードハッシュは含まない）。
+func (s *Server) handleListUsers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+		writeJSON(w, http.StatusOK, s.users.List())
+	})
+}
+
+// handlePutUser は PUT /api/users/{name} のハンドラ。
+// ユーザーを作成または更新する。既存ユーザーの更新では password を省略できる。
+func (s *Server) handlePutUser() http.Handler {
+	type putUserRequest struct {
+		Password string   `json:"password"`
+		Role     Role     `json:"role"`
+		Sessions []string `json:"sessions"`
+		Projects []string `json:"projects"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+
+		var req putUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if !req.Role.Valid() {
+			writeError(w, http.StatusBadRequest, "role must be one of: admin, operator, viewer")
+			return
+		}
+
+		name := r.PathValue("name")
+		_, existed := s.users.Get(name)
+		u, err := s.users.Put(User{
+			Name:     name,
+			Role:     req.Role,
+			Sessions: req.Sessions,
+			Projects: req.Projects,
+		}, req.Password)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		status := http.StatusOK
+		if !existed {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, u)
+	})
+}
+
+// handleDeleteUser は DELETE /api/users/{name} のハンドラ。
+// ユーザーを削除する。発行済みのセッション cookie も以降は無効になる。
+func (s *Server) handleDeleteUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireFullScope(w, r) {
+			return
+		}
+
+		found, err := s.users.Delete(r.PathValue("name"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tjst-t/palmux/internal/tmux"
+)
+
+// newTestServerWithUsers はユーザーストア付きのテスト用 Server を作成するヘルパー。
+func newTestServerWithUsers(t *testing.T, mock *configurableMock) (*Server, *UserStore) {
+	t.Helper()
+	us, err := NewUserStore("")
+	if err != nil {
+		t.Fatalf("NewUserStore() error = %v", err)
+	}
+	srv := NewServer(Options{
+		Tmux:     mock,
+		Token:    "test-token",
+		Users:    us,
+		BasePath: "/",
+	})
+	return srv, us
+}
+
+// loginAsUser はユーザーアカウントでログインしてセッション cookie を返すヘルパー。
+func loginAsUser(t *testing.T, handler http.Handler, name, password string) *http.Cookie {
+	t.Helper()
+	body := `{"username":"` + name + `","secret":"` + password + `"}`
+	rec := doRequest(t, handler, http.MethodPost, "/api/auth/login", "", body)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("login status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	cookie := findSessionCookie(rec)
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+	return cookie
+}
+
+// doCookieRequest は cookie 付きでリクエストを送るヘルパー。
+func doCookieRequest(handler http.Handler, method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlePutUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "正常系: viewerを作成", body: `{"password":"pw","role":"viewer","sessions":["dev-*"]}`, wantStatus: http.StatusCreated},
+		{name: "パスワードなし: 400", body: `{"role":"viewer"}`, wantStatus: http.StatusBadRequest},
+		{name: "不正なrole: 400", body: `{"password":"pw","role":"root"}`, wantStatus: http.StatusBadRequest},
+		{name: "不正なパターン: 400", body: `{"password":"pw","role":"viewer","sessions":["["]}`, wantStatus: http.StatusBadRequest},
+		{name: "不正なJSON: 400", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newTestServerWithUsers(t, &configurableMock{})
+			rec := doRequest(t, srv.Handler(), http.MethodPut, "/api/users/alice", "test-token", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp map[string]any
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp["name"] != "alice" || resp["role"] != "viewer" {
+				t.Errorf("unexpected response: %v", resp)
+			}
+			if _, ok := resp["password_hash"]; ok {
+				t.Error("response must not contain password_hash")
+			}
+		})
+	}
+}
+
+func TestUserLogin_RoleAndSessionVisibility(t *testing.T) {
+	mock := &configurableMock{
+		sessions: []tmux.Session{{Name: "dev-api"}, {Name: "dev-web"}, {Name: "prod"}},
+	}
+	srv, us := newTestServerWithUsers(t, mock)
+	handler := srv.Handler()
+
+	if _, err := us.Put(User{Name: "alice", Role: RoleViewer, Sessions: []string{"dev-*"}}, "pw"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	cookie := loginAsUser(t, handler, "alice", "pw")
+
+	// セッション一覧は許可されたセッションのみ
+	rec := doCookieRequest(handler, http.MethodGet, "/api/sessions", cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var sessions []tmux.Session
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].Name != "dev-api" || sessions[1].Name != "dev-web" {
+		t.Errorf("sessions = %+v, want dev-api and dev-web", sessions)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "許可セッションのウィンドウ一覧", method: http.MethodGet, path: "/api/sessions/dev-api/windows", wantStatus: http.StatusOK},
+		{name: "非許可セッションのウィンドウ一覧は403", method: http.MethodGet, path: "/api/sessions/prod/windows", wantStatus: http.StatusForbidden},
+		{name: "viewerはウィンドウ作成できない", method: http.MethodPost, path: "/api/sessions/dev-api/windows", wantStatus: http.StatusForbidden},
+		{name: "viewerはセッション削除できない", method: http.MethodDelete, path: "/api/sessions/dev-api", wantStatus: http.StatusForbidden},
+		{name: "ユーザー一覧は403", method: http.MethodGet, path: "/api/users", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doCookieRequest(handler, tt.method, tt.path, cookie)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	// ユーザーを削除すると発行済み cookie も無効になる
+	if _, err := us.Delete("alice"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	rec = doCookieRequest(handler, http.MethodGet, "/api/sessions", cookie)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status after delete = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestUserLogin_OperatorCannotCreateHiddenSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "許可パターンのセッション作成", body: `{"name":"dev-new"}`, wantStatus: http.StatusCreated},
+		{name: "非許可のセッション作成は403", body: `{"name":"prod"}`, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &configurableMock{newSession: &tmux.Session{Name: "dev-new"}}
+			srv, us := newTestServerWithUsers(t, mock)
+			handler := srv.Handler()
+			if _, err := us.Put(User{Name: "bob", Role: RoleOperator, Sessions: []string{"dev-*"}}, "pw"); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			cookie := loginAsUser(t, handler, "bob", "pw")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/sessions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(cookie)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusForbidden && mock.calledNewSession != "" {
+				t.Errorf("NewSession should not be called, got %q", mock.calledNewSession)
+			}
+		})
+	}
+}
+
+func TestUserLogin_WrongPassword(t *testing.T) {
+	srv, us := newTestServerWithUsers(t, &configurableMock{})
+	us.Put(User{Name: "alice", Role: RoleViewer}, "pw")
+
+	rec := doRequest(t, srv.Handler(), http.MethodPost, "/api/auth/login", "", `{"username":"alice","secret":"test-token"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
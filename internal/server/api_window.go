@@ -2,10 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/tjst-t/palmux/internal/tmux"
+	"github.com/tjst-t/palmux/internal/vt"
 )
 
 // handleGetSessionMode は GET /api/sessions/{session}/mode のハンドラ。
@@ -244,6 +247,80 @@ func (s *Server) handleGetPaneCommand() http.Handler {
 	})
 }
 
+// snapshotMaxHistory はスナップショットに含めるスクロールバックの最大行数。
+const snapshotMaxHistory = 10000
+
+// handleGetSnapshot は GET /api/sessions/{session}/windows/{index}/snapshot のハンドラ。
+// attach せずに指定ウィンドウの画面の内容（tmux capture-pane）を返す。
+// クエリパラメータ format で形式（text: プレーンテキスト、ansi: 色付きのエスケープシーケンス、html: 色付きの <pre> 要素）、
+// history でスクロールバックから含める行数（最大 snapshotMaxHistory、デフォルト 0 で表示中の画面のみ）、
+// pane で対象のペイン ID（省略時はアクティブなペイン）を指定する。
+func (s *Server) handleGetSnapshot() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.PathValue("session")
+		indexStr := r.PathValue("index")
+
+		index, err := strconv.Atoi(indexStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid window index: "+indexStr)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "":
+			format = "text"
+		case "text", "ansi", "html":
+		default:
+			writeError(w, http.StatusBadRequest, "format must be text, ansi or html")
+			return
+		}
+
+		history := 0
+		if v := r.URL.Query().Get("history"); v != "" {
+			history, err = strconv.Atoi(v)
+			if err != nil || history < 0 {
+				writeError(w, http.StatusBadRequest, "invalid history: "+v)
+				return
+			}
+			history = min(history, snapshotMaxHistory)
+		}
+
+		var pane string
+		if v := r.URL.Query().Get("pane"); v != "" {
+			pane, err = tmux.ParsePaneID(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		out, err := s.tmux.CapturePane(session, index, pane, format != "text", history)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// 画面下部の空行は含めない
+		if out = strings.TrimRight(out, "\n"); out != "" {
+			out += "\n"
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if format == "html" {
+			// 生成する HTML はインラインスタイルのみ。念のためスクリプト等は一切読み込ませない
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+			w.WriteHeader(http.StatusOK)
+			w.Write(vt.HTML([]byte(out)))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, out)
+	})
+}
+
 // handleDeleteWindow は DELETE /api/sessions/{session}/windows/{index} のハンドラ。
 // パスパラメータの session と index で指定されたウィンドウを削除し、204 No Content を返す。
 func (s *Server) handleDeleteWindow() http.Handler {
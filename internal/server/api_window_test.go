@@ -850,3 +850,118 @@ func TestHandleDeleteWindow_WithBasePath(t *testing.T) {
 		t.Errorf("KillWindow index = %d, want %d", mock.calledKillWindow.index, 2)
 	}
 }
+
+func TestHandleGetSnapshot(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		captureErr      error
+		wantStatus      int
+		wantEscapes     bool
+		wantHistory     int
+		wantPane        string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "正常系: デフォルトはプレーンテキスト",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "$ make\nerror: <nil>\n",
+		},
+		{
+			name:            "正常系: ANSI とスクロールバック",
+			query:           "?format=ansi&history=200",
+			wantStatus:      http.StatusOK,
+			wantEscapes:     true,
+			wantHistory:     200,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "$ make\n\x1b[31merror\x1b[39m: <nil>\n",
+		},
+		{
+			name:            "正常系: HTML はエスケープして色を付ける",
+			query:           "?format=html",
+			wantStatus:      http.StatusOK,
+			wantEscapes:     true,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody: `<pre class="palmux-snapshot" style="background-color:#000000;color:#e5e5e5">` +
+				"$ make\n" + `<span style="color:#cd0000">error</span>: &lt;nil&gt;` + "\n</pre>",
+		},
+		{
+			name:            "正常系: history は上限で切り詰める",
+			query:           "?history=999999",
+			wantStatus:      http.StatusOK,
+			wantHistory:     snapshotMaxHistory,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "$ make\nerror: <nil>\n",
+		},
+		{
+			name:            "正常系: pane を指定",
+			query:           "?pane=5",
+			wantStatus:      http.StatusOK,
+			wantPane:        "%5",
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "$ make\nerror: <nil>\n",
+		},
+		{
+			name:       "異常系: 不正な pane",
+			query:      "?pane=main:1.0",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "異常系: 不正な format",
+			query:      "?format=pdf",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "異常系: 負の history",
+			query:      "?history=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "異常系: tmux エラー",
+			captureErr: errors.New("can't find window: 1"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &configurableMock{
+				// 画面下部の空行は取り除かれる
+				capture:     "$ make\nerror: <nil>\n\n\n",
+				captureANSI: "$ make\n\x1b[31merror\x1b[39m: <nil>\n\n\n",
+				captureErr:  tt.captureErr,
+			}
+			srv, token := newTestServer(mock)
+			rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/sessions/main/windows/1/snapshot"+tt.query, token, "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body = %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := mock.calledCapturePane; got.session != "main" || got.index != 1 || got.pane != tt.wantPane || got.escapes != tt.wantEscapes || got.history != tt.wantHistory {
+				t.Errorf("CapturePane called with %+v, want pane %q, escapes %v, history %d", got, tt.wantPane, tt.wantEscapes, tt.wantHistory)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantContentType)
+			}
+			if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("X-Content-Type-Options should be nosniff")
+			}
+			if body := rec.Body.String(); body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleGetSnapshot_InvalidIndex(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+	rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/sessions/main/windows/abc/snapshot", token, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/tjst-t/palmux/internal/vt"
+)
+
+// attachResumeGrace は WebSocket 切断後に attach（pty とグループセッション）を保持する時間。
+// この間に resume トークン付きで再接続すると同じ pty を引き継ぎ、取りこぼした出力を再送する。
+var attachResumeGrace = 30 * time.Second
+
+// attachScrollbackSize は attach ごとに保持する直近の出力の量（バイト）。
+// 再接続時はこの範囲の出力を再送し、範囲外の場合は画面全体を再描画させる。
+var attachScrollbackSize = 1 << 20
+
+// outputRing は pty 出力の直近 size バイトをストリームオフセット付きで保持するリングバッファ。
+type outputRing struct {
+	data []byte
+	end  int64 // 書き込まれた出力の総バイト数（= 次に書き込まれるバイトのオフセット）
+}
+
+// newOutputRing は size バイトの outputRing を生成する。
+func newOutputRing(size int) *outputRing {
+	return &outputRing{data: make([]byte, size)}
+}
+
+// start は保持している出力の先頭のストリームオフセットを返す。
+func (r *outputRing) start() int64 {
+	if r.end < int64(len(r.data)) {
+		return 0
+	}
+	return r.end - int64(len(r.data))
+}
+
+// write は出力を追加する。size を超えた分は古いものから上書きする。
+func (r *outputRing) write(p []byte) {
+	size := len(r.data)
+	if len(p) > size {
+		r.end += int64(len(p) - size)
+		p = p[len(p)-size:]
+	}
+	for len(p) > 0 {
+		i := int(r.end % int64(size))
+		n := copy(r.data[i:], p)
+		r.end += int64(n)
+		p = p[n:]
+	}
+}
+
+// since は offset 以降の出力を dst に追加して返す。
+// offset がすでに上書きされている、または未来の位置の場合は false を返す。
+func (r *outputRing) since(offset int64, dst []byte) ([]byte, bool) {
+	if offset < r.start() || offset > r.end {
+		return dst, false
+	}
+	size := int64(len(r.data))
+	for offset < r.end {
+		i := offset % size
+		j := size
+		if r.end-offset < size-i {
+			j = i + r.end - offset
+		}
+		dst = append(dst, r.data[i:j]...)
+		offset += j - i
+	}
+	return dst, true
+}
+
+// errAttachmentClosed は閉じられた attachment に接続しようとしたことを表す。
+var errAttachmentClosed = errors.New("attachment closed")
+
+// attachment は 1 つの tmux attach（pty とグループセッション）を表す。
+// WebSocket 接続とは独立しており、切断後も attachResumeGrace の間は保持して
+// resume トークンによる再接続で同じ pty を引き継げるようにする。
+// 接続数の枠は接続中の WebSocket のみが使い、切断中の attachment は枠を返す。
+type attachment struct {
+	token    string
+	session  string
+	window   int    // attach 時に指定したウィンドウ（指定なしは -1）
+	owner    string // attach した Principal の名前（引き継げるのは同じ Principal のみ）
+	readOnly bool
+	ptmx     *os.File
+	ptsName  string
+	release  func() // pty・tmux attach・グループセッション等を解放する
+	store    *attachmentStore
+	recorder *recorder          // attach の録画（?record=1 で attach した場合のみ）
+	conns    *connectionTracker // 接続数の枠を管理する（多重化接続の attachment では nil）
+
+	mu     sync.Mutex
+	ring   *outputRing
+	queue  *outputQueue // 接続中の WebSocket の送信キュー（切断中・状態同期モードでは nil）
+	screen *vt.Screen   // 状態同期モードで使うヘッドレス端末（状態同期モードで接続されるまで nil）
+	conn   int          // 接続の世代（bind ごとに増える）
+	kick   func()       // 接続中の WebSocket を切り離す
+	connID string       // 接続中の WebSocket が使っている接続数の枠（切断中は空）
+	timer  *time.Timer  // 切断後の猶予タイマー
+	closed bool
+
+	screenReady chan struct{} // screen が更新されたことを通知する（容量 1）
+
+	closeOnce sync.Once
+	done      chan struct{} // close 完了時に close される
+}
+
+// attachmentStore は resume トークンから attachment を引く。
+type attachmentStore struct {
+	mu sync.Mutex
+	m  map[string]*attachment
+}
+
+// newAttachmentStore は空の attachmentStore を生成する。
+func newAttachmentStore() *attachmentStore {
+	return &attachmentStore{m: make(map[string]*attachment)}
+}
+
+// get は token の attachment を返す（存在しなければ nil）。
+func (st *attachmentStore) get(token string) *attachment {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.m[token]
+}
+
+// remove は attachment を登録から外す。
+func (st *attachmentStore) remove(a *attachment) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.m[a.token] == a {
+		delete(st.m, a.token)
+	}
+}
+
+// generateResumeToken は attachment の resume トークンを生成する。
+func generateResumeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate resume token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newAttachment は attach 済みの pty から attachment を生成して登録し、pty の読み取りを開始する。
+// release は attachment を閉じるときに一度だけ呼ばれる。rec が nil でなければ pty の出力と画面サイズの変化を録画する。
+// 呼び出し側は beginAttach 済みであること（attachment が閉じるまで Shutdown に待たせる）。
+func (s *Server) newAttachment(session string, window int, owner string, readOnly bool, ptmx *os.File, rec *recorder, release func()) (*attachment, error) {
+	token, err := generateResumeToken()
+	if err != nil {
+		return nil, err
+	}
+	a := &attachment{
+		token:    token,
+		session:  session,
+		window:   window,
+		owner:    owner,
+		readOnly: readOnly,
+		ptmx:     ptmx,
+		ptsName:  getPTSName(ptmx),
+		release:  release,
+		store:    s.attachments,
+		recorder: rec,
+		ring:     newOutputRing(attachScrollbackSize),
+		done:     make(chan struct{}),
+
+		screenReady: make(chan struct{}, 1),
+	}
+
+	s.attachWG.Add(1)
+	s.attachments.mu.Lock()
+	s.attachments.m[token] = a
+	s.attachments.mu.Unlock()
+
+	go a.readPty()
+	go func() {
+		// 切断中の attachment はシャットダウン時にそのまま閉じる
+		// （接続中のものは watchShutdown がクライアントに通知してから閉じる）
+		select {
+		case <-a.done:
+		case <-s.shutdownCh:
+			a.mu.Lock()
+			detached := a.kick == nil
+			a.mu.Unlock()
+			if detached {
+				a.close()
+			}
+		}
+	}()
+	go func() {
+		<-a.done
+		s.attachWG.Done()
+	}()
+	return a, nil
+}
+
+// readPty は pty の出力をリングバッファと接続中の送信キュー（状態同期モードではヘッドレス端末）、録画に書き込む。
+// pty が閉じられたら attachment を閉じる。
+func (a *attachment) readPty() {
+	buf := make([]byte, wsOutputReadSize)
+	for {
+		n, err := a.ptmx.Read(buf)
+		if err != nil {
+			// pty が閉じられた
+			a.close()
+			return
+		}
+		a.mu.Lock()
+		a.ring.write(buf[:n])
+		if a.queue != nil {
+			a.queue.push(buf[:n])
+		}
+		if a.screen != nil {
+			a.screen.Write(buf[:n])
+			select {
+			case a.screenReady <- struct{}{}:
+			default:
+			}
+		}
+		a.mu.Unlock()
+		if a.recorder != nil {
+			a.recorder.output(buf[:n])
+		}
+	}
+}
+
+// startScreen は状態同期モード用のヘッドレス端末を用意する。
+// 新しく作成した場合は true を返す（作成前の出力は反映されていないため、呼び出し側で tmux に再描画させる）。
+// 画面サイズは pty のサイズ（取得できなければ 80x24）から始める。
+func (a *attachment) startScreen() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.screen != nil {
+		return false
+	}
+	cols, rows := 80, 24
+	if ws, err := pty.GetsizeFull(a.ptmx); err == nil && ws.Cols > 0 && ws.Rows > 0 {
+		cols, rows = int(ws.Cols), int(ws.Rows)
+	}
+	a.screen = vt.New(cols, rows)
+	return true
+}
+
+// snapshot はヘッドレス端末の現在の画面を返す。
+func (a *attachment) snapshot() *vt.Frame {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.screen.Snapshot()
+}
+
+// resize は pty（と状態同期モードのヘッドレス端末）の画面サイズを変更し、録画中なら変化を記録する。
+func (a *attachment) resize(cols, rows int) error {
+	if err := pty.Setsize(a.ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)}); err != nil {
+		return err
+	}
+	if a.recorder != nil {
+		a.recorder.resize(cols, rows)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.screen != nil {
+		a.screen.Resize(cols, rows)
+	}
+	return nil
+}
+
+// resumableBy は owner が session の window への attach として（readOnly の指定を変えずに）引き継げるかを返す。
+func (a *attachment) resumableBy(owner, session string, window int, readOnly bool) bool {
+	return a.owner == owner && a.session == session && a.window == window && a.readOnly == readOnly
+}
+
+// bind は WebSocket 接続を attachment に結び付け、その接続の送信キューを返す。
+// すでに接続中の WebSocket があれば kick して切り離し、その接続数の枠を引き継ぐ。
+// 切断中の attachment に再接続する場合は remoteIP の接続として枠を取り直す。
+// キューには offset 以降の出力（リングバッファに残っている分）を再送用に積む。
+// offset が再送できない位置の場合は現在位置から始め、キューを破棄状態にして再描画させる。
+// 状態同期モード（state）では送信キューを使わず、q = nil、start は現在位置になる。
+// start は送信キューの先頭のストリームオフセット、gen は unbind に渡す接続の世代。
+// attachment がすでに閉じている場合は errAttachmentClosed を、接続数の上限に達している場合はそのエラーを返す。
+func (a *attachment) bind(offset int64, state bool, remoteIP string, kick func()) (q *outputQueue, start int64, gen int, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil, 0, 0, errAttachmentClosed
+	}
+	if a.conns != nil && a.connID == "" {
+		if a.readOnly {
+			a.connID, err = a.conns.addSpectator(a.session, remoteIP, a.owner)
+		} else {
+			a.connID, err = a.conns.add(a.session, remoteIP, a.owner)
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	if a.kick != nil {
+		a.kick()
+	}
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+
+	a.conn++
+	a.kick = kick
+	if state {
+		a.queue = nil
+		return nil, a.ring.end, a.conn, nil
+	}
+
+	replay, replayable := a.ring.since(offset, nil)
+	if replayable {
+		start = offset
+	} else {
+		start = a.ring.end
+	}
+	q = newOutputQueue(wsOutputBufferLimit, start)
+	if replayable {
+		if len(replay) > 0 {
+			q.push(replay)
+		}
+	} else {
+		q.drop()
+	}
+	a.queue = q
+	return q, start, a.conn, nil
+}
+
+// unbind は世代 gen の WebSocket 接続を attachment から切り離して接続数の枠を返し、
+// attachResumeGrace 後に attachment を閉じるタイマーを開始する。
+// すでに新しい接続に引き継がれている場合は何もしない。
+// シャットダウン中は猶予を置かずに閉じる。
+func (a *attachment) unbind(s *Server, gen int) {
+	a.mu.Lock()
+	if a.closed || a.conn != gen {
+		a.mu.Unlock()
+		return
+	}
+	a.queue = nil
+	a.kick = nil
+	a.releaseConnLocked()
+	select {
+	case <-s.shutdownCh:
+		a.mu.Unlock()
+		a.close()
+		return
+	default:
+	}
+	a.timer = time.AfterFunc(attachResumeGrace, a.close)
+	a.mu.Unlock()
+}
+
+// releaseConnLocked は接続数の枠を返す。呼び出し側は a.mu を保持していること。
+func (a *attachment) releaseConnLocked() {
+	if a.connID != "" {
+		a.conns.remove(a.connID)
+		a.connID = ""
+	}
+}
+
+// close は attachment を閉じる。接続中の WebSocket を切り離し、release で資源を解放する。
+// 複数回呼んでも release は一度だけ実行され、すべての呼び出しは解放の完了を待つ。
+func (a *attachment) close() {
+	a.closeOnce.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		a.queue = nil
+		kick := a.kick
+		a.kick = nil
+		a.releaseConnLocked()
+		if a.timer != nil {
+			a.timer.Stop()
+			a.timer = nil
+		}
+		a.mu.Unlock()
+
+		a.store.remove(a)
+		if kick != nil {
+			kick()
+		}
+		a.release()
+		close(a.done)
+	})
+	<-a.done
+}
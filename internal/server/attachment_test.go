@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+func TestOutputRing(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string
+		offset  int64
+		want    string
+		wantOK  bool
+		wantEnd int64
+	}{
+		{name: "空のバッファ", offset: 0, want: "", wantOK: true},
+		{name: "先頭から取得", writes: []string{"abc", "de"}, offset: 0, want: "abcde", wantOK: true, wantEnd: 5},
+		{name: "途中から取得", writes: []string{"abc", "de"}, offset: 3, want: "de", wantOK: true, wantEnd: 5},
+		{name: "末尾は空", writes: []string{"abc"}, offset: 3, want: "", wantOK: true, wantEnd: 3},
+		{name: "折り返した出力を連結する", writes: []string{"abcdef", "ghij"}, offset: 2, want: "cdefghij", wantOK: true, wantEnd: 10},
+		{name: "上書き済みの位置は取得できない", writes: []string{"abcdef", "ghij"}, offset: 1, wantOK: false, wantEnd: 10},
+		{name: "サイズを超える書き込みは末尾だけ残す", writes: []string{"0123456789abc"}, offset: 5, want: "56789abc", wantOK: true, wantEnd: 13},
+		{name: "未来の位置は取得できない", writes: []string{"abc"}, offset: 4, wantOK: false, wantEnd: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newOutputRing(8)
+			for _, w := range tt.writes {
+				r.write([]byte(w))
+			}
+			got, ok := r.since(tt.offset, nil)
+			if ok != tt.wantOK {
+				t.Fatalf("since(%d) ok = %v, want %v", tt.offset, ok, tt.wantOK)
+			}
+			if ok && string(got) != tt.want {
+				t.Errorf("since(%d) = %q, want %q", tt.offset, got, tt.want)
+			}
+			if r.end != tt.wantEnd {
+				t.Errorf("end = %d, want %d", r.end, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// readResumeMessage は接続直後の resume メッセージを読み取るヘルパー。
+func readResumeMessage(t *testing.T, ctx context.Context, conn *websocket.Conn) wsResumeMessage {
+	t.Helper()
+
+	typ, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("failed to read resume message: %v", err)
+	}
+	var msg wsResumeMessage
+	if typ != websocket.MessageText || json.Unmarshal(data, &msg) != nil || msg.Type != "resume" || msg.Token == "" {
+		t.Fatalf("first message = %q, want resume message", data)
+	}
+	return msg
+}
+
+// dialAttach は attach エンドポイントに接続し、resume メッセージを返すヘルパー。
+func dialAttach(t *testing.T, tsURL, path, token string) (*websocket.Conn, context.Context, context.CancelFunc, wsResumeMessage) {
+	t.Helper()
+
+	wsURL := "ws" + strings.TrimPrefix(tsURL, "http") + path
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{"Bearer " + token}},
+	})
+	if err != nil {
+		cancel()
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	return conn, ctx, cancel, readResumeMessage(t, ctx, conn)
+}
+
+// readOutput は output メッセージを want の長さに達するまで読み取るヘルパー。
+// 最後の output メッセージのストリームオフセットも返す。
+func readOutput(t *testing.T, ctx context.Context, conn *websocket.Conn, want string) (string, int64) {
+	t.Helper()
+
+	var got string
+	var offset int64
+	for len(got) < len(want) {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("failed to read output (got %q so far): %v", got, err)
+		}
+		var msg wsOutputMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("failed to unmarshal %q: %v", data, err)
+		}
+		if msg.Type != "output" {
+			continue
+		}
+		got += msg.Data
+		offset = msg.Offset
+	}
+	return got, offset
+}
+
+// waitAttachmentClosed は token の attachment が閉じられるまで待つヘルパー。
+func waitAttachmentClosed(t *testing.T, srv *Server, token string) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for srv.attachments.get(token) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("attachment was not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleAttach_ResumeReplaysMissedOutput(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	const path = "/api/sessions/main/windows/0/attach"
+	conn, ctx, cancel, first := dialAttach(t, ts.URL, path, token)
+	defer cancel()
+	if first.Resumed || first.Offset != 0 {
+		t.Errorf("first resume message = %+v, want a new attach at offset 0", first)
+	}
+
+	if _, err := pts.Write([]byte("before")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	got, offset := readOutput(t, ctx, conn, "before")
+	if got != "before" || offset != int64(len("before")) {
+		t.Fatalf("output = %q at offset %d, want %q at %d", got, offset, "before", len("before"))
+	}
+
+	// close フレームのない切断（ネットワーク断）の間に出力が続く
+	conn.CloseNow()
+	if _, err := pts.Write([]byte("missed")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	conn2, ctx2, cancel2, resumed := dialAttach(t, ts.URL, path+"?resume="+first.Token+"&offset=6", token)
+	defer cancel2()
+	defer conn2.Close(websocket.StatusNormalClosure, "")
+
+	if !resumed.Resumed || resumed.Token != first.Token || resumed.Offset != 6 {
+		t.Errorf("resume message = %+v, want resumed at offset 6 with the same token", resumed)
+	}
+	got, offset = readOutput(t, ctx2, conn2, "missed")
+	if got != "missed" || offset != 12 {
+		t.Errorf("replayed output = %q at offset %d, want %q at 12", got, offset, "missed")
+	}
+
+	mock.mu.Lock()
+	refreshed := len(mock.refreshedClients)
+	mock.mu.Unlock()
+	if refreshed != 0 {
+		t.Errorf("RefreshClient called %d times, want 0 when output is replayable", refreshed)
+	}
+	if conns := srv.connTracker.list(); len(conns) != 1 {
+		t.Errorf("connections = %d, want 1 (resume reuses the attach)", len(conns))
+	}
+}
+
+func TestHandleAttach_ResumeFromStaleOffsetRedraws(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	origSize := attachScrollbackSize
+	attachScrollbackSize = 16
+	defer func() { attachScrollbackSize = origSize }()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	const path = "/api/sessions/main/windows/0/attach"
+	conn, _, cancel, first := dialAttach(t, ts.URL, path, token)
+	defer cancel()
+	conn.CloseNow()
+
+	// リングバッファを溢れさせる
+	if _, err := pts.Write([]byte(strings.Repeat("x", 64))); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	conn2, ctx2, cancel2, resumed := dialAttach(t, ts.URL, path+"?resume="+first.Token+"&offset=0", token)
+	defer cancel2()
+	defer conn2.Close(websocket.StatusNormalClosure, "")
+
+	if !resumed.Resumed || resumed.Offset != 64 {
+		t.Errorf("resume message = %+v, want resumed at the current offset 64", resumed)
+	}
+	got, offset := readOutput(t, ctx2, conn2, wsOutputResync)
+	if got != wsOutputResync || offset != 64 {
+		t.Errorf("output = %q at offset %d, want resync %q at 64", got, offset, wsOutputResync)
+	}
+	if name := getPTSName(mock.attachPty); name != "" {
+		mock.mu.Lock()
+		refreshed := append([]string(nil), mock.refreshedClients...)
+		mock.mu.Unlock()
+		if len(refreshed) != 1 || refreshed[0] != name {
+			t.Errorf("RefreshClient calls = %v, want [%s]", refreshed, name)
+		}
+	}
+}
+
+func TestHandleAttach_ResumeEndsAttach(t *testing.T) {
+	tests := []struct {
+		name       string
+		disconnect func(conn *websocket.Conn)
+		grace      time.Duration
+	}{
+		{
+			name:       "クライアントが明示的に閉じた場合はすぐに終了する",
+			disconnect: func(conn *websocket.Conn) { conn.Close(websocket.StatusNormalClosure, "") },
+			grace:      time.Minute,
+		},
+		{
+			name:       "猶予を過ぎたら終了する",
+			disconnect: func(conn *websocket.Conn) { conn.CloseNow() },
+			grace:      50 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, cleanup := setupWSTest(t)
+			defer cleanup()
+
+			origGrace := attachResumeGrace
+			attachResumeGrace = tt.grace
+			defer func() { attachResumeGrace = origGrace }()
+
+			srv, token := newTestServerWithWS(t, mock)
+			ts := httptest.NewServer(srv.Handler())
+			defer ts.Close()
+
+			conn, _, cancel, first := dialAttach(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+			defer cancel()
+			tt.disconnect(conn)
+
+			waitAttachmentClosed(t, srv, first.Token)
+			if conns := srv.connTracker.list(); len(conns) != 0 {
+				t.Errorf("connections = %d, want 0 after the attach ends", len(conns))
+			}
+		})
+	}
+}
+
+func TestHandleAttach_ResumeRequiresSameMode(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+	mock.multiPty = true // 新規 attach ごとに別の pty を使う
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, _, cancel, first := dialAttach(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	conn.CloseNow()
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "観戦モードでは操作用の attach を引き継がない", path: "/api/sessions/main/windows/0/attach?readonly=1&resume=" + first.Token},
+		{name: "別セッションの attach は引き継がない", path: "/api/sessions/other/windows/0/attach?resume=" + first.Token},
+		{name: "別ウィンドウの attach は引き継がない", path: "/api/sessions/main/windows/1/attach?resume=" + first.Token},
+		{name: "不明なトークンは新規 attach になる", path: "/api/sessions/main/windows/0/attach?resume=unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn2, _, cancel2, msg := dialAttach(t, ts.URL, tt.path, token)
+			defer cancel2()
+			defer conn2.Close(websocket.StatusNormalClosure, "")
+
+			if msg.Resumed || msg.Token == first.Token {
+				t.Errorf("resume message = %+v, want a new attach", msg)
+			}
+		})
+	}
+}
+
+func TestHandleAttach_DetachedReleasesConnection(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+	mock.multiPty = true // 新規 attach ごとに別の pty を使う
+
+	srv, token := newTestServerWithWSAndMaxConn(t, mock, 1)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	const path = "/api/sessions/main/windows/0/attach"
+	waitConnections := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for len(srv.connTracker.list()) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("connections = %d, want %d", len(srv.connTracker.list()), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// ネットワーク断で切断された attachment は猶予の間も保持されるが、接続数の枠は返す
+	conn, _, cancel, first := dialAttach(t, ts.URL, path, token)
+	defer cancel()
+	conn.CloseNow()
+	waitConnections(0)
+	if srv.attachments.get(first.Token) == nil {
+		t.Fatal("attachment was closed, want it kept for resume")
+	}
+
+	// 空いた枠で別の attach ができる
+	conn2, _, cancel2, second := dialAttach(t, ts.URL, path, token)
+	defer cancel2()
+	if second.Resumed {
+		t.Errorf("resume message = %+v, want a new attach", second)
+	}
+	waitConnections(1)
+
+	// 枠が埋まっている間は再接続できない（attachment は保持したまま）
+	ctx, cancel3 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel3()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + path + "?resume=" + first.Token
+	conn3, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{"Bearer " + token}},
+	})
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	if _, _, err := conn3.Read(ctx); websocket.CloseStatus(err) != websocket.StatusTryAgainLater {
+		t.Errorf("resume over the limit: err = %v, want close status %v", err, websocket.StatusTryAgainLater)
+	}
+	if srv.attachments.get(first.Token) == nil {
+		t.Error("attachment was closed by a rejected resume")
+	}
+
+	// 枠が空けば再接続で枠を取り直す
+	conn2.Close(websocket.StatusNormalClosure, "")
+	waitConnections(0)
+	conn4, _, cancel4, resumed := dialAttach(t, ts.URL, path+"?resume="+first.Token, token)
+	defer cancel4()
+	defer conn4.Close(websocket.StatusNormalClosure, "")
+	if !resumed.Resumed || resumed.Token != first.Token {
+		t.Errorf("resume message = %+v, want resumed with the same token", resumed)
+	}
+	waitConnections(1)
+}
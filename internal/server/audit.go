@@ -0,0 +1,390 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 監査ログのイベント種別。
+const (
+	AuditEventRequest = "request" // 状態を変更する API 呼び出し
+	AuditEventAttach  = "attach"  // ターミナルへの attach
+	AuditEventDetach  = "detach"  // ターミナルからの detach
+)
+
+// defaultAuditMaxSize は監査ログファイルをローテーションするデフォルトのサイズ（バイト）。
+const defaultAuditMaxSize = 10 << 20
+
+// defaultAuditMaxBackups はローテーション後に保持する世代数のデフォルト値。
+const defaultAuditMaxBackups = 5
+
+// auditMaxBodySize はパラメータとして記録するリクエストボディの最大サイズ。
+// これを超える JSON ボディはパラメータに含めない。
+const auditMaxBodySize = 64 << 10
+
+// auditMaxParamLen は記録する文字列パラメータの最大長。超えた分は切り詰める。
+const auditMaxParamLen = 256
+
+// auditRedactedParams は値を記録しないパラメータ名（認証情報やファイル内容）。
+var auditRedactedParams = map[string]bool{
+	"token":    true,
+	"share":    true,
+	"secret":   true,
+	"password": true,
+	"content":  true,
+}
+
+// auditPathParams は監査ログに記録するルーティングのパスパラメータ名。
+var auditPathParams = []string{"session", "name", "index", "project", "branch", "id"}
+
+// AuditEntry は監査ログの 1 エントリ。
+type AuditEntry struct {
+	Time     time.Time              `json:"time"`
+	Event    string                 `json:"event"`
+	Actor    string                 `json:"actor"`
+	RemoteIP string                 `json:"remote_ip"`
+	Method   string                 `json:"method,omitempty"`
+	Endpoint string                 `json:"endpoint"`
+	Session  string                 `json:"session,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	Status   int                    `json:"status,omitempty"`
+	Result   string                 `json:"result"` // "ok" またはエラー内容
+}
+
+// AuditQuery は監査ログの検索条件。ゼロ値の項目は条件に含めない。
+type AuditQuery struct {
+	Since   time.Time
+	Until   time.Time
+	Session string
+	Limit   int // 0 の場合は無制限（新しいものから Limit 件）
+}
+
+// matches はエントリが検索条件に一致するかを返す。
+func (q AuditQuery) matches(e AuditEntry) bool {
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	if q.Session != "" && e.Session != q.Session {
+		return false
+	}
+	return true
+}
+
+// AuditLog は追記専用の JSONL 監査ログ。
+// ファイルサイズが maxSize を超えると <path>.1, <path>.2, ... にローテーションし、
+// maxBackups を超えた古い世代は削除する。
+// nil の AuditLog は何も記録しない（監査ログ無効）。
+type AuditLog struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// OpenAuditLog は監査ログファイルを追記モードで開く。
+// maxSize・maxBackups が 0 以下の場合はデフォルト値を使用する。
+func OpenAuditLog(path string, maxSize int64, maxBackups int) (*AuditLog, error) {
+	if path == "" {
+		return nil, fmt.Errorf("audit log path is required")
+	}
+	if maxSize <= 0 {
+		maxSize = defaultAuditMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultAuditMaxBackups
+	}
+	a := &AuditLog{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := a.openLocked(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// openLocked は現在のログファイルを開き直す。
+func (a *AuditLog) openLocked() error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// Close はログファイルを閉じる。
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// Record はエントリを 1 行の JSON として追記する。
+// Time が未設定の場合は現在時刻を使用する。書き込みに失敗してもリクエスト処理は継続させるため、
+// エラーは返さずに呼び出し元へは影響させない。
+func (a *AuditLog) Record(e AuditEntry) {
+	if a == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotateLocked(); err != nil {
+			log.Printf("audit log rotation failed: %v", err)
+			if a.file == nil {
+				return
+			}
+		}
+	}
+	n, _ := a.file.Write(line)
+	a.size += int64(n)
+}
+
+// rotateLocked は現在のファイルを <path>.1 に移し、既存の世代を 1 つずつずらす。
+func (a *AuditLog) rotateLocked() error {
+	a.file.Close()
+	a.file = nil
+
+	os.Remove(a.backupPath(a.maxBackups))
+	for i := a.maxBackups - 1; i >= 1; i-- {
+		os.Rename(a.backupPath(i), a.backupPath(i+1))
+	}
+	if err := os.Rename(a.path, a.backupPath(1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		// リネームできなくても現在のファイルへの追記は続ける
+		a.openLocked()
+		return err
+	}
+	return a.openLocked()
+}
+
+// backupPath は n 世代前のログファイルのパスを返す。
+func (a *AuditLog) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", a.path, n)
+}
+
+// Query は保持している全世代から条件に一致するエントリを古い順に返す。
+// Limit が指定されている場合は新しいものから Limit 件に絞る。
+func (a *AuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	if a == nil {
+		return []AuditEntry{}, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := []AuditEntry{}
+	for i := a.maxBackups; i >= 0; i-- {
+		p := a.path
+		if i > 0 {
+			p = a.backupPath(i)
+		}
+		entries, err := readAuditFile(p, q)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entries...)
+	}
+
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result, nil
+}
+
+// readAuditFile は 1 つのログファイルから条件に一致するエントリを読み込む。
+// ファイルが存在しない場合は空を返し、壊れた行は読み飛ばす。
+func readAuditFile(path string, q AuditQuery) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if q.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// statusRecorder はハンドラが書き込んだステータスコードを記録する ResponseWriter。
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// auditMiddleware は状態を変更するリクエスト（GET/HEAD 以外）を監査ログに記録するミドルウェア。
+// 認証ミドルウェアの内側で使用し、Principal を実行者として記録する。
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.audit == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		params := auditRequestParams(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		result := "ok"
+		if status >= 400 {
+			result = http.StatusText(status)
+		}
+
+		p, _ := PrincipalFromContext(r.Context())
+		s.audit.Record(AuditEntry{
+			Event:    AuditEventRequest,
+			Actor:    p.Name,
+			RemoteIP: r.RemoteAddr,
+			Method:   r.Method,
+			Endpoint: r.URL.Path,
+			Session:  auditSession(r, params),
+			Params:   params,
+			Status:   status,
+			Result:   result,
+		})
+	})
+}
+
+// auditRequestParams はパスパラメータ・クエリパラメータ・JSON ボディのトップレベル項目を
+// 監査ログ用のパラメータとして抽出する。認証情報やファイル内容は記録しない。
+// ボディは読み取った後にハンドラが再度読めるよう差し戻す。
+func auditRequestParams(r *http.Request) map[string]interface{} {
+	params := make(map[string]interface{})
+	for _, name := range auditPathParams {
+		if v := r.PathValue(name); v != "" {
+			params[name] = v
+		}
+	}
+	for k, v := range r.URL.Query() {
+		if len(v) > 0 {
+			params[k] = auditParamValue(k, v[0])
+		}
+	}
+
+	if r.Body != nil && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(io.LimitReader(r.Body, auditMaxBodySize+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err == nil && len(body) <= auditMaxBodySize {
+			var fields map[string]interface{}
+			if json.Unmarshal(body, &fields) == nil {
+				for k, v := range fields {
+					params[k] = auditParamValue(k, v)
+				}
+			}
+		}
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// auditParamValue は機密パラメータを伏せ、長い文字列を切り詰めた値を返す。
+func auditParamValue(key string, v interface{}) interface{} {
+	if auditRedactedParams[key] {
+		return "[redacted]"
+	}
+	if s, ok := v.(string); ok && len(s) > auditMaxParamLen {
+		return s[:auditMaxParamLen] + "..."
+	}
+	return v
+}
+
+// auditSession はリクエストの対象セッション名を返す。
+// パスの {session}（DELETE /api/sessions/{name} は {name}）、POST /api/sessions はボディの name、
+// それ以外はボディの session を参照する。
+func auditSession(r *http.Request, params map[string]interface{}) string {
+	if s := r.PathValue("session"); s != "" {
+		return s
+	}
+	key := "session"
+	if r.URL.Path == "/api/sessions" || strings.HasPrefix(r.URL.Path, "/api/sessions/") {
+		key = "name"
+	}
+	if s := r.PathValue(key); s != "" {
+		return s
+	}
+	s, _ := params[key].(string)
+	return s
+}
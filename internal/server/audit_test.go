@@ -0,0 +1,113 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLog_RecordAndQuery(t *testing.T) {
+	a, err := OpenAuditLog(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	if err != nil {
+		t.Fatalf("OpenAuditLog() error = %v", err)
+	}
+	defer a.Close()
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.Record(AuditEntry{Time: base, Event: AuditEventRequest, Actor: "alice", Session: "main", Result: "ok"})
+	a.Record(AuditEntry{Time: base.Add(time.Hour), Event: AuditEventAttach, Actor: "bob", Session: "dev", Result: "ok"})
+	a.Record(AuditEntry{Time: base.Add(2 * time.Hour), Event: AuditEventDetach, Actor: "bob", Session: "main", Result: "ok"})
+
+	tests := []struct {
+		name       string
+		query      AuditQuery
+		wantActors []string
+	}{
+		{name: "全件", query: AuditQuery{}, wantActors: []string{"alice", "bob", "bob"}},
+		{name: "セッションで絞り込み", query: AuditQuery{Session: "main"}, wantActors: []string{"alice", "bob"}},
+		{name: "since で絞り込み", query: AuditQuery{Since: base.Add(time.Hour)}, wantActors: []string{"bob", "bob"}},
+		{name: "until は含まない", query: AuditQuery{Until: base.Add(time.Hour)}, wantActors: []string{"alice"}},
+		{name: "limit は新しい方から", query: AuditQuery{Limit: 1}, wantActors: []string{"bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := a.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(entries) != len(tt.wantActors) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.wantActors))
+			}
+			for i, e := range entries {
+				if e.Actor != tt.wantActors[i] {
+					t.Errorf("entries[%d].Actor = %q, want %q", i, e.Actor, tt.wantActors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLog_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := OpenAuditLog(path, 200, 2)
+	if err != nil {
+		t.Fatalf("OpenAuditLog() error = %v", err)
+	}
+	defer a.Close()
+
+	for i := 0; i < 20; i++ {
+		a.Record(AuditEntry{Event: AuditEventRequest, Actor: "alice", Endpoint: "/api/sessions", Result: "ok"})
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("stat %s: %v", p, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s size = %d, want <= 200", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 should not exist (maxBackups = 2)", path)
+	}
+
+	// ローテーション後も保持している世代から検索できる
+	entries, err := a.Query(AuditQuery{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(entries) == 0 || len(entries) >= 20 {
+		t.Errorf("got %d entries, want between 1 and 19", len(entries))
+	}
+}
+
+func TestAuditLog_AppendsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, _ := OpenAuditLog(path, 0, 0)
+	a.Record(AuditEntry{Actor: "alice", Result: "ok"})
+	a.Close()
+
+	a, err := OpenAuditLog(path, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenAuditLog() error = %v", err)
+	}
+	defer a.Close()
+	a.Record(AuditEntry{Actor: "bob", Result: "ok"})
+
+	entries, _ := a.Query(AuditQuery{})
+	if len(entries) != 2 {
+		t.Errorf("got %d entries, want 2", len(entries))
+	}
+}
+
+func TestAuditLog_NilIsNoop(t *testing.T) {
+	var a *AuditLog
+	a.Record(AuditEntry{Actor: "alice"})
+	entries, err := a.Query(AuditQuery{})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Query() on nil = %v, %v; want empty", entries, err)
+	}
+}
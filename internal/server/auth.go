@@ -1,36 +1,288 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"log"
 	"net/http"
 	"strings"
 )
 
+// Principal は認証済みリクエストの主体を表す。
+type Principal struct {
+	Name  string     `json:"name"`  // 識別名（ユーザー名、名前付きトークン名、JWT のユーザー識別子、"master" 等）
+	Scope TokenScope `json:"scope"` // 許可された操作の範囲（トークン由来）
+	Role  Role       `json:"role"`  // 権限レベル（ユーザーアカウント以外は admin）
+
+	user  *User        // ユーザーアカウントでログインした場合のみ設定される
+	share *shareClaims // 共有リンクでアクセスした場合のみ設定される
+}
+
+// CanAccessSession は Principal が指定セッションにアクセスできるかを返す。
+// ユーザーアカウント・共有リンク以外（トークン等）は全セッションにアクセスできる。
+func (p Principal) CanAccessSession(session string) bool {
+	if p.share != nil {
+		return p.share.Session == session
+	}
+	return p.user == nil || p.user.CanAccessSession(session)
+}
+
+// CanAccessProject は Principal が指定 ghq プロジェクトにアクセスできるかを返す。
+// 共有リンクはプロジェクト単位の API にはアクセスできない。
+func (p Principal) CanAccessProject(project string) bool {
+	if p.share != nil {
+		return false
+	}
+	return p.user == nil || p.user.CanAccessProject(project)
+}
+
+// ReadOnly は Principal がターミナルへの入力を許可されていないかを返す。
+// viewer ロールのほか、スコープが full 以外のトークンも入力できない。
+func (p Principal) ReadOnly() bool {
+	return p.Role == RoleViewer || p.Scope != ScopeFull
+}
+
+// principalContextKey は Principal を context に格納するためのキー。
+type principalContextKey struct{}
+
+// withPrincipal は Principal を格納した context を返す。
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext は context から認証済みの Principal を取り出す。
+// 認証を経ていない場合は false を返す。
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator はリクエストの認証とスコープ検査を行う。
+// 受け付ける資格情報は以下の通り:
+//   - Token: 起動時に生成（または --token で指定）されるマスタートークン（フルアクセス）
+//   - Tokens: 名前付き API トークン（スコープ付き）
+//   - Cookies: ログインページで発行した署名付きセッション cookie
+//     （ユーザーアカウントでログインした場合は Users のロールとセッション制限に従う）
+//   - Shares: 共有リンク（?share=）。単一セッション（またはウィンドウ）の閲覧・attach のみ
+//   - JWT: 信頼するリバースプロキシ（Cloudflare Access 等）がヘッダーで付与する署名付き JWT
+//     （識別子と同名のユーザーアカウントがあればそのロールとセッション制限に従い、なければフルアクセス）
+//   - ClientCerts: 相互 TLS のクライアント証明書（サブジェクトを識別子として JWT と同様に扱う）
+type Authenticator struct {
+	Token       string
+	Tokens      *TokenStore
+	Cookies     *CookieAuth
+	Users       *UserStore
+	Shares      *ShareStore
+	JWT         *JWTAuth
+	ClientCerts *ClientCertAuth
+
+	throttle *authThrottle // クライアント IP ごとの認証失敗ロックアウト
+}
+
 // AuthMiddleware は Bearer token による認証ミドルウェアを返す。
 // Authorization ヘッダーが "Bearer <token>" 形式で、
 // 指定されたトークンと一致する場合のみ次のハンドラに委譲する。
-// Authorization ヘッダーがない場合はクエリパラメータ "token" をフォールバックとして使用する。
+// Authorization ヘッダーがない場合、attach エンドポイントに限りクエリパラメータ "token" をフォールバックとして使用する。
 // これは WebSocket 接続時にブラウザ JS からカスタムヘッダーを送れないための対応。
+// さらに cookies が nil でなければ、ログインページで発行した署名付きセッション cookie も受け付ける。
 // 不正な場合は 401 Unauthorized を返す。
-func AuthMiddleware(token string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-
-			var reqToken string
-			if strings.HasPrefix(authHeader, "Bearer ") {
-				// "Bearer " 以降のトークンを取得
-				reqToken = authHeader[len("Bearer "):]
-			} else if authHeader == "" {
-				// フォールバック: クエリパラメータ（WebSocket 接続用）
-				reqToken = r.URL.Query().Get("token")
-			}
+func AuthMiddleware(token string, cookies *CookieAuth) func(http.Handler) http.Handler {
+	a := &Authenticator{Token: token, Cookies: cookies, throttle: newAuthThrottle()}
+	return a.Middleware
+}
 
-			if reqToken == "" || reqToken != token {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+// Middleware は認証ミドルウェア。
+// 資格情報が不正な場合は 401 Unauthorized を返す。
+// トークン（Bearer / ?token= / ?share=）による認証失敗が続いたクライアント IP は一定時間ロックアウトし、
+// その間はトークンによるリクエストと認証に失敗したリクエストに 429 Too Many Requests と Retry-After を返す。
+// スコープ・ロール外の操作や、パスの {session}/{name}/{project} が
+// アクセス不可のセッション・プロジェクトを指す場合は 403 Forbidden を返す。
+// 認証に成功した場合は Principal を context に格納して次のハンドラに委譲する。
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := a.authenticate(r)
+
+		// ロックアウトは推測可能なトークンと認証の失敗にのみ適用する。
+		// 署名付きの資格情報（cookie・JWT・クライアント証明書）で認証できたリクエストは、
+		// 同じ IP（プロキシ・Unix ソケット経由等）からの失敗があっても拒否しない
+		tokenCredentials := hasTokenCredentials(r)
+		if a.throttle != nil && (!ok || tokenCredentials) {
+			ip := clientIP(r)
+			if wait, allowed := a.throttle.check(ip); !allowed {
+				writeTooManyRequests(w, wait, "too many failed authentication attempts")
 				return
 			}
+			if !ok && tokenCredentials {
+				a.throttle.fail(ip)
+			} else if ok {
+				a.throttle.succeed(ip)
+			}
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !p.Scope.Allows(r) || !p.Role.Allows(r) || (p.share != nil && !p.share.Allows(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// DELETE /api/sessions/{name} は {name}、その他のセッション配下のルートは {session}
+		session := r.PathValue("session")
+		if session == "" && strings.HasPrefix(r.URL.Path, "/api/sessions/") {
+			session = r.PathValue("name")
+		}
+		if session != "" && !p.CanAccessSession(session) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if project := r.PathValue("project"); project != "" && !p.CanAccessProject(project) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
+
+// authenticate はリクエストの資格情報を検証し、対応する Principal を返す。
+// クライアント証明書がある場合は証明書のみで判定する（失効していれば他の資格情報があっても拒否する）。
+// JWT ヘッダーがある場合は JWT のみで判定する（不正な JWT は他の資格情報があっても拒否する）。
+// Authorization ヘッダーがある場合はヘッダーのみで判定する（cookie やクエリにはフォールバックしない）。
+func (a *Authenticator) authenticate(r *http.Request) (Principal, bool) {
+	if a.ClientCerts != nil && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return a.clientCertPrincipal(r.TLS.PeerCertificates[0])
+	}
+
+	if a.JWT != nil {
+		if assertion := r.Header.Get(a.JWT.Header()); assertion != "" {
+			return a.jwtPrincipal(assertion)
+		}
+	}
+
+	authHeader := r.Header.Get("Authorization")
+
+	if authHeader != "" {
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return Principal{}, false
+		}
+		// "Bearer " 以降のトークンを取得
+		return a.lookupToken(authHeader[len("Bearer "):])
+	}
+
+	// フォールバック: クエリパラメータ（WebSocket の attach のみ）
+	if isAttachPath(r.URL.Path) {
+		if p, ok := a.lookupToken(r.URL.Query().Get("token")); ok {
+			return p, true
+		}
+	}
+
+	// フォールバック: 共有リンク
+	if a.Shares != nil {
+		if claims, ok := a.Shares.Lookup(r.URL.Query().Get("share")); ok {
+			return sharePrincipal(claims), true
+		}
+	}
+
+	// フォールバック: セッション cookie（ログインページ経由のブラウザ）
+	if a.Cookies != nil {
+		if claims, ok := a.Cookies.requestClaims(r); ok {
+			return a.cookiePrincipal(claims)
+		}
+	}
+
+	return Principal{}, false
+}
+
+// cookiePrincipal はセッション cookie のクレームから Principal を組み立てる。
+// ユーザーアカウントの cookie は毎回 UserStore を参照するため、
+// 削除やロール変更は発行済みの cookie にも即座に反映される。
+func (a *Authenticator) cookiePrincipal(claims sessionClaims) (Principal, bool) {
+	if claims.Subject == "" {
+		return Principal{Name: "session", Scope: ScopeFull, Role: RoleAdmin}, true
+	}
+	if a.Users == nil {
+		return Principal{}, false
+	}
+	u, ok := a.Users.Get(claims.Subject)
+	if !ok {
+		return Principal{}, false
+	}
+	return Principal{Name: u.Name, Scope: ScopeFull, Role: u.Role, user: &u}, true
+}
+
+// jwtPrincipal は JWT を検証し、ユーザー識別子から Principal を組み立てる。
+func (a *Authenticator) jwtPrincipal(assertion string) (Principal, bool) {
+	name, err := a.JWT.Verify(assertion)
+	if err != nil {
+		log.Printf("jwt auth rejected: %v", err)
+		return Principal{}, false
+	}
+	return a.identityPrincipal(name), true
+}
 
-			next.ServeHTTP(w, r)
-		})
+// clientCertPrincipal はクライアント証明書の失効を確認し、サブジェクトから Principal を組み立てる。
+// 長時間の keep-alive 接続でも失効が反映されるよう、リクエストごとに確認する。
+func (a *Authenticator) clientCertPrincipal(cert *x509.Certificate) (Principal, bool) {
+	if a.ClientCerts.Revoked(cert) {
+		return Principal{}, false
+	}
+	return a.identityPrincipal(a.ClientCerts.Identity(cert)), true
+}
+
+// identityPrincipal は外部で認証済みのユーザー識別子（JWT・クライアント証明書）から Principal を組み立てる。
+// 識別子と同名のユーザーアカウントがある場合はそのロールとセッション制限を適用し、なければフルアクセスとする。
+func (a *Authenticator) identityPrincipal(name string) Principal {
+	if a.Users != nil {
+		if u, ok := a.Users.Get(name); ok {
+			return Principal{Name: u.Name, Scope: ScopeFull, Role: u.Role, user: &u}
+		}
+	}
+	return Principal{Name: name, Scope: ScopeFull, Role: RoleAdmin}
+}
+
+// sharePrincipal は共有リンクのクレームから Principal を組み立てる。
+// 読み取り専用のリンクは viewer ロールとして扱い、attach 時の入力を破棄させる。
+func sharePrincipal(claims shareClaims) Principal {
+	role := RoleOperator
+	if claims.ReadOnly {
+		role = RoleViewer
+	}
+	return Principal{Name: "share:" + claims.ID, Scope: ScopeFull, Role: role, share: &claims}
+}
+
+// isAttachPath は WebSocket の attach エンドポイント（多重化接続を含む）のパスかどうかを返す。
+// ?token= によるクエリパラメータ認証はこのエンドポイントに限定する。
+func isAttachPath(path string) bool {
+	return path == "/api/mux" || (strings.HasPrefix(path, "/api/sessions/") && strings.HasSuffix(path, "/attach"))
+}
+
+// hasTokenCredentials はリクエストが推測可能なトークン（Bearer / ?token= / ?share=）を含むかを返す。
+// 署名付きの cookie や JWT は総当たりの対象にならず、期限切れの cookie を持つブラウザを
+// ロックアウトしないよう、失敗回数には数えない。
+func hasTokenCredentials(r *http.Request) bool {
+	q := r.URL.Query()
+	if r.Header.Get("Authorization") != "" || q.Get("share") != "" {
+		return true
+	}
+	return q.Get("token") != "" && isAttachPath(r.URL.Path)
+}
+
+// lookupToken はトークン文字列をマスタートークン・名前付きトークンの順に照合する。
+// タイミング攻撃を避けるため定数時間で比較する。
+func (a *Authenticator) lookupToken(reqToken string) (Principal, bool) {
+	if reqToken == "" {
+		return Principal{}, false
+	}
+	if a.Token != "" && subtle.ConstantTimeCompare([]byte(reqToken), []byte(a.Token)) == 1 {
+		return Principal{Name: "master", Scope: ScopeFull, Role: RoleAdmin}, true
+	}
+	if a.Tokens != nil {
+		if t, ok := a.Tokens.Lookup(reqToken); ok {
+			return Principal{Name: t.Name, Scope: t.Scope, Role: RoleAdmin}, true
+		}
 	}
+	return Principal{}, false
 }
@@ -83,7 +83,7 @@ func TestAuthMiddleware(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			middleware := AuthMiddleware(tt.token)
+			middleware := AuthMiddleware(tt.token, nil)
 			handler := middleware(innerHandler)
 
 			req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
@@ -114,7 +114,7 @@ func TestAuthMiddleware_DoesNotCallNextOnFailure(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	middleware := AuthMiddleware(validToken)
+	middleware := AuthMiddleware(validToken, nil)
 	handler := middleware(innerHandler)
 
 	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
@@ -140,7 +140,7 @@ func TestAuthMiddleware_CallsNextOnSuccess(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	middleware := AuthMiddleware(validToken)
+	middleware := AuthMiddleware(validToken, nil)
 	handler := middleware(innerHandler)
 
 	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
@@ -211,10 +211,10 @@ func TestAuthMiddleware_QueryParamToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			middleware := AuthMiddleware(validToken)
+			middleware := AuthMiddleware(validToken, nil)
 			handler := middleware(innerHandler)
 
-			url := "/api/sessions"
+			url := "/api/sessions/main/windows/0/attach"
 			if tt.queryToken != "" {
 				url += "?token=" + tt.queryToken
 			}
@@ -236,3 +236,54 @@ func TestAuthMiddleware_QueryParamToken(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthMiddleware_QueryParamTokenOnlyForAttach(t *testing.T) {
+	const validToken = "test-secret-token-12345"
+
+	innerHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "attach: 200", path: "/api/sessions/main/windows/0/attach", wantStatus: http.StatusOK},
+		{name: "セッション一覧: 401", path: "/api/sessions", wantStatus: http.StatusUnauthorized},
+		{name: "ファイル取得: 401", path: "/api/sessions/main/files", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AuthMiddleware(validToken, nil)(innerHandler)
+			req := httptest.NewRequest(http.MethodGet, tt.path+"?token="+validToken, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPrincipal_ReadOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Principal
+		want bool
+	}{
+		{name: "full スコープの admin", p: Principal{Scope: ScopeFull, Role: RoleAdmin}, want: false},
+		{name: "viewer ロール", p: Principal{Scope: ScopeFull, Role: RoleViewer}, want: true},
+		{name: "read スコープのトークン", p: Principal{Scope: ScopeRead, Role: RoleAdmin}, want: true},
+		{name: "notify スコープのトークン", p: Principal{Scope: ScopeNotify, Role: RoleAdmin}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.ReadOnly(); got != tt.want {
+				t.Errorf("ReadOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 自動 TLS の証明書の有効期間と更新タイミング。テスト時に上書き可能。
+var (
+	// autoTLSCAValidity はローカル CA 証明書の有効期間。
+	autoTLSCAValidity = 10 * 365 * 24 * time.Hour
+	// autoTLSCertValidity はサーバー証明書の有効期間（ブラウザの上限 398 日以内）。
+	autoTLSCertValidity = 365 * 24 * time.Hour
+	// autoTLSRenewBefore は有効期限のこの時間前になったらサーバー証明書を更新する。
+	autoTLSRenewBefore = 30 * 24 * time.Hour
+)
+
+// 自動 TLS のファイル名（ディレクトリ内）。
+const (
+	autoTLSCACertFile = "ca.pem"
+	autoTLSCAKeyFile  = "ca-key.pem"
+	autoTLSCertFile   = "server.pem"
+	autoTLSKeyFile    = "server-key.pem"
+)
+
+// AutoTLS はローカル CA とその CA が署名したサーバー証明書を自動生成・永続化する。
+// CA は一度生成すると再利用するため、端末に CA をインストールすれば
+// サーバー証明書が更新されても警告なしに接続できる。
+// サーバー証明書は対象ホストが変わった場合（LAN IP の変更等）と有効期限が近づいた場合に再発行する。
+type AutoTLS struct {
+	dir   string
+	hosts []string
+
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caPEM  []byte
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+// NewAutoTLS は dir から CA とサーバー証明書を読み込み、なければ生成して保存する。
+// hosts はサーバー証明書の SAN に含めるホスト名・IP アドレス。
+func NewAutoTLS(dir string, hosts []string) (*AutoTLS, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("auto tls directory is required")
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("auto tls requires at least one host")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create auto tls directory: %w", err)
+	}
+
+	a := &AutoTLS{dir: dir, hosts: hosts}
+	if err := a.loadOrCreateCA(); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cert, err := a.loadServerCert(); err == nil && a.usable(cert.Leaf) {
+		a.cert = cert
+		return a, nil
+	}
+	if err := a.issueLocked(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// CAPath は CA 証明書のファイルパスを返す。
+func (a *AutoTLS) CAPath() string {
+	return filepath.Join(a.dir, autoTLSCACertFile)
+}
+
+// CACertPEM は CA 証明書を PEM 形式で返す。
+func (a *AutoTLS) CACertPEM() []byte {
+	return a.caPEM
+}
+
+// GetCertificate は tls.Config.GetCertificate 用に現在のサーバー証明書を返す。
+// 有効期限が autoTLSRenewBefore 以内に迫っていれば再発行してから返す。
+func (a *AutoTLS) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if time.Until(a.cert.Leaf.NotAfter) < autoTLSRenewBefore {
+		if err := a.issueLocked(); err != nil {
+			// 更新に失敗しても期限内であれば現在の証明書で継続する
+			log.Printf("auto tls renewal failed: %v", err)
+		}
+	}
+	return a.cert, nil
+}
+
+// loadOrCreateCA は CA 証明書と鍵を読み込む。存在しないか期限切れの場合は新しく生成する。
+func (a *AutoTLS) loadOrCreateCA() error {
+	certPath := filepath.Join(a.dir, autoTLSCACertFile)
+	keyPath := filepath.Join(a.dir, autoTLSCAKeyFile)
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if ok && pair.Leaf.IsCA && time.Now().Before(pair.Leaf.NotAfter) {
+			a.caCert = pair.Leaf
+			a.caKey = key
+			a.caPEM, err = os.ReadFile(certPath)
+			return err
+		}
+		log.Printf("auto tls: regenerating unusable or expired CA in %s", a.dir)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("load auto tls ca: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate auto tls ca key: %w", err)
+	}
+	now := time.Now()
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{Organization: []string{"Palmux"}, CommonName: "Palmux Local CA " + hostname},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(autoTLSCAValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("create auto tls ca: %w", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := writeKeyPair(certPath, keyPath, caPEM, key); err != nil {
+		return err
+	}
+
+	a.caCert = cert
+	a.caKey = key
+	a.caPEM = caPEM
+	return nil
+}
+
+// loadServerCert は保存済みのサーバー証明書を読み込む。
+func (a *AutoTLS) loadServerCert() (*tls.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(filepath.Join(a.dir, autoTLSCertFile), filepath.Join(a.dir, autoTLSKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// usable はサーバー証明書が現在の CA で署名され、全ての hosts を含み、更新時期を過ぎていないかを返す。
+func (a *AutoTLS) usable(leaf *x509.Certificate) bool {
+	if leaf.CheckSignatureFrom(a.caCert) != nil {
+		return false
+	}
+	if time.Until(leaf.NotAfter) < autoTLSRenewBefore {
+		return false
+	}
+	for _, h := range a.hosts {
+		if leaf.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// issueLocked は新しいサーバー証明書を発行して保存する。
+func (a *AutoTLS) issueLocked() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate auto tls server key: %w", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{Organization: []string{"Palmux"}, CommonName: a.hosts[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(autoTLSCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range a.hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.caCert, &key.PublicKey, a.caKey)
+	if err != nil {
+		return fmt.Errorf("create auto tls server certificate: %w", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := writeKeyPair(filepath.Join(a.dir, autoTLSCertFile), filepath.Join(a.dir, autoTLSKeyFile), certPEM, key); err != nil {
+		return err
+	}
+
+	a.cert = &tls.Certificate{
+		Certificate: [][]byte{der, a.caCert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	return nil
+}
+
+// writeKeyPair は証明書（PEM）と秘密鍵をファイルに保存する。秘密鍵は 0600 で書き込む。
+func writeKeyPair(certPath, keyPath string, certPEM []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("marshal auto tls key: %w", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("save auto tls key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("save auto tls certificate: %w", err)
+	}
+	return nil
+}
+
+// randomSerial は 128 ビットのランダムな証明書シリアル番号を返す。
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
+
+// AutoTLSHosts はサーバー証明書に含めるホストの一覧を返す。
+// listenHost（全インターフェースを表す 0.0.0.0 / :: 以外の場合）、localhost、ホスト名、
+// 全ネットワークインターフェースの IP アドレス（ループバックを含む）を重複なく列挙する。
+func AutoTLSHosts(listenHost string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(h string) {
+		if h != "" && !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+
+	if ip := net.ParseIP(listenHost); ip == nil || !ip.IsUnspecified() {
+		add(listenHost)
+	}
+	add("localhost")
+	if hostname, err := os.Hostname(); err == nil {
+		add(hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				add(ipNet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// handleGetCACert は GET /api/tls/ca.crt のハンドラ。
+// 端末にインストールするためのローカル CA 証明書を返す（公開情報のため認証不要）。
+func (s *Server) handleGetCACert() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Header().Set("Content-Disposition", `attachment; filename="palmux-ca.crt"`)
+		w.Write(s.autoTLS.CACertPEM())
+	})
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewAutoTLS_CreatesAndPersists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	hosts := []string{"palmux.local", "127.0.0.1", "192.168.1.10"}
+
+	a, err := NewAutoTLS(dir, hosts)
+	if err != nil {
+		t.Fatalf("NewAutoTLS() error = %v", err)
+	}
+
+	for _, name := range []string{autoTLSCACertFile, autoTLSCAKeyFile, autoTLSCertFile, autoTLSKeyFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not persisted: %v", name, err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, autoTLSCAKeyFile))
+	if err != nil {
+		t.Fatalf("stat ca key: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("ca key permission = %o, want 600", perm)
+	}
+
+	cert, _ := a.GetCertificate(nil)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(a.CACertPEM())
+	for _, h := range hosts {
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: h, Roots: pool}); err != nil {
+			t.Errorf("server certificate should be valid for %s: %v", h, err)
+		}
+	}
+
+	// 再起動しても CA とサーバー証明書を再利用する
+	b, err := NewAutoTLS(dir, hosts)
+	if err != nil {
+		t.Fatalf("NewAutoTLS() reload error = %v", err)
+	}
+	if string(b.CACertPEM()) != string(a.CACertPEM()) {
+		t.Error("CA should be reused across restarts")
+	}
+	reloaded, _ := b.GetCertificate(nil)
+	if reloaded.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+		t.Error("server certificate should be reused across restarts")
+	}
+
+	// ホストが増えた場合はサーバー証明書のみ再発行する
+	c, err := NewAutoTLS(dir, append(hosts, "10.0.0.5"))
+	if err != nil {
+		t.Fatalf("NewAutoTLS() with new host error = %v", err)
+	}
+	if string(c.CACertPEM()) != string(a.CACertPEM()) {
+		t.Error("CA should be kept when hosts change")
+	}
+	reissued, _ := c.GetCertificate(nil)
+	if err := reissued.Leaf.VerifyHostname("10.0.0.5"); err != nil {
+		t.Errorf("reissued certificate should cover the new host: %v", err)
+	}
+}
+
+func TestAutoTLS_RenewsBeforeExpiry(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewAutoTLS(dir, []string{"localhost"})
+	if err != nil {
+		t.Fatalf("NewAutoTLS() error = %v", err)
+	}
+	first, _ := a.GetCertificate(nil)
+
+	orig := autoTLSRenewBefore
+	autoTLSRenewBefore = autoTLSCertValidity + time.Hour
+	defer func() { autoTLSRenewBefore = orig }()
+
+	renewed, _ := a.GetCertificate(nil)
+	if renewed.Leaf.SerialNumber.Cmp(first.Leaf.SerialNumber) == 0 {
+		t.Error("certificate should be renewed when it is about to expire")
+	}
+
+	// 更新した証明書はディスクにも保存される
+	data, err := os.ReadFile(filepath.Join(dir, autoTLSCertFile))
+	if err != nil {
+		t.Fatalf("read server cert: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	saved, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse server cert: %v", err)
+	}
+	if saved.SerialNumber.Cmp(renewed.Leaf.SerialNumber) != 0 {
+		t.Error("renewed certificate should be persisted")
+	}
+}
+
+func TestAutoTLSHosts(t *testing.T) {
+	hosts := AutoTLSHosts("0.0.0.0")
+	has := func(h string) bool {
+		for _, x := range hosts {
+			if x == h {
+				return true
+			}
+		}
+		return false
+	}
+	if has("0.0.0.0") {
+		t.Error("unspecified listen address should not be included")
+	}
+	for _, want := range []string{"localhost", "127.0.0.1"} {
+		if !has(want) {
+			t.Errorf("hosts %v should include %s", hosts, want)
+		}
+	}
+	if hosts := AutoTLSHosts("palmux.example.com"); hosts[0] != "palmux.example.com" {
+		t.Errorf("hosts[0] = %q, want listen host", hosts[0])
+	}
+}
+
+func TestServer_AutoTLS(t *testing.T) {
+	autoTLS, err := NewAutoTLS(t.TempDir(), []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("NewAutoTLS() error = %v", err)
+	}
+	srv := NewServer(Options{
+		Tmux:     &configurableMock{},
+		Token:    "test-token",
+		AutoTLS:  autoTLS,
+		BasePath: "/",
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	hs := srv.httpServer()
+	go hs.ServeTLS(ln, "", "")
+	defer hs.Close()
+
+	// ダウンロードした CA を信頼すれば証明書の警告なしに接続できる
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(autoTLS.CACertPEM())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	resp, err := client.Get("https://" + ln.Addr().String() + "/api/tls/ca.crt")
+	if err != nil {
+		t.Fatalf("GET ca.crt error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-x509-ca-cert" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestHandleGetCACert_DisabledWithoutAutoTLS(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+	rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/tls/ca.crt", token, "")
+	if rec.Code == http.StatusOK && rec.Header().Get("Content-Type") == "application/x-x509-ca-cert" {
+		t.Error("CA endpoint should not be served without auto TLS")
+	}
+}
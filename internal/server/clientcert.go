@@ -0,0 +1,256 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// revocationCheckInterval は CRL・拒否リストファイルの更新を確認する最小間隔。
+// 確認時にファイルの更新日時が変わっていれば再読み込みする。テスト時に上書き可能。
+var revocationCheckInterval = 5 * time.Second
+
+// ClientCertConfig は ClientCertAuth の設定。
+type ClientCertConfig struct {
+	CAFile       string // クライアント証明書を署名した CA 証明書（PEM、必須）
+	CRLFile      string // 失効リスト（PEM または DER。空の場合は検査しない）
+	DenylistFile string // 拒否する証明書の一覧（空の場合は検査しない）
+}
+
+// ClientCertAuth は相互 TLS（mTLS）のクライアント証明書を検証する。
+// CA で署名された証明書のみを TLS ハンドシェイクで受け付け、
+// CRL または拒否リストに含まれる証明書は拒否する。
+// CRL・拒否リストはファイルの更新を検知して再起動なしに再読み込みする。
+//
+// 拒否リストは 1 行に 1 つ、証明書のシリアル番号（16 進数）または
+// SHA-256 フィンガープリント（64 桁の 16 進数）を書く。":" 区切りも可。"#" 以降はコメント。
+type ClientCertAuth struct {
+	pool     *x509.CertPool
+	cas      []*x509.Certificate
+	crlFile  string
+	denyFile string
+
+	mu          sync.Mutex
+	revoked     map[string]bool // key: "serial:<hex>" または "sha256:<hex>"
+	crlModTime  time.Time
+	denyModTime time.Time
+	lastChecked time.Time
+}
+
+// NewClientCertAuth は ClientCertAuth を生成する。
+// CA 証明書と、指定されていれば CRL・拒否リストをこの時点で読み込み、不正であればエラーを返す。
+func NewClientCertAuth(cfg ClientCertConfig) (*ClientCertAuth, error) {
+	if cfg.CAFile == "" {
+		return nil, fmt.Errorf("client ca file is required")
+	}
+	data, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca: %w", err)
+	}
+
+	c := &ClientCertAuth{
+		pool:     x509.NewCertPool(),
+		crlFile:  cfg.CRLFile,
+		denyFile: cfg.DenylistFile,
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse client ca: %w", err)
+		}
+		c.pool.AddCert(cert)
+		c.cas = append(c.cas, cert)
+	}
+	if len(c.cas) == 0 {
+		return nil, fmt.Errorf("no certificates found in client ca file %s", cfg.CAFile)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reloadLocked(true); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TLSConfig はクライアント証明書を必須とする TLS 設定を返す。
+// 失効した証明書はハンドシェイクの時点で拒否する。
+func (c *ClientCertAuth) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  c.pool,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) > 0 && c.Revoked(cs.PeerCertificates[0]) {
+				return errors.New("client certificate revoked")
+			}
+			return nil
+		},
+	}
+}
+
+// Revoked は証明書が CRL または拒否リストに含まれているかを返す。
+// 前回の確認から revocationCheckInterval 以上経過していれば、ファイルの更新を確認してから判定する。
+func (c *ClientCertAuth) Revoked(cert *x509.Certificate) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.lastChecked) >= revocationCheckInterval {
+		if err := c.reloadLocked(false); err != nil {
+			// 読み込みに失敗した場合は直前の一覧で判定を続ける
+			log.Printf("client certificate revocation reload failed: %v", err)
+		}
+	}
+	return c.revoked[serialKey(cert)] || c.revoked[fingerprintKey(cert)]
+}
+
+// Identity は証明書のサブジェクトからユーザー識別子を返す。
+// CommonName、メールアドレス SAN、DNS 名 SAN の順に参照し、いずれもなければシリアル番号を使う。
+func (c *ClientCertAuth) Identity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return "cert:" + strings.ToLower(cert.SerialNumber.Text(16))
+}
+
+// reloadLocked は CRL・拒否リストの更新日時を確認し、変更があれば読み込み直す。
+// force が true の場合は更新日時に関わらず読み込む。
+func (c *ClientCertAuth) reloadLocked(force bool) error {
+	c.lastChecked = time.Now()
+
+	crlMod, err := modTime(c.crlFile)
+	if err != nil {
+		return fmt.Errorf("stat client crl: %w", err)
+	}
+	denyMod, err := modTime(c.denyFile)
+	if err != nil {
+		return fmt.Errorf("stat client denylist: %w", err)
+	}
+	if !force && crlMod.Equal(c.crlModTime) && denyMod.Equal(c.denyModTime) {
+		return nil
+	}
+
+	revoked := make(map[string]bool)
+	if c.crlFile != "" {
+		if err := c.loadCRL(revoked); err != nil {
+			return err
+		}
+	}
+	if c.denyFile != "" {
+		if err := loadDenylist(c.denyFile, revoked); err != nil {
+			return err
+		}
+	}
+	c.revoked = revoked
+	c.crlModTime = crlMod
+	c.denyModTime = denyMod
+	return nil
+}
+
+// loadCRL は CRL を読み込み、CA の署名を検証して失効したシリアル番号を revoked に追加する。
+func (c *ClientCertAuth) loadCRL(revoked map[string]bool) error {
+	data, err := os.ReadFile(c.crlFile)
+	if err != nil {
+		return fmt.Errorf("read client crl: %w", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("parse client crl: %w", err)
+	}
+
+	signed := false
+	for _, ca := range c.cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return fmt.Errorf("client crl %s is not signed by the client ca", c.crlFile)
+	}
+
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked["serial:"+strings.ToLower(entry.SerialNumber.Text(16))] = true
+	}
+	return nil
+}
+
+// loadDenylist は拒否リストを読み込み、シリアル番号・フィンガープリントを revoked に追加する。
+func loadDenylist(path string, revoked map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read client denylist: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(line), ":", ""))
+		if line == "" {
+			continue
+		}
+		if _, err := hex.DecodeString(strings.Repeat("0", len(line)%2) + line); err != nil {
+			log.Printf("client denylist: ignoring invalid entry %q", line)
+			continue
+		}
+		if len(line) == sha256.Size*2 {
+			revoked["sha256:"+line] = true
+		} else {
+			serial := strings.TrimLeft(line, "0")
+			if serial == "" {
+				serial = "0"
+			}
+			revoked["serial:"+serial] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// modTime はファイルの更新日時を返す。path が空の場合はゼロ値を返す。
+func modTime(path string) (time.Time, error) {
+	if path == "" {
+		return time.Time{}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// serialKey は証明書のシリアル番号による revoked のキーを返す。
+func serialKey(cert *x509.Certificate) string {
+	return "serial:" + strings.ToLower(cert.SerialNumber.Text(16))
+}
+
+// fingerprintKey は証明書の SHA-256 フィンガープリントによる revoked のキーを返す。
+func fingerprintKey(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
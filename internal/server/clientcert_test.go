@@ -0,0 +1,262 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI はテスト用にローカル生成した CA。
+type testPKI struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	caPath string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ca key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Palmux Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create ca cert: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+	return &testPKI{cert: cert, key: key, caPath: caPath}
+}
+
+// issue は CA で署名したクライアント証明書を発行する。
+func (p *testPKI) issue(t *testing.T, cn string, serial int64) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate client key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.cert, &key.PublicKey, p.key)
+	if err != nil {
+		t.Fatalf("create client cert: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCRL は serials を失効させた PEM 形式の CRL を書き出す。
+func (p *testPKI) writeCRL(t *testing.T, path string, serials ...int64) {
+	t.Helper()
+	var entries []x509.RevocationListEntry
+	for _, s := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, p.cert, p.key)
+	if err != nil {
+		t.Fatalf("create crl: %v", err)
+	}
+	writeFileWithNewModTime(t, path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}))
+}
+
+// writeFileWithNewModTime はファイルを書き込み、更新日時を確実に変化させる
+// （ファイルシステムの時刻の粒度によっては連続した書き込みで更新日時が変わらないため）。
+func writeFileWithNewModTime(t *testing.T, path string, data []byte) {
+	t.Helper()
+	mod := time.Now()
+	if info, err := os.Stat(path); err == nil && !info.ModTime().Before(mod) {
+		mod = info.ModTime().Add(time.Second)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+func TestClientCertAuth_Revocation(t *testing.T) {
+	orig := revocationCheckInterval
+	revocationCheckInterval = 0
+	defer func() { revocationCheckInterval = orig }()
+
+	pki := newTestPKI(t)
+	alice := pki.issue(t, "alice", 100).Leaf
+	bob := pki.issue(t, "bob", 200).Leaf
+	carol := pki.issue(t, "carol", 300).Leaf
+
+	dir := t.TempDir()
+	crlPath := filepath.Join(dir, "client.crl")
+	denyPath := filepath.Join(dir, "denylist.txt")
+	pki.writeCRL(t, crlPath)
+	writeFileWithNewModTime(t, denyPath, []byte("# empty\n"))
+
+	c, err := NewClientCertAuth(ClientCertConfig{CAFile: pki.caPath, CRLFile: crlPath, DenylistFile: denyPath})
+	if err != nil {
+		t.Fatalf("NewClientCertAuth() error = %v", err)
+	}
+	for _, cert := range []*x509.Certificate{alice, bob, carol} {
+		if c.Revoked(cert) {
+			t.Errorf("%s should not be revoked initially", cert.Subject.CommonName)
+		}
+	}
+
+	// CRL と拒否リスト（シリアル番号・フィンガープリント）を更新すると再起動なしに反映される
+	pki.writeCRL(t, crlPath, 100)
+	fp := strings.TrimPrefix(fingerprintKey(carol), "sha256:")
+	writeFileWithNewModTime(t, denyPath, []byte("c8 # bob\n"+strings.ToUpper(fp)+"\n"))
+
+	tests := []struct {
+		cert        *x509.Certificate
+		wantRevoked bool
+	}{
+		{cert: alice, wantRevoked: true},
+		{cert: bob, wantRevoked: true},
+		{cert: carol, wantRevoked: true},
+		{cert: pki.issue(t, "dave", 400).Leaf, wantRevoked: false},
+	}
+	for _, tt := range tests {
+		if got := c.Revoked(tt.cert); got != tt.wantRevoked {
+			t.Errorf("Revoked(%s) = %v, want %v", tt.cert.Subject.CommonName, got, tt.wantRevoked)
+		}
+	}
+
+	// 不正な CRL に差し替えても直前の一覧で判定を続ける
+	writeFileWithNewModTime(t, crlPath, []byte("broken"))
+	if !c.Revoked(alice) {
+		t.Error("Revoked() should keep the previous list when reload fails")
+	}
+}
+
+func TestNewClientCertAuth_Validation(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newTestPKI(t)
+	dir := t.TempDir()
+
+	foreignCRL := filepath.Join(dir, "foreign.crl")
+	other.writeCRL(t, foreignCRL, 1)
+
+	tests := []struct {
+		name string
+		cfg  ClientCertConfig
+	}{
+		{name: "CA なし", cfg: ClientCertConfig{}},
+		{name: "存在しない CA", cfg: ClientCertConfig{CAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "他の CA が署名した CRL", cfg: ClientCertConfig{CAFile: pki.caPath, CRLFile: foreignCRL}},
+		{name: "存在しない拒否リスト", cfg: ClientCertConfig{CAFile: pki.caPath, DenylistFile: filepath.Join(dir, "missing.txt")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClientCertAuth(tt.cfg); err == nil {
+				t.Error("NewClientCertAuth() should fail")
+			}
+		})
+	}
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	denyPath := filepath.Join(t.TempDir(), "denylist.txt")
+	writeFileWithNewModTime(t, denyPath, []byte("c8\n"))
+
+	clientCerts, err := NewClientCertAuth(ClientCertConfig{CAFile: pki.caPath, DenylistFile: denyPath})
+	if err != nil {
+		t.Fatalf("NewClientCertAuth() error = %v", err)
+	}
+
+	users, _ := NewUserStore("")
+	if _, err := users.Put(User{Name: "viewer-phone", Role: RoleViewer}, "pw"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	srv := NewServer(Options{
+		Tmux:        &configurableMock{},
+		Token:       "test-token",
+		Users:       users,
+		ClientCerts: clientCerts,
+		BasePath:    "/",
+	})
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.TLS = clientCerts.TLSConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		tr := ts.Client().Transport.(*http.Transport).Clone()
+		tr.TLSClientConfig.Certificates = certs
+		return &http.Client{Transport: tr}
+	}
+	other := newTestPKI(t)
+
+	tests := []struct {
+		name       string
+		client     *http.Client
+		method     string
+		wantErr    bool
+		wantStatus int
+	}{
+		{name: "証明書なし: ハンドシェイク失敗", client: client(), method: http.MethodGet, wantErr: true},
+		{name: "他の CA の証明書: ハンドシェイク失敗", client: client(other.issue(t, "mallory", 100)), method: http.MethodGet, wantErr: true},
+		{name: "拒否リストの証明書: ハンドシェイク失敗", client: client(pki.issue(t, "bob", 200)), method: http.MethodGet, wantErr: true},
+		{name: "有効な証明書: トークンなしで 200", client: client(pki.issue(t, "alice", 100)), method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "viewer ユーザーに対応する証明書は POST 不可: 403", client: client(pki.issue(t, "viewer-phone", 300)), method: http.MethodPost, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+"/api/sessions", strings.NewReader(`{"name":"x"}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := tt.client.Do(req)
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("request should fail, got status %d", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request error = %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/lsp"
+	"github.com/tjst-t/palmux/internal/tmux"
+)
+
+// イベントストリーム（GET /api/events）で配信するイベントの種類。
+const (
+	EventSessionCreated    = "session.created"
+	EventSessionClosed     = "session.closed"
+	EventSessionRenamed    = "session.renamed"
+	EventWindowCreated     = "window.created"
+	EventWindowClosed      = "window.closed"
+	EventWindowRenamed     = "window.renamed"
+	EventNotificationSet   = "notification.set"
+	EventNotificationClear = "notification.clear"
+	EventConnectionOpen    = "connection.open"
+	EventConnectionClose   = "connection.close"
+	EventCloneProgress     = "clone.progress"
+	EventLSPStatus         = "lsp.status"
+)
+
+// serverEventTypes は配信するイベントの種類の一覧（フィルタの検証に使用する）。
+var serverEventTypes = []string{
+	EventSessionCreated, EventSessionClosed, EventSessionRenamed,
+	EventWindowCreated, EventWindowClosed, EventWindowRenamed,
+	EventNotificationSet, EventNotificationClear,
+	EventConnectionOpen, EventConnectionClose,
+	EventCloneProgress, EventLSPStatus,
+}
+
+// クローンの進捗（cloneProgress.Status）。
+const (
+	CloneStarted = "started"
+	CloneDone    = "done"
+	CloneFailed  = "failed"
+)
+
+// ServerEvent はイベントストリームで配信するイベント。種類ごとに使うフィールドだけを設定する。
+type ServerEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Session string    `json:"session,omitempty"`  // 対象のセッション名（session.renamed では変更後の名前、notification.* では変更があったセッション）
+	OldName string    `json:"old_name,omitempty"` // session.renamed・window.renamed の変更前の名前
+	Window  *int      `json:"window,omitempty"`   // window.* のウィンドウ番号
+	Name    string    `json:"name,omitempty"`     // window.* のウィンドウ名
+
+	// notification.* の変更後の通知一覧（通知が残っていない場合は省略）
+	Notifications []Notification  `json:"notifications,omitempty"`
+	Connection    *connectionInfo `json:"connection,omitempty"` // connection.* の接続
+	Clone         *cloneProgress  `json:"clone,omitempty"`      // clone.progress の進捗
+	LSP           *lsp.ServerInfo `json:"lsp,omitempty"`        // lsp.status の言語サーバー
+
+	// clone.progress・lsp.status のアクセス制御用（配信しない）
+	project string // クローンしたプロジェクト（完了前は不明なので空）・言語サーバーのプロジェクト
+	actor   string // クローンを開始した主体の識別名
+}
+
+// cloneProgress は ghq リポジトリのクローンの進捗。
+type cloneProgress struct {
+	URL    string        `json:"url"`
+	Status string        `json:"status"`          // CloneStarted、CloneDone、CloneFailed
+	Repo   *tmux.GhqRepo `json:"repo,omitempty"`  // 完了時のリポジトリ
+	Error  string        `json:"error,omitempty"` // 失敗時のエラー
+}
+
+// eventBus はサーバー内で発生したイベント（接続・クローン・セッション・ウィンドウ・言語サーバー）を購読者に配信する。
+// 通知のイベントは各ストリームが NotificationStore を直接購読して生成する。
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[chan ServerEvent]struct{}
+}
+
+// newEventBus は eventBus を生成する。
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[chan ServerEvent]struct{})}
+}
+
+// Subscribe はイベントチャネルを作成し、購読者として登録する。
+func (b *eventBus) Subscribe() chan ServerEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan ServerEvent, 64)
+	b.subs[ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe は購読者を解除し、チャネルをクローズする。
+func (b *eventBus) Unsubscribe(ch chan ServerEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Publish は全購読者にイベントを送信する。b が nil の場合は何もしない。
+// チャネルが一杯の購読者には送らない（遅いクライアントでサーバーを止めない）。
+func (b *eventBus) Publish(ev ServerEvent) {
+	if b == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// eventFilter はイベントストリームの購読条件。
+type eventFilter struct {
+	Types    []string `json:"types"`    // 種類（"session.created" または "session" のような分類）。空の場合は全種類
+	Sessions []string `json:"sessions"` // セッション名。空の場合は全セッション（セッションに関係しないイベントは常に対象）
+}
+
+// newEventFilter は購読条件を検証して eventFilter を生成する。空の要素は無視する。
+func newEventFilter(types, sessions []string) (*eventFilter, error) {
+	f := &eventFilter{Types: []string{}, Sessions: []string{}}
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !slices.ContainsFunc(serverEventTypes, func(known string) bool {
+			return known == t || strings.HasPrefix(known, t+".")
+		}) {
+			return nil, fmt.Errorf("unknown event type: %s", t)
+		}
+		f.Types = append(f.Types, t)
+	}
+	for _, s := range sessions {
+		if s = strings.TrimSpace(s); s != "" {
+			f.Sessions = append(f.Sessions, s)
+		}
+	}
+	return f, nil
+}
+
+// wantsType は種類 typ のイベントが購読対象かどうかを返す。
+func (f *eventFilter) wantsType(typ string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(f.Types, func(t string) bool {
+		return t == typ || strings.HasPrefix(typ, t+".")
+	})
+}
+
+// wantsSession はセッション names（リネームの場合は変更前後）のイベントが購読対象かどうかを返す。
+func (f *eventFilter) wantsSession(names ...string) bool {
+	if len(f.Sessions) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(names, func(name string) bool {
+		return name != "" && slices.Contains(f.Sessions, name)
+	})
+}
+
+// visibleEvent は ev を購読条件 f と Principal p のアクセス範囲に絞り込む。
+// 配信しない場合は false を返す。通知のイベントは変更があったセッションが見える（購読している）場合にだけ配信し、
+// 一覧は見えるセッションの通知だけに絞る（一覧が空になるのは、見えるセッションの最後の通知が消えた場合だけ）。
+func visibleEvent(p Principal, f *eventFilter, ev ServerEvent) (ServerEvent, bool) {
+	if !f.wantsType(ev.Type) {
+		return ev, false
+	}
+
+	switch ev.Type {
+	case EventNotificationSet, EventNotificationClear:
+		if !p.CanAccessSession(ev.Session) || !f.wantsSession(ev.Session) {
+			return ev, false
+		}
+		var visible []Notification
+		for _, n := range ev.Notifications {
+			if p.CanAccessSession(n.Session) && f.wantsSession(n.Session) {
+				visible = append(visible, n)
+			}
+		}
+		ev.Notifications = visible
+		return ev, true
+	case EventCloneProgress:
+		return ev, p.Name == ev.actor || p.CanAccessProject(ev.project)
+	case EventLSPStatus:
+		return ev, p.CanAccessProject(ev.project)
+	}
+
+	// セッション・ウィンドウ・接続のイベント（リネームはどちらかの名前が見えれば配信する）
+	names := []string{ev.Session}
+	if ev.Type == EventSessionRenamed {
+		names = append(names, ev.OldName)
+	}
+	if !slices.ContainsFunc(names, func(name string) bool { return name != "" && p.CanAccessSession(name) }) {
+		return ev, false
+	}
+	return ev, f.wantsSession(names...)
+}
+
+// tmuxSnapshot はイベントを検出するためのセッション・ウィンドウの一覧（キーはセッション名）。
+type tmuxSnapshot map[string]sessionSnapshot
+
+// sessionSnapshot は 1 セッションの作成日時とウィンドウ名（キーはウィンドウ番号）。
+type sessionSnapshot struct {
+	created time.Time
+	windows map[int]string
+}
+
+// snapshotTmux は現在のセッション・ウィンドウの一覧を取得する。
+// 一覧の取得後に閉じられたセッションは含めない。
+func (s *Server) snapshotTmux() (tmuxSnapshot, error) {
+	sessions, err := s.tmux.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	snap := make(tmuxSnapshot, len(sessions))
+	for _, sess := range sessions {
+		windows, err := s.tmux.ListWindows(sess.Name)
+		if err != nil {
+			continue
+		}
+		ss := sessionSnapshot{created: sess.Created, windows: make(map[int]string, len(windows))}
+		for _, w := range windows {
+			ss.windows[w.Index] = w.Name
+		}
+		snap[sess.Name] = ss
+	}
+	return snap, nil
+}
+
+// diffTmuxSnapshot は old から cur への変化をイベントの列にする。
+// tmux のセッション名以外に安定した識別子を使わないため、消えたセッションと現れたセッションの作成日時が
+// 1 対 1 で一致する場合はリネームとみなす。作成・終了したセッションのウィンドウのイベントは出さない。
+func diffTmuxSnapshot(old, cur tmuxSnapshot) []ServerEvent {
+	var removed, added []string
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	for name := range cur {
+		if _, ok := old[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+
+	now := time.Now()
+	var events []ServerEvent
+
+	// セッションの対応（変更前の名前 → 変更後の名前）。リネームしていないセッションは同じ名前
+	renamed := make(map[string]string)
+	for _, r := range removed {
+		var match []string
+		for _, a := range added {
+			if !old[r].created.IsZero() && cur[a].created.Equal(old[r].created) {
+				match = append(match, a)
+			}
+		}
+		if len(match) != 1 {
+			continue
+		}
+		// 変更後の名前の候補が他のセッションとも一致する場合は判断しない
+		unique := true
+		for _, other := range removed {
+			if other != r && old[other].created.Equal(cur[match[0]].created) {
+				unique = false
+			}
+		}
+		if unique {
+			renamed[r] = match[0]
+		}
+	}
+	renamedTo := make(map[string]bool)
+	for _, a := range renamed {
+		renamedTo[a] = true
+	}
+
+	for _, r := range removed {
+		if a, ok := renamed[r]; ok {
+			events = append(events, ServerEvent{Type: EventSessionRenamed, Time: now, Session: a, OldName: r})
+		} else {
+			events = append(events, ServerEvent{Type: EventSessionClosed, Time: now, Session: r})
+		}
+	}
+	for _, a := range added {
+		if !renamedTo[a] {
+			events = append(events, ServerEvent{Type: EventSessionCreated, Time: now, Session: a})
+		}
+	}
+
+	// 存続したセッション（リネームを含む）のウィンドウを比較する
+	var names []string
+	for name := range old {
+		if _, ok := cur[name]; ok {
+			names = append(names, name)
+		} else if _, ok := renamed[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		session := name
+		if a, ok := renamed[name]; ok {
+			session = a
+		}
+		events = append(events, diffWindows(session, old[name].windows, cur[session].windows, now)...)
+	}
+	return events
+}
+
+// diffWindows は 1 セッションのウィンドウの変化をウィンドウ番号順のイベントの列にする。
+func diffWindows(session string, old, cur map[int]string, now time.Time) []ServerEvent {
+	indexes := make([]int, 0, len(old)+len(cur))
+	for i := range old {
+		indexes = append(indexes, i)
+	}
+	for i := range cur {
+		if _, ok := old[i]; !ok {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+
+	var events []ServerEvent
+	for _, i := range indexes {
+		oldName, wasOpen := old[i]
+		name, isOpen := cur[i]
+		ev := ServerEvent{Time: now, Session: session, Window: &i, Name: name}
+		switch {
+		case !wasOpen:
+			ev.Type = EventWindowCreated
+		case !isOpen:
+			ev.Type = EventWindowClosed
+			ev.Name = oldName
+		case name != oldName:
+			ev.Type = EventWindowRenamed
+			ev.OldName = oldName
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// lspKey は言語サーバーを識別するキー（言語とルートディレクトリ）を返す。
+func lspKey(info lsp.ServerInfo) string {
+	return info.Language + "\x00" + info.RootDir
+}
+
+// diffLSPStatus は言語サーバーの状態の変化を lsp.status イベントの列にする。
+// 一覧から消えた言語サーバーは stopped として通知する。
+func diffLSPStatus(old, cur []lsp.ServerInfo) []ServerEvent {
+	prev := make(map[string]lsp.ServerInfo, len(old))
+	for _, info := range old {
+		prev[lspKey(info)] = info
+	}
+
+	now := time.Now()
+	var events []ServerEvent
+	for _, info := range cur {
+		p, ok := prev[lspKey(info)]
+		delete(prev, lspKey(info))
+		if ok && p.Status == info.Status {
+			continue
+		}
+		events = append(events, ServerEvent{Type: EventLSPStatus, Time: now, LSP: &info})
+	}
+
+	var gone []lsp.ServerInfo
+	for _, info := range prev {
+		gone = append(gone, info)
+	}
+	sort.Slice(gone, func(i, j int) bool { return lspKey(gone[i]) < lspKey(gone[j]) })
+	for _, info := range gone {
+		if info.Status == lsp.StatusStopped {
+			continue
+		}
+		info.Status = lsp.StatusStopped
+		events = append(events, ServerEvent{Type: EventLSPStatus, Time: now, LSP: &info})
+	}
+	return events
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/lsp"
+)
+
+// formatEvents はイベントの列を比較しやすい文字列にする。
+func formatEvents(events []ServerEvent) string {
+	var parts []string
+	for _, ev := range events {
+		s := ev.Type + " " + ev.Session
+		if ev.OldName != "" {
+			s += " old=" + ev.OldName
+		}
+		if ev.Window != nil {
+			s += fmt.Sprintf(" %d:%s", *ev.Window, ev.Name)
+		}
+		if ev.LSP != nil {
+			s += fmt.Sprintf(" %s %s", ev.LSP.Language, ev.LSP.Status)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "|")
+}
+
+func TestDiffTmuxSnapshot(t *testing.T) {
+	t1 := time.Unix(1700000000, 0)
+	t2 := time.Unix(1700000100, 0)
+	sess := func(created time.Time, windows ...string) sessionSnapshot {
+		ss := sessionSnapshot{created: created, windows: map[int]string{}}
+		for i, name := range windows {
+			if name != "" {
+				ss.windows[i] = name
+			}
+		}
+		return ss
+	}
+
+	tests := []struct {
+		name string
+		old  tmuxSnapshot
+		cur  tmuxSnapshot
+		want string
+	}{
+		{
+			name: "変化なし",
+			old:  tmuxSnapshot{"main": sess(t1, "bash")},
+			cur:  tmuxSnapshot{"main": sess(t1, "bash")},
+			want: "",
+		},
+		{
+			name: "セッションの作成と終了",
+			old:  tmuxSnapshot{"main": sess(t1, "bash")},
+			cur:  tmuxSnapshot{"dev": sess(t2, "bash")},
+			want: "session.closed main|session.created dev",
+		},
+		{
+			name: "作成日時の一致するセッションはリネーム",
+			old:  tmuxSnapshot{"main": sess(t1, "bash", "vim")},
+			cur:  tmuxSnapshot{"work": sess(t1, "bash", "htop")},
+			want: "session.renamed work old=main|window.renamed work old=vim 1:htop",
+		},
+		{
+			name: "作成日時の一致するセッションが複数ある場合はリネームとみなさない",
+			old:  tmuxSnapshot{"a": sess(t1, "bash"), "b": sess(t1, "bash")},
+			cur:  tmuxSnapshot{"c": sess(t1, "bash"), "d": sess(t1, "bash")},
+			want: "session.closed a|session.closed b|session.created c|session.created d",
+		},
+		{
+			name: "ウィンドウの作成・終了・リネーム",
+			old:  tmuxSnapshot{"main": sess(t1, "bash", "vim", "")},
+			cur:  tmuxSnapshot{"main": sess(t1, "zsh", "", "htop")},
+			want: "window.renamed main old=bash 0:zsh|window.closed main 1:vim|window.created main 2:htop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatEvents(diffTmuxSnapshot(tt.old, tt.cur)); got != tt.want {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLSPStatus(t *testing.T) {
+	gopls := lsp.ServerInfo{Language: "go", Status: lsp.StatusStarting, Server: "gopls", RootDir: "/repo"}
+	ready := gopls
+	ready.Status = lsp.StatusReady
+	pyright := lsp.ServerInfo{Language: "python", Status: lsp.StatusReady, Server: "pyright", RootDir: "/repo"}
+
+	tests := []struct {
+		name string
+		old  []lsp.ServerInfo
+		cur  []lsp.ServerInfo
+		want string
+	}{
+		{name: "変化なし", old: []lsp.ServerInfo{gopls}, cur: []lsp.ServerInfo{gopls}, want: ""},
+		{name: "起動", old: nil, cur: []lsp.ServerInfo{gopls}, want: "lsp.status  go starting"},
+		{name: "状態の変化", old: []lsp.ServerInfo{gopls}, cur: []lsp.ServerInfo{ready}, want: "lsp.status  go ready"},
+		{name: "一覧から消えた場合は stopped", old: []lsp.ServerInfo{ready, pyright}, cur: []lsp.ServerInfo{ready}, want: "lsp.status  python stopped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatEvents(diffLSPStatus(tt.old, tt.cur)); got != tt.want {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEventFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   []string
+		wantErr bool
+	}{
+		{name: "指定なし", types: nil},
+		{name: "種類と分類", types: []string{"session.created", "window", " notification "}},
+		{name: "不明な種類", types: []string{"session.deleted"}, wantErr: true},
+		{name: "分類の前方一致ではない", types: []string{"sess"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newEventFilter(tt.types, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVisibleEvent(t *testing.T) {
+	admin := Principal{Name: "master", Role: RoleAdmin}
+	dev := Principal{Name: "alice", Role: RoleOperator, user: &User{Name: "alice", Role: RoleOperator, Sessions: []string{"dev-*"}}}
+	proj := Principal{Name: "carol", Role: RoleOperator, user: &User{Name: "carol", Role: RoleOperator, Projects: []string{"palmux"}}}
+	window := 1
+
+	tests := []struct {
+		name     string
+		p        Principal
+		types    []string
+		sessions []string
+		ev       ServerEvent
+		want     bool
+	}{
+		{name: "条件なし", p: admin, ev: ServerEvent{Type: EventSessionCreated, Session: "main"}, want: true},
+		{name: "分類で絞り込み", p: admin, types: []string{"window"}, ev: ServerEvent{Type: EventWindowCreated, Session: "main", Window: &window}, want: true},
+		{name: "分類に含まれない種類", p: admin, types: []string{"window"}, ev: ServerEvent{Type: EventSessionCreated, Session: "main"}, want: false},
+		{name: "セッションで絞り込み", p: admin, sessions: []string{"dev"}, ev: ServerEvent{Type: EventConnectionOpen, Session: "main"}, want: false},
+		{name: "リネームは変更前の名前でも一致", p: admin, sessions: []string{"main"}, ev: ServerEvent{Type: EventSessionRenamed, Session: "work", OldName: "main"}, want: true},
+		{name: "アクセスできないセッション", p: dev, ev: ServerEvent{Type: EventWindowClosed, Session: "main", Window: &window}, want: false},
+		{name: "アクセスできるセッション", p: dev, ev: ServerEvent{Type: EventWindowClosed, Session: "dev-api", Window: &window}, want: true},
+		{name: "セッションに関係しないイベントはセッションで絞り込まない", p: admin, sessions: []string{"dev"}, ev: ServerEvent{Type: EventLSPStatus}, want: true},
+		{name: "アクセスできるプロジェクトの言語サーバー", p: proj, ev: ServerEvent{Type: EventLSPStatus, LSP: &lsp.ServerInfo{RootDir: "/ghq/github.com/tjst-t/palmux"}, project: "palmux"}, want: true},
+		{name: "アクセスできないプロジェクトの言語サーバー", p: proj, ev: ServerEvent{Type: EventLSPStatus, LSP: &lsp.ServerInfo{RootDir: "/ghq/github.com/acme/secret"}, project: "secret"}, want: false},
+		{name: "プロジェクトが不明な言語サーバーは制限されたユーザーに配信しない", p: dev, ev: ServerEvent{Type: EventLSPStatus, LSP: &lsp.ServerInfo{RootDir: "/tmp/x"}}, want: false},
+		{name: "完了前のクローンは開始した主体のみ", p: dev, ev: ServerEvent{Type: EventCloneProgress, actor: "bob"}, want: false},
+		{name: "自分のクローン", p: dev, ev: ServerEvent{Type: EventCloneProgress, actor: "alice"}, want: true},
+		{name: "トークンは全てのクローン", p: admin, ev: ServerEvent{Type: EventCloneProgress, actor: "alice"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newEventFilter(tt.types, tt.sessions)
+			if err != nil {
+				t.Fatalf("newEventFilter: %v", err)
+			}
+			if _, got := visibleEvent(tt.p, f, tt.ev); got != tt.want {
+				t.Errorf("visible = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisibleEvent_Notifications(t *testing.T) {
+	dev := Principal{Name: "alice", Role: RoleOperator, user: &User{Name: "alice", Role: RoleOperator, Sessions: []string{"dev-*"}}}
+	both := []Notification{
+		{Session: "dev-api", WindowIndex: 0, Type: "bell"},
+		{Session: "main", WindowIndex: 1, Type: "bell"},
+	}
+	mainOnly := []Notification{{Session: "main", WindowIndex: 1, Type: "bell"}}
+
+	tests := []struct {
+		name     string
+		sessions []string
+		ev       ServerEvent
+		want     []string // 配信される通知のセッション（nil は配信しない）
+	}{
+		{name: "見えるセッションの通知だけに絞る", ev: ServerEvent{Type: EventNotificationSet, Session: "dev-api", Notifications: both}, want: []string{"dev-api"}},
+		{name: "見えないセッションの変更は配信しない", ev: ServerEvent{Type: EventNotificationSet, Session: "main", Notifications: both}},
+		{name: "見えないセッションの通知が消えても配信しない", ev: ServerEvent{Type: EventNotificationClear, Session: "main", Notifications: nil}},
+		{name: "見えるセッションの最後の通知が消えたら空の一覧を配信する", ev: ServerEvent{Type: EventNotificationClear, Session: "dev-api", Notifications: mainOnly}, want: []string{}},
+		{name: "購読していないセッションの変更は配信しない", sessions: []string{"dev-web"}, ev: ServerEvent{Type: EventNotificationSet, Session: "dev-api", Notifications: both}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _ := newEventFilter(nil, tt.sessions)
+			orig := len(tt.ev.Notifications)
+			got, ok := visibleEvent(dev, f, tt.ev)
+			if ok != (tt.want != nil) {
+				t.Fatalf("visible = %v, want %v", ok, tt.want != nil)
+			}
+			if !ok {
+				return
+			}
+			var sessions []string
+			for _, n := range got.Notifications {
+				sessions = append(sessions, n.Session)
+			}
+			if !slices.Equal(sessions, tt.want) {
+				t.Errorf("notifications = %v, want %v", sessions, tt.want)
+			}
+			if len(tt.ev.Notifications) != orig {
+				t.Errorf("original event was modified: %+v", tt.ev.Notifications)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // crypto.SHA256 の登録
+	_ "crypto/sha512" // crypto.SHA384 / crypto.SHA512 の登録
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJWTHeader は JWT を受け取るデフォルトのヘッダー名（Cloudflare Access）。
+const defaultJWTHeader = "Cf-Access-Jwt-Assertion"
+
+// defaultJWTUserClaim はユーザー識別子として使うデフォルトのクレーム名。
+const defaultJWTUserClaim = "email"
+
+// jwtClockSkew は exp / nbf / iat の検証で許容する時計のずれ。
+const jwtClockSkew = time.Minute
+
+// jwksMinRefreshInterval は未知の kid を受け取った際に JWKS を再取得する最小間隔。
+// 不正なトークンを大量に送られても JWKS エンドポイントに負荷をかけないよう間引く。
+var jwksMinRefreshInterval = time.Minute
+
+// JWTConfig は JWTAuth の設定。
+type JWTConfig struct {
+	Header    string // JWT を受け取るヘッダー名（空の場合は defaultJWTHeader）
+	JWKS      string // JWKS のファイルパスまたは http(s) URL
+	Audience  string // 期待する aud クレーム（必須）
+	Issuer    string // 期待する iss クレーム（空の場合は検査しない）
+	UserClaim string // ユーザー識別子とするクレーム（空の場合は "email"、なければ "sub" を使う）
+}
+
+// JWTAuth はリバースプロキシ（Cloudflare Access 等）が付与する署名付き JWT を検証する。
+// 署名鍵は JWKS（ファイルまたは URL）から読み込み、未知の kid を受け取ると再読み込みする。
+type JWTAuth struct {
+	header    string
+	source    string
+	audience  string
+	issuer    string
+	userClaim string
+	client    *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey // key: kid
+	lastFetched time.Time
+}
+
+// NewJWTAuth は JWTAuth を生成する。
+// JWKS がファイルの場合はこの時点で読み込み、不正であればエラーを返す。
+// URL の場合は最初の検証時に取得する。
+func NewJWTAuth(cfg JWTConfig) (*JWTAuth, error) {
+	if cfg.JWKS == "" {
+		return nil, fmt.Errorf("jwks source is required")
+	}
+	if cfg.Audience == "" {
+		return nil, fmt.Errorf("jwt audience is required")
+	}
+	if cfg.Header == "" {
+		cfg.Header = defaultJWTHeader
+	}
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = defaultJWTUserClaim
+	}
+
+	j := &JWTAuth{
+		header:    cfg.Header,
+		source:    cfg.JWKS,
+		audience:  cfg.Audience,
+		issuer:    cfg.Issuer,
+		userClaim: cfg.UserClaim,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		keys:      make(map[string]crypto.PublicKey),
+	}
+	if !j.isRemote() {
+		if err := j.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// Header は JWT を受け取るヘッダー名を返す。
+func (j *JWTAuth) Header() string {
+	return j.header
+}
+
+// isRemote は JWKS の取得元が URL かどうかを返す。
+func (j *JWTAuth) isRemote() bool {
+	return strings.HasPrefix(j.source, "https://") || strings.HasPrefix(j.source, "http://")
+}
+
+// Verify はトークンの署名・有効期限・aud・iss を検証し、ユーザー識別子を返す。
+func (j *JWTAuth) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed jwt")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", fmt.Errorf("decode jwt header: %w", err)
+	}
+
+	key, err := j.key(header.Kid)
+	if err != nil {
+		return "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("decode jwt signature: %w", err)
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return "", err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("decode jwt claims: %w", err)
+	}
+	if err := j.checkClaims(claims, time.Now()); err != nil {
+		return "", err
+	}
+
+	user, _ := claims[j.userClaim].(string)
+	if user == "" {
+		user, _ = claims["sub"].(string)
+	}
+	if user == "" {
+		return "", fmt.Errorf("jwt has no %q or \"sub\" claim", j.userClaim)
+	}
+	return user, nil
+}
+
+// checkClaims は登録済みクレーム（exp / nbf / aud / iss）を検証する。
+func (j *JWTAuth) checkClaims(claims map[string]interface{}, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("jwt has no exp claim")
+	}
+	if now.Add(-jwtClockSkew).Unix() >= int64(exp) {
+		return errors.New("jwt expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtClockSkew).Unix() < int64(nbf) {
+		return errors.New("jwt not yet valid")
+	}
+
+	audOK := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audOK = aud == j.audience
+	case []interface{}:
+		for _, a := range aud {
+			if s, _ := a.(string); s == j.audience {
+				audOK = true
+				break
+			}
+		}
+	}
+	if !audOK {
+		return errors.New("jwt audience mismatch")
+	}
+
+	if j.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.issuer {
+			return errors.New("jwt issuer mismatch")
+		}
+	}
+	return nil
+}
+
+// key は kid に対応する公開鍵を返す。
+// 見つからない場合は jwksMinRefreshInterval 以上経過していれば JWKS を再読み込みする（鍵ローテーション対応）。
+func (j *JWTAuth) key(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key, ok := j.keys[kid]
+	stale := time.Since(j.lastFetched) >= jwksMinRefreshInterval
+	j.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown jwt key id %q", kid)
+	}
+
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown jwt key id %q", kid)
+}
+
+// refresh は JWKS を読み込み直して鍵を差し替える。
+func (j *JWTAuth) refresh() error {
+	j.mu.Lock()
+	j.lastFetched = time.Now()
+	j.mu.Unlock()
+
+	data, err := j.fetch()
+	if err != nil {
+		return fmt.Errorf("load jwks: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("load jwks %s: %w", j.source, err)
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+	return nil
+}
+
+// fetch は JWKS の JSON をファイルまたは URL から取得する。
+func (j *JWTAuth) fetch() ([]byte, error) {
+	if !j.isRemote() {
+		return os.ReadFile(j.source)
+	}
+
+	resp, err := j.client.Get(j.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", j.source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// jwk は JWKS 内の個々の鍵の JSON 表現（RSA / EC のみ対応）。
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS は JWKS の JSON を kid から公開鍵へのマップに変換する。
+// 署名用途以外（use が "sig" 以外）の鍵と未対応の鍵種別は無視する。
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey は JWK を公開鍵に変換する。未対応の鍵種別の場合は nil を返す。
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode e: %w", err)
+		}
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decode y: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, nil
+}
+
+// verifyJWTSignature は alg に従って署名を検証する。
+// 対応アルゴリズムは RS256/384/512 と ES256/384/512（"none" や HMAC は受け付けない）。
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported jwt alg %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	if hash == 0 {
+		return fmt.Errorf("unsupported jwt alg %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt alg %q does not match key type", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt alg %q does not match key type", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid jwt signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported jwt alg %q", alg)
+}
+
+// decodeJWTPart は base64url エンコードされた JWT のヘッダー・ペイロードを JSON としてデコードする。
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testJWTKeys はテスト用にローカル生成した署名鍵のセット。
+// kid は "rsa<gen>" と "ec<gen>"。
+type testJWTKeys struct {
+	gen string
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestJWTKeys(t *testing.T, gen string) *testJWTKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	return &testJWTKeys{gen: gen, rsa: rsaKey, ec: ecKey}
+}
+
+// jwks は鍵セットを JWKS の JSON として返す。
+func (k *testJWTKeys) jwks() []byte {
+	b64 := base64.RawURLEncoding.EncodeToString
+	data, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa" + k.gen, "use": "sig",
+				"n": b64(k.rsa.N.Bytes()),
+				"e": b64(big.NewInt(int64(k.rsa.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec" + k.gen, "crv": "P-256",
+				"x": b64(k.ec.X.FillBytes(make([]byte, 32))),
+				"y": b64(k.ec.Y.FillBytes(make([]byte, 32))),
+			},
+		},
+	})
+	return data
+}
+
+// sign は claims を指定アルゴリズム（RS256 / ES256）で署名した JWT を返す。
+func (k *testJWTKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("sign rsa: %v", err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatalf("sign ec: %v", err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// validClaims は検証を通過するクレームを返す。
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"aud":   []string{"palmux-aud"},
+		"iss":   "https://team.cloudflareaccess.com",
+		"email": "alice@example.com",
+		"sub":   "user-123",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+	}
+}
+
+// newTestJWTAuth は JWKS をファイルに書き出して JWTAuth を生成するヘルパー。
+func newTestJWTAuth(t *testing.T, keys *testJWTKeys) *JWTAuth {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, keys.jwks(), 0600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	j, err := NewJWTAuth(JWTConfig{
+		JWKS:     path,
+		Audience: "palmux-aud",
+		Issuer:   "https://team.cloudflareaccess.com",
+	})
+	if err != nil {
+		t.Fatalf("NewJWTAuth() error = %v", err)
+	}
+	return j
+}
+
+func TestJWTAuth_Verify(t *testing.T) {
+	keys := newTestJWTKeys(t, "1")
+	j := newTestJWTAuth(t, keys)
+
+	with := func(key string, value interface{}) map[string]interface{} {
+		c := validClaims()
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantUser string
+		wantErr  bool
+	}{
+		{name: "RS256: 正常系", token: keys.sign(t, "RS256", "rsa1", validClaims()), wantUser: "alice@example.com"},
+		{name: "ES256: 正常系", token: keys.sign(t, "ES256", "ec1", validClaims()), wantUser: "alice@example.com"},
+		{name: "aud が文字列", token: keys.sign(t, "RS256", "rsa1", with("aud", "palmux-aud")), wantUser: "alice@example.com"},
+		{name: "email がなければ sub", token: keys.sign(t, "RS256", "rsa1", with("email", nil)), wantUser: "user-123"},
+		{name: "aud 不一致", token: keys.sign(t, "RS256", "rsa1", with("aud", "other")), wantErr: true},
+		{name: "iss 不一致", token: keys.sign(t, "RS256", "rsa1", with("iss", "https://evil.example.com")), wantErr: true},
+		{name: "期限切れ", token: keys.sign(t, "RS256", "rsa1", with("exp", time.Now().Add(-time.Hour).Unix())), wantErr: true},
+		{name: "exp なし", token: keys.sign(t, "RS256", "rsa1", with("exp", nil)), wantErr: true},
+		{name: "nbf が未来", token: keys.sign(t, "RS256", "rsa1", with("nbf", time.Now().Add(time.Hour).Unix())), wantErr: true},
+		{name: "未知の kid", token: keys.sign(t, "RS256", "unknown", validClaims()), wantErr: true},
+		{name: "alg と鍵種別の不一致", token: keys.sign(t, "ES256", "rsa1", validClaims()), wantErr: true},
+		{name: "alg none", token: keys.sign(t, "none", "rsa1", validClaims()), wantErr: true},
+		{name: "改ざんされたペイロード", token: tamperJWT(keys.sign(t, "RS256", "rsa1", validClaims())), wantErr: true},
+		{name: "不正な形式", token: "not-a-jwt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := j.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if user != tt.wantUser {
+				t.Errorf("Verify() user = %q, want %q", user, tt.wantUser)
+			}
+		})
+	}
+}
+
+// tamperJWT は署名を保ったままペイロードの email を書き換える。
+func tamperJWT(token string) string {
+	parts := strings.Split(token, ".")
+	claims := validClaims()
+	claims["email"] = "mallory@example.com"
+	payload, _ := json.Marshal(claims)
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	return strings.Join(parts, ".")
+}
+
+func TestNewJWTAuth_Validation(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte(`{"keys":[]}`), 0600)
+
+	tests := []struct {
+		name string
+		cfg  JWTConfig
+	}{
+		{name: "JWKS なし", cfg: JWTConfig{Audience: "aud"}},
+		{name: "audience なし", cfg: JWTConfig{JWKS: broken}},
+		{name: "存在しないファイル", cfg: JWTConfig{JWKS: filepath.Join(dir, "missing.json"), Audience: "aud"}},
+		{name: "鍵が空", cfg: JWTConfig{JWKS: broken, Audience: "aud"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewJWTAuth(tt.cfg); err == nil {
+				t.Error("NewJWTAuth() should fail")
+			}
+		})
+	}
+}
+
+func TestJWTAuth_RemoteJWKSRotation(t *testing.T) {
+	orig := jwksMinRefreshInterval
+	jwksMinRefreshInterval = 0
+	defer func() { jwksMinRefreshInterval = orig }()
+
+	oldKeys := newTestJWTKeys(t, "1")
+	newKeys := newTestJWTKeys(t, "2")
+	var current atomic.Pointer[testJWTKeys]
+	current.Store(oldKeys)
+	var fetches atomic.Int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(current.Load().jwks())
+	}))
+	defer ts.Close()
+
+	j, err := NewJWTAuth(JWTConfig{JWKS: ts.URL, Audience: "palmux-aud"})
+	if err != nil {
+		t.Fatalf("NewJWTAuth() error = %v", err)
+	}
+
+	if _, err := j.Verify(oldKeys.sign(t, "RS256", "rsa1", validClaims())); err != nil {
+		t.Fatalf("Verify() with initial keys error = %v", err)
+	}
+
+	// 鍵をローテーションすると、未知の kid を受け取った時点で JWKS を再取得する
+	current.Store(newKeys)
+	if _, err := j.Verify(newKeys.sign(t, "ES256", "ec2", validClaims())); err != nil {
+		t.Errorf("Verify() after rotation error = %v", err)
+	}
+	// 再取得後は旧鍵で署名されたトークンを受け付けない
+	if _, err := j.Verify(oldKeys.sign(t, "RS256", "rsa1", validClaims())); err == nil {
+		t.Error("Verify() should reject tokens signed by rotated-out keys")
+	}
+	if got := fetches.Load(); got != 3 {
+		t.Errorf("JWKS fetched %d times, want 2", got)
+	}
+}
+
+func TestAuthMiddleware_JWT(t *testing.T) {
+	keys := newTestJWTKeys(t, "1")
+	jwtAuth := newTestJWTAuth(t, keys)
+
+	users, _ := NewUserStore("")
+	if _, err := users.Put(User{Name: "bob@example.com", Role: RoleViewer}, "pw"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	srv := NewServer(Options{
+		Tmux:     &configurableMock{},
+		Token:    "test-token",
+		Users:    users,
+		JWT:      jwtAuth,
+		BasePath: "/",
+	})
+	handler := srv.Handler()
+
+	bob := validClaims()
+	bob["email"] = "bob@example.com"
+
+	tests := []struct {
+		name       string
+		method     string
+		assertion  string
+		bearer     string
+		wantStatus int
+	}{
+		{name: "有効な JWT: 200", method: http.MethodGet, assertion: keys.sign(t, "RS256", "rsa1", validClaims()), wantStatus: http.StatusOK},
+		{name: "不正な JWT: 401", method: http.MethodGet, assertion: "bogus", wantStatus: http.StatusUnauthorized},
+		{name: "不正な JWT は Bearer があっても 401", method: http.MethodGet, assertion: "bogus", bearer: "test-token", wantStatus: http.StatusUnauthorized},
+		{name: "JWT なしは従来通り Bearer", method: http.MethodGet, bearer: "test-token", wantStatus: http.StatusOK},
+		{name: "viewer ユーザーに対応する JWT は POST 不可: 403", method: http.MethodPost, assertion: keys.sign(t, "RS256", "rsa1", bob), wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/sessions", strings.NewReader(`{"name":"x"}`))
+			if tt.assertion != "" {
+				req.Header.Set("Cf-Access-Jwt-Assertion", tt.assertion)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// unixAddrPrefix は Unix ドメインソケットの待ち受けアドレスの接頭辞（例: "unix:/run/palmux/palmux.sock"）。
+const unixAddrPrefix = "unix:"
+
+// defaultSocketMode は ListenAndServe で作成する Unix ソケットのパーミッション。
+const defaultSocketMode os.FileMode = 0660
+
+// listenFDsStart は systemd のソケットアクティベーションで渡される最初のファイルディスクリプタ番号
+// （SD_LISTEN_FDS_START）。テスト時に上書き可能。
+var listenFDsStart = 3
+
+// Listen は addr で待ち受ける net.Listener を返す。
+// addr が "unix:" で始まる場合は Unix ドメインソケットを作成してパーミッションを socketMode にする。
+// 同じパスに応答のない古いソケットが残っている場合は削除してから作成する。
+// それ以外の場合は TCP（"host:port"）で待ち受ける。
+func Listen(addr string, socketMode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixAddrPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("unix socket path is required")
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod unix socket: %w", err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket は path に接続を受け付けていない古いソケットがあれば削除する。
+// 他のプロセスが待ち受け中の場合や、ソケット以外のファイルがある場合はエラーを返す。
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("unix socket %s is already in use", path)
+	}
+	return os.Remove(path)
+}
+
+// SystemdListeners は systemd のソケットアクティベーション（LISTEN_PID / LISTEN_FDS）で
+// 渡された待ち受けソケットを返す。ソケットアクティベーションでない場合は nil を返す。
+// 子プロセス（tmux 等）に引き継がれないよう、関連する環境変数は削除する。
+func SystemdListeners() ([]net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		// 別のプロセス宛て（親プロセスから環境変数を引き継いだ場合等）
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %q", fds)
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "systemd-socket-"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener は fd を複製するため元の fd は閉じる
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("systemd socket fd %d: %w", fd, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// ListenerAddr は起動メッセージ用に待ち受けアドレスを表示形式にする（Unix ソケットは "unix:" を付ける）。
+func ListenerAddr(ln net.Listener) string {
+	if ln.Addr().Network() == "unix" {
+		return unixAddrPrefix + ln.Addr().String()
+	}
+	return ln.Addr().String()
+}
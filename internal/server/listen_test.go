@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// unixHTTPClient は Unix ソケット経由で接続する HTTP クライアントを返す。
+func unixHTTPClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "palmux.sock")
+
+	ln, err := Listen("unix:"+path, 0600)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want socket with 0600", fi.Mode())
+	}
+	if got := ListenerAddr(ln); got != "unix:"+path {
+		t.Errorf("ListenerAddr() = %q, want %q", got, "unix:"+path)
+	}
+
+	srv, token := newTestServer(&configurableMock{})
+	go srv.Serve(ln)
+	defer srv.Shutdown(context.Background())
+
+	req, _ := http.NewRequest(http.MethodGet, "http://palmux/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := unixHTTPClient(path).Do(req)
+	if err != nil {
+		t.Fatalf("request over unix socket: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestListen_UnixSocketInUseOrStale(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("使用中のソケット", func(t *testing.T) {
+		path := filepath.Join(dir, "busy.sock")
+		ln, err := Listen("unix:"+path, 0660)
+		if err != nil {
+			t.Fatalf("Listen() error = %v", err)
+		}
+		defer ln.Close()
+
+		if _, err := Listen("unix:"+path, 0660); err == nil || !strings.Contains(err.Error(), "already in use") {
+			t.Errorf("second Listen() error = %v, want already in use", err)
+		}
+	})
+
+	t.Run("古いソケットは削除して作り直す", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		// 異常終了を模擬するため、ソケットファイルを残したまま閉じる
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		ln.Close()
+
+		ln, err = Listen("unix:"+path, 0660)
+		if err != nil {
+			t.Fatalf("Listen() over stale socket error = %v", err)
+		}
+		ln.Close()
+	})
+
+	t.Run("ソケット以外のファイル", func(t *testing.T) {
+		path := filepath.Join(dir, "regular")
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Listen("unix:"+path, 0660); err == nil || !strings.Contains(err.Error(), "not a socket") {
+			t.Errorf("Listen() error = %v, want not a socket", err)
+		}
+	})
+}
+
+func TestSystemdListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	// systemd から渡される fd を模擬する（SystemdListeners が閉じるため複製を渡す）
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+
+	origStart := listenFDsStart
+	listenFDsStart = fd
+	defer func() { listenFDsStart = origStart }()
+
+	tests := []struct {
+		name    string
+		pid     string
+		fds     string
+		wantN   int
+		wantErr bool
+	}{
+		{name: "ソケットアクティベーションなし", pid: "", fds: "", wantN: 0},
+		{name: "別プロセス宛て", pid: "1", fds: "1", wantN: 0},
+		{name: "不正な LISTEN_FDS", pid: strconv.Itoa(os.Getpid()), fds: "x", wantErr: true},
+		{name: "1 つのソケット", pid: strconv.Itoa(os.Getpid()), fds: "1", wantN: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+
+			listeners, err := SystemdListeners()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SystemdListeners() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(listeners) != tt.wantN {
+				t.Fatalf("got %d listeners, want %d", len(listeners), tt.wantN)
+			}
+			if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+				t.Error("LISTEN_* environment variables must be unset")
+			}
+			for _, ln := range listeners {
+				if ln.Addr().String() != tcp.Addr().String() {
+					t.Errorf("listener addr = %s, want %s", ln.Addr(), tcp.Addr())
+				}
+				ln.Close()
+			}
+		})
+	}
+}
+
+func TestServer_ServeMultipleListeners(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		addrs = append(addrs, ln.Addr().String())
+		go srv.Serve(ln)
+	}
+
+	for _, addr := range addrs {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/api/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET via %s: %v", addr, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("status via %s = %d, want %d", addr, resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	for _, addr := range addrs {
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			conn.Close()
+			t.Errorf("listener %s still accepting after Shutdown", addr)
+		}
+	}
+}
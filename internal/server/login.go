@@ -0,0 +1,357 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionCookieName はログインセッション cookie の名前。
+const sessionCookieName = "palmux_session"
+
+// defaultSessionTTL はログインセッション cookie のデフォルト有効期間。
+const defaultSessionTTL = 30 * 24 * time.Hour
+
+// sessionClaims はセッション cookie に署名付きで格納するクレーム。
+type sessionClaims struct {
+	Subject   string `json:"sub,omitempty"` // ユーザー名（トークン・パスワードでログインした場合は空）
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// CookieAuth は署名付き HttpOnly セッション cookie の発行と検証を行う。
+// 署名鍵を差し替える（Rotate）と発行済みの全 cookie が無効になるため、
+// 「全デバイスからログアウト」として使用できる。
+type CookieAuth struct {
+	mu         sync.RWMutex
+	secret     []byte
+	ttl        time.Duration
+	secretPath string // 空の場合は鍵をメモリ上にのみ保持する
+}
+
+// NewCookieAuth は CookieAuth を生成する。
+// secretPath が指定されている場合はそのファイルから署名鍵を読み込み、
+// 存在しなければ新しい鍵を生成して保存する。これによりサーバー再起動後も
+// 発行済みの cookie が有効なまま維持される。
+// ttl が 0 以下の場合は defaultSessionTTL を使用する。
+func NewCookieAuth(secretPath string, ttl time.Duration) (*CookieAuth, error) {
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	c := &CookieAuth{
+		ttl:        ttl,
+		secretPath: secretPath,
+	}
+
+	if secretPath != "" {
+		data, err := os.ReadFile(secretPath)
+		if err == nil && len(data) >= 32 {
+			c.secret = data
+			return c, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read session secret: %w", err)
+		}
+	}
+
+	if err := c.Rotate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TTL は cookie の有効期間を返す。
+func (c *CookieAuth) TTL() time.Duration {
+	return c.ttl
+}
+
+// Rotate は署名鍵を新しいランダム値に差し替え、発行済みの全 cookie を無効化する。
+// secretPath が設定されている場合は新しい鍵をファイルに保存する。
+func (c *CookieAuth) Rotate() error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("generate session secret: %w", err)
+	}
+
+	if c.secretPath != "" {
+		if err := os.MkdirAll(filepath.Dir(c.secretPath), 0700); err != nil {
+			return fmt.Errorf("save session secret: %w", err)
+		}
+		if err := os.WriteFile(c.secretPath, secret, 0600); err != nil {
+			return fmt.Errorf("save session secret: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.secret = secret
+	c.mu.Unlock()
+	return nil
+}
+
+// Issue は新しいセッション cookie の値と有効期限を返す。
+// subject にはユーザーアカウントでログインした場合のユーザー名を渡す。
+// 値は "<base64url(claims JSON)>.<base64url(HMAC-SHA256)>" 形式。
+func (c *CookieAuth) Issue(subject string) (string, time.Time) {
+	now := time.Now()
+	expires := now.Add(c.ttl)
+	payload, _ := json.Marshal(sessionClaims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + c.sign(encoded), expires
+}
+
+// Verify は cookie の値の署名と有効期限を検証する。
+func (c *CookieAuth) Verify(value string) bool {
+	_, ok := c.parse(value)
+	return ok
+}
+
+// VerifyRequest はリクエストに有効なセッション cookie が付いているかを返す。
+func (c *CookieAuth) VerifyRequest(r *http.Request) bool {
+	_, ok := c.requestClaims(r)
+	return ok
+}
+
+// requestClaims はリクエストのセッション cookie を検証し、クレームを返す。
+func (c *CookieAuth) requestClaims(r *http.Request) (sessionClaims, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return sessionClaims{}, false
+	}
+	return c.parse(cookie.Value)
+}
+
+// parse は cookie の値の署名と有効期限を検証し、クレームを返す。
+func (c *CookieAuth) parse(value string) (sessionClaims, bool) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok || encoded == "" || sig == "" {
+		return sessionClaims{}, false
+	}
+	if !hmac.Equal([]byte(sig), []byte(c.sign(encoded))) {
+		return sessionClaims{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return sessionClaims{}, false
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return sessionClaims{}, false
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return sessionClaims{}, false
+	}
+	return claims, true
+}
+
+// sign は encoded に対する HMAC-SHA256 署名を base64url で返す。
+func (c *CookieAuth) sign(encoded string) string {
+	c.mu.RLock()
+	mac := hmac.New(sha256.New, c.secret)
+	c.mu.RUnlock()
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isSecureRequest はリクエストが HTTPS 経由かどうかを返す。
+// 信頼するリバースプロキシ（--trusted-proxies。Cloudflare Tunnel 等）から届いた場合のみ X-Forwarded-Proto を参照する。
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || (viaTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+// setSessionCookie はセッション cookie をレスポンスに設定する。
+// subject はユーザーアカウントでログインした場合のユーザー名（それ以外は空）。
+func (s *Server) setSessionCookie(w http.ResponseWriter, r *http.Request, subject string) {
+	value, expires := s.cookieAuth.Issue(subject)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     s.basePath,
+		Expires:  expires,
+		MaxAge:   int(s.cookieAuth.TTL().Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSessionCookie はセッション cookie を削除する。
+func (s *Server) clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     s.basePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkLoginSecret はログインフォームに入力された値がトークンまたはパスワードに一致するかを返す。
+// タイミング攻撃を避けるため定数時間で比較する。
+func (s *Server) checkLoginSecret(secret string) bool {
+	if secret == "" {
+		return false
+	}
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.token)) == 1 {
+		return true
+	}
+	if s.password != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.password)) == 1 {
+		return true
+	}
+	return false
+}
+
+// loginPageTemplate はログインページの HTML テンプレート。
+// フロントエンドのビルド成果物に依存せず単体で表示できるようにインラインで持つ。
+var loginPageTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <meta name="theme-color" content="#16213e">
+  <title>Palmux - Login</title>
+  <style>
+    body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center;
+           background: #16213e; color: #e0e0e0; font-family: -apple-system, BlinkMacSystemFont, sans-serif; }
+    form { width: 280px; display: flex; flex-direction: column; gap: 12px; }
+    h1 { margin: 0 0 8px; font-size: 24px; text-align: center; }
+    input { padding: 10px; font-size: 16px; border: 1px solid #444; border-radius: 6px; background: #0f1629; color: inherit; }
+    button { padding: 10px; font-size: 16px; border: none; border-radius: 6px; background: #e94560; color: #fff; }
+    .error { color: #ff6b6b; font-size: 14px; text-align: center; }
+  </style>
+</head>
+<body>
+  <form method="post" action="{{.BasePath}}api/auth/login">
+    <h1>Palmux</h1>
+    {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+    <input type="text" name="username" placeholder="User (optional)" autocomplete="username" autocapitalize="off">
+    <input type="password" name="secret" placeholder="Token or password" autocomplete="current-password" autofocus required>
+    <button type="submit">Log in</button>
+  </form>
+</body>
+</html>
+`))
+
+// renderLoginPage はログインページを描画する。
+func (s *Server) renderLoginPage(w http.ResponseWriter, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	loginPageTemplate.Execute(w, struct {
+		BasePath string
+		Error    string
+	}{s.basePath, errMsg})
+}
+
+// handleLoginPage は GET /login のハンドラ。
+// 既に有効なセッション cookie を持っている場合はトップページにリダイレクトする。
+func (s *Server) handleLoginPage() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cookieAuth.VerifyRequest(r) {
+			http.Redirect(w, r, s.basePath, http.StatusSeeOther)
+			return
+		}
+		s.renderLoginPage(w, http.StatusOK, "")
+	})
+}
+
+// handleLogin は POST /api/auth/login のハンドラ。
+// トークンまたはパスワード（username 指定時はユーザーアカウントのパスワード）を一度だけ検証し、
+// 署名付きセッション cookie を発行する。
+// フォーム送信の場合はトップページにリダイレクトし、JSON の場合は 204 No Content を返す。
+// 失敗が続いたクライアント IP は一定時間ロックアウトし、429 Too Many Requests を返す。
+func (s *Server) handleLogin() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if wait, ok := s.authThrottle.check(ip); !ok {
+			writeTooManyRequests(w, wait, "too many failed login attempts")
+			return
+		}
+
+		isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+
+		var username, secret string
+		if isJSON {
+			var req struct {
+				Username string `json:"username"`
+				Secret   string `json:"secret"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON")
+				return
+			}
+			username, secret = req.Username, req.Secret
+		} else {
+			username, secret = r.PostFormValue("username"), r.PostFormValue("secret")
+		}
+
+		// ユーザー名が指定された場合はユーザーアカウントとして認証する
+		var subject string
+		ok := false
+		if username != "" {
+			if u, found := s.users.Authenticate(username, secret); found {
+				subject, ok = u.Name, true
+			}
+		} else {
+			ok = s.checkLoginSecret(secret)
+		}
+
+		if !ok {
+			s.authThrottle.fail(ip)
+			if isJSON {
+				writeError(w, http.StatusUnauthorized, "invalid credentials")
+			} else {
+				s.renderLoginPage(w, http.StatusUnauthorized, "Invalid credentials")
+			}
+			return
+		}
+
+		s.authThrottle.succeed(ip)
+		s.setSessionCookie(w, r, subject)
+		if isJSON {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Redirect(w, r, s.basePath, http.StatusSeeOther)
+	})
+}
+
+// handleLogout は POST /api/auth/logout のハンドラ。
+// このデバイスのセッション cookie を削除する。
+func (s *Server) handleLogout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.clearSessionCookie(w, r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleLogoutAll は POST /api/auth/logout-all のハンドラ。
+// 署名鍵をローテーションして全デバイスのセッション cookie を無効化する。
+func (s *Server) handleLogoutAll() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.cookieAuth.Rotate(); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.clearSessionCookie(w, r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServerWithPassword はパスワード付きのテスト用 Server を作成するヘルパー。
+func newTestServerWithPassword(password string) *Server {
+	return NewServer(Options{
+		Tmux:     &configurableMock{},
+		Token:    "test-token",
+		Password: password,
+		BasePath: "/",
+	})
+}
+
+// postLoginForm はログインフォームを送信するヘルパー。
+func postLoginForm(t *testing.T, handler http.Handler, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+	form := url.Values{"secret": {secret}}
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// findSessionCookie はレスポンスからセッション cookie を取り出す。
+func findSessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestCookieAuth_IssueAndVerify(t *testing.T) {
+	ca, err := NewCookieAuth("", time.Hour)
+	if err != nil {
+		t.Fatalf("NewCookieAuth() error = %v", err)
+	}
+
+	value, expires := ca.Issue("")
+	if !ca.Verify(value) {
+		t.Error("Verify() = false for freshly issued cookie, want true")
+	}
+	if time.Until(expires) < 59*time.Minute {
+		t.Errorf("expires = %v, want about 1h from now", expires)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "空文字列", value: ""},
+		{name: "区切りなし", value: "abc"},
+		{name: "署名の改ざん", value: value + "x"},
+		{name: "ペイロードの改ざん", value: "x" + value},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ca.Verify(tt.value) {
+				t.Errorf("Verify(%q) = true, want false", tt.value)
+			}
+		})
+	}
+}
+
+func TestCookieAuth_Expired(t *testing.T) {
+	ca, err := NewCookieAuth("", time.Nanosecond)
+	if err != nil {
+		t.Fatalf("NewCookieAuth() error = %v", err)
+	}
+
+	value, _ := ca.Issue("")
+	time.Sleep(1100 * time.Millisecond)
+	if ca.Verify(value) {
+		t.Error("Verify() = true for expired cookie, want false")
+	}
+}
+
+func TestCookieAuth_RotateInvalidatesCookies(t *testing.T) {
+	ca, err := NewCookieAuth("", time.Hour)
+	if err != nil {
+		t.Fatalf("NewCookieAuth() error = %v", err)
+	}
+
+	value, _ := ca.Issue("")
+	if err := ca.Rotate(); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if ca.Verify(value) {
+		t.Error("Verify() = true after Rotate, want false")
+	}
+}
+
+func TestCookieAuth_PersistsSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "palmux", "session.key")
+
+	ca1, err := NewCookieAuth(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCookieAuth() error = %v", err)
+	}
+	value, _ := ca1.Issue("")
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("secret file not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("secret file mode = %o, want 600", info.Mode().Perm())
+	}
+
+	// 再起動を想定: 同じファイルから読み込んだ鍵で検証できる
+	ca2, err := NewCookieAuth(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCookieAuth() error = %v", err)
+	}
+	if !ca2.Verify(value) {
+		t.Error("cookie should remain valid after reloading the secret file")
+	}
+}
+
+func TestHandleLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		secret     string
+		wantStatus int
+		wantCookie bool
+	}{
+		{
+			name:       "正しいトークン: cookieを発行してリダイレクト",
+			secret:     "test-token",
+			wantStatus: http.StatusSeeOther,
+			wantCookie: true,
+		},
+		{
+			name:       "正しいパスワード: cookieを発行してリダイレクト",
+			password:   "hunter2",
+			secret:     "hunter2",
+			wantStatus: http.StatusSeeOther,
+			wantCookie: true,
+		},
+		{
+			name:       "不正な値: 401とログインページ",
+			password:   "hunter2",
+			secret:     "wrong",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "パスワード未設定時の空入力: 401",
+			secret:     "",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServerWithPassword(tt.password)
+			rec := postLoginForm(t, srv.Handler(), tt.secret)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			cookie := findSessionCookie(rec)
+			if tt.wantCookie {
+				if cookie == nil {
+					t.Fatal("session cookie not set")
+				}
+				if !cookie.HttpOnly {
+					t.Error("session cookie should be HttpOnly")
+				}
+				if cookie.Path != "/" {
+					t.Errorf("cookie path = %q, want %q", cookie.Path, "/")
+				}
+			} else if cookie != nil {
+				t.Errorf("session cookie should not be set, got %v", cookie)
+			}
+		})
+	}
+}
+
+func TestHandleLogin_SecureCookie(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		proto      string
+		want       bool
+	}{
+		{name: "信頼するプロキシの X-Forwarded-Proto", proxies: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:5000", proto: "https", want: true},
+		{name: "信頼しない接続元の X-Forwarded-Proto は無視", proxies: []string{"10.0.0.0/8"}, remoteAddr: "203.0.113.5:5000", proto: "https", want: false},
+		{name: "プロキシ未設定では X-Forwarded-Proto を無視", remoteAddr: "10.1.2.3:5000", proto: "https", want: false},
+		{name: "信頼するプロキシ経由の HTTP", proxies: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:5000", proto: "http", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(Options{Tmux: &configurableMock{}, Token: "test-token", BasePath: "/", TrustedProxies: tt.proxies})
+			form := url.Values{"secret": {"test-token"}}
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			cookie := findSessionCookie(rec)
+			if cookie == nil {
+				t.Fatalf("session cookie not set (status %d)", rec.Code)
+			}
+			if cookie.Secure != tt.want {
+				t.Errorf("Secure = %v, want %v", cookie.Secure, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleLogin_JSON(t *testing.T) {
+	srv := newTestServerWithPassword("")
+	rec := doRequest(t, srv.Handler(), http.MethodPost, "/api/auth/login", "", `{"secret":"test-token"}`)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if findSessionCookie(rec) == nil {
+		t.Error("session cookie not set")
+	}
+}
+
+func TestSessionCookie_AuthenticatesAPI(t *testing.T) {
+	srv := newTestServerWithPassword("")
+	handler := srv.Handler()
+
+	cookie := findSessionCookie(postLoginForm(t, handler, "test-token"))
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status with cookie = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// Authorization ヘッダーが付いている場合はヘッダーが優先される
+	req = httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.AddCookie(cookie)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status with wrong header = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandleLogoutAll_InvalidatesCookies(t *testing.T) {
+	srv := newTestServerWithPassword("")
+	handler := srv.Handler()
+
+	cookie := findSessionCookie(postLoginForm(t, handler, "test-token"))
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout-all", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("logout-all status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status after logout-all = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandleLogout_ClearsCookie(t *testing.T) {
+	srv := newTestServerWithPassword("")
+	rec := doRequest(t, srv.Handler(), http.MethodPost, "/api/auth/logout", "", "")
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	cookie := findSessionCookie(rec)
+	if cookie == nil || cookie.MaxAge >= 0 {
+		t.Errorf("logout should expire the session cookie, got %v", cookie)
+	}
+}
+
+func TestHandleLoginPage(t *testing.T) {
+	srv := NewServer(Options{
+		Tmux:     &configurableMock{},
+		Token:    "test-token",
+		BasePath: "/palmux/",
+	})
+	handler := srv.Handler()
+
+	rec := doRequest(t, handler, http.MethodGet, "/palmux/login", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `action="/palmux/api/auth/login"`) {
+		t.Errorf("login form should post to base path, got %q", body)
+	}
+	if strings.Contains(body, "test-token") {
+		t.Error("login page must not contain the auth token")
+	}
+}
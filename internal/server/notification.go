@@ -16,7 +16,8 @@ type Notification struct {
 
 // NotificationEvent は通知の変更イベント。
 type NotificationEvent struct {
-	Action        string         `json:"action"` // "set" or "clear"
+	Action        string         `json:"action"`  // "set" or "clear"
+	Session       string         `json:"session"` // 変更があったセッション
 	Notifications []Notification `json:"notifications"`
 }
 
@@ -25,6 +26,7 @@ type NotificationStore struct {
 	mu    sync.Mutex
 	items map[string]*notificationEntry // key: "session:windowIndex"
 	subs  map[chan NotificationEvent]struct{}
+	ttl   time.Duration // 0 の場合は notificationTTL を使用する
 }
 
 type notificationEntry struct {
@@ -44,6 +46,14 @@ func NewNotificationStore() *NotificationStore {
 	}
 }
 
+// SetTTL は以降に追加される通知の TTL を変更する。0 以下の場合はデフォルト値を使用する。
+// 既に表示中の通知のタイマーは変更しない。
+func (s *NotificationStore) SetTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ttl = ttl
+}
+
 // Set は通知を追加/更新し、TTLタイマーを開始してサブスクライバにブロードキャストする。
 func (s *NotificationStore) Set(session string, windowIndex int, ntype string) {
 	s.mu.Lock()
@@ -62,7 +72,11 @@ func (s *NotificationStore) Set(session string, windowIndex int, ntype string) {
 		Type:        ntype,
 	}
 
-	timer := time.AfterFunc(notificationTTL, func() {
+	ttl := s.ttl
+	if ttl <= 0 {
+		ttl = notificationTTL
+	}
+	timer := time.AfterFunc(ttl, func() {
 		s.Clear(session, windowIndex)
 	})
 
@@ -71,7 +85,7 @@ func (s *NotificationStore) Set(session string, windowIndex int, ntype string) {
 		timer:        timer,
 	}
 
-	s.broadcast("set")
+	s.broadcast("set", session)
 }
 
 // Clear は通知を削除し、タイマーを停止してサブスクライバにブロードキャストする。
@@ -86,7 +100,7 @@ func (s *NotificationStore) Clear(session string, windowIndex int) {
 		delete(s.items, key)
 	}
 
-	s.broadcast("clear")
+	s.broadcast("clear", session)
 }
 
 // List は全通知のスナップショットをキーでソートして返す。
@@ -133,9 +147,10 @@ func (s *NotificationStore) Unsubscribe(ch chan NotificationEvent) {
 }
 
 // broadcast はロックを取得済みの状態で全サブスクライバにイベントを送信する。
-func (s *NotificationStore) broadcast(action string) {
+func (s *NotificationStore) broadcast(action, session string) {
 	event := NotificationEvent{
 		Action:        action,
+		Session:       session,
 		Notifications: s.listLocked(),
 	}
 
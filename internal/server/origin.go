@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// originPolicy はブラウザからのクロスオリジンリクエストを許可するかを判定する。
+// 同一オリジン（Origin のホストが Host または X-Forwarded-Host と一致）は常に許可し、
+// それ以外は allowed に一致するオリジンのみ許可する。
+// allowed の各要素は "https://example.com" のようなオリジン、または "*.example.com" のようなホストの glob パターン。
+// "*" を含む場合は全てのオリジンを許可する（従来の挙動）。
+type originPolicy struct {
+	mu       sync.RWMutex
+	allowAll bool
+	patterns []string
+}
+
+// newOriginPolicy は許可するオリジンの一覧から originPolicy を生成する。空要素は無視する。
+func newOriginPolicy(allowed []string) *originPolicy {
+	p := &originPolicy{}
+	p.set(allowed)
+	return p
+}
+
+// set は許可するオリジンの一覧を置き換える（設定の再読み込み用）。
+func (p *originPolicy) set(allowed []string) {
+	allowAll := false
+	var patterns []string
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(a), "/"))
+		switch a {
+		case "":
+		case "*":
+			allowAll = true
+		default:
+			patterns = append(patterns, a)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allowAll = allowAll
+	p.patterns = patterns
+}
+
+// allowed はリクエストの Origin ヘッダーが許可されているかを返す。
+// Origin ヘッダーがないリクエスト（curl 等のブラウザ以外のクライアント）は許可する。
+// X-Forwarded-Host はブラウザのクロスオリジンリクエストからは付与できないため、
+// リバースプロキシ背後の同一オリジン判定に使用する。
+func (p *originPolicy) allowed(r *http.Request) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.allowAll {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+
+	if strings.EqualFold(host, r.Host) {
+		return true
+	}
+	if fwd, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); fwd != "" && strings.EqualFold(host, strings.TrimSpace(fwd)) {
+		return true
+	}
+
+	full := strings.ToLower(u.Scheme) + "://" + host
+	for _, pattern := range p.patterns {
+		target := host
+		if strings.Contains(pattern, "://") {
+			target = full
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isStateChangingMethod は状態を変更する HTTP メソッドかどうかを返す。
+func isStateChangingMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// originMiddleware は状態を変更するリクエスト（GET/HEAD/OPTIONS 以外）の CSRF 対策を行うミドルウェア。
+// Origin ヘッダーが許可されていない場合、または Origin がなく Sec-Fetch-Site が cross-site の場合は
+// 403 Forbidden を返す。WebSocket の attach は handleAttach で同じ policy を検査する。
+func (s *Server) originMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStateChangingMethod(r.Method) {
+			crossSite := r.Header.Get("Origin") == "" && r.Header.Get("Sec-Fetch-Site") == "cross-site"
+			if crossSite || !s.origins.allowed(r) {
+				writeError(w, http.StatusForbidden, "cross-origin request not allowed")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
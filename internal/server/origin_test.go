@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+func TestOriginPolicy_Allowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowed   []string
+		origin    string
+		fwdHost   string
+		wantAllow bool
+	}{
+		{name: "Origin なし", origin: "", wantAllow: true},
+		{name: "同一オリジン", origin: "http://palmux.local:8080", wantAllow: true},
+		{name: "同一オリジン（大文字小文字の違い）", origin: "http://PALMUX.local:8080", wantAllow: true},
+		{name: "X-Forwarded-Host と一致", origin: "https://example.com", fwdHost: "example.com", wantAllow: true},
+		{name: "別オリジン", origin: "https://evil.example.com", wantAllow: false},
+		{name: "null オリジン", origin: "null", wantAllow: false},
+		{name: "オリジン指定で一致", allowed: []string{"https://app.example.com"}, origin: "https://app.example.com", wantAllow: true},
+		{name: "オリジン指定でスキーム不一致", allowed: []string{"https://app.example.com"}, origin: "http://app.example.com", wantAllow: false},
+		{name: "ホストの glob で一致", allowed: []string{"*.example.com"}, origin: "https://a.example.com", wantAllow: true},
+		{name: "ホストの glob で不一致", allowed: []string{"*.example.com"}, origin: "https://example.org", wantAllow: false},
+		{name: "* は全て許可", allowed: []string{"*"}, origin: "https://evil.example.com", wantAllow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newOriginPolicy(tt.allowed)
+			req := httptest.NewRequest(http.MethodPost, "http://palmux.local:8080/api/sessions", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.fwdHost != "" {
+				req.Header.Set("X-Forwarded-Host", tt.fwdHost)
+			}
+			if got := p.allowed(req); got != tt.wantAllow {
+				t.Errorf("allowed() = %v, want %v", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestOriginMiddleware(t *testing.T) {
+	srv := NewServer(Options{
+		Tmux:           &configurableMock{},
+		Token:          "test-token",
+		BasePath:       "/",
+		AllowedOrigins: []string{"https://app.example.com"},
+	})
+	handler := srv.Handler()
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		fetchSite  string
+		wantStatus int
+	}{
+		{name: "クロスオリジンの POST: 403", method: http.MethodPost, origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "許可オリジンの POST: 201", method: http.MethodPost, origin: "https://app.example.com", wantStatus: http.StatusCreated},
+		{name: "同一オリジンの POST: 201", method: http.MethodPost, origin: "http://example.com", wantStatus: http.StatusCreated},
+		{name: "Origin なし（curl 等）: 201", method: http.MethodPost, wantStatus: http.StatusCreated},
+		{name: "Origin なしで Sec-Fetch-Site が cross-site: 403", method: http.MethodPost, fetchSite: "cross-site", wantStatus: http.StatusForbidden},
+		{name: "クロスオリジンの GET は検査しない: 200", method: http.MethodGet, origin: "https://evil.example.com", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/sessions", strings.NewReader(`{"name":"x"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer test-token")
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.fetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAttach_OriginCheck(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv := NewServer(Options{
+		Tmux:           mock,
+		Token:          "test-token",
+		BasePath:       "/",
+		AllowedOrigins: []string{"https://app.example.com"},
+	})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/sessions/main/windows/0/attach"
+
+	dial := func(origin string) (*websocket.Conn, *http.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+			HTTPHeader: http.Header{
+				"Authorization": []string{"Bearer test-token"},
+				"Origin":        []string{origin},
+			},
+		})
+	}
+
+	_, resp, err := dial("https://evil.example.com")
+	if err == nil {
+		t.Fatal("dial from disallowed origin should fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("response = %v, want status %d", resp, http.StatusForbidden)
+	}
+
+	conn, _, err := dial("https://app.example.com")
+	if err != nil {
+		t.Fatalf("dial from allowed origin error = %v", err)
+	}
+	conn.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies はクライアント IP を転送ヘッダー（X-Forwarded-For / X-Real-IP）から取得してよい
+// リバースプロキシの一覧（--trusted-proxies）。
+// 各要素は IP アドレス、CIDR、または Unix ソケット経由の接続を表す "unix"。
+type trustedProxies struct {
+	prefixes []netip.Prefix
+	unix     bool
+}
+
+// newTrustedProxies は信頼するプロキシの一覧から trustedProxies を生成する。空要素・不正な要素は無視する。
+func newTrustedProxies(list []string) *trustedProxies {
+	tp := &trustedProxies{}
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "unix" {
+			tp.unix = true
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			tp.prefixes = append(tp.prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(s); err == nil {
+			tp.prefixes = append(tp.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return tp
+}
+
+// empty は信頼するプロキシが 1 つもないかを返す。
+func (tp *trustedProxies) empty() bool {
+	return len(tp.prefixes) == 0 && !tp.unix
+}
+
+// trustsAddr は IP アドレス s が信頼するプロキシかを返す。
+func (tp *trustedProxies) trustsAddr(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range tp.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustsPeer は接続元（RemoteAddr）が信頼するプロキシかを返す。
+// IP アドレスでない接続元（Unix ソケット）は "unix" が指定されている場合のみ信頼する。
+func (tp *trustedProxies) trustsPeer(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if _, err := netip.ParseAddr(host); err != nil {
+		return tp.unix
+	}
+	return tp.trustsAddr(host)
+}
+
+// forwardedFor は信頼するプロキシからのリクエストについて、転送ヘッダーからクライアント IP を返す。
+// X-Forwarded-For は右（最後に経由したプロキシ）から辿り、信頼するプロキシでない最初のアドレスを採用する。
+// X-Forwarded-For がない場合は X-Real-IP を使う。接続元が信頼できない場合やヘッダーが不正な場合は空文字列を返す。
+func (tp *trustedProxies) forwardedFor(r *http.Request) string {
+	if !tp.trustsPeer(r.RemoteAddr) {
+		return ""
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	if len(hops) == 0 {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			if addr, err := netip.ParseAddr(ip); err == nil {
+				return addr.Unmap().String()
+			}
+		}
+		return ""
+	}
+
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !tp.trustsAddr(client) {
+			break
+		}
+	}
+	return client
+}
+
+// middleware は信頼するプロキシからのリクエストに印を付け（viaTrustedProxy）、
+// RemoteAddr を転送ヘッダーのクライアント IP に置き換える。
+// 認証失敗のロックアウト・レート制限・接続一覧・監査ログは置き換えた RemoteAddr を使う。
+func (tp *trustedProxies) middleware(next http.Handler) http.Handler {
+	if tp.empty() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tp.trustsPeer(r.RemoteAddr) {
+			ip := tp.forwardedFor(r)
+			r = r.WithContext(context.WithValue(r.Context(), viaTrustedProxyKey{}, true))
+			if ip != "" {
+				r.RemoteAddr = ip
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// viaTrustedProxyKey は信頼するプロキシから届いたリクエストの印のコンテキストキー。
+type viaTrustedProxyKey struct{}
+
+// viaTrustedProxy はリクエストが信頼するプロキシ（--trusted-proxies）から届いたかを返す。
+// X-Forwarded-Proto 等の転送ヘッダーはクライアントが自由に付けられるため、この場合にだけ参照する。
+func viaTrustedProxy(r *http.Request) bool {
+	v, _ := r.Context().Value(viaTrustedProxyKey{}).(bool)
+	return v
+}
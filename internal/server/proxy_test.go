@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies_ForwardedFor(t *testing.T) {
+	tp := newTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "unix", "bogus"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		want       string
+	}{
+		{name: "信頼するプロキシ経由", remoteAddr: "10.1.2.3:5000", xff: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "単一の IP アドレス", remoteAddr: "192.0.2.1:5000", xff: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "信頼しない接続元はヘッダーを無視", remoteAddr: "203.0.113.5:5000", xff: []string{"198.51.100.7"}, want: ""},
+		{name: "右から信頼するプロキシを飛ばす", remoteAddr: "10.1.2.3:5000", xff: []string{"1.1.1.1, 198.51.100.7, 10.9.9.9"}, want: "198.51.100.7"},
+		{name: "複数のヘッダー", remoteAddr: "10.1.2.3:5000", xff: []string{"1.1.1.1", "198.51.100.7"}, want: "198.51.100.7"},
+		{name: "全て信頼するプロキシ", remoteAddr: "10.1.2.3:5000", xff: []string{"10.0.0.1, 10.0.0.2"}, want: "10.0.0.1"},
+		{name: "不正なアドレス", remoteAddr: "10.1.2.3:5000", xff: []string{"unknown"}, want: ""},
+		{name: "X-Real-IP", remoteAddr: "10.1.2.3:5000", realIP: "198.51.100.7", want: "198.51.100.7"},
+		{name: "Unix ソケット", remoteAddr: "@", xff: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "IPv4 射影アドレス", remoteAddr: "[::ffff:10.1.2.3]:5000", xff: []string{"::ffff:198.51.100.7"}, want: "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := tp.forwardedFor(req); got != tt.want {
+				t.Errorf("forwardedFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies_UnixNotTrustedByDefault(t *testing.T) {
+	tp := newTrustedProxies([]string{"10.0.0.0/8"})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = ""
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	if got := tp.forwardedFor(req); got != "" {
+		t.Errorf("forwardedFor() = %q, want empty", got)
+	}
+}
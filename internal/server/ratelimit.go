@@ -0,0 +1,221 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 認証失敗によるロックアウトの設定。テスト時に上書き可能。
+var (
+	// authFreeAttempts はロックアウトせずに許容する連続失敗回数。
+	authFreeAttempts = 5
+	// authBaseLockout は最初のロックアウト時間。以降は失敗ごとに倍になる。
+	authBaseLockout = time.Second
+	// authMaxLockout はロックアウト時間の上限。
+	authMaxLockout = 15 * time.Minute
+	// authFailureWindow は最後の失敗からこの時間が経過すると失敗回数をリセットする。
+	authFailureWindow = time.Hour
+)
+
+// 負荷の高いエンドポイントのレート制限（1 秒あたりのリクエスト数とバースト）。テスト時に上書き可能。
+var (
+	grepRateLimit       = 1.0
+	grepRateBurst       = 10
+	gitDiffRateLimit    = 5.0
+	gitDiffRateBurst    = 30
+	ghqCloneRateLimit   = 1.0 / 30
+	ghqCloneRateBurst   = 3
+	scrollbackRateLimit = 1.0
+	scrollbackRateBurst = 10
+)
+
+// rateLimitPruneInterval は使われなくなったエントリを掃除する間隔。
+const rateLimitPruneInterval = time.Minute
+
+// authFailure は 1 クライアントの認証失敗状態。
+type authFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// authThrottle はクライアント IP ごとの認証失敗を追跡し、
+// authFreeAttempts 回を超えた失敗に対して指数的に伸びるロックアウトを課す。
+type authThrottle struct {
+	mu        sync.Mutex
+	failures  map[string]*authFailure // key: クライアント IP
+	lastPrune time.Time
+}
+
+// newAuthThrottle は新しい authThrottle を生成する。
+func newAuthThrottle() *authThrottle {
+	return &authThrottle{
+		failures: make(map[string]*authFailure),
+	}
+}
+
+// check はクライアントがロックアウト中かどうかを返す。
+// ロックアウト中の場合は解除までの残り時間と false を返す。
+func (t *authThrottle) check(ip string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.failures[ip]
+	if !ok {
+		return 0, true
+	}
+	if wait := time.Until(f.lockedUntil); wait > 0 {
+		return wait, false
+	}
+	return 0, true
+}
+
+// fail は認証失敗を記録し、課したロックアウト時間（なければ 0）を返す。
+func (t *authThrottle) fail(ip string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.pruneLocked(now)
+
+	f, ok := t.failures[ip]
+	if !ok || now.Sub(f.lastFailure) > authFailureWindow {
+		f = &authFailure{}
+		t.failures[ip] = f
+	}
+	f.count++
+	f.lastFailure = now
+
+	over := f.count - authFreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	lockout := authMaxLockout
+	if over <= 30 {
+		if d := authBaseLockout << (over - 1); d > 0 && d < authMaxLockout {
+			lockout = d
+		}
+	}
+	f.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// succeed は認証成功時に失敗回数をリセットする。
+func (t *authThrottle) succeed(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, ip)
+}
+
+// pruneLocked は失敗回数のリセット期間を過ぎたエントリを削除する。
+func (t *authThrottle) pruneLocked(now time.Time) {
+	if now.Sub(t.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	t.lastPrune = now
+	for ip, f := range t.failures {
+		if now.Sub(f.lastFailure) > authFailureWindow && !now.Before(f.lockedUntil) {
+			delete(t.failures, ip)
+		}
+	}
+}
+
+// tokenBucket はトークンバケット方式のレート制限の状態。
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter はクライアントごとのトークンバケットでリクエスト頻度を制限する。
+// rate は 1 秒あたりに補充されるリクエスト数、burst は連続して許可する最大数。
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket // key: クライアント IP
+	lastPrune time.Time
+}
+
+// newRateLimiter は新しい rateLimiter を生成する。
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow はリクエストを許可するかどうかを返す。
+// 拒否する場合は次のリクエストが許可されるまでの時間と false を返す。
+func (rl *rateLimiter) allow(key string) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.pruneLocked(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	return wait, false
+}
+
+// pruneLocked は満タンまで回復したバケットを削除する（削除しても挙動は変わらない）。
+func (rl *rateLimiter) pruneLocked(now time.Time) {
+	if now.Sub(rl.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	rl.lastPrune = now
+	for key, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// rateLimited は rl でクライアントごとのリクエスト頻度を制限するミドルウェア。
+// 制限を超えた場合は 429 Too Many Requests と Retry-After を返す。
+func rateLimited(rl *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait, ok := rl.allow(clientIP(r)); !ok {
+			writeTooManyRequests(w, wait, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeTooManyRequests は Retry-After（秒、切り上げ）付きの 429 エラーを返す。
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeError(w, http.StatusTooManyRequests, message+"; retry after "+strconv.Itoa(secs)+"s")
+}
+
+// clientIP はリクエスト元の IP アドレスを返す（ポート番号は除く）。
+// X-Forwarded-For 等は偽装できるため直接は参照しない。信頼するプロキシ（--trusted-proxies）経由の場合は
+// trustedProxies.middleware が RemoteAddr を転送ヘッダーのクライアント IP に置き換えている。
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
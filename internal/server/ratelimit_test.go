@@ -0,0 +1,223 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuthThrottle_ExponentialLockout(t *testing.T) {
+	th := newAuthThrottle()
+	const ip = "192.0.2.1"
+
+	for i := 0; i < authFreeAttempts; i++ {
+		if d := th.fail(ip); d != 0 {
+			t.Fatalf("fail() #%d lockout = %v, want 0", i+1, d)
+		}
+		if _, ok := th.check(ip); !ok {
+			t.Fatalf("check() after %d failures should allow", i+1)
+		}
+	}
+
+	want := authBaseLockout
+	for i := 0; i < 4; i++ {
+		if d := th.fail(ip); d != want {
+			t.Errorf("fail() lockout = %v, want %v", d, want)
+		}
+		want *= 2
+	}
+	if _, ok := th.check(ip); ok {
+		t.Error("check() should deny while locked out")
+	}
+	if _, ok := th.check("192.0.2.2"); !ok {
+		t.Error("check() should not affect other clients")
+	}
+
+	// 上限を超えない
+	for i := 0; i < 40; i++ {
+		th.fail(ip)
+	}
+	if d := th.fail(ip); d != authMaxLockout {
+		t.Errorf("fail() lockout = %v, want max %v", d, authMaxLockout)
+	}
+
+	th.succeed(ip)
+	if _, ok := th.check(ip); !ok {
+		t.Error("check() should allow after succeed()")
+	}
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	rl := newRateLimiter(1000, 3)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := rl.allow("a"); !ok {
+			t.Fatalf("allow() #%d should succeed within burst", i+1)
+		}
+	}
+	wait, ok := rl.allow("a")
+	if ok {
+		t.Fatal("allow() should fail after burst is exhausted")
+	}
+	if wait <= 0 {
+		t.Errorf("wait = %v, want > 0", wait)
+	}
+	if _, ok := rl.allow("b"); !ok {
+		t.Error("allow() should be per client")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := rl.allow("a"); !ok {
+		t.Error("allow() should succeed after tokens are refilled")
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	called := 0
+	handler := rateLimited(newRateLimiter(0.1, 2), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	}))
+
+	var rec *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/x", nil))
+	}
+
+	if called != 2 {
+		t.Errorf("next called %d times, want 2", called)
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	secs, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || secs < 1 || secs > 10 {
+		t.Errorf("Retry-After = %q, want 1..10 seconds", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestAuthMiddleware_Lockout(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+	handler := srv.Handler()
+
+	for i := 0; i < authFreeAttempts; i++ {
+		if rec := doRequest(t, handler, http.MethodGet, "/api/sessions", "wrong", ""); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	// 次の失敗でロックアウトされる
+	doRequest(t, handler, http.MethodGet, "/api/sessions", "wrong", "")
+
+	// ロックアウト中は正しいトークンでも 429
+	rec := doRequest(t, handler, http.MethodGet, "/api/sessions", token, "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header should be set")
+	}
+
+	// ロックアウト解除後に成功すると失敗回数がリセットされる
+	srv.authThrottle.succeed("192.0.2.1")
+	if rec := doRequest(t, handler, http.MethodGet, "/api/sessions", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("status after unlock = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAuthMiddleware_CookieFailuresNotCounted(t *testing.T) {
+	srv, _ := newTestServer(&configurableMock{})
+	handler := srv.Handler()
+
+	for i := 0; i < authFreeAttempts+3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "expired.cookie"})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestAuthMiddleware_LockoutSkipsSignedCredentials(t *testing.T) {
+	srv := newTestServerWithPassword("")
+	handler := srv.Handler()
+
+	// ロックアウト前にログインした cookie
+	cookie := findSessionCookie(postLoginForm(t, handler, "test-token"))
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+
+	// 同じ IP（プロキシ・Unix ソケット経由の他のクライアント等）からのトークンの失敗でロックアウトする
+	for i := 0; i <= authFreeAttempts; i++ {
+		doRequest(t, handler, http.MethodGet, "/api/sessions", "wrong", "")
+	}
+
+	// 署名付き cookie で認証できるリクエストはロックアウトの影響を受けない
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status with cookie = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// 資格情報のない（認証に失敗する）リクエストは 429
+	rec = doRequest(t, handler, http.MethodGet, "/api/sessions", "", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status without credentials = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestAuthMiddleware_LockoutPerForwardedClient(t *testing.T) {
+	srv := NewServer(Options{
+		Tmux:           &configurableMock{},
+		Token:          "test-token",
+		BasePath:       "/",
+		TrustedProxies: []string{"192.0.2.0/24"},
+	})
+	handler := srv.Handler()
+
+	request := func(client, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+		req.Header.Set("X-Forwarded-For", client)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// 信頼するプロキシ経由では転送ヘッダーのクライアント IP ごとにロックアウトする
+	for i := 0; i <= authFreeAttempts; i++ {
+		request("198.51.100.7", "wrong")
+	}
+	if code := request("198.51.100.7", "test-token"); code != http.StatusTooManyRequests {
+		t.Errorf("locked client status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := request("203.0.113.9", "test-token"); code != http.StatusOK {
+		t.Errorf("other client status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestHandleLogin_Lockout(t *testing.T) {
+	srv := newTestServerWithPassword("hunter2")
+	handler := srv.Handler()
+
+	for i := 0; i <= authFreeAttempts; i++ {
+		postLoginForm(t, handler, "wrong")
+	}
+
+	rec := postLoginForm(t, handler, "hunter2")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header should be set")
+	}
+	if findSessionCookie(rec) != nil {
+		t.Error("session cookie should not be set while locked out")
+	}
+}
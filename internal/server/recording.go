@@ -0,0 +1,642 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 録画の種別。
+const (
+	RecordingSourceWindow = "window" // pipe-pane によるウィンドウ（アクティブ pane）の録画
+	RecordingSourceAttach = "attach" // attach（?record=1）の録画
+)
+
+// defaultRecordingRetention は録画を保持するデフォルトの期間（録画終了からの経過時間）。
+const defaultRecordingRetention = 7 * 24 * time.Hour
+
+// defaultRecordingMaxSize は録画の合計サイズのデフォルトの上限（バイト）。
+const defaultRecordingMaxSize = 1 << 30
+
+// recordingPipeTimeout は pipe-pane で起動したコマンドが FIFO を開くのを待つ最大時間。
+var recordingPipeTimeout = 5 * time.Second
+
+// recordingStopTimeout は pipe-pane を閉じてから、コマンドの終了（FIFO の EOF）を待つ最大時間。
+// 過ぎた場合はサーバー側で FIFO を閉じて録画を終える。
+var recordingStopTimeout = 5 * time.Second
+
+// recordingResizeInterval はウィンドウの録画で pane の大きさの変化を確認する最小間隔。
+// 出力があったときだけ確認する（出力のない間は大きさが変わっても記録しない）。
+var recordingResizeInterval = time.Second
+
+// recordingIDPattern は録画 ID の形式（ファイル名に使うため英数字とハイフンのみ）。
+var recordingIDPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+var (
+	errRecordingNotFound = errors.New("recording not found")
+	errRecordingActive   = errors.New("window is already being recorded")
+)
+
+// Recording は録画のメタデータ。
+type Recording struct {
+	ID       string    `json:"id"`
+	Source   string    `json:"source"` // RecordingSourceWindow または RecordingSourceAttach
+	Session  string    `json:"session"`
+	Window   int       `json:"window"` // attach の録画ではウィンドウ指定なしの場合 -1
+	Actor    string    `json:"actor"`  // 録画を開始した Principal の名前
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration"` // 最後に記録した時点までの秒数
+	Size     int64     `json:"size"`
+	Active   bool      `json:"active"` // 録画中かどうか
+}
+
+// castHeader は asciicast v2 のヘッダー行。
+// Palmux 固有の情報は palmux フィールドに入れる（プレーヤーは未知のフィールドを無視する）。
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Palmux    castMeta          `json:"palmux"`
+}
+
+// castMeta は録画ファイルのヘッダーに保存する Palmux 固有の情報。
+type castMeta struct {
+	Source  string `json:"source"`
+	Session string `json:"session"`
+	Window  int    `json:"window"`
+	Actor   string `json:"actor"`
+}
+
+// RecordingStore は asciicast v2 形式の録画ファイル（<dir>/<id>.cast）を管理する。
+// 録画終了から retention を過ぎたものと、合計サイズが maxSize を超えた分の古いものは
+// 起動時・録画の開始時・一覧の取得時に削除する（録画中のものは削除しない）。
+// nil の RecordingStore は録画機能が無効であることを表す。
+type RecordingStore struct {
+	dir       string
+	retention time.Duration
+	maxSize   int64
+
+	mu      sync.Mutex
+	active  map[string]*recorder // key: ID
+	windows map[string]*recorder // key: "session:index"（ウィンドウの録画のみ）
+}
+
+// OpenRecordingStore は dir を録画の保存先として開く（存在しなければ作成する）。
+// retention・maxSize が 0 以下の場合はデフォルト値を使用する。
+func OpenRecordingStore(dir string, retention time.Duration, maxSize int64) (*RecordingStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("recordings directory is required")
+	}
+	if retention <= 0 {
+		retention = defaultRecordingRetention
+	}
+	if maxSize <= 0 {
+		maxSize = defaultRecordingMaxSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("open recordings: %w", err)
+	}
+	st := &RecordingStore{
+		dir:       dir,
+		retention: retention,
+		maxSize:   maxSize,
+		active:    make(map[string]*recorder),
+		windows:   make(map[string]*recorder),
+	}
+
+	// 前回の異常終了で残った FIFO を削除する
+	if fifos, err := filepath.Glob(filepath.Join(dir, "*.fifo")); err == nil {
+		for _, f := range fifos {
+			os.Remove(f)
+		}
+	}
+	st.prune()
+	return st, nil
+}
+
+// windowKey はウィンドウの録画を引くキーを返す。
+func windowKey(session string, index int) string {
+	return session + ":" + strconv.Itoa(index)
+}
+
+// generateRecordingID は開始時刻とランダムな接尾辞から録画 ID を生成する。
+func generateRecordingID(now time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate recording id: %w", err)
+	}
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
+
+// path は録画 ID のファイルパスを返す。ID の形式が不正な場合は空文字列を返す。
+func (st *RecordingStore) path(id string) string {
+	if !recordingIDPattern.MatchString(id) {
+		return ""
+	}
+	return filepath.Join(st.dir, id+".cast")
+}
+
+// create は新しい録画ファイルを作成してヘッダーを書き込み、recorder を返す。
+// source が RecordingSourceWindow の場合、同じウィンドウを録画中なら errRecordingActive を返す。
+func (st *RecordingStore) create(source, session string, window int, actor string, cols, rows int) (*recorder, error) {
+	st.prune()
+
+	now := time.Now()
+	id, err := generateRecordingID(now)
+	if err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := windowKey(session, window)
+	if source == RecordingSourceWindow && st.windows[key] != nil {
+		return nil, errRecordingActive
+	}
+
+	f, err := os.OpenFile(st.path(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+	title := session
+	if window >= 0 {
+		title = key
+	}
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: now.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+		Palmux:    castMeta{Source: source, Session: session, Window: window, Actor: actor},
+	})
+	header = append(header, '\n')
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+
+	r := &recorder{
+		store: st,
+		info: Recording{
+			ID:      id,
+			Source:  source,
+			Session: session,
+			Window:  window,
+			Actor:   actor,
+			Started: time.Unix(now.Unix(), 0),
+			Active:  true,
+		},
+		file:    f,
+		started: now,
+		last:    now,
+		size:    int64(len(header)),
+		cols:    cols,
+		rows:    rows,
+		done:    make(chan struct{}),
+	}
+	st.active[id] = r
+	if source == RecordingSourceWindow {
+		st.windows[key] = r
+	}
+	return r, nil
+}
+
+// finish は録画を終えた recorder を録画中の一覧から外す。
+func (st *RecordingStore) finish(r *recorder) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.active, r.info.ID)
+	key := windowKey(r.info.Session, r.info.Window)
+	if st.windows[key] == r {
+		delete(st.windows, key)
+	}
+}
+
+// window は session のウィンドウ index を録画中の recorder を返す（なければ nil）。
+func (st *RecordingStore) window(session string, index int) *recorder {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.windows[windowKey(session, index)]
+}
+
+// List は保存されている録画を新しい順に返す。
+func (st *RecordingStore) List() ([]Recording, error) {
+	st.prune()
+	recs, err := st.scan()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Started.After(recs[j].Started)
+	})
+	return recs, nil
+}
+
+// Get は録画 ID のメタデータを返す。存在しない場合は errRecordingNotFound を返す。
+func (st *RecordingStore) Get(id string) (Recording, error) {
+	p := st.path(id)
+	if p == "" {
+		return Recording{}, errRecordingNotFound
+	}
+	rec, err := st.read(id)
+	if errors.Is(err, os.ErrNotExist) {
+		return Recording{}, errRecordingNotFound
+	}
+	return rec, err
+}
+
+// Open は録画ファイルを読み取り用に開く。録画中のファイルはその時点までの内容を読める。
+func (st *RecordingStore) Open(id string) (*os.File, error) {
+	p := st.path(id)
+	if p == "" {
+		return nil, errRecordingNotFound
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errRecordingNotFound
+	}
+	return f, err
+}
+
+// Delete は録画を削除する。録画中の場合は録画を止めてから削除する。
+func (st *RecordingStore) Delete(id string) error {
+	p := st.path(id)
+	if p == "" {
+		return errRecordingNotFound
+	}
+	st.mu.Lock()
+	r := st.active[id]
+	st.mu.Unlock()
+	if r != nil {
+		r.stop()
+	}
+	if err := os.Remove(p); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errRecordingNotFound
+		}
+		return fmt.Errorf("delete recording: %w", err)
+	}
+	return nil
+}
+
+// scan は保存先ディレクトリのすべての録画のメタデータを返す。
+func (st *RecordingStore) scan() ([]Recording, error) {
+	paths, err := filepath.Glob(filepath.Join(st.dir, "*.cast"))
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]Recording, 0, len(paths))
+	for _, p := range paths {
+		id := strings.TrimSuffix(filepath.Base(p), ".cast")
+		rec, err := st.read(id)
+		if err != nil {
+			// 読めないファイル（書きかけのヘッダー等）は一覧に含めない
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// read は録画ファイルのヘッダーとファイル情報からメタデータを組み立てる。
+// 録画中の場合は recorder が保持している情報を返す。
+func (st *RecordingStore) read(id string) (Recording, error) {
+	st.mu.Lock()
+	r := st.active[id]
+	st.mu.Unlock()
+	if r != nil {
+		return r.snapshot(), nil
+	}
+
+	f, err := os.Open(st.path(id))
+	if err != nil {
+		return Recording{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Recording{}, err
+	}
+	line, err := bufio.NewReader(io.LimitReader(f, 64<<10)).ReadBytes('\n')
+	if err != nil {
+		return Recording{}, fmt.Errorf("read recording header: %w", err)
+	}
+	var h castHeader
+	if err := json.Unmarshal(line, &h); err != nil || h.Version != 2 {
+		return Recording{}, fmt.Errorf("invalid recording header in %s", id)
+	}
+	started := time.Unix(h.Timestamp, 0)
+	return Recording{
+		ID:       id,
+		Source:   h.Palmux.Source,
+		Session:  h.Palmux.Session,
+		Window:   h.Palmux.Window,
+		Actor:    h.Palmux.Actor,
+		Started:  started,
+		Duration: max(0, info.ModTime().Sub(started).Seconds()),
+		Size:     info.Size(),
+	}, nil
+}
+
+// prune は保持期間を過ぎた録画と、合計サイズの上限を超えた分の古い録画を削除する。
+// 録画中のものは削除せず、合計サイズには含める。
+func (st *RecordingStore) prune() {
+	recs, err := st.scan()
+	if err != nil {
+		log.Printf("recordings: %v", err)
+		return
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Started.Before(recs[j].Started)
+	})
+
+	var total int64
+	for _, rec := range recs {
+		total += rec.Size
+	}
+	now := time.Now()
+	for _, rec := range recs {
+		if rec.Active {
+			continue
+		}
+		ended := rec.Started.Add(time.Duration(rec.Duration * float64(time.Second)))
+		if now.Sub(ended) <= st.retention && total <= st.maxSize {
+			continue
+		}
+		if err := os.Remove(st.path(rec.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("recordings: %v", err)
+			continue
+		}
+		total -= rec.Size
+	}
+}
+
+// recorder は録画中の 1 つの録画ファイルに asciicast v2 のイベントを書き込む。
+type recorder struct {
+	store *RecordingStore
+	info  Recording
+
+	mu         sync.Mutex
+	stopFunc   func()   // 録画を止める（ウィンドウの録画で pipe-pane を閉じる。nil の場合は close）
+	file       *os.File // 閉じた後は nil
+	started    time.Time
+	last       time.Time // 最後にイベントを書き込んだ時刻
+	size       int64
+	cols, rows int
+	partial    []byte // 次の出力と合わせて書く、末尾の不完全な UTF-8 シーケンス
+
+	closeOnce sync.Once
+	done      chan struct{} // close 完了時に close される
+}
+
+// stop は録画を止め、録画ファイルが閉じられるまで待つ。
+func (r *recorder) stop() {
+	r.mu.Lock()
+	stop := r.stopFunc
+	r.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	r.close()
+}
+
+// output は端末の出力を "o" イベントとして書き込む。
+// 末尾の不完全な UTF-8 シーケンスは次の出力と合わせて書く。
+func (r *recorder) output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	data := append(r.partial, p...)
+	n := utf8TruncIndex(data)
+	r.partial = append([]byte(nil), data[n:]...)
+	if n > 0 {
+		r.writeEvent("o", string(data[:n]))
+	}
+}
+
+// resize は端末の大きさの変化を "r" イベントとして書き込む（変わっていなければ何もしない）。
+func (r *recorder) resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil || (cols == r.cols && rows == r.rows) {
+		return
+	}
+	r.cols, r.rows = cols, rows
+	r.writeEvent("r", strconv.Itoa(cols)+"x"+strconv.Itoa(rows))
+}
+
+// writeEvent は録画開始からの経過秒数付きのイベントを 1 行書き込む。
+// 書き込みに失敗した場合はファイルを閉じ、以降の記録を諦める。
+func (r *recorder) writeEvent(code, data string) {
+	now := time.Now()
+	d, _ := json.Marshal(data)
+	line := make([]byte, 0, len(d)+32)
+	line = append(line, '[')
+	line = strconv.AppendFloat(line, now.Sub(r.started).Seconds(), 'f', 6, 64)
+	line = append(line, `, "`...)
+	line = append(line, code...)
+	line = append(line, `", `...)
+	line = append(line, d...)
+	line = append(line, "]\n"...)
+	if _, err := r.file.Write(line); err != nil {
+		log.Printf("recording %s: %v", r.info.ID, err)
+		r.file.Close()
+		r.file = nil
+		return
+	}
+	r.last = now
+	r.size += int64(len(line))
+}
+
+// snapshot は録画中のメタデータを返す。
+func (r *recorder) snapshot() Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := r.info
+	rec.Duration = r.last.Sub(r.started).Seconds()
+	rec.Size = r.size
+	return rec
+}
+
+// close は録画ファイルを閉じて録画を終える。複数回呼んでも安全で、すべての呼び出しは終了を待つ。
+func (r *recorder) close() {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		if r.file != nil {
+			if len(r.partial) > 0 {
+				r.writeEvent("o", string(r.partial))
+				r.partial = nil
+			}
+			if r.file != nil {
+				r.file.Close()
+				r.file = nil
+			}
+		}
+		r.mu.Unlock()
+
+		r.store.finish(r)
+		close(r.done)
+	})
+	<-r.done
+}
+
+// shellQuote は s をシェルの単一引用符で囲んだ文字列を返す。
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// startWindowRecording は session のウィンドウ index（のアクティブ pane）の録画を開始する。
+// tmux の pipe-pane で pane の出力を録画ディレクトリ内の FIFO に書き込ませ、
+// サーバー側で読み取って時刻付きで録画ファイルに書き込む。
+// ウィンドウが終了すると tmux がパイプを閉じるため、録画も自動的に終わる。
+func (s *Server) startWindowRecording(session string, index int, actor string) (Recording, error) {
+	st := s.recordings
+	cols, rows, err := s.tmux.GetPaneSize(session, index)
+	if err != nil {
+		return Recording{}, err
+	}
+	r, err := st.create(RecordingSourceWindow, session, index, actor, cols, rows)
+	if err != nil {
+		return Recording{}, err
+	}
+
+	fifo := filepath.Join(st.dir, r.info.ID+".fifo")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		r.close()
+		os.Remove(st.path(r.info.ID))
+		return Recording{}, fmt.Errorf("create recording pipe: %w", err)
+	}
+	defer os.Remove(fifo) // 両端が開いた後は名前は不要
+
+	// FIFO の読み取り側は書き込み側（pipe-pane のコマンド）が開くまでブロックする
+	opened := make(chan *os.File, 1)
+	go func() {
+		f, err := os.OpenFile(fifo, os.O_RDONLY, 0)
+		if err != nil {
+			opened <- nil
+			return
+		}
+		opened <- f
+	}()
+	// abort は書き込み側が開かなかった場合に、ブロックしている読み取り側を解放して録画を取り消す
+	abort := func() {
+		if w, err := os.OpenFile(fifo, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			w.Close()
+		}
+		if f := <-opened; f != nil {
+			f.Close()
+		}
+		r.close()
+		os.Remove(st.path(r.info.ID))
+	}
+
+	if err := s.tmux.PipePane(session, index, "exec cat > "+shellQuote(fifo)); err != nil {
+		abort()
+		return Recording{}, err
+	}
+	var pipe *os.File
+	timer := time.NewTimer(recordingPipeTimeout)
+	defer timer.Stop()
+	select {
+	case pipe = <-opened:
+	case <-timer.C:
+	}
+	if pipe == nil {
+		s.tmux.PipePane(session, index, "")
+		abort()
+		return Recording{}, fmt.Errorf("recording pipe was not opened by tmux")
+	}
+
+	// 停止: pipe-pane を閉じるとコマンドが終了して FIFO が EOF になる。
+	// 終了しない場合は recordingStopTimeout 後に FIFO を閉じる
+	r.mu.Lock()
+	r.stopFunc = func() {
+		if err := s.tmux.PipePane(session, index, ""); err != nil {
+			log.Printf("recording %s: %v", r.info.ID, err)
+		}
+		select {
+		case <-r.done:
+		case <-time.After(recordingStopTimeout):
+			pipe.Close()
+			<-r.done
+		}
+	}
+	r.mu.Unlock()
+	go s.readWindowRecording(r, pipe, session, index)
+	return r.snapshot(), nil
+}
+
+// readWindowRecording は FIFO から pane の出力を読み取って録画する。
+// 出力があったときに recordingResizeInterval ごとに pane の大きさを確認し、変化を記録する。
+// FIFO が EOF になる（ウィンドウの終了・録画の停止）と録画を終える。
+func (s *Server) readWindowRecording(r *recorder, pipe *os.File, session string, index int) {
+	defer r.close()
+	defer pipe.Close()
+
+	buf := make([]byte, wsOutputReadSize)
+	var lastCheck time.Time
+	for {
+		n, err := pipe.Read(buf)
+		if n > 0 {
+			if time.Since(lastCheck) >= recordingResizeInterval {
+				lastCheck = time.Now()
+				if cols, rows, err := s.tmux.GetPaneSize(session, index); err == nil {
+					r.resize(cols, rows)
+				}
+			}
+			r.output(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// stopWindowRecording は session のウィンドウ index の録画を止め、録画のメタデータを返す。
+// 録画中でない場合は errRecordingNotFound を返す。
+func (s *Server) stopWindowRecording(session string, index int) (Recording, error) {
+	r := s.recordings.window(session, index)
+	if r == nil {
+		return Recording{}, errRecordingNotFound
+	}
+	r.stop()
+	return s.recordings.Get(r.info.ID)
+}
+
+// stopWindowRecordings はすべてのウィンドウの録画を止める（シャットダウン時に pipe-pane を片付ける）。
+func (s *Server) stopWindowRecordings() {
+	if s.recordings == nil {
+		return
+	}
+	s.recordings.mu.Lock()
+	recs := make([]*recorder, 0, len(s.recordings.windows))
+	for _, r := range s.recordings.windows {
+		recs = append(recs, r)
+	}
+	s.recordings.mu.Unlock()
+	for _, r := range recs {
+		r.stop()
+	}
+}
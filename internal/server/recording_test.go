@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readCast は asciicast v2 の録画ファイルを読み、ヘッダーとイベント（[時刻, 種別, データ]）を返すヘルパー。
+func readCast(t *testing.T, path string) (castHeader, [][]interface{}) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open recording: %v", err)
+	}
+	defer f.Close()
+
+	var header castHeader
+	var events [][]interface{}
+	sc := bufio.NewScanner(f)
+	for i := 0; sc.Scan(); i++ {
+		if i == 0 {
+			if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+				t.Fatalf("invalid header %q: %v", sc.Text(), err)
+			}
+			continue
+		}
+		var ev []interface{}
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil || len(ev) != 3 {
+			t.Fatalf("invalid event %q: %v", sc.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	return header, events
+}
+
+// castEvents はイベントの種別とデータだけを "o:hello" の形式で並べて返す。
+func castEvents(events [][]interface{}) []string {
+	out := make([]string, len(events))
+	for i, ev := range events {
+		out[i] = fmt.Sprintf("%v:%v", ev[1], ev[2])
+	}
+	return out
+}
+
+// writeCast は開始時刻 started・最終更新時刻 ended の録画ファイルを dir に作成するヘルパー。
+func writeCast(t *testing.T, dir, id, session string, started, ended time.Time, size int) {
+	t.Helper()
+
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     80,
+		Height:    24,
+		Timestamp: started.Unix(),
+		Palmux:    castMeta{Source: RecordingSourceWindow, Session: session},
+	})
+	data := append(header, '\n')
+	if pad := size - len(data); pad > 0 {
+		data = append(data, strings.Repeat("x", pad)...)
+	}
+	path := filepath.Join(dir, id+".cast")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write recording: %v", err)
+	}
+	if err := os.Chtimes(path, ended, ended); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	st, err := OpenRecordingStore(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("OpenRecordingStore() error = %v", err)
+	}
+
+	r, err := st.create(RecordingSourceAttach, "main", 1, "alice", 80, 24)
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+	r.output([]byte("hello\r\n"))
+	// UTF-8 の途中で分かれた出力は次の出力と合わせて 1 つのイベントにする
+	r.output([]byte("日")[:2])
+	r.output(append([]byte("日")[2:], '!'))
+	r.resize(100, 30)
+	r.resize(100, 30) // 大きさが変わらなければ記録しない
+	r.output([]byte("\x1b[1mbold\x1b[m"))
+	r.close()
+	r.output([]byte("after close"))
+
+	header, events := readCast(t, st.path(r.info.ID))
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Title != "main:1" {
+		t.Errorf("header = %+v", header)
+	}
+	if header.Palmux != (castMeta{Source: RecordingSourceAttach, Session: "main", Window: 1, Actor: "alice"}) {
+		t.Errorf("header.palmux = %+v", header.Palmux)
+	}
+	want := []string{"o:hello\r\n", "o:日!", "r:100x30", "o:\x1b[1mbold\x1b[m"}
+	if got := castEvents(events); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	last := -1.0
+	for _, ev := range events {
+		ts, ok := ev[0].(float64)
+		if !ok || ts < last {
+			t.Errorf("event time = %v, want non-decreasing seconds", ev[0])
+		}
+		last = ts
+	}
+
+	rec, err := st.Get(r.info.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if rec.Active || rec.Session != "main" || rec.Window != 1 || rec.Actor != "alice" || rec.Source != RecordingSourceAttach {
+		t.Errorf("Get() = %+v", rec)
+	}
+	info, _ := os.Stat(st.path(r.info.ID))
+	if rec.Size != info.Size() {
+		t.Errorf("size = %d, want %d", rec.Size, info.Size())
+	}
+}
+
+func TestRecordingStore_ListAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	st, err := OpenRecordingStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenRecordingStore() error = %v", err)
+	}
+	now := time.Now()
+	writeCast(t, dir, "old", "main", now.Add(-2*time.Hour), now.Add(-time.Hour), 0)
+
+	active, err := st.create(RecordingSourceWindow, "dev", 0, "", 80, 24)
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+	if _, err := st.create(RecordingSourceWindow, "dev", 0, "", 80, 24); !errors.Is(err, errRecordingActive) {
+		t.Errorf("create() for the same window error = %v, want errRecordingActive", err)
+	}
+
+	recs, err := st.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(recs) != 2 || recs[0].ID != active.info.ID || !recs[0].Active || recs[1].ID != "old" || recs[1].Active {
+		t.Fatalf("List() = %+v, want the active recording first", recs)
+	}
+	if d := recs[1].Duration; d < 3599 || d > 3601 {
+		t.Errorf("duration = %v, want about 3600", d)
+	}
+
+	// 録画中のものは止めてから削除する
+	if err := st.Delete(active.info.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	select {
+	case <-active.done:
+	default:
+		t.Error("recording was not stopped by Delete()")
+	}
+	if st.window("dev", 0) != nil {
+		t.Error("window recording is still registered after Delete()")
+	}
+	if _, err := st.Get(active.info.ID); !errors.Is(err, errRecordingNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want errRecordingNotFound", err)
+	}
+
+	for _, id := range []string{"missing", "../old", ""} {
+		if err := st.Delete(id); !errors.Is(err, errRecordingNotFound) {
+			t.Errorf("Delete(%q) error = %v, want errRecordingNotFound", id, err)
+		}
+	}
+}
+
+func TestRecordingStore_Prune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	// 保持期間（24 時間）を過ぎたもの
+	writeCast(t, dir, "expired", "main", now.Add(-50*time.Hour), now.Add(-48*time.Hour), 200)
+	// 合計サイズの上限（500 バイト）を超える分は古いものから削除する
+	writeCast(t, dir, "oldest", "main", now.Add(-3*time.Hour), now.Add(-3*time.Hour), 200)
+	writeCast(t, dir, "older", "main", now.Add(-2*time.Hour), now.Add(-2*time.Hour), 200)
+	writeCast(t, dir, "newest", "main", now.Add(-time.Hour), now.Add(-time.Hour), 200)
+	// 前回の異常終了で残った FIFO
+	os.WriteFile(filepath.Join(dir, "stale.fifo"), nil, 0600)
+
+	st, err := OpenRecordingStore(dir, 24*time.Hour, 500)
+	if err != nil {
+		t.Fatalf("OpenRecordingStore() error = %v", err)
+	}
+	recs, err := st.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var ids []string
+	for _, rec := range recs {
+		ids = append(ids, rec.ID)
+	}
+	if strings.Join(ids, ",") != "newest,older" {
+		t.Errorf("recordings after prune = %v, want [newest older]", ids)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stale.fifo")); !os.IsNotExist(err) {
+		t.Errorf("stale fifo was not removed: %v", err)
+	}
+}
@@ -1,11 +1,16 @@
 package server
 
 import (
+	"crypto/tls"
 	"io/fs"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tjst-t/palmux/internal/git"
 	"github.com/tjst-t/palmux/internal/grep"
@@ -23,15 +28,29 @@ type TmuxManager interface {
 	ListWindows(session string) ([]tmux.Window, error)
 	NewWindow(session, name, command string) (*tmux.Window, error)
 	KillWindow(session string, index int) error
-	SendKeys(session string, index int, key string) error
+	SendKeys(session string, index int, pane string, keys ...string) error
 	RenameWindow(session string, index int, name string) error
-	Attach(session string, windowIndex int) (*os.File, *exec.Cmd, error)
+	Attach(session string, windowIndex int, readOnly bool) (*os.File, *exec.Cmd, error)
 	CreateGroupedSession(target string) (string, error)
 	DestroyGroupedSession(name string) error
 	GetSessionCwd(session string) (string, error)
 	GetSessionProjectDir(session string) (string, error)
 	GetClientSessionWindow(tty string) (string, int, error)
+	RefreshClient(tty string) error
 	GetPaneCommand(session string, windowIndex int) (string, error)
+	GetPaneSize(session string, windowIndex int) (int, int, error)
+	PipePane(session string, windowIndex int, command string) error
+	CapturePane(session string, windowIndex int, pane string, escapes bool, history int) (string, error)
+	ListPanes(session string, windowIndex int) ([]tmux.Pane, error)
+	SplitPane(session string, windowIndex int, pane string, horizontal bool, command string) (*tmux.Pane, error)
+	SelectPane(session string, windowIndex int, pane string) error
+	KillPane(session string, windowIndex int, pane string) error
+	ZoomPane(session string, windowIndex int, pane string) error
+	ResizePane(session string, windowIndex int, pane string, width, height int) error
+	SwapPane(session string, windowIndex int, src, dst string) error
+	GetClientPane(tty string) (string, error)
+	SubscribeEvents() chan tmux.Event
+	UnsubscribeEvents(ch chan tmux.Event)
 	ListGhqRepos() ([]tmux.GhqRepo, error)
 	CloneGhqRepo(url string) (*tmux.GhqRepo, error)
 	DeleteGhqRepo(fullPath string) error
@@ -55,26 +74,73 @@ type Server struct {
 	lsp           lsp.LSPService
 	portman       portman.Runner
 	token         string
+	password      string
+	cookieAuth    *CookieAuth
+	tokens        *TokenStore
+	users         *UserStore
+	shares        *ShareStore
+	audit         *AuditLog
+	recordings    *RecordingStore
+	authThrottle  *authThrottle
+	origins       *originPolicy
+	clientCerts   *ClientCertAuth
+	autoTLS       *AutoTLS
 	basePath      string
+	publicURL     string
 	claudePath    string
 	handler       http.Handler
 	connTracker   *connectionTracker
+	attachments   *attachmentStore
 	notifications *NotificationStore
+	events        *eventBus
+	tmuxEvents    sharedProducer // /api/events の購読者がいる間だけ動く tmux の一覧の監視
+	lspEvents     sharedProducer // /api/events の購読者がいる間だけ動く言語サーバーの状態の監視
+	reload        func() ([]string, error)
+
+	// グレースフルシャットダウン（Shutdown）の状態
+	lifecycleMu  sync.Mutex
+	httpSrv      *http.Server
+	shuttingDown bool
+	shutdownCh   chan struct{} // シャットダウン開始時に close される
+	attachWG     sync.WaitGroup
+
+	// 稼働中に ApplySettings で変更される設定
+	settingsMu     sync.RWMutex
+	grepMaxResults int
+	maxUploadSize  int64
 }
 
 // Options は Server の生成オプション。
 type Options struct {
 	Tmux           TmuxManager
 	GitCmd         git.CommandRunner // git コマンドランナー（nil の場合 RealCommandRunner を使用）
-	Searcher       grep.Searcher    // 全文検索エンジン（nil の場合 grep.NewSearcher() を使用）
+	Searcher       grep.Searcher     // 全文検索エンジン（nil の場合 grep.NewSearcher() を使用）
 	LSP            lsp.LSPService    // LSP サービス（nil の場合 LSP 機能は無効）
 	Portman        portman.Runner    // portman ランナー（nil の場合 RealRunner を使用）
 	Token          string
+	Password       string          // ログインページで受け付ける追加のパスワード（空の場合はトークンのみ）
+	SessionTTL     time.Duration   // ログインセッション cookie の有効期間（デフォルト: 30 日）
+	SessionSecret  string          // セッション cookie 署名鍵の保存先（空の場合はメモリ上のみ）
+	Tokens         *TokenStore     // 名前付き API トークン（nil の場合は永続化しない空のストアを使用）
+	Users          *UserStore      // ユーザーアカウント（nil の場合は永続化しない空のストアを使用）
+	JWT            *JWTAuth        // リバースプロキシが付与する JWT の検証（nil の場合は JWT 認証を無効）
+	ClientCerts    *ClientCertAuth // 相互 TLS のクライアント証明書の検証（nil の場合はクライアント証明書を要求しない）
+	AutoTLS        *AutoTLS        // 自動生成したローカル CA・サーバー証明書（nil の場合は CA のダウンロードを提供しない）
+	Audit          *AuditLog       // 監査ログ（nil の場合は記録しない）
+	Recordings     *RecordingStore // 録画の保存先（nil の場合は録画機能を無効）
 	BasePath       string
-	ClaudePath     string // Claude コマンドのパス（デフォルト: "claude"）
-	Frontend       fs.FS  // 静的ファイル配信用 FS（テスト時は nil 可）
-	MaxConnections int    // 同一セッションへの最大同時接続数（デフォルト: 5）
+	PublicURL      string   // ブラウザから開く URL（共有リンクに使う。空の場合はリクエストから求める）
+	ClaudePath     string   // Claude コマンドのパス（デフォルト: "claude"）
+	Frontend       fs.FS    // 静的ファイル配信用 FS（テスト時は nil 可）
+	MaxConnections int      // 同一セッションへの最大同時接続数（デフォルト: 5）
+	MaxSpectators  int      // 同一セッションへの最大同時観戦接続数（デフォルト: 20）
+	AllowedOrigins []string // 同一オリジン以外に許可するブラウザのオリジン（"*" で全て許可）
+	TrustedProxies []string // 転送ヘッダーのクライアント IP を信頼するプロキシ（IP・CIDR・"unix"）
 	Version        string
+
+	// Reload は設定ファイルを再読み込みして反映し、再起動が必要な設定キーを返す。
+	// nil の場合は POST /api/config/reload を提供しない。
+	Reload func() ([]string, error)
 }
 
 // NewServer は Options を元に新しい Server を生成する。
@@ -100,6 +166,25 @@ func NewServer(opts Options) *Server {
 		portmanRunner = &portman.RealRunner{}
 	}
 
+	cookieAuth, err := NewCookieAuth(opts.SessionSecret, opts.SessionTTL)
+	if err != nil {
+		// 鍵ファイルが読めない場合はメモリ上の鍵で継続する（再起動でログアウトされる）
+		log.Printf("warning: %v; using in-memory session secret", err)
+		cookieAuth, _ = NewCookieAuth("", opts.SessionTTL)
+	}
+
+	tokens := opts.Tokens
+	if tokens == nil {
+		tokens, _ = NewTokenStore("")
+	}
+
+	users := opts.Users
+	if users == nil {
+		users, _ = NewUserStore("")
+	}
+
+	shares, _ := NewShareStore()
+
 	s := &Server{
 		tmux:          opts.Tmux,
 		gitCmd:        gitCmd,
@@ -107,16 +192,87 @@ func NewServer(opts Options) *Server {
 		lsp:           opts.LSP,
 		portman:       portmanRunner,
 		token:         opts.Token,
+		password:      opts.Password,
+		cookieAuth:    cookieAuth,
+		tokens:        tokens,
+		users:         users,
+		shares:        shares,
+		audit:         opts.Audit,
+		recordings:    opts.Recordings,
+		authThrottle:  newAuthThrottle(),
+		origins:       newOriginPolicy(opts.AllowedOrigins),
+		clientCerts:   opts.ClientCerts,
+		autoTLS:       opts.AutoTLS,
 		basePath:      NormalizeBasePath(opts.BasePath),
+		publicURL:     opts.PublicURL,
 		claudePath:    claudePath,
 		connTracker:   newConnectionTracker(opts.MaxConnections),
+		attachments:   newAttachmentStore(),
 		notifications: NewNotificationStore(),
+		events:        newEventBus(),
+		reload:        opts.Reload,
+		shutdownCh:    make(chan struct{}),
 	}
 
+	if opts.MaxSpectators > 0 {
+		s.connTracker.maxSpectatorsPerSession = opts.MaxSpectators
+	}
+	s.connTracker.events = s.events
+
 	mux := http.NewServeMux()
 
 	// 認証ミドルウェア
-	auth := AuthMiddleware(s.token)
+	authenticator := &Authenticator{
+		Token:   s.token,
+		Tokens:  s.tokens,
+		Cookies: s.cookieAuth,
+		Users:   s.users,
+		Shares:  s.shares,
+		JWT:     opts.JWT,
+
+		ClientCerts: opts.ClientCerts,
+
+		throttle: s.authThrottle,
+	}
+	// 認証後に状態変更リクエストを監査ログに記録する
+	auth := func(next http.Handler) http.Handler {
+		return authenticator.Middleware(s.auditMiddleware(next))
+	}
+
+	// 負荷の高いエンドポイントのクライアントごとのレート制限
+	grepLimit := newRateLimiter(grepRateLimit, grepRateBurst)
+	gitDiffLimit := newRateLimiter(gitDiffRateLimit, gitDiffRateBurst)
+	ghqCloneLimit := newRateLimiter(ghqCloneRateLimit, ghqCloneRateBurst)
+	scrollbackLimit := newRateLimiter(scrollbackRateLimit, scrollbackRateBurst)
+
+	// ログイン（認証不要）
+	mux.Handle("GET /login", s.handleLoginPage())
+	mux.Handle("POST /api/auth/login", s.handleLogin())
+	mux.Handle("POST /api/auth/logout", s.handleLogout())
+	if s.autoTLS != nil {
+		mux.Handle("GET /api/tls/ca.crt", s.handleGetCACert())
+	}
+	mux.Handle("POST /api/auth/logout-all", auth(s.handleLogoutAll()))
+	mux.Handle("GET /api/tokens", auth(s.handleListTokens()))
+	mux.Handle("POST /api/tokens", auth(s.handleCreateToken()))
+	mux.Handle("DELETE /api/tokens/{id}", auth(s.handleRevokeToken()))
+	mux.Handle("GET /api/users", auth(s.handleListUsers()))
+	mux.Handle("PUT /api/users/{name}", auth(s.handlePutUser()))
+	mux.Handle("DELETE /api/users/{name}", auth(s.handleDeleteUser()))
+	mux.Handle("GET /api/shares", auth(s.handleListShares()))
+	mux.Handle("POST /api/shares", auth(s.handleCreateShare()))
+	mux.Handle("DELETE /api/shares/{id}", auth(s.handleRevokeShare()))
+	mux.Handle("GET /api/audit", auth(s.handleQueryAudit()))
+	if s.recordings != nil {
+		mux.Handle("GET /api/recordings", auth(s.handleListRecordings()))
+		mux.Handle("GET /api/recordings/{id}", auth(s.handleGetRecording()))
+		mux.Handle("DELETE /api/recordings/{id}", auth(s.handleDeleteRecording()))
+		mux.Handle("POST /api/sessions/{session}/windows/{index}/recording", auth(s.handleStartRecording()))
+		mux.Handle("DELETE /api/sessions/{session}/windows/{index}/recording", auth(s.handleStopRecording()))
+	}
+	if s.reload != nil {
+		mux.Handle("POST /api/config/reload", auth(s.handleReloadConfig()))
+	}
 
 	// API ルート
 	mux.Handle("GET /api/sessions", auth(s.handleListSessions()))
@@ -127,18 +283,30 @@ func NewServer(opts Options) *Server {
 	mux.Handle("DELETE /api/sessions/{session}/windows/{index}", auth(s.handleDeleteWindow()))
 	mux.Handle("PATCH /api/sessions/{session}/windows/{index}", auth(s.handleRenameWindow()))
 	mux.Handle("GET /api/sessions/{session}/windows/{index}/attach", auth(s.handleAttach()))
+	mux.Handle("GET /api/mux", auth(s.handleMux()))
 	mux.Handle("GET /api/sessions/{session}/windows/{index}/command", auth(s.handleGetPaneCommand()))
+	mux.Handle("GET /api/sessions/{session}/windows/{index}/snapshot", auth(s.handleGetSnapshot()))
+	mux.Handle("GET /api/sessions/{session}/windows/{index}/panes", auth(s.handleListPanes()))
+	mux.Handle("POST /api/sessions/{session}/windows/{index}/panes", auth(s.handleSplitPane()))
+	mux.Handle("DELETE /api/sessions/{session}/windows/{index}/panes/{pane}", auth(s.handleDeletePane()))
+	mux.Handle("POST /api/sessions/{session}/windows/{index}/panes/{pane}/select", auth(s.handleSelectPane()))
+	mux.Handle("POST /api/sessions/{session}/windows/{index}/panes/{pane}/zoom", auth(s.handleZoomPane()))
+	mux.Handle("POST /api/sessions/{session}/windows/{index}/panes/{pane}/resize", auth(s.handleResizePane()))
+	mux.Handle("POST /api/sessions/{session}/windows/{index}/panes/{pane}/swap", auth(s.handleSwapPane()))
+	mux.Handle("POST /api/sessions/{session}/windows/{index}/panes/{pane}/keys", auth(s.handleSendPaneKeys()))
+	mux.Handle("GET /api/sessions/{session}/scrollback/search", auth(rateLimited(scrollbackLimit, s.handleSearchScrollback())))
 	mux.Handle("GET /api/sessions/{session}/cwd", auth(s.handleGetCwd()))
 	mux.Handle("GET /api/sessions/{session}/portman-urls", auth(s.handleGetPortmanURLs()))
 	mux.Handle("GET /api/sessions/{session}/github-url", auth(s.handleGetGitHubURL()))
 	mux.Handle("GET /api/sessions/{session}/commands", auth(s.handleGetCommands()))
 	mux.Handle("GET /api/sessions/{session}/files", auth(s.handleGetFiles()))
 	mux.Handle("GET /api/sessions/{session}/files/search", auth(s.handleSearchFiles()))
-	mux.Handle("GET /api/sessions/{session}/files/grep", auth(s.handleGrepSearch()))
+	mux.Handle("GET /api/sessions/{session}/files/grep", auth(rateLimited(grepLimit, s.handleGrepSearch())))
 	mux.Handle("PUT /api/sessions/{session}/files", auth(s.handlePutFile()))
 	mux.Handle("GET /api/connections", auth(s.handleListConnections()))
+	mux.Handle("GET /api/events", auth(s.handleEvents()))
 	mux.Handle("GET /api/ghq/repos", auth(s.handleListGhqRepos()))
-	mux.Handle("POST /api/ghq/repos", auth(s.handleCloneGhqRepo()))
+	mux.Handle("POST /api/ghq/repos", auth(rateLimited(ghqCloneLimit, s.handleCloneGhqRepo())))
 	mux.Handle("DELETE /api/ghq/repos", auth(s.handleDeleteGhqRepo()))
 	mux.Handle("GET /api/projects/{project}/worktrees", auth(s.handleListProjectWorktrees()))
 	mux.Handle("POST /api/projects/{project}/worktrees", auth(s.handleCreateProjectWorktree()))
@@ -150,7 +318,7 @@ func NewServer(opts Options) *Server {
 	mux.Handle("POST /api/sessions/{session}/claude/restart", auth(s.handleRestartClaudeWindow()))
 	mux.Handle("GET /api/sessions/{session}/git/status", auth(s.handleGitStatus()))
 	mux.Handle("GET /api/sessions/{session}/git/log", auth(s.handleGitLog()))
-	mux.Handle("GET /api/sessions/{session}/git/diff", auth(s.handleGitDiff()))
+	mux.Handle("GET /api/sessions/{session}/git/diff", auth(rateLimited(gitDiffLimit, s.handleGitDiff())))
 	mux.Handle("GET /api/sessions/{session}/git/show", auth(s.handleGitShow()))
 	mux.Handle("GET /api/sessions/{session}/git/branches", auth(s.handleGitBranches()))
 	mux.Handle("POST /api/sessions/{session}/git/discard", auth(s.handleGitDiscard()))
@@ -174,18 +342,23 @@ func NewServer(opts Options) *Server {
 		mux.Handle("/", &indexInjector{
 			fs:         opts.Frontend,
 			basePath:   s.basePath,
-			token:      s.token,
 			claudePath: s.claudePath,
 			version:    opts.Version,
 			fallback:   fileServer,
 		})
 	}
 
+	// 状態を変更するクロスオリジンリクエストを拒否する（CSRF 対策）
+	handler := s.originMiddleware(mux)
+
+	// 信頼するリバースプロキシ経由の場合は転送ヘッダーのクライアント IP を使う
+	handler = newTrustedProxies(opts.TrustedProxies).middleware(handler)
+
 	// ベースパスが "/" の場合は StripPrefix 不要
 	if s.basePath == "/" {
-		s.handler = mux
+		s.handler = handler
 	} else {
-		s.handler = http.StripPrefix(strings.TrimSuffix(s.basePath, "/"), mux)
+		s.handler = http.StripPrefix(strings.TrimSuffix(s.basePath, "/"), handler)
 	}
 
 	return s
@@ -197,22 +370,71 @@ func (s *Server) Handler() http.Handler {
 }
 
 // ListenAndServe は指定アドレスで HTTP サーバーを起動する。
+// addr には "host:port" または "unix:/path/to.sock" を指定できる。
+// Shutdown が呼ばれると http.ErrServerClosed を返す。
 func (s *Server) ListenAndServe(addr string) error {
-	return http.ListenAndServe(addr, s.handler)
+	ln, err := Listen(addr, defaultSocketMode)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
 }
 
 // ListenAndServeTLS は指定アドレスで TLS 付き HTTP サーバーを起動する。
+// ClientCerts が設定されている場合はクライアント証明書を必須とする（相互 TLS）。
+// AutoTLS が設定されている場合は certFile・keyFile を空にすると自動生成した証明書を使用する。
 func (s *Server) ListenAndServeTLS(addr, certFile, keyFile string) error {
-	return http.ListenAndServeTLS(addr, certFile, keyFile, s.handler)
+	ln, err := Listen(addr, defaultSocketMode)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(ln, certFile, keyFile)
+}
+
+// Serve は ln で HTTP サーバーを起動する（Unix ソケット・systemd から渡されたソケット等）。
+// 複数の Listener で同時に呼び出すことができ、Shutdown で全て停止する。
+func (s *Server) Serve(ln net.Listener) error {
+	hs, err := s.serving()
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	return hs.Serve(ln)
+}
+
+// ServeTLS は ln で TLS 付き HTTP サーバーを起動する。証明書の扱いは ListenAndServeTLS と同じ。
+func (s *Server) ServeTLS(ln net.Listener, certFile, keyFile string) error {
+	hs, err := s.serving()
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	return hs.ServeTLS(ln, certFile, keyFile)
+}
+
+// httpServer は TLS 設定を適用した http.Server を返す。
+func (s *Server) httpServer() *http.Server {
+	srv := &http.Server{Handler: s.handler}
+	if s.clientCerts != nil {
+		srv.TLSConfig = s.clientCerts.TLSConfig()
+	}
+	if s.autoTLS != nil {
+		if srv.TLSConfig == nil {
+			srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		srv.TLSConfig.GetCertificate = s.autoTLS.GetCertificate
+	}
+	return srv
 }
 
 // indexInjector は index.html のリクエストを横取りして、
-// base-path と auth-token と app-version と claude-path の meta タグに実際の値を注入するハンドラ。
+// base-path と app-version と claude-path の meta タグに実際の値を注入するハンドラ。
+// index.html は認証なしで取得できるため、auth-token には何も注入しない。
+// ブラウザはログインページで発行されるセッション cookie で認証する。
 // それ以外のリクエストは fallback ハンドラに委譲する。
 type indexInjector struct {
 	fs         fs.FS
 	basePath   string
-	token      string
 	claudePath string
 	version    string
 	fallback   http.Handler
@@ -246,11 +468,6 @@ func (h *indexInjector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			`<meta name="base-path" content="/">`,
 			`<meta name="base-path" content="`+h.basePath+`">`,
 			1)
-		// auth-token meta タグの content 属性を置換
-		html = strings.Replace(html,
-			`<meta name="auth-token" content="">`,
-			`<meta name="auth-token" content="`+h.token+`">`,
-			1)
 		// app-version meta タグの content 属性を置換
 		html = strings.Replace(html,
 			`<meta name="app-version" content="">`,
@@ -28,13 +28,13 @@ func (m *mockTmuxManager) NewWindow(session, name, command string) (*tmux.Window
 	return &tmux.Window{}, nil
 }
 func (m *mockTmuxManager) KillWindow(session string, index int) error { return nil }
-func (m *mockTmuxManager) SendKeys(session string, index int, key string) error {
+func (m *mockTmuxManager) SendKeys(session string, index int, pane string, keys ...string) error {
 	return nil
 }
 func (m *mockTmuxManager) RenameWindow(session string, index int, name string) error {
 	return nil
 }
-func (m *mockTmuxManager) Attach(session string, windowIndex int) (*os.File, *exec.Cmd, error) {
+func (m *mockTmuxManager) Attach(session string, windowIndex int, readOnly bool) (*os.File, *exec.Cmd, error) {
 	return nil, nil, nil
 }
 func (m *mockTmuxManager) CreateGroupedSession(target string) (string, error) {
@@ -53,10 +53,38 @@ func (m *mockTmuxManager) DeleteGhqRepo(fullPath string) error { return nil }
 func (m *mockTmuxManager) GetClientSessionWindow(tty string) (string, int, error) {
 	return "", -1, fmt.Errorf("not implemented")
 }
+func (m *mockTmuxManager) RefreshClient(tty string) error   { return nil }
 func (m *mockTmuxManager) IsGhqSession(session string) bool { return false }
 func (m *mockTmuxManager) GetPaneCommand(session string, windowIndex int) (string, error) {
 	return "bash", nil
 }
+func (m *mockTmuxManager) GetPaneSize(session string, windowIndex int) (int, int, error) {
+	return 80, 24, nil
+}
+func (m *mockTmuxManager) PipePane(session string, windowIndex int, command string) error {
+	return nil
+}
+func (m *mockTmuxManager) CapturePane(session string, windowIndex int, pane string, escapes bool, history int) (string, error) {
+	return "", nil
+}
+func (m *mockTmuxManager) ListPanes(session string, windowIndex int) ([]tmux.Pane, error) {
+	return nil, nil
+}
+func (m *mockTmuxManager) SplitPane(session string, windowIndex int, pane string, horizontal bool, command string) (*tmux.Pane, error) {
+	return &tmux.Pane{}, nil
+}
+func (m *mockTmuxManager) SelectPane(session string, windowIndex int, pane string) error { return nil }
+func (m *mockTmuxManager) KillPane(session string, windowIndex int, pane string) error   { return nil }
+func (m *mockTmuxManager) ZoomPane(session string, windowIndex int, pane string) error   { return nil }
+func (m *mockTmuxManager) ResizePane(session string, windowIndex int, pane string, width, height int) error {
+	return nil
+}
+func (m *mockTmuxManager) SwapPane(session string, windowIndex int, src, dst string) error {
+	return nil
+}
+func (m *mockTmuxManager) GetClientPane(tty string) (string, error) { return "", nil }
+func (m *mockTmuxManager) SubscribeEvents() chan tmux.Event         { return nil }
+func (m *mockTmuxManager) UnsubscribeEvents(ch chan tmux.Event)     {}
 func (m *mockTmuxManager) EnsureClaudeWindow(session, claudePath string) (*tmux.Window, error) {
 	return nil, fmt.Errorf("not implemented")
 }
@@ -330,6 +358,20 @@ func TestServer_RoutingWithBasePathRoot(t *testing.T) {
 			withToken:  false,
 			wantStatus: http.StatusUnauthorized,
 		},
+		{
+			name:       "GET /api/mux: 認証あり → 426 (WebSocket Upgrade Required)",
+			method:     http.MethodGet,
+			path:       "/api/mux",
+			withToken:  true,
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:       "GET /api/events: 認証あり → 426 (WebSocket Upgrade Required)",
+			method:     http.MethodGet,
+			path:       "/api/events",
+			withToken:  true,
+			wantStatus: http.StatusUpgradeRequired,
+		},
 		{
 			name:       "GET /: 静的ファイル → 200 (認証不要)",
 			method:     http.MethodGet,
@@ -627,23 +669,20 @@ func TestServer_IndexHTMLInjection(t *testing.T) {
 		token        string
 		requestPath  string
 		wantBasePath string
-		wantToken    string
 	}{
 		{
-			name:         "ルートパス: basePathとtokenが注入される",
+			name:         "ルートパス: basePathが注入される",
 			basePath:     "/",
 			token:        "my-secret-token",
 			requestPath:  "/",
 			wantBasePath: `content="/"`,
-			wantToken:    `content="my-secret-token"`,
 		},
 		{
-			name:         "/index.html でもbasePathとtokenが注入される",
+			name:         "/index.html でもbasePathが注入される",
 			basePath:     "/",
 			token:        "my-secret-token",
 			requestPath:  "/index.html",
 			wantBasePath: `content="/"`,
-			wantToken:    `content="my-secret-token"`,
 		},
 		{
 			name:         "カスタムbasePath: basePathが注入される",
@@ -651,7 +690,6 @@ func TestServer_IndexHTMLInjection(t *testing.T) {
 			token:        "abc123",
 			requestPath:  "/palmux/",
 			wantBasePath: `content="/palmux/"`,
-			wantToken:    `content="abc123"`,
 		},
 		{
 			name:         "深いネストパス: basePathが注入される",
@@ -659,7 +697,6 @@ func TestServer_IndexHTMLInjection(t *testing.T) {
 			token:        "deep-token",
 			requestPath:  "/deep/nested/path/",
 			wantBasePath: `content="/deep/nested/path/"`,
-			wantToken:    `content="deep-token"`,
 		},
 	}
 
@@ -698,12 +735,12 @@ func TestServer_IndexHTMLInjection(t *testing.T) {
 				t.Errorf("body should contain %q for base-path, got %q", tt.wantBasePath, body)
 			}
 
-			// auth-token meta タグの値が注入されている
-			if !strings.Contains(body, `name="auth-token"`) {
-				t.Errorf("body should contain auth-token meta tag, got %q", body)
+			// 認証なしで取得できるため auth-token は注入されない
+			if strings.Contains(body, tt.token) {
+				t.Errorf("body should not contain auth token %q, got %q", tt.token, body)
 			}
-			if !strings.Contains(body, tt.wantToken) {
-				t.Errorf("body should contain %q for auth-token, got %q", tt.wantToken, body)
+			if !strings.Contains(body, `<meta name="auth-token" content="">`) {
+				t.Errorf("auth-token meta tag should stay empty, got %q", body)
 			}
 
 			// Content-Type が text/html
@@ -810,6 +847,8 @@ func TestServer_APIRoutesRequireAuth(t *testing.T) {
 		{http.MethodPatch, "/api/sessions/test/windows/0"},
 		{http.MethodGet, "/api/sessions/test/windows/0/attach"},
 		{http.MethodGet, "/api/connections"},
+		{http.MethodGet, "/api/events"},
+		{http.MethodGet, "/api/mux"},
 	}
 
 	for _, route := range apiRoutes {
@@ -991,12 +1030,12 @@ func TestServer_TLS_IndexHTMLInjectionOverTLS(t *testing.T) {
 	n, _ := resp.Body.Read(bodyBytes)
 	body := string(bodyBytes[:n])
 
-	// base-path と token が注入されている
+	// base-path が注入され、token は注入されない
 	if !strings.Contains(body, `content="/secure/"`) {
 		t.Errorf("body should contain injected base-path '/secure/', got %q", body)
 	}
-	if !strings.Contains(body, `content="tls-test-token"`) {
-		t.Errorf("body should contain injected token, got %q", body)
+	if strings.Contains(body, token) {
+		t.Errorf("body should not contain auth token, got %q", body)
 	}
 }
 
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/grep"
+)
+
+// defaultMaxUploadSize は画像アップロードの最大サイズのデフォルト値。
+const defaultMaxUploadSize = 10 << 20 // 10MB
+
+// RuntimeSettings はサーバーの稼働中に変更できる設定。
+// ゼロ値のフィールドはデフォルト値を使用する。
+type RuntimeSettings struct {
+	MaxConnections  int           // 同一セッションへの最大同時接続数（デフォルト: 5）
+	MaxSpectators   int           // 同一セッションへの最大同時観戦接続数（デフォルト: 20）
+	AllowedOrigins  []string      // 同一オリジン以外に許可するブラウザのオリジン
+	Searcher        grep.Searcher // 全文検索エンジン（nil の場合は変更しない）
+	GrepMaxResults  int           // 1 回の検索で返す最大件数の上限（デフォルト: 500）
+	NotificationTTL time.Duration // 通知が自動で消えるまでの時間（デフォルト: 30 分）
+	MaxUploadSize   int64         // 画像アップロードの最大バイト数（デフォルト: 10MB）
+}
+
+// ApplySettings は稼働中のサーバーに rs を反映する。
+// 既存の WebSocket 接続は切断せず、以降の接続・リクエストから新しい設定を使う。
+func (s *Server) ApplySettings(rs RuntimeSettings) {
+	s.connTracker.setLimits(rs.MaxConnections, rs.MaxSpectators)
+	s.origins.set(rs.AllowedOrigins)
+	s.notifications.SetTTL(rs.NotificationTTL)
+
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if rs.Searcher != nil {
+		s.searcher = rs.Searcher
+	}
+	s.grepMaxResults = rs.GrepMaxResults
+	s.maxUploadSize = rs.MaxUploadSize
+}
+
+// currentSearcher は現在の全文検索エンジンを返す。
+func (s *Server) currentSearcher() grep.Searcher {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.searcher
+}
+
+// grepMaxResultsLimit は 1 回の検索で返す最大件数の上限を返す。
+func (s *Server) grepMaxResultsLimit() int {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	if s.grepMaxResults <= 0 {
+		return 500
+	}
+	return s.grepMaxResults
+}
+
+// uploadSizeLimit は画像アップロードの最大バイト数を返す。
+func (s *Server) uploadSizeLimit() int64 {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	if s.maxUploadSize <= 0 {
+		return defaultMaxUploadSize
+	}
+	return s.maxUploadSize
+}
+
+// handleReloadConfig は POST /api/config/reload のハンドラ（admin のみ）。
+// 設定ファイルを再読み込みし、再起動が必要な変更があればそのキーを返す。
+// 設定ファイルが不正な場合は 400 を返し、現在の設定を維持する。
+func (s *Server) handleReloadConfig() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		restartRequired, err := s.reload()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if restartRequired == nil {
+			restartRequired = []string{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"reloaded":         true,
+			"restart_required": restartRequired,
+		})
+	})
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/grep"
+)
+
+func TestServer_ApplySettings(t *testing.T) {
+	root := setupFilesTestDir(t)
+	oldSearcher := &mockSearcher{name: "old"}
+	newSearcher := &mockSearcher{name: "new"}
+
+	const token = "test-token"
+	srv := NewServer(Options{
+		Tmux:     &configurableMock{cwd: root},
+		Token:    token,
+		BasePath: "/",
+		Searcher: oldSearcher,
+	})
+
+	srv.ApplySettings(RuntimeSettings{
+		MaxConnections:  2,
+		MaxSpectators:   1,
+		AllowedOrigins:  []string{"https://app.example.com"},
+		Searcher:        newSearcher,
+		GrepMaxResults:  50,
+		NotificationTTL: time.Minute,
+		MaxUploadSize:   1 << 20,
+	})
+
+	t.Run("接続数の上限", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := srv.connTracker.add("main", "127.0.0.1", ""); err != nil {
+				t.Fatalf("add() #%d error = %v", i, err)
+			}
+		}
+		if _, err := srv.connTracker.add("main", "127.0.0.1", ""); err == nil {
+			t.Error("add() beyond new limit succeeded, want error")
+		}
+		if _, err := srv.connTracker.addSpectator("main", "127.0.0.1", ""); err != nil {
+			t.Fatalf("addSpectator() error = %v", err)
+		}
+		if _, err := srv.connTracker.addSpectator("main", "127.0.0.1", ""); err == nil {
+			t.Error("addSpectator() beyond new limit succeeded, want error")
+		}
+	})
+
+	t.Run("許可オリジン", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sessions", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		if !srv.origins.allowed(req) {
+			t.Error("newly allowed origin was rejected")
+		}
+	})
+
+	t.Run("検索エンジンと件数の上限", func(t *testing.T) {
+		rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/sessions/main/files/grep?q=hello&limit=1000", token, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		if oldSearcher.calledQuery != "" {
+			t.Error("old searcher was used after ApplySettings")
+		}
+		if newSearcher.calledOpts.MaxResults != 50 {
+			t.Errorf("MaxResults = %d, want 50 (capped by grep max results)", newSearcher.calledOpts.MaxResults)
+		}
+		var resp grep.Response
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp.Engine != "new" {
+			t.Errorf("engine = %q, want %q", resp.Engine, "new")
+		}
+	})
+
+	t.Run("通知の TTL とアップロード上限", func(t *testing.T) {
+		if srv.notifications.ttl != time.Minute {
+			t.Errorf("notification ttl = %v, want 1m", srv.notifications.ttl)
+		}
+		if got := srv.uploadSizeLimit(); got != 1<<20 {
+			t.Errorf("uploadSizeLimit() = %d, want %d", got, 1<<20)
+		}
+	})
+
+	t.Run("ゼロ値はデフォルトに戻す", func(t *testing.T) {
+		srv.ApplySettings(RuntimeSettings{})
+		if got := srv.grepMaxResultsLimit(); got != 500 {
+			t.Errorf("grepMaxResultsLimit() = %d, want 500", got)
+		}
+		if got := srv.uploadSizeLimit(); got != defaultMaxUploadSize {
+			t.Errorf("uploadSizeLimit() = %d, want %d", got, defaultMaxUploadSize)
+		}
+		if srv.currentSearcher() != newSearcher {
+			t.Error("nil Searcher must keep the current searcher")
+		}
+	})
+}
+
+func TestHandleReloadConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		reload     func() ([]string, error)
+		wantStatus int
+		wantKeys   []string
+	}{
+		{
+			name:       "再起動不要",
+			reload:     func() ([]string, error) { return nil, nil },
+			wantStatus: http.StatusOK,
+			wantKeys:   []string{},
+		},
+		{
+			name:       "再起動が必要な変更あり",
+			reload:     func() ([]string, error) { return []string{"server.port"}, nil },
+			wantStatus: http.StatusOK,
+			wantKeys:   []string{"server.port"},
+		},
+		{
+			name:       "不正な設定ファイル",
+			reload:     func() ([]string, error) { return nil, errors.New("unknown key \"server.prot\"") },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const token = "test-token"
+			srv := NewServer(Options{
+				Tmux:     &configurableMock{},
+				Token:    token,
+				BasePath: "/",
+				Reload:   tt.reload,
+			})
+
+			rec := doRequest(t, srv.Handler(), http.MethodPost, "/api/config/reload", token, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Reloaded        bool     `json:"reloaded"`
+				RestartRequired []string `json:"restart_required"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !resp.Reloaded || !reflect.DeepEqual(resp.RestartRequired, tt.wantKeys) {
+				t.Errorf("response = %+v, want restart_required %v", resp, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestHandleReloadConfig_NotRegisteredWithoutReload(t *testing.T) {
+	srv, token := newTestServer(&configurableMock{})
+	rec := doRequest(t, srv.Handler(), http.MethodPost, "/api/config/reload", token, "")
+	if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 404 or 405", rec.Code)
+	}
+}
+
+func TestHandleReloadConfig_RequiresAdmin(t *testing.T) {
+	srv := NewServer(Options{
+		Tmux:     &configurableMock{},
+		Token:    "test-token",
+		BasePath: "/",
+		Reload:   func() ([]string, error) { return nil, nil },
+	})
+	if _, err := srv.users.Put(User{Name: "op", Role: RoleOperator}, "pw"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	cookie := loginAsUser(t, srv.Handler(), "op", "pw")
+
+	rec := doCookieRequest(srv.Handler(), http.MethodPost, "/api/config/reload", cookie)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
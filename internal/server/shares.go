@@ -0,0 +1,219 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultShareTTL は共有リンクのデフォルト有効期間。
+const defaultShareTTL = time.Hour
+
+// maxShareTTL は共有リンクに指定できる最大有効期間。
+const maxShareTTL = 7 * 24 * time.Hour
+
+// shareCheckInterval は共有リンク経由の WebSocket 接続が
+// 失効・期限切れになっていないかを確認する間隔。テスト時に上書き可能。
+var shareCheckInterval = 5 * time.Second
+
+// Share は単一セッション（またはウィンドウ）への期限付き共有リンクを表す。
+// リンク自体がクレーム（セッション・ウィンドウ・有効期限・読み取り専用）を署名付きで保持し、
+// ShareStore に登録されている間のみ有効となる。
+type Share struct {
+	ID        string    `json:"id"`
+	Session   string    `json:"session"`
+	Window    *int      `json:"window,omitempty"` // nil の場合はセッション内の全ウィンドウ
+	ReadOnly  bool      `json:"read_only"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// shareClaims は共有リンクのトークンに署名付きで格納するクレーム。
+type shareClaims struct {
+	ID        string `json:"id"`
+	Session   string `json:"session"`
+	Window    *int   `json:"window,omitempty"`
+	ReadOnly  bool   `json:"ro,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Allows は共有リンクがリクエストを許可するかどうかを返す。
+// 許可するのは対象セッションのウィンドウ一覧と、対象ウィンドウへの attach のみ。
+func (c *shareClaims) Allows(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.PathValue("session") != c.Session {
+		return false
+	}
+	if strings.HasSuffix(r.URL.Path, "/windows") {
+		return true
+	}
+	if !strings.HasSuffix(r.URL.Path, "/attach") {
+		return false
+	}
+	if c.Window == nil {
+		return true
+	}
+	idx, err := strconv.Atoi(r.PathValue("index"))
+	return err == nil && idx == *c.Window
+}
+
+// ShareStore は共有リンクの発行・検証・失効を管理する。
+// 署名鍵と有効なリンクはメモリ上にのみ保持するため、サーバーを再起動すると全リンクが無効になる。
+type ShareStore struct {
+	mu     sync.Mutex
+	shares map[string]*Share // key: ID
+	secret []byte
+}
+
+// NewShareStore は新しい署名鍵で ShareStore を生成する。
+func NewShareStore() (*ShareStore, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate share secret: %w", err)
+	}
+	return &ShareStore{
+		shares: make(map[string]*Share),
+		secret: secret,
+	}, nil
+}
+
+// Create は共有リンクを発行し、メタデータとリンク用トークンを返す。
+// ttl が 0 以下の場合は defaultShareTTL を使用する。
+func (ss *ShareStore) Create(session string, window *int, readOnly bool, ttl time.Duration, createdBy string) (Share, string, error) {
+	if session == "" {
+		return Share{}, "", fmt.Errorf("session is required")
+	}
+	if window != nil && *window < 0 {
+		return Share{}, "", fmt.Errorf("invalid window index %d", *window)
+	}
+	if ttl <= 0 {
+		ttl = defaultShareTTL
+	}
+	if ttl > maxShareTTL {
+		return Share{}, "", fmt.Errorf("ttl must not exceed %s", maxShareTTL)
+	}
+
+	now := time.Now()
+	sh := &Share{
+		ID:        generateConnID()[:12],
+		Session:   session,
+		Window:    window,
+		ReadOnly:  readOnly,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	payload, err := json.Marshal(shareClaims{
+		ID:        sh.ID,
+		Session:   sh.Session,
+		Window:    sh.Window,
+		ReadOnly:  sh.ReadOnly,
+		ExpiresAt: sh.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return Share{}, "", fmt.Errorf("encode share claims: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.shares[sh.ID] = sh
+	return *sh, encoded + "." + ss.sign(encoded), nil
+}
+
+// List は有効な共有リンクを作成日時順に返す。期限切れのリンクはこの時点で削除する。
+func (ss *ShareStore) List() []Share {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	now := time.Now()
+	result := make([]Share, 0, len(ss.shares))
+	for id, sh := range ss.shares {
+		if !now.Before(sh.ExpiresAt) {
+			delete(ss.shares, id)
+			continue
+		}
+		result = append(result, *sh)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Get は指定 ID の有効な共有リンクを返す。
+func (ss *ShareStore) Get(id string) (Share, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sh, ok := ss.shares[id]
+	if !ok || !time.Now().Before(sh.ExpiresAt) {
+		return Share{}, false
+	}
+	return *sh, true
+}
+
+// Revoke は指定 ID の共有リンクを無効化する。存在しない場合は false を返す。
+func (ss *ShareStore) Revoke(id string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, ok := ss.shares[id]; !ok {
+		return false
+	}
+	delete(ss.shares, id)
+	return true
+}
+
+// Active は指定 ID の共有リンクが失効・期限切れになっていないかを返す。
+func (ss *ShareStore) Active(id string) bool {
+	_, ok := ss.Get(id)
+	return ok
+}
+
+// Lookup はリンク用トークンの署名・有効期限を検証し、失効していなければクレームを返す。
+func (ss *ShareStore) Lookup(token string) (shareClaims, bool) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || encoded == "" || sig == "" {
+		return shareClaims{}, false
+	}
+	if !hmac.Equal([]byte(sig), []byte(ss.sign(encoded))) {
+		return shareClaims{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return shareClaims{}, false
+	}
+	var claims shareClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return shareClaims{}, false
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return shareClaims{}, false
+	}
+	if !ss.Active(claims.ID) {
+		return shareClaims{}, false
+	}
+	return claims, true
+}
+
+// sign は encoded に対する HMAC-SHA256 署名を base64url で返す。
+func (ss *ShareStore) sign(encoded string) string {
+	mac := hmac.New(sha256.New, ss.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
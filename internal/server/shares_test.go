@@ -0,0 +1,153 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShareStore_CreateLookupRevoke(t *testing.T) {
+	ss, err := NewShareStore()
+	if err != nil {
+		t.Fatalf("NewShareStore() error = %v", err)
+	}
+
+	window := 2
+	share, token, err := ss.Create("main", &window, true, time.Hour, "master")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	claims, ok := ss.Lookup(token)
+	if !ok {
+		t.Fatal("Lookup() should accept a freshly created share")
+	}
+	if claims.ID != share.ID || claims.Session != "main" || claims.Window == nil || *claims.Window != 2 || !claims.ReadOnly {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if got := ss.List(); len(got) != 1 || got[0].ID != share.ID {
+		t.Errorf("List() = %+v, want [%s]", got, share.ID)
+	}
+
+	if !ss.Revoke(share.ID) {
+		t.Fatal("Revoke() = false, want true")
+	}
+	if _, ok := ss.Lookup(token); ok {
+		t.Error("Lookup() should reject a revoked share")
+	}
+	if ss.Revoke(share.ID) {
+		t.Error("second Revoke() = true, want false")
+	}
+}
+
+func TestShareStore_LookupRejectsInvalid(t *testing.T) {
+	ss, _ := NewShareStore()
+	other, _ := NewShareStore()
+
+	_, token, err := ss.Create("main", nil, false, time.Hour, "master")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	_, foreign, _ := other.Create("main", nil, false, time.Hour, "master")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "空文字", token: ""},
+		{name: "署名なし", token: "abc"},
+		{name: "改ざんされた署名", token: token + "x"},
+		{name: "別の鍵で署名", token: foreign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ss.Lookup(tt.token); ok {
+				t.Errorf("Lookup(%q) should fail", tt.token)
+			}
+		})
+	}
+}
+
+func TestShareStore_Expired(t *testing.T) {
+	ss, _ := NewShareStore()
+	share, token, err := ss.Create("main", nil, false, time.Hour, "master")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// 有効期限を過去にずらす
+	ss.mu.Lock()
+	ss.shares[share.ID].ExpiresAt = time.Now().Add(-time.Second)
+	ss.mu.Unlock()
+
+	if ss.Active(share.ID) {
+		t.Error("Active() should be false for an expired share")
+	}
+	if _, ok := ss.Lookup(token); ok {
+		t.Error("Lookup() should reject an expired share")
+	}
+	if got := ss.List(); len(got) != 0 {
+		t.Errorf("List() = %+v, want empty", got)
+	}
+}
+
+func TestShareStore_CreateValidation(t *testing.T) {
+	ss, _ := NewShareStore()
+	negative := -1
+
+	if _, _, err := ss.Create("", nil, false, time.Hour, "master"); err == nil {
+		t.Error("Create() with empty session should fail")
+	}
+	if _, _, err := ss.Create("main", &negative, false, time.Hour, "master"); err == nil {
+		t.Error("Create() with negative window should fail")
+	}
+	if _, _, err := ss.Create("main", nil, false, maxShareTTL+time.Hour, "master"); err == nil {
+		t.Error("Create() with too long ttl should fail")
+	}
+	share, _, err := ss.Create("main", nil, false, 0, "master")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := share.ExpiresAt.Sub(share.CreatedAt); got != defaultShareTTL {
+		t.Errorf("default ttl = %v, want %v", got, defaultShareTTL)
+	}
+}
+
+func TestShareClaims_Allows(t *testing.T) {
+	window := 1
+	tests := []struct {
+		name   string
+		window *int
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "対象ウィンドウへのattachを許可", window: &window, method: http.MethodGet, path: "/api/sessions/main/windows/1/attach", want: true},
+		{name: "別ウィンドウへのattachを拒否", window: &window, method: http.MethodGet, path: "/api/sessions/main/windows/0/attach", want: false},
+		{name: "ウィンドウ指定なしは全ウィンドウを許可", window: nil, method: http.MethodGet, path: "/api/sessions/main/windows/3/attach", want: true},
+		{name: "ウィンドウ一覧を許可", window: &window, method: http.MethodGet, path: "/api/sessions/main/windows", want: true},
+		{name: "別セッションを拒否", window: nil, method: http.MethodGet, path: "/api/sessions/other/windows/0/attach", want: false},
+		{name: "ファイル閲覧を拒否", window: nil, method: http.MethodGet, path: "/api/sessions/main/files", want: false},
+		{name: "ウィンドウ作成を拒否", window: nil, method: http.MethodPost, path: "/api/sessions/main/windows", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			var got bool
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				c := &shareClaims{Session: "main", Window: tt.window}
+				got = c.Allows(r)
+			}
+			mux.HandleFunc("/api/sessions/{session}/windows/{index}/attach", handler)
+			mux.HandleFunc("/api/sessions/{session}/windows", handler)
+			mux.HandleFunc("/api/sessions/{session}/files", handler)
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			if got != tt.want {
+				t.Errorf("Allows(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
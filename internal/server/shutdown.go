@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// shutdownNotifyTimeout は server_shutdown メッセージの送信を待つ時間。
+const shutdownNotifyTimeout = time.Second
+
+// Shutdown はサーバーをグレースフルに停止する。
+// 新しい接続の受け付けを止め、接続中の WebSocket クライアントに server_shutdown を送って切断し、
+// 各接続のクリーンアップ（tmux attach の終了・グループセッションの削除）、ウィンドウの録画の停止と
+// 処理中の HTTP リクエスト（git 操作等）の完了を待つ。
+// ctx が先に終了した場合は待機を打ち切って ctx のエラーを返す。
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	if !s.shuttingDown {
+		s.shuttingDown = true
+		close(s.shutdownCh)
+	}
+	hs := s.httpSrv
+	s.lifecycleMu.Unlock()
+
+	// ウィンドウの録画を止める（pipe-pane を閉じて録画ファイルを完結させる）
+	s.stopWindowRecordings()
+
+	// http.Server.Shutdown はハイジャックされた WebSocket 接続を待たないため、attach は別途待つ
+	var err error
+	if hs != nil {
+		err = hs.Shutdown(ctx)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.attachWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+// serving は Serve で共有する http.Server を返す（初回に生成して Shutdown の対象として登録する）。
+// シャットダウン開始後は http.ErrServerClosed を返す。
+func (s *Server) serving() (*http.Server, error) {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	if s.shuttingDown {
+		return nil, http.ErrServerClosed
+	}
+	if s.httpSrv == nil {
+		s.httpSrv = s.httpServer()
+	}
+	return s.httpSrv, nil
+}
+
+// beginAttach は attach 接続を Shutdown の待機対象に登録する。
+// シャットダウン中の場合は登録せずに false を返す。
+// true を返した場合、呼び出し側は接続のクリーンアップ後に s.attachWG.Done() を呼ぶ。
+func (s *Server) beginAttach() bool {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	if s.shuttingDown {
+		return false
+	}
+	s.attachWG.Add(1)
+	return true
+}
+
+// watchShutdown はサーバーのシャットダウン開始を監視し、
+// クライアントに server_shutdown を送って再接続を促してから WebSocket 接続を閉じる。
+func (s *Server) watchShutdown(ctx context.Context, writeWS func(context.Context, []byte) error, conn *websocket.Conn, cleanup func()) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-s.shutdownCh:
+	}
+
+	if data, err := json.Marshal(wsOutputMessage{Type: "server_shutdown"}); err == nil {
+		writeCtx, cancel := context.WithTimeout(ctx, shutdownNotifyTimeout)
+		writeWS(writeCtx, data)
+		cancel()
+	}
+	conn.Close(websocket.StatusGoingAway, "server shutting down")
+	cleanup()
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+func TestServer_Shutdown_DrainsWebSockets(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	// クライアント側: server_shutdown を受信した後、GoingAway で閉じられることを確認する
+	type result struct {
+		gotShutdown bool
+		closeStatus websocket.StatusCode
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		var res result
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				res.closeStatus = websocket.CloseStatus(err)
+				resCh <- res
+				return
+			}
+			var msg wsTestMessage
+			if json.Unmarshal(data, &msg) == nil && msg.Type == "server_shutdown" {
+				res.gotShutdown = true
+			}
+		}
+	}()
+
+	// attach が確立するまで待つ
+	for i := 0; i < 50 && len(srv.connTracker.list()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(srv.connTracker.list()) != 1 {
+		t.Fatalf("connections = %d, want 1 before shutdown", len(srv.connTracker.list()))
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	// Shutdown が戻った時点で接続のクリーンアップは完了している
+	if n := len(srv.connTracker.list()); n != 0 {
+		t.Errorf("connections = %d after Shutdown, want 0", n)
+	}
+
+	select {
+	case res := <-resCh:
+		if !res.gotShutdown {
+			t.Error("client did not receive server_shutdown message")
+		}
+		if res.closeStatus != websocket.StatusGoingAway {
+			t.Errorf("close status = %v, want %v", res.closeStatus, websocket.StatusGoingAway)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("websocket was not closed by Shutdown")
+	}
+}
+
+func TestServer_Shutdown_RejectsNewAttach(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/sessions/main/windows/0/attach", token, "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if err := srv.ListenAndServe("127.0.0.1:0"); !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("ListenAndServe() after Shutdown = %v, want http.ErrServerClosed", err)
+	}
+}
+
+func TestServer_Shutdown_Timeout(t *testing.T) {
+	srv, _ := newTestServerWithWS(t, &wsMock{})
+
+	// クリーンアップの終わらない接続を模擬する
+	if !srv.beginAttach() {
+		t.Fatal("beginAttach() = false before shutdown")
+	}
+	defer srv.attachWG.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want context.DeadlineExceeded", err)
+	}
+}
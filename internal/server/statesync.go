@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/vt"
+)
+
+// wsStateProtocol はサーバー側の端末エミュレーターで画面の状態を同期する WebSocket サブプロトコル。
+// クライアントが Sec-WebSocket-Protocol でこれを要求した場合、pty の出力をそのまま送る代わりに
+// attachment ごとのヘッドレス端末（internal/vt）で解釈し、表示中の画面の差分を frame メッセージで送る。
+// クライアントは frame を描画したら ack を返し、サーバーは ack を受け取るまで次の frame を送らない。
+// 回線が遅い間の途中経過の出力はキューに溜まらず読み飛ばされる（mosh と同じ考え方）。
+// 入力と制御メッセージは wsBinaryProtocol と同じ（バイナリフレームも pty への入力として扱う）。
+const wsStateProtocol = "palmux.state.v1"
+
+// wsStateMinInterval・wsStateMaxInterval は frame を送る間隔の下限と上限。
+// 間隔は ack の往復時間（平滑化した RTT）の半分で、回線が遅いほど frame をまとめる。
+var (
+	wsStateMinInterval = 20 * time.Millisecond
+	wsStateMaxInterval = time.Second
+)
+
+// wsStateAckTimeout は frame の ack を待つ最大時間。
+// 過ぎた場合は ack を待たずに次の frame を送る（送信間隔は wsStateMaxInterval になる）。
+var wsStateAckTimeout = 5 * time.Second
+
+// wsFrameMessage は状態同期モードで送る frame メッセージ。
+// Data はクライアント側の端末を最新の画面にするエスケープシーケンス、Seq は ack で返す通し番号。
+type wsFrameMessage struct {
+	Type string `json:"type"`
+	Seq  int64  `json:"seq"`
+	Data string `json:"data"`
+}
+
+// syncState はヘッドレス端末の画面の差分を frame メッセージとして WebSocket に送る。
+// 接続直後（再接続を含む）の最初の frame は画面全体を描き直す。
+// 送信中の frame は常に 1 つまでで、ack（acks に届く Seq）を受け取ってから、
+// RTT に応じた間隔を空けてその時点の画面との差分を送る。
+func (s *Server) syncState(ctx context.Context, writeWS func(context.Context, []byte) error, a *attachment, acks <-chan int64, cleanup func()) {
+	var prev *vt.Frame
+	var seq int64
+	var srtt time.Duration
+	interval := wsStateMinInterval
+	var lastSent time.Time
+	dirty := true // 最初の frame はすぐに送る
+	for {
+		if !dirty {
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.screenReady:
+			}
+		}
+		dirty = false
+
+		// 前回の送信から interval 経つまで待ち、その間の出力をまとめる
+		if wait := interval - time.Since(lastSent); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		next := a.snapshot()
+		diff := vt.Diff(prev, next)
+		if diff == nil {
+			continue
+		}
+		seq++
+		msg, err := json.Marshal(wsFrameMessage{Type: "frame", Seq: seq, Data: string(diff)})
+		if err != nil {
+			log.Printf("json marshal error: %v", err)
+			continue
+		}
+		lastSent = time.Now()
+		if err := writeWS(ctx, msg); err != nil {
+			cleanup()
+			return
+		}
+		prev = next
+
+		// ack を待つ（その間の出力はヘッドレス端末に反映されるだけで送らない）
+		rtt, ok := waitAck(ctx, acks, seq, lastSent)
+		if !ok {
+			return
+		}
+		if srtt == 0 {
+			srtt = rtt
+		} else {
+			srtt = (7*srtt + rtt) / 8
+		}
+		interval = max(wsStateMinInterval, min(srtt/2, wsStateMaxInterval))
+	}
+}
+
+// waitAck は seq の ack を wsStateAckTimeout まで待ち、送信からの経過時間を返す。
+// タイムアウトした場合は wsStateAckTimeout を返す。ctx が終了した場合は ok = false を返す。
+func waitAck(ctx context.Context, acks <-chan int64, seq int64, sent time.Time) (rtt time.Duration, ok bool) {
+	timer := time.NewTimer(wsStateAckTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, false
+		case n := <-acks:
+			if n == seq {
+				return time.Since(sent), true
+			}
+			// 古い frame の ack は無視する
+		case <-timer.C:
+			return wsStateAckTimeout, true
+		}
+	}
+}
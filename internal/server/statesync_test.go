@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/tjst-t/palmux/internal/vt"
+	"nhooyr.io/websocket"
+)
+
+// dialWSState は wsStateProtocol と wsBinaryProtocol を提示して WebSocket 接続を確立し、
+// 状態同期モードが選ばれたことを確認して最初の resume メッセージを読み捨てるヘルパー。
+func dialWSState(t *testing.T, tsURL, path, token string) (*websocket.Conn, context.Context, context.CancelFunc) {
+	t.Helper()
+
+	wsURL := "ws" + strings.TrimPrefix(tsURL, "http") + path
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader:   http.Header{"Authorization": []string{"Bearer " + token}},
+		Subprotocols: []string{wsStateProtocol, wsBinaryProtocol},
+	})
+	if err != nil {
+		cancel()
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	if got := conn.Subprotocol(); got != wsStateProtocol {
+		cancel()
+		t.Fatalf("negotiated subprotocol = %q, want %q", got, wsStateProtocol)
+	}
+	readResumeMessage(t, ctx, conn)
+
+	return conn, ctx, cancel
+}
+
+// readFrames は WebSocket から frame メッセージだけを読み取ってチャネルに流すヘルパー。
+// 接続が閉じられるとチャネルを閉じる。
+func readFrames(ctx context.Context, conn *websocket.Conn) <-chan wsFrameMessage {
+	ch := make(chan wsFrameMessage, 16)
+	go func() {
+		defer close(ch)
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			var msg wsFrameMessage
+			if json.Unmarshal(data, &msg) == nil && msg.Type == "frame" {
+				ch <- msg
+			}
+		}
+	}()
+	return ch
+}
+
+// nextFrame は次の frame メッセージを待つヘルパー。
+func nextFrame(t *testing.T, frames <-chan wsFrameMessage) wsFrameMessage {
+	t.Helper()
+
+	select {
+	case msg, ok := <-frames:
+		if !ok {
+			t.Fatal("connection closed while waiting for a frame")
+		}
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for a frame")
+	}
+	return wsFrameMessage{}
+}
+
+// sendAck は frame の ack を送るヘルパー。
+func sendAck(t *testing.T, ctx context.Context, conn *websocket.Conn, seq int64) {
+	t.Helper()
+
+	data, _ := json.Marshal(wsInputMessage{Type: "ack", Seq: seq})
+	if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
+		t.Fatalf("failed to send ack: %v", err)
+	}
+}
+
+// screenLine はクライアント側の端末の y 行目を文字列にして返す（行末の空白は削る）。
+func screenLine(s *vt.Screen, y int) string {
+	var b strings.Builder
+	for _, c := range s.Snapshot().Cells[y] {
+		if c.Width > 0 {
+			b.WriteRune(c.Rune)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+func TestHandleAttach_StateSync(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWSState(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	frames := readFrames(ctx, conn)
+
+	// 最初の frame は画面全体の描き直し
+	client := vt.New(80, 24)
+	first := nextFrame(t, frames)
+	if first.Seq != 1 || !strings.Contains(first.Data, "\x1b[2J") {
+		t.Fatalf("first frame = %+v, want a full redraw with seq 1", first)
+	}
+	client.Write([]byte(first.Data))
+	sendAck(t, ctx, conn, first.Seq)
+
+	if _, err := pts.Write([]byte("\x1b[1mhello\x1b[m\r\nworld")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	frame := nextFrame(t, frames)
+	if frame.Seq != 2 {
+		t.Errorf("seq = %d, want 2", frame.Seq)
+	}
+	client.Write([]byte(frame.Data))
+	if got := []string{screenLine(client, 0), screenLine(client, 1)}; got[0] != "hello" || got[1] != "world" {
+		t.Errorf("client screen = %q, want [hello world]", got)
+	}
+	if attr := client.Snapshot().Cells[0][0].Attr; attr.Flags != vt.Bold {
+		t.Errorf("attr = %+v, want bold", attr)
+	}
+
+	// 途中から作成したヘッドレス端末に画面を反映させるため tmux に再描画させる
+	if name := getPTSName(mock.attachPty); name != "" {
+		mock.mu.Lock()
+		refreshed := append([]string(nil), mock.refreshedClients...)
+		mock.mu.Unlock()
+		if len(refreshed) != 1 || refreshed[0] != name {
+			t.Errorf("RefreshClient calls = %v, want [%s]", refreshed, name)
+		}
+	}
+}
+
+func TestHandleAttach_StateSyncSkipsWhileUnacked(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWSState(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	frames := readFrames(ctx, conn)
+
+	client := vt.New(80, 24)
+	first := nextFrame(t, frames)
+	client.Write([]byte(first.Data))
+
+	// ack を返すまでは出力が続いても次の frame は送られない
+	for _, s := range []string{"1", "2", "3"} {
+		if _, err := pts.Write([]byte(s)); err != nil {
+			t.Fatalf("failed to write to pts: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	select {
+	case msg := <-frames:
+		t.Fatalf("received frame %+v before ack", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// ack を返すと、途中経過を飛ばして最新の画面の frame が 1 つ届く
+	sendAck(t, ctx, conn, first.Seq)
+	frame := nextFrame(t, frames)
+	client.Write([]byte(frame.Data))
+	if got := screenLine(client, 0); got != "123" {
+		t.Errorf("client screen = %q, want %q", got, "123")
+	}
+	select {
+	case msg := <-frames:
+		t.Errorf("received extra frame %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHandleAttach_StateSyncResize(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWSState(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	frames := readFrames(ctx, conn)
+	sendAck(t, ctx, conn, nextFrame(t, frames).Seq)
+
+	resize, _ := json.Marshal(wsInputMessage{Type: "resize", Cols: 40, Rows: 10})
+	if err := conn.Write(ctx, websocket.MessageText, resize); err != nil {
+		t.Fatalf("failed to send resize: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		rows, cols, err := pty.Getsize(pts)
+		if err == nil && cols == 40 && rows == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pty size = %dx%d, want 40x10", cols, rows)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// サイズが変わった後の frame は新しいサイズで画面全体を描き直す
+	if _, err := pts.Write([]byte("resized")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	frame := nextFrame(t, frames)
+	if !strings.Contains(frame.Data, "\x1b[2J") {
+		t.Errorf("frame after resize = %q, want a full redraw", frame.Data)
+	}
+	client := vt.New(40, 10)
+	client.Write([]byte(frame.Data))
+	if got := screenLine(client, 0); got != "resized" {
+		t.Errorf("client screen = %q, want %q", got, "resized")
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TokenScope は API トークンが許可される操作の範囲を表す。
+type TokenScope string
+
+const (
+	// ScopeFull は全ての API 操作を許可する。
+	ScopeFull TokenScope = "full"
+	// ScopeRead は GET/HEAD のみを許可する（ターミナルへの attach は不可）。
+	// ダッシュボード等の閲覧用途を想定する。
+	ScopeRead TokenScope = "read"
+	// ScopeNotify は POST/DELETE /api/notifications のみを許可する。
+	// Claude Code の Hook スクリプト用途を想定する。
+	ScopeNotify TokenScope = "notify"
+)
+
+// Valid はスコープが既知の値かどうかを返す。
+func (sc TokenScope) Valid() bool {
+	switch sc {
+	case ScopeFull, ScopeRead, ScopeNotify:
+		return true
+	}
+	return false
+}
+
+// Allows はスコープがリクエストを許可するかどうかを返す。
+// パスはベースパスを除いたもの（例: "/api/sessions"）を渡す。
+func (sc TokenScope) Allows(r *http.Request) bool {
+	switch sc {
+	case ScopeFull:
+		return true
+	case ScopeRead:
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return false
+		}
+		// attach・多重化接続は GET だが入力を送れるため閲覧用スコープでは許可しない
+		return !isAttachPath(r.URL.Path)
+	case ScopeNotify:
+		return r.URL.Path == "/api/notifications" &&
+			(r.Method == http.MethodPost || r.Method == http.MethodDelete)
+	}
+	return false
+}
+
+// APIToken は名前付き API トークンのメタデータ。
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scope      TokenScope `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Ephemeral  bool       `json:"ephemeral,omitempty"` // true の場合はファイルに保存しない
+}
+
+// tokenEntry は TokenStore 内部およびトークンファイルでのトークン表現。
+// トークン文字列そのものは保存せず、SHA-256 ハッシュのみを保持する。
+type tokenEntry struct {
+	APIToken
+	SecretHash string `json:"secret_hash"`
+}
+
+// tokenLastUsedPersistInterval は LastUsedAt の更新をファイルに書き出す最小間隔。
+// リクエストごとにファイルを書き換えないよう間引く。
+var tokenLastUsedPersistInterval = time.Minute
+
+// TokenStore は名前付き API トークンを管理する。
+// path が指定されている場合は JSON ファイルに永続化し、再起動後も有効なまま維持する。
+type TokenStore struct {
+	mu        sync.Mutex
+	tokens    map[string]*tokenEntry // key: ID
+	path      string
+	lastSaved time.Time
+}
+
+// NewTokenStore は TokenStore を生成する。
+// path が空でなければ既存のトークンファイルを読み込む（存在しなければ空で開始する）。
+func NewTokenStore(path string) (*TokenStore, error) {
+	ts := &TokenStore{
+		tokens: make(map[string]*tokenEntry),
+		path:   path,
+	}
+	if path == "" {
+		return ts, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ts, nil
+		}
+		return nil, fmt.Errorf("read token file: %w", err)
+	}
+
+	var tokens []*tokenEntry
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parse token file %s: %w", path, err)
+	}
+	for _, t := range tokens {
+		ts.tokens[t.ID] = t
+	}
+	return ts, nil
+}
+
+// Create は新しいトークンを発行し、メタデータとトークン文字列を返す。
+// トークン文字列はこの時点でしか取得できない。
+func (ts *TokenStore) Create(name string, scope TokenScope) (APIToken, string, error) {
+	return ts.create(name, scope, false)
+}
+
+// CreateEphemeral はファイルに保存しないトークンを発行する。
+// サーバープロセスの生存期間中のみ有効で、起動ごとに発行し直す用途（Hook 用トークン等）に使う。
+func (ts *TokenStore) CreateEphemeral(name string, scope TokenScope) (APIToken, string, error) {
+	return ts.create(name, scope, true)
+}
+
+func (ts *TokenStore) create(name string, scope TokenScope, ephemeral bool) (APIToken, string, error) {
+	if name == "" {
+		return APIToken{}, "", fmt.Errorf("token name is required")
+	}
+	if !scope.Valid() {
+		return APIToken{}, "", fmt.Errorf("invalid token scope %q", scope)
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return APIToken{}, "", fmt.Errorf("generate token: %w", err)
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	t := &tokenEntry{
+		APIToken: APIToken{
+			ID:        generateConnID()[:12],
+			Name:      name,
+			Scope:     scope,
+			CreatedAt: time.Now(),
+			Ephemeral: ephemeral,
+		},
+		SecretHash: hashTokenSecret(secret),
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tokens[t.ID] = t
+	if !ephemeral {
+		if err := ts.saveLocked(); err != nil {
+			delete(ts.tokens, t.ID)
+			return APIToken{}, "", err
+		}
+	}
+	return t.APIToken, secret, nil
+}
+
+// List は全トークンのメタデータを作成日時順に返す。
+func (ts *TokenStore) List() []APIToken {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	result := make([]APIToken, 0, len(ts.tokens))
+	for _, t := range ts.tokens {
+		result = append(result, t.APIToken)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Revoke は指定 ID のトークンを無効化する。
+// 存在しない場合は false を返す。
+func (ts *TokenStore) Revoke(id string) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	t, ok := ts.tokens[id]
+	if !ok {
+		return false, nil
+	}
+	delete(ts.tokens, id)
+	if !t.Ephemeral {
+		if err := ts.saveLocked(); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Lookup はトークン文字列に一致するトークンを探し、LastUsedAt を更新して返す。
+// 一致するトークンがない場合は false を返す。
+func (ts *TokenStore) Lookup(secret string) (APIToken, bool) {
+	if secret == "" {
+		return APIToken{}, false
+	}
+	hash := hashTokenSecret(secret)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, t := range ts.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.SecretHash), []byte(hash)) == 1 {
+			now := time.Now()
+			t.LastUsedAt = &now
+			if !t.Ephemeral && now.Sub(ts.lastSaved) >= tokenLastUsedPersistInterval {
+				// LastUsedAt の保存失敗で認証自体を失敗させない
+				_ = ts.saveLocked()
+			}
+			return t.APIToken, true
+		}
+	}
+	return APIToken{}, false
+}
+
+// saveLocked はロックを取得済みの状態で永続トークンをファイルに書き出す。
+func (ts *TokenStore) saveLocked() error {
+	if ts.path == "" {
+		return nil
+	}
+
+	tokens := make([]*tokenEntry, 0, len(ts.tokens))
+	for _, t := range ts.tokens {
+		if !t.Ephemeral {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save token file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0700); err != nil {
+		return fmt.Errorf("save token file: %w", err)
+	}
+	// 一時ファイルに書いてからリネームし、書き込み途中のファイルを読ませない
+	tmp := ts.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("save token file: %w", err)
+	}
+	if err := os.Rename(tmp, ts.path); err != nil {
+		return fmt.Errorf("save token file: %w", err)
+	}
+	ts.lastSaved = time.Now()
+	return nil
+}
+
+// hashTokenSecret はトークン文字列の SHA-256 ハッシュを16進文字列で返す。
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenScope_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		scope  TokenScope
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "full: 任意の操作を許可", scope: ScopeFull, method: http.MethodDelete, path: "/api/sessions/main", want: true},
+		{name: "read: GETを許可", scope: ScopeRead, method: http.MethodGet, path: "/api/sessions", want: true},
+		{name: "read: POSTを拒否", scope: ScopeRead, method: http.MethodPost, path: "/api/sessions", want: false},
+		{name: "read: attachを拒否", scope: ScopeRead, method: http.MethodGet, path: "/api/sessions/main/windows/0/attach", want: false},
+		{name: "read: 多重化接続を拒否", scope: ScopeRead, method: http.MethodGet, path: "/api/mux", want: false},
+		{name: "notify: 通知POSTを許可", scope: ScopeNotify, method: http.MethodPost, path: "/api/notifications", want: true},
+		{name: "notify: 通知DELETEを許可", scope: ScopeNotify, method: http.MethodDelete, path: "/api/notifications", want: true},
+		{name: "notify: 通知GETを拒否", scope: ScopeNotify, method: http.MethodGet, path: "/api/notifications", want: false},
+		{name: "notify: 他のAPIを拒否", scope: ScopeNotify, method: http.MethodGet, path: "/api/sessions", want: false},
+		{name: "未知のスコープ: 拒否", scope: TokenScope("admin"), method: http.MethodGet, path: "/api/sessions", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if got := tt.scope.Allows(req); got != tt.want {
+				t.Errorf("%q.Allows(%s %s) = %v, want %v", tt.scope, tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenStore_CreateLookupRevoke(t *testing.T) {
+	ts, err := NewTokenStore("")
+	if err != nil {
+		t.Fatalf("NewTokenStore() error = %v", err)
+	}
+
+	token, secret, err := ts.Create("dashboard", ScopeRead)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if token.ID == "" || secret == "" {
+		t.Fatalf("Create() returned empty id or secret: %+v %q", token, secret)
+	}
+	if token.LastUsedAt != nil {
+		t.Error("LastUsedAt should be nil before first use")
+	}
+
+	got, ok := ts.Lookup(secret)
+	if !ok {
+		t.Fatal("Lookup() did not find the created token")
+	}
+	if got.Name != "dashboard" || got.Scope != ScopeRead {
+		t.Errorf("Lookup() = %+v, want name=dashboard scope=read", got)
+	}
+	if got.LastUsedAt == nil {
+		t.Error("LastUsedAt should be set after Lookup")
+	}
+
+	if _, ok := ts.Lookup("wrong"); ok {
+		t.Error("Lookup() should not match a wrong secret")
+	}
+
+	found, err := ts.Revoke(token.ID)
+	if err != nil || !found {
+		t.Fatalf("Revoke() = %v, %v, want true, nil", found, err)
+	}
+	if _, ok := ts.Lookup(secret); ok {
+		t.Error("Lookup() should fail after Revoke")
+	}
+	if found, _ := ts.Revoke(token.ID); found {
+		t.Error("Revoke() of unknown id should return false")
+	}
+}
+
+func TestTokenStore_CreateValidation(t *testing.T) {
+	ts, _ := NewTokenStore("")
+
+	if _, _, err := ts.Create("", ScopeFull); err == nil {
+		t.Error("Create() with empty name should fail")
+	}
+	if _, _, err := ts.Create("x", TokenScope("root")); err == nil {
+		t.Error("Create() with unknown scope should fail")
+	}
+}
+
+func TestTokenStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	ts, err := NewTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewTokenStore() error = %v", err)
+	}
+	_, secret, err := ts.Create("ci", ScopeFull)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	_, ephemeralSecret, err := ts.CreateEphemeral("hooks", ScopeNotify)
+	if err != nil {
+		t.Fatalf("CreateEphemeral() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("token file not written: %v", err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Error("token file must not contain the plain token")
+	}
+	if strings.Contains(string(data), "hooks") {
+		t.Error("ephemeral token must not be persisted")
+	}
+
+	// 再起動を想定: ファイルから読み込んだストアで検証できる
+	reloaded, err := NewTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewTokenStore() reload error = %v", err)
+	}
+	if _, ok := reloaded.Lookup(secret); !ok {
+		t.Error("persisted token should be valid after reload")
+	}
+	if _, ok := reloaded.Lookup(ephemeralSecret); ok {
+		t.Error("ephemeral token should not survive reload")
+	}
+}
+
+func TestTokenStore_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTokenStore(path); err == nil {
+		t.Error("NewTokenStore() should fail on a corrupt file")
+	}
+}
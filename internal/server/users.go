@@ -0,0 +1,363 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/tmux"
+)
+
+// Role はユーザーアカウントの権限レベルを表す。
+type Role string
+
+const (
+	// RoleAdmin は全ての操作（ユーザー・トークン管理を含む）を許可する。
+	RoleAdmin Role = "admin"
+	// RoleOperator は表示可能なセッションに対する全ての操作を許可する（ユーザー・トークン管理は不可）。
+	RoleOperator Role = "operator"
+	// RoleViewer は閲覧のみを許可する。attach はできるが入力は破棄される。
+	RoleViewer Role = "viewer"
+)
+
+// Valid はロールが既知の値かどうかを返す。
+func (ro Role) Valid() bool {
+	switch ro {
+	case RoleAdmin, RoleOperator, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// Allows はロールがリクエストを許可するかどうかを返す。
+// パスはベースパスを除いたもの（例: "/api/sessions"）を渡す。
+func (ro Role) Allows(r *http.Request) bool {
+	switch ro {
+	case RoleAdmin:
+		return true
+	case RoleOperator:
+		return !isAdminPath(r.URL.Path)
+	case RoleViewer:
+		if isAdminPath(r.URL.Path) {
+			return false
+		}
+		return r.Method == http.MethodGet || r.Method == http.MethodHead
+	}
+	return false
+}
+
+// isAdminPath は管理者のみが操作できるパスかどうかを返す。
+func isAdminPath(p string) bool {
+	return p == "/api/auth/logout-all" ||
+		p == "/api/tokens" || strings.HasPrefix(p, "/api/tokens/") ||
+		p == "/api/users" || strings.HasPrefix(p, "/api/users/") ||
+		p == "/api/audit" ||
+		strings.HasPrefix(p, "/api/config/")
+}
+
+// User はユーザーアカウントを表す。
+// Sessions と Projects の両方が空の場合は全セッションにアクセスできる。
+// いずれかが指定されている場合は、一致するセッションのみ一覧表示・attach・操作できる。
+type User struct {
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	Sessions  []string  `json:"sessions,omitempty"` // セッション名のパターン（path.Match 形式、例: "dev-*"）
+	Projects  []string  `json:"projects,omitempty"` // ghq プロジェクト名（"project" と "project@branch" の両方に一致）
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CanAccessSession はユーザーが指定セッションにアクセスできるかを返す。
+func (u *User) CanAccessSession(session string) bool {
+	if u.Role == RoleAdmin || (len(u.Sessions) == 0 && len(u.Projects) == 0) {
+		return true
+	}
+	for _, pattern := range u.Sessions {
+		if ok, _ := path.Match(pattern, session); ok {
+			return true
+		}
+	}
+	repo, _ := tmux.ParseSessionName(session)
+	return u.CanAccessProject(repo)
+}
+
+// CanAccessProject はユーザーが指定 ghq プロジェクトにアクセスできるかを返す。
+func (u *User) CanAccessProject(project string) bool {
+	if u.Role == RoleAdmin || (len(u.Sessions) == 0 && len(u.Projects) == 0) {
+		return true
+	}
+	for _, p := range u.Projects {
+		if p == project {
+			return true
+		}
+	}
+	return false
+}
+
+// userEntry は UserStore 内部およびユーザーファイルでのユーザー表現。
+type userEntry struct {
+	User
+	PasswordHash string `json:"password_hash"`
+}
+
+// UserStore はユーザーアカウントを管理する。
+// path が指定されている場合は JSON ファイルに永続化する。
+type UserStore struct {
+	mu    sync.Mutex
+	users map[string]*userEntry // key: Name
+	path  string
+}
+
+// NewUserStore は UserStore を生成する。
+// path が空でなければ既存のユーザーファイルを読み込む（存在しなければ空で開始する）。
+func NewUserStore(path string) (*UserStore, error) {
+	us := &UserStore{
+		users: make(map[string]*userEntry),
+		path:  path,
+	}
+	if path == "" {
+		return us, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return us, nil
+		}
+		return nil, fmt.Errorf("read user file: %w", err)
+	}
+
+	var users []*userEntry
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("parse user file %s: %w", path, err)
+	}
+	for _, u := range users {
+		us.users[u.Name] = u
+	}
+	return us, nil
+}
+
+// Put はユーザーを作成または更新する。
+// 既存ユーザーの更新で password が空の場合はパスワードを変更しない。
+func (us *UserStore) Put(user User, password string) (User, error) {
+	if user.Name == "" {
+		return User{}, fmt.Errorf("user name is required")
+	}
+	if !user.Role.Valid() {
+		return User{}, fmt.Errorf("invalid role %q", user.Role)
+	}
+	for _, pattern := range user.Sessions {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return User{}, fmt.Errorf("invalid session pattern %q: %w", pattern, err)
+		}
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	existing, exists := us.users[user.Name]
+	if !exists && password == "" {
+		return User{}, fmt.Errorf("password is required for a new user")
+	}
+
+	entry := &userEntry{User: user}
+	if exists {
+		entry.CreatedAt = existing.CreatedAt
+		entry.PasswordHash = existing.PasswordHash
+	} else {
+		entry.CreatedAt = time.Now()
+	}
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return User{}, err
+		}
+		entry.PasswordHash = hash
+	}
+
+	prev := us.users[user.Name]
+	us.users[user.Name] = entry
+	if err := us.saveLocked(); err != nil {
+		if prev != nil {
+			us.users[user.Name] = prev
+		} else {
+			delete(us.users, user.Name)
+		}
+		return User{}, err
+	}
+	return entry.User, nil
+}
+
+// Get は指定名のユーザーを返す。
+func (us *UserStore) Get(name string) (User, bool) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	u, ok := us.users[name]
+	if !ok {
+		return User{}, false
+	}
+	return u.User, true
+}
+
+// List は全ユーザーを名前順に返す。
+func (us *UserStore) List() []User {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	result := make([]User, 0, len(us.users))
+	for _, u := range us.users {
+		result = append(result, u.User)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Delete は指定名のユーザーを削除する。存在しない場合は false を返す。
+func (us *UserStore) Delete(name string) (bool, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	prev, ok := us.users[name]
+	if !ok {
+		return false, nil
+	}
+	delete(us.users, name)
+	if err := us.saveLocked(); err != nil {
+		us.users[name] = prev
+		return true, err
+	}
+	return true, nil
+}
+
+// Authenticate はユーザー名とパスワードを検証する。
+func (us *UserStore) Authenticate(name, password string) (User, bool) {
+	us.mu.Lock()
+	u, ok := us.users[name]
+	us.mu.Unlock()
+
+	if !ok || password == "" {
+		return User{}, false
+	}
+	if !verifyPassword(password, u.PasswordHash) {
+		return User{}, false
+	}
+	return u.User, true
+}
+
+// saveLocked はロックを取得済みの状態でユーザーをファイルに書き出す。
+func (us *UserStore) saveLocked() error {
+	if us.path == "" {
+		return nil
+	}
+
+	users := make([]*userEntry, 0, len(us.users))
+	for _, u := range us.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save user file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(us.path), 0700); err != nil {
+		return fmt.Errorf("save user file: %w", err)
+	}
+	tmp := us.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("save user file: %w", err)
+	}
+	if err := os.Rename(tmp, us.path); err != nil {
+		return fmt.Errorf("save user file: %w", err)
+	}
+	return nil
+}
+
+// passwordHashIterations は PBKDF2 の反復回数。
+const passwordHashIterations = 120000
+
+// hashPassword はパスワードを PBKDF2-HMAC-SHA256 でハッシュ化する。
+// 形式: "pbkdf2-sha256$<iterations>$<base64 salt>$<base64 hash>"
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate password salt: %w", err)
+	}
+	key := pbkdf2SHA256([]byte(password), salt, passwordHashIterations, 32)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s",
+		passwordHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword はパスワードが hashPassword の出力と一致するかを返す。
+func verifyPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got := pbkdf2SHA256([]byte(password), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// pbkdf2SHA256 は RFC 8018 の PBKDF2 を HMAC-SHA256 で計算する。
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		role   Role
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "admin: ユーザー管理", role: RoleAdmin, method: http.MethodPut, path: "/api/users/alice", want: true},
+		{name: "operator: セッション削除", role: RoleOperator, method: http.MethodDelete, path: "/api/sessions/main", want: true},
+		{name: "operator: トークン一覧は不可", role: RoleOperator, method: http.MethodGet, path: "/api/tokens", want: false},
+		{name: "operator: 全デバイスログアウトは不可", role: RoleOperator, method: http.MethodPost, path: "/api/auth/logout-all", want: false},
+		{name: "viewer: セッション一覧", role: RoleViewer, method: http.MethodGet, path: "/api/sessions", want: true},
+		{name: "viewer: attach", role: RoleViewer, method: http.MethodGet, path: "/api/sessions/main/windows/0/attach", want: true},
+		{name: "viewer: ファイル保存は不可", role: RoleViewer, method: http.MethodPut, path: "/api/sessions/main/files", want: false},
+		{name: "viewer: ユーザー一覧は不可", role: RoleViewer, method: http.MethodGet, path: "/api/users", want: false},
+		{name: "不明なロール", role: Role("root"), method: http.MethodGet, path: "/api/sessions", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if got := tt.role.Allows(r); got != tt.want {
+				t.Errorf("Allows(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUser_CanAccessSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    User
+		session string
+		want    bool
+	}{
+		{name: "制限なし", user: User{Role: RoleOperator}, session: "anything", want: true},
+		{name: "admin は制限を無視", user: User{Role: RoleAdmin, Sessions: []string{"dev"}}, session: "prod", want: true},
+		{name: "パターン一致", user: User{Role: RoleOperator, Sessions: []string{"dev-*"}}, session: "dev-api", want: true},
+		{name: "パターン不一致", user: User{Role: RoleOperator, Sessions: []string{"dev-*"}}, session: "prod", want: false},
+		{name: "プロジェクト一致", user: User{Role: RoleViewer, Projects: []string{"palmux"}}, session: "palmux", want: true},
+		{name: "プロジェクトのブランチセッション", user: User{Role: RoleViewer, Projects: []string{"palmux"}}, session: "palmux@feature", want: true},
+		{name: "別プロジェクト", user: User{Role: RoleViewer, Projects: []string{"palmux"}}, session: "other@main", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.CanAccessSession(tt.session); got != tt.want {
+				t.Errorf("CanAccessSession(%q) = %v, want %v", tt.session, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserStore_PutAndAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	us, err := NewUserStore(path)
+	if err != nil {
+		t.Fatalf("NewUserStore() error = %v", err)
+	}
+
+	if _, err := us.Put(User{Name: "alice", Role: RoleViewer}, ""); err == nil {
+		t.Error("Put() without password for a new user should fail")
+	}
+	if _, err := us.Put(User{Name: "alice", Role: Role("root")}, "pw"); err == nil {
+		t.Error("Put() with invalid role should fail")
+	}
+	if _, err := us.Put(User{Name: "alice", Role: RoleViewer, Sessions: []string{"dev-*"}}, "s3cret"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if _, ok := us.Authenticate("alice", "wrong"); ok {
+		t.Error("Authenticate() with wrong password = true, want false")
+	}
+	if _, ok := us.Authenticate("bob", "s3cret"); ok {
+		t.Error("Authenticate() for unknown user = true, want false")
+	}
+
+	// パスワードを省略した更新では既存のパスワードが維持される
+	if _, err := us.Put(User{Name: "alice", Role: RoleOperator}, ""); err != nil {
+		t.Fatalf("Put() update error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("user file not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("user file mode = %o, want 600", info.Mode().Perm())
+	}
+
+	// 再起動を想定: ファイルから読み込み直しても認証できる
+	reloaded, err := NewUserStore(path)
+	if err != nil {
+		t.Fatalf("NewUserStore() reload error = %v", err)
+	}
+	u, ok := reloaded.Authenticate("alice", "s3cret")
+	if !ok {
+		t.Fatal("Authenticate() after reload = false, want true")
+	}
+	if u.Role != RoleOperator || len(u.Sessions) != 0 {
+		t.Errorf("reloaded user = %+v, want operator without session restriction", u)
+	}
+
+	if found, err := reloaded.Delete("alice"); !found || err != nil {
+		t.Errorf("Delete() = %v, %v, want true, nil", found, err)
+	}
+	if _, ok := reloaded.Get("alice"); ok {
+		t.Error("Get() after Delete should return false")
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914 Section 11 のテストベクタ
+	got := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("pbkdf2SHA256() = %x, want %s", got, want)
+	}
+}
@@ -3,18 +3,18 @@ package server
 import (
 	"context"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/creack/pty"
+	"github.com/tjst-t/palmux/internal/tmux"
 	"nhooyr.io/websocket"
 )
 
@@ -22,23 +22,31 @@ import (
 // Cloudflare Tunnel の 100 秒アイドルタイムアウト対策。
 var wsPingInterval = 30 * time.Second
 
-// wsWatchActiveWindowInterval は WebSocket のアクティブウィンドウ監視間隔。
-// テスト時に上書き可能。
+// wsWatchActiveWindowInterval は tmux のコントロールモードが使えない場合の、
+// WebSocket のアクティブウィンドウ・pane の監視間隔。テスト時に上書き可能。
 var wsWatchActiveWindowInterval = 2 * time.Second
 
 // connectionInfo は個々の WebSocket 接続のメタデータ。
 type connectionInfo struct {
 	Session   string    `json:"session"`
 	RemoteIP  string    `json:"remote_ip"`
+	User      string    `json:"user,omitempty"` // 認証された主体の識別名（ユーザー名、JWT のユーザー識別子等）
 	Connected time.Time `json:"connected"`
+	Spectator bool      `json:"spectator"` // 読み取り専用の観戦接続かどうか
 }
 
+// defaultMaxSpectatorsPerSession は同一セッションへの観戦接続数のデフォルト上限。
+const defaultMaxSpectatorsPerSession = 20
+
 // connectionTracker は WebSocket 接続を追跡する。
 // 同一セッションへの最大同時接続数を制限する。
+// 観戦（読み取り専用）接続は通常の接続とは別に maxSpectatorsPerSession で制限する。
 type connectionTracker struct {
-	mu            sync.Mutex
-	connections   map[string]*connectionInfo // keyed by unique ID
-	maxPerSession int
+	mu                      sync.Mutex
+	connections             map[string]*connectionInfo // keyed by unique ID
+	maxPerSession           int
+	maxSpectatorsPerSession int
+	events                  *eventBus // 接続の開始・終了を配信する（nil の場合は配信しない）
 }
 
 // newConnectionTracker は新しい connectionTracker を生成する。
@@ -47,35 +55,76 @@ func newConnectionTracker(maxPerSession int) *connectionTracker {
 		maxPerSession = 5
 	}
 	return &connectionTracker{
-		connections:   make(map[string]*connectionInfo),
-		maxPerSession: maxPerSession,
+		connections:             make(map[string]*connectionInfo),
+		maxPerSession:           maxPerSession,
+		maxSpectatorsPerSession: defaultMaxSpectatorsPerSession,
 	}
 }
 
+// setLimits は同一セッションへの最大同時接続数と観戦接続数を変更する。
+// 0 以下の値はデフォルト値を使用する。既存の接続は上限を超えていても切断しない。
+func (ct *connectionTracker) setLimits(maxPerSession, maxSpectators int) {
+	if maxPerSession <= 0 {
+		maxPerSession = 5
+	}
+	if maxSpectators <= 0 {
+		maxSpectators = defaultMaxSpectatorsPerSession
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.maxPerSession = maxPerSession
+	ct.maxSpectatorsPerSession = maxSpectators
+}
+
 // add は新しい接続を追加する。
 // 同一セッションの接続数が maxPerSession を超える場合はエラーを返す。
-func (ct *connectionTracker) add(session, remoteIP string) (string, error) {
+// user には認証された主体の識別名を渡す（接続一覧に表示される）。
+func (ct *connectionTracker) add(session, remoteIP, user string) (string, error) {
+	return ct.addConn(session, remoteIP, user, false)
+}
+
+// addSpectator は新しい観戦接続を追加する。
+// 観戦接続は maxPerSession には数えず、同一セッションの観戦接続数が
+// maxSpectatorsPerSession を超える場合はエラーを返す。
+func (ct *connectionTracker) addSpectator(session, remoteIP, user string) (string, error) {
+	return ct.addConn(session, remoteIP, user, true)
+}
+
+// addConn は add / addSpectator の共通実装。
+func (ct *connectionTracker) addConn(session, remoteIP, user string, spectator bool) (string, error) {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 
-	// 同一セッションの接続数をカウント
+	// 同一セッション・同一種別の接続数をカウント
 	count := 0
 	for _, c := range ct.connections {
-		if c.Session == session {
+		if c.Session == session && c.Spectator == spectator {
 			count++
 		}
 	}
 
-	if count >= ct.maxPerSession {
+	limit := ct.maxPerSession
+	if spectator {
+		limit = ct.maxSpectatorsPerSession
+	}
+	if count >= limit {
+		if spectator {
+			return "", fmt.Errorf("too many spectators for session %q", session)
+		}
 		return "", fmt.Errorf("too many connections for session %q", session)
 	}
 
 	id := generateConnID()
-	ct.connections[id] = &connectionInfo{
+	info := &connectionInfo{
 		Session:   session,
 		RemoteIP:  remoteIP,
+		User:      user,
 		Connected: time.Now(),
+		Spectator: spectator,
 	}
+	ct.connections[id] = info
+	opened := *info
+	ct.events.Publish(ServerEvent{Type: EventConnectionOpen, Session: session, Connection: &opened})
 	return id, nil
 }
 
@@ -83,7 +132,11 @@ func (ct *connectionTracker) add(session, remoteIP string) (string, error) {
 func (ct *connectionTracker) remove(id string) {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
-	delete(ct.connections, id)
+	if info, ok := ct.connections[id]; ok {
+		delete(ct.connections, id)
+		closed := *info
+		ct.events.Publish(ServerEvent{Type: EventConnectionClose, Session: info.Session, Connection: &closed})
+	}
 }
 
 // list は全接続のリストを返す。
@@ -115,27 +168,76 @@ type wsClientStatusMessage struct {
 	Window  int    `json:"window"`
 }
 
+// wsPaneMessage はクライアントが表示しているウィンドウのアクティブ pane の通知メッセージ。
+// Pane は pane ID（%12 の形式）で、pane API の {pane} や snapshot の pane パラメータにそのまま使える。
+type wsPaneMessage struct {
+	Type string `json:"type"`
+	Pane string `json:"pane"`
+}
+
 // wsInputMessage はクライアントから送られる入力メッセージ。
+// Seq は状態同期モードの ack メッセージで、描画を終えた frame の通し番号を表す。
 type wsInputMessage struct {
 	Type string `json:"type"`
 	Data string `json:"data,omitempty"`
 	Cols int    `json:"cols,omitempty"`
 	Rows int    `json:"rows,omitempty"`
+	Seq  int64  `json:"seq,omitempty"`
+}
+
+// wsBinaryProtocol はバイナリフレームで端末出力を送る WebSocket サブプロトコル。
+// クライアントが Sec-WebSocket-Protocol でこれを要求した場合、pty の出力は加工せずにバイナリフレームで送り、
+// クライアントからのバイナリフレームはそのまま pty への入力として扱う。
+// 制御メッセージ（resize、ping、client_status、notification_update 等）は従来通り JSON のテキストフレームで送受信する。
+// サブプロトコルを要求しない古いクライアントには出力も JSON（output メッセージ）で送る。
+const wsBinaryProtocol = "palmux.binary.v1"
+
+// wsResumeMessage は接続直後に送る resume メッセージ。
+// 再接続時に Token と、受信済みの出力のストリームオフセットを resume・offset クエリパラメータで渡すと
+// 同じ attach を引き継いで続きの出力を受け取れる。Offset はこのメッセージの後に続く出力の開始位置。
+type wsResumeMessage struct {
+	Type    string `json:"type"`
+	Token   string `json:"token"`
+	Offset  int64  `json:"offset"`
+	Resumed bool   `json:"resumed"`
 }
 
 // wsOutputMessage はクライアントに送る出力メッセージ。
+// Offset は output・offset メッセージで、このメッセージの後に続く出力のストリームオフセットを表す。
 type wsOutputMessage struct {
-	Type string `json:"type"`
-	Data string `json:"data"`
+	Type   string `json:"type"`
+	Data   string `json:"data"`
+	Offset int64  `json:"offset,omitempty"`
 }
 
 // handleAttach は WebSocket pty ブリッジのハンドラ。
 // WebSocket 接続を受け付け、tmux attach-session の pty と双方向にデータを中継する。
 // 接続数が maxPerSession を超える場合は 429 Too Many Requests を返す。
+// クエリパラメータ readonly=1（または viewer ロール）の場合は観戦モードとなり、
+// tmux の読み取り専用クライアントとして接続して input メッセージを破棄する。
+// 観戦接続は maxPerSession とは別枠で数える。
+// クエリパラメータ record=1 の場合は attach の出力を asciicast v2 で録画する（録画機能が有効な場合。共有リンク・viewer ロールでは無視する）。
+// Origin ヘッダーが許可されていない場合（--allowed-origins）は 403 Forbidden を返す。
+// シャットダウン中は 503 Service Unavailable を返す。
 // 同一セッションの複数接続で独立したウィンドウ選択を可能にするため、
 // tmux セッショングループを使用する。
+// 出力の送り方は WebSocket サブプロトコルで選ぶ（なし: JSON、wsBinaryProtocol: バイナリ、wsStateProtocol: 画面状態の同期）。
 func (s *Server) handleAttach() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// クロスサイト WebSocket ハイジャック対策（アップグレードの前に検査する）
+		if !s.origins.allowed(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		// シャットダウン中は新しい接続を受け付けない。受け付けた接続は
+		// クリーンアップが終わるまで Shutdown に待たせる（defer は cleanup より後に実行される）
+		if !s.beginAttach() {
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer s.attachWG.Done()
+
 		session := r.PathValue("session")
 		windowIndex := -1
 		if idxStr := r.PathValue("index"); idxStr != "" {
@@ -144,112 +246,326 @@ func (s *Server) handleAttach() http.Handler {
 			}
 		}
 
-		// 接続数チェック（WebSocket upgrade の前に行う）
-		connID, err := s.connTracker.add(session, r.RemoteAddr)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusTooManyRequests)
-			return
+		// 観戦モード（viewer ロール・読み取り専用の共有リンクは常に観戦モード）
+		readOnly, _ := strconv.ParseBool(r.URL.Query().Get("readonly"))
+		p, _ := PrincipalFromContext(r.Context())
+		if p.ReadOnly() {
+			readOnly = true
+		}
+
+		// 再接続: resume トークンの attachment（同じ Principal・セッション・ウィンドウ・モードのもの）を引き継ぐ
+		query := r.URL.Query()
+		var resumed *attachment
+		if token := query.Get("resume"); token != "" {
+			if a := s.attachments.get(token); a != nil && a.resumableBy(p.Name, session, windowIndex, readOnly) {
+				resumed = a
+			}
+		}
+		offset, _ := strconv.ParseInt(query.Get("offset"), 10, 64)
+		record, _ := strconv.ParseBool(query.Get("record"))
+		record = record && s.recordings != nil && p.share == nil && !p.ReadOnly()
+
+		// 接続数チェック（新規 attach のみ。WebSocket upgrade の前に行う）
+		// 切断中の attachment は枠を返しているため、再接続では bind で枠を取り直す
+		var connID string
+		var err error
+		if resumed == nil {
+			if readOnly {
+				connID, err = s.connTracker.addSpectator(session, r.RemoteAddr, p.Name)
+			} else {
+				connID, err = s.connTracker.add(session, r.RemoteAddr, p.Name)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
 		}
 
 		// WebSocket アップグレード
+		// Origin は s.origins で検査済みのため、websocket パッケージの同一オリジン検査は行わない
 		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 			InsecureSkipVerify: true,
+			// クライアントが両方を提示した場合は状態同期を優先する
+			Subprotocols: []string{wsStateProtocol, wsBinaryProtocol},
+			// 端末出力はエスケープシーケンスの繰り返しが多く圧縮が効く。
+			// 接続は長時間アイドルのことが多いため、接続ごとに圧縮器を保持しないモードを使う
+			CompressionMode: websocket.CompressionNoContextTakeover,
 		})
 		if err != nil {
 			log.Printf("websocket accept error: %v", err)
-			s.connTracker.remove(connID)
+			if resumed == nil {
+				s.connTracker.remove(connID)
+			}
 			return
 		}
 		defer conn.Close(websocket.StatusInternalError, "internal error")
 
-		// グループセッションを作成（独立したウィンドウ選択のため）
-		groupedSession, groupErr := s.tmux.CreateGroupedSession(session)
-		attachTarget := session
-		if groupErr == nil {
-			attachTarget = groupedSession
+		a := resumed
+		if a == nil {
+			a, err = s.attachNew(r, session, windowIndex, readOnly, record, p, connID)
+			if err != nil {
+				conn.Close(websocket.StatusInternalError, "attach failed: "+err.Error())
+				return
+			}
+			offset = 0
+		} else {
+			s.audit.Record(AuditEntry{
+				Event:    AuditEventAttach,
+				Actor:    p.Name,
+				RemoteIP: r.RemoteAddr,
+				Endpoint: r.URL.Path,
+				Session:  session,
+				Params:   map[string]interface{}{"readonly": readOnly, "resumed": true},
+				Result:   "ok",
+			})
 		}
 
-		// tmux attach（ウィンドウインデックス指定付き）
-		ptmx, cmd, err := s.tmux.Attach(attachTarget, windowIndex)
-		if err != nil {
-			log.Printf("attach error: %v", err)
-			s.connTracker.remove(connID)
-			if groupErr == nil {
-				s.tmux.DestroyGroupedSession(groupedSession)
+		// 状態同期モードではヘッドレス端末を用意する。
+		// 途中から作成した場合はそれまでの画面を知らないため、tmux に画面全体を再描画させる
+		state := conn.Subprotocol() == wsStateProtocol
+		if state && a.startScreen() && a.ptsName != "" {
+			if err := s.tmux.RefreshClient(a.ptsName); err != nil {
+				log.Printf("refresh client %s: %v", a.ptsName, err)
 			}
-			conn.Close(websocket.StatusInternalError, "attach failed: "+err.Error())
-			return
 		}
 
-		// クリーンアップ
+		// この接続を attachment に結び付ける（引き継ぎの場合は旧接続を切り離す）
 		ctx, cancel := context.WithCancel(r.Context())
+		q, start, gen, err := a.bind(offset, state, r.RemoteAddr, cancel)
+		if err != nil {
+			// 猶予切れ等で attachment が閉じられた（クライアントは resume なしで再接続する）、
+			// または再接続で接続数の上限を超えた
+			cancel()
+			conn.Close(websocket.StatusTryAgainLater, err.Error())
+			return
+		}
+
+		// 接続ごとの goroutine はクリーンアップ後に終了を待つ（Shutdown がこの接続の終了まで待てるように）
+		var g connGoroutines
+		defer g.wait()
+
+		// クリーンアップ（接続のみ。attachment は猶予の間保持して再接続を待つ）
 		var once sync.Once
 		cleanup := func() {
 			once.Do(func() {
 				cancel()
-				s.connTracker.remove(connID)
-				// プロセスを先にシグナルで終了させてから PTY を閉じる。
-				// PTY を先に閉じるとプロセスが異常な状態で終了する可能性がある。
-				if cmd != nil && cmd.Process != nil {
-					cmd.Process.Signal(syscall.SIGTERM)
-					// タイムアウト付きで終了を待つ（デッドロック防止）
-					done := make(chan struct{})
-					go func() {
-						cmd.Wait()
-						close(done)
-					}()
-					select {
-					case <-done:
-						// プロセスが正常終了
-					case <-time.After(3 * time.Second):
-						// タイムアウト: 強制終了
-						cmd.Process.Signal(syscall.SIGKILL)
-						<-done
-					}
-				}
-				ptmx.Close()
-				// グループセッションをクリーンアップ
-				if groupErr == nil {
-					s.tmux.DestroyGroupedSession(groupedSession)
-				}
+				a.unbind(s, gen)
 			})
 		}
 		defer cleanup()
+		// 接続と attachment の両方を終了する（共有リンク・証明書の失効、シャットダウン）
+		terminate := func() {
+			a.close()
+			cleanup()
+		}
 
 		// 全 WebSocket 書き込みをシリアライズする（concurrent writes 対策）
 		var wsMu sync.Mutex
-		writeWS := func(ctx context.Context, data []byte) error {
+		writeFrame := func(ctx context.Context, typ websocket.MessageType, data []byte) error {
 			wsMu.Lock()
 			defer wsMu.Unlock()
-			return conn.Write(ctx, websocket.MessageText, data)
+			return conn.Write(ctx, typ, data)
+		}
+		writeWS := func(ctx context.Context, data []byte) error {
+			return writeFrame(ctx, websocket.MessageText, data)
+		}
+		binary := conn.Subprotocol() == wsBinaryProtocol
+
+		// resume トークンと出力の開始位置を最初のメッセージとして送る
+		resumeMsg, _ := json.Marshal(wsResumeMessage{
+			Type:    "resume",
+			Token:   a.token,
+			Offset:  start,
+			Resumed: resumed != nil,
+		})
+		if err := writeWS(ctx, resumeMsg); err != nil {
+			return
 		}
 
 		// WebSocket ping (Cloudflare Tunnel の 100 秒アイドルタイムアウト対策)
-		go s.wsPing(ctx, writeWS, cleanup)
-
-		// pty → WebSocket (出力)
-		go s.ptyToWS(ctx, writeWS, ptmx, cleanup)
+		g.spawn(func() { s.wsPing(ctx, writeWS, cleanup) })
+
+		// pty → WebSocket (出力。状態同期モードでは画面の差分)
+		var acks chan int64
+		if state {
+			acks = make(chan int64, 4)
+			g.spawn(func() { s.syncState(ctx, writeWS, a, acks, cleanup) })
+		} else {
+			g.spawn(func() { s.flushOutput(ctx, writeFrame, q, a.ptsName, binary, cleanup) })
+		}
 
 		// クライアントのセッション/ウィンドウ変更を監視して WebSocket に通知
-		go s.watchActiveWindow(ctx, writeWS, ptmx, cleanup)
+		g.spawn(func() { s.watchActiveWindow(ctx, writeWS, a.ptsName, cleanup) })
+
+		// アクティブ pane を接続直後と変更時に WebSocket に通知
+		g.spawn(func() { s.watchActivePane(ctx, writeWS, a.ptsName, cleanup) })
+
+		// セッション・ウィンドウの一覧の変化を WebSocket に通知
+		g.spawn(func() { s.watchTmuxChanged(ctx, writeWS, cleanup) })
 
 		// 通知ストアの変更を WebSocket に配信
-		go s.watchNotifications(ctx, writeWS, cleanup)
+		g.spawn(func() { s.watchNotifications(ctx, p, writeWS, cleanup) })
+
+		// 共有リンク経由の場合はリンクの失効・期限切れで切断する
+		if p.share != nil {
+			g.spawn(func() { s.watchShare(ctx, p.share.ID, conn, terminate) })
+		}
+
+		// クライアント証明書で接続している場合は証明書の失効で切断する
+		if s.clientCerts != nil && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			g.spawn(func() { s.watchClientCert(ctx, r.TLS.PeerCertificates[0], conn, terminate) })
+		}
 
-		// WebSocket → pty (入力)
-		s.wsToPty(ctx, conn, ptmx, writeWS, cleanup)
+		// サーバーのシャットダウン時にクライアントへ通知して切断する
+		g.spawn(func() { s.watchShutdown(ctx, writeWS, conn, terminate) })
+
+		// WebSocket → pty (入力。観戦モードでは破棄する)
+		err = s.wsToPty(ctx, conn, a, acks, writeWS, cleanup)
+
+		// クライアントが明示的に閉じた場合は再接続を待たずに attach を終了する
+		// （ネットワーク断など close フレームのない切断だけを猶予の対象にする）
+		switch websocket.CloseStatus(err) {
+		case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+			a.close()
+		}
 	})
 }
 
+// attachNew は tmux に attach して新しい attachment を生成する。
+// connID の接続数枠は attachment に渡し（多重化接続では空）、attach・detach の監査ログと record の場合の録画は
+// attachment の寿命に合わせて管理する。
+func (s *Server) attachNew(r *http.Request, session string, windowIndex int, readOnly, record bool, p Principal, connID string) (*attachment, error) {
+	// グループセッションを作成（独立したウィンドウ選択のため）
+	groupedSession, groupErr := s.tmux.CreateGroupedSession(session)
+	attachTarget := session
+	if groupErr == nil {
+		attachTarget = groupedSession
+	}
+
+	// 監査ログ（attach の成否と、終了時の detach を記録する）
+	auditEntry := AuditEntry{
+		Event:    AuditEventAttach,
+		Actor:    p.Name,
+		RemoteIP: r.RemoteAddr,
+		Endpoint: r.URL.Path,
+		Session:  session,
+		Params:   map[string]interface{}{"index": windowIndex, "readonly": readOnly},
+		Result:   "ok",
+	}
+
+	// tmux attach（ウィンドウインデックス指定付き）
+	ptmx, cmd, err := s.tmux.Attach(attachTarget, windowIndex, readOnly)
+	if err != nil {
+		log.Printf("attach error: %v", err)
+		auditEntry.Result = err.Error()
+		s.audit.Record(auditEntry)
+		s.connTracker.remove(connID)
+		if groupErr == nil {
+			s.tmux.DestroyGroupedSession(groupedSession)
+		}
+		return nil, err
+	}
+
+	s.audit.Record(auditEntry)
+	attachedAt := time.Now()
+
+	// 録画は attach 直後の tmux の描画から記録するため、pty の読み取りを始める前に開始する。
+	// 大きさはクライアントの最初の resize で記録される。録画を開始できなくても attach は続ける
+	var rec *recorder
+	if record {
+		rec, err = s.recordings.create(RecordingSourceAttach, session, windowIndex, p.Name, 80, 24)
+		if err != nil {
+			log.Printf("start recording: %v", err)
+			rec = nil
+		}
+	}
+
+	release := func() {
+		auditEntry.Event = AuditEventDetach
+		auditEntry.Params["duration_sec"] = int(time.Since(attachedAt).Seconds())
+		s.audit.Record(auditEntry)
+		// プロセスを先にシグナルで終了させてから PTY を閉じる。
+		// PTY を先に閉じるとプロセスが異常な状態で終了する可能性がある。
+		if cmd != nil && cmd.Process != nil {
+			cmd.Process.Signal(syscall.SIGTERM)
+			// タイムアウト付きで終了を待つ（デッドロック防止）
+			done := make(chan struct{})
+			go func() {
+				cmd.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				// プロセスが正常終了
+			case <-time.After(3 * time.Second):
+				// タイムアウト: 強制終了
+				cmd.Process.Signal(syscall.SIGKILL)
+				<-done
+			}
+		}
+		ptmx.Close()
+		// グループセッションをクリーンアップ
+		if groupErr == nil {
+			s.tmux.DestroyGroupedSession(groupedSession)
+		}
+		if rec != nil {
+			rec.close()
+		}
+	}
+
+	a, err := s.newAttachment(session, windowIndex, p.Name, readOnly, ptmx, rec, release)
+	if err != nil {
+		s.connTracker.remove(connID)
+		release()
+		return nil, err
+	}
+	// 接続数の枠は attachment が接続中の WebSocket の分だけ持つ（切断中は返し、再接続で取り直す）
+	if connID != "" {
+		a.mu.Lock()
+		a.conns = s.connTracker
+		a.connID = connID
+		a.mu.Unlock()
+	}
+	return a, nil
+}
+
 // handleListConnections は GET /api/connections のハンドラ。
-// 全セッションの接続一覧を JSON 配列で返す。
+// 全セッションの接続一覧を JSON 配列で返す（アクセスできないセッションの接続は除外する）。
 func (s *Server) handleListConnections() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
 		conns := s.connTracker.list()
-		writeJSON(w, http.StatusOK, conns)
+		visible := conns[:0]
+		for _, c := range conns {
+			if p.CanAccessSession(c.Session) {
+				visible = append(visible, c)
+			}
+		}
+		writeJSON(w, http.StatusOK, visible)
 	})
 }
 
+// connGoroutines は WebSocket 接続ごとに起動する goroutine（ping・各種監視・出力の送信）の終了を待つ。
+// ハンドラーは接続のクリーンアップ（ctx のキャンセル）の後に wait を呼び、
+// goroutine が閉じた接続に書き込んだりハンドラーより長く生き残ったりしないようにする。
+type connGoroutines struct {
+	wg sync.WaitGroup
+}
+
+// spawn は f を goroutine で実行する。
+func (g *connGoroutines) spawn(f func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		f()
+	}()
+}
+
+// wait は spawn した goroutine がすべて終了するまで待つ。
+func (g *connGoroutines) wait() {
+	g.wg.Wait()
+}
+
 // wsPing は定期的に ping メッセージを WebSocket に送信する。
 // Cloudflare Tunnel 等のアイドルタイムアウトによる切断を防止する。
 func (s *Server) wsPing(ctx context.Context, writeWS func(context.Context, []byte) error, cleanup func()) {
@@ -273,6 +589,44 @@ func (s *Server) wsPing(ctx context.Context, writeWS func(context.Context, []byt
 	}
 }
 
+// watchShare は shareCheckInterval ごとに共有リンクの有効性を確認し、
+// 失効または期限切れになった時点で WebSocket 接続を閉じる。
+func (s *Server) watchShare(ctx context.Context, id string, conn *websocket.Conn, cleanup func()) {
+	ticker := time.NewTicker(shareCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.shares.Active(id) {
+				conn.Close(websocket.StatusPolicyViolation, "share link expired or revoked")
+				cleanup()
+				return
+			}
+		}
+	}
+}
+
+// watchClientCert は revocationCheckInterval ごとにクライアント証明書の失効を確認し、
+// CRL・拒否リストに追加された時点で WebSocket 接続を閉じる。
+func (s *Server) watchClientCert(ctx context.Context, cert *x509.Certificate, conn *websocket.Conn, cleanup func()) {
+	ticker := time.NewTicker(revocationCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.clientCerts.Revoked(cert) {
+				conn.Close(websocket.StatusPolicyViolation, "client certificate revoked")
+				cleanup()
+				return
+			}
+		}
+	}
+}
+
 // wsNotificationMessage は通知更新メッセージ。
 type wsNotificationMessage struct {
 	Type          string         `json:"type"`
@@ -280,9 +634,11 @@ type wsNotificationMessage struct {
 }
 
 // watchNotifications は NotificationStore の変更を監視し、
-// notification_update メッセージを WebSocket に送信する。
+// p がアクセスできるセッションの通知を notification_update メッセージで WebSocket に送信する。
+// アクセスできないセッションの変更では送信しない。
 func (s *Server) watchNotifications(
 	ctx context.Context,
+	p Principal,
 	writeWS func(context.Context, []byte) error,
 	cleanup func(),
 ) {
@@ -297,9 +653,13 @@ func (s *Server) watchNotifications(
 			if !ok {
 				return
 			}
+			// アクセスできないセッションの変更は知らせない
+			if !p.CanAccessSession(event.Session) {
+				continue
+			}
 			msg := wsNotificationMessage{
 				Type:          "notification_update",
-				Notifications: event.Notifications,
+				Notifications: visibleNotifications(p, event.Notifications),
 			}
 			data, err := json.Marshal(msg)
 			if err != nil {
@@ -313,48 +673,6 @@ func (s *Server) watchNotifications(
 	}
 }
 
-// ptyToWS は pty からの出力を WebSocket に中継する。
-// UTF-8 のマルチバイト文字がバッファ境界で分断されないよう、
-// 不完全なシーケンスは次回の読み取りに繰り越す。
-func (s *Server) ptyToWS(ctx context.Context, writeWS func(context.Context, []byte) error, ptmx *os.File, cleanup func()) {
-	buf := make([]byte, 4096)
-	carry := 0 // 前回の繰り越しバイト数
-	for {
-		n, err := ptmx.Read(buf[carry:])
-		if err != nil {
-			// pty が閉じられた
-			cleanup()
-			return
-		}
-		n += carry
-		carry = 0
-
-		// 末尾の不完全な UTF-8 シーケンスを検出して繰り越す
-		sendEnd := utf8TruncIndex(buf[:n])
-
-		msg := wsOutputMessage{
-			Type: "output",
-			Data: string(buf[:sendEnd]),
-		}
-		data, err := json.Marshal(msg)
-		if err != nil {
-			log.Printf("json marshal error: %v", err)
-			continue
-		}
-
-		// 不完全バイトをバッファ先頭に繰り越す
-		if sendEnd < n {
-			carry = copy(buf, buf[sendEnd:n])
-		}
-
-		if err := writeWS(ctx, data); err != nil {
-			// WebSocket 書き込みエラー（クライアント切断など）
-			cleanup()
-			return
-		}
-	}
-}
-
 // utf8TruncIndex は data の末尾にある不完全な UTF-8 シーケンスの開始位置を返す。
 // 末尾が完全な UTF-8 であれば len(data) を返す。
 func utf8TruncIndex(data []byte) int {
@@ -396,14 +714,30 @@ func utf8TruncIndex(data []byte) int {
 	return n
 }
 
-// wsToPty は WebSocket からの入力を pty に中継する。
-func (s *Server) wsToPty(ctx context.Context, conn *websocket.Conn, ptmx *os.File, writeWS func(context.Context, []byte) error, cleanup func()) {
+// wsToPty は WebSocket からの入力を attachment の pty に中継する。
+// 観戦モードの attachment では、input メッセージとバイナリフレームは pty に書き込まずに破棄する。
+// 状態同期モードの ack メッセージの通し番号は acks に渡す（受け取り側が詰まっている場合は捨てる）。
+// WebSocket の読み込みエラー（クライアントの切断）で終了した場合はそのエラーを返す。
+func (s *Server) wsToPty(ctx context.Context, conn *websocket.Conn, a *attachment, acks chan<- int64, writeWS func(context.Context, []byte) error, cleanup func()) error {
 	for {
-		_, msgData, err := conn.Read(ctx)
+		typ, msgData, err := conn.Read(ctx)
 		if err != nil {
 			// WebSocket 読み込みエラー（クライアント切断など）
 			cleanup()
-			return
+			return err
+		}
+
+		// バイナリフレームは pty への生の入力（wsBinaryProtocol）
+		if typ == websocket.MessageBinary {
+			if a.readOnly {
+				continue
+			}
+			if _, err := a.ptmx.Write(msgData); err != nil {
+				log.Printf("pty write error: %v", err)
+				cleanup()
+				return nil
+			}
+			continue
 		}
 
 		var msg wsInputMessage
@@ -414,21 +748,26 @@ func (s *Server) wsToPty(ctx context.Context, conn *websocket.Conn, ptmx *os.Fil
 
 		switch msg.Type {
 		case "input":
-			if _, err := ptmx.Write([]byte(msg.Data)); err != nil {
+			if a.readOnly {
+				continue
+			}
+			if _, err := a.ptmx.Write([]byte(msg.Data)); err != nil {
 				log.Printf("pty write error: %v", err)
 				cleanup()
-				return
+				return nil
 			}
 		case "resize":
 			if msg.Cols > 0 && msg.Rows > 0 {
-				if err := pty.Setsize(ptmx, &pty.Winsize{
-					Cols: uint16(msg.Cols),
-					Rows: uint16(msg.Rows),
-				}); err != nil {
+				if err := a.resize(msg.Cols, msg.Rows); err != nil {
 					log.Printf("pty resize error: %v", err)
 					// resize エラーは致命的ではないので継続
 				}
 			}
+		case "ack":
+			select {
+			case acks <- msg.Seq:
+			default:
+			}
 		case "pong":
 			// クライアントからの生存確認に即 ping で応答
 			pingMsg, _ := json.Marshal(wsOutputMessage{Type: "ping"})
@@ -439,59 +778,95 @@ func (s *Server) wsToPty(ctx context.Context, conn *websocket.Conn, ptmx *os.Fil
 	}
 }
 
-// watchActiveWindow は wsWatchActiveWindowInterval ごとにクライアントの
-// セッション/ウィンドウを監視し、変化を検知したら client_status メッセージを送信する。
-// ptmx からスレーブ pts 名を取得し、tmux display-message でクライアントの現在状態を問い合わせる。
+// watchActiveWindow はクライアントのセッション/ウィンドウを監視し、変化を検知したら client_status メッセージを送信する。
+// attach した pty のスレーブ pts 名（ptsName）で tmux display-message を実行し、クライアントの現在状態を問い合わせる。
 // これによりセッション切替（tmux switch-client 等）もウィンドウ切替も検知できる。
+// 問い合わせるのは tmux のコントロールモードでアクティブウィンドウの変更が通知されたときで、
+// コントロールモードが使えない場合は wsWatchActiveWindowInterval ごとに問い合わせる。
 func (s *Server) watchActiveWindow(
 	ctx context.Context,
 	writeWS func(context.Context, []byte) error,
-	ptmx *os.File,
+	ptsName string,
 	cleanup func(),
 ) {
-	ptsName := getPTSName(ptmx)
 	if ptsName == "" {
 		// pts 名を取得できない場合は監視不可
 		return
 	}
 
-	ticker := time.NewTicker(wsWatchActiveWindowInterval)
-	defer ticker.Stop()
+	w := s.newTmuxWatch(tmux.EventResync, "session-window-changed", "client-session-changed")
+	defer w.stop()
 
-	lastSession := "" // 空文字 = ベースライン未確立
-	lastWindow := -1
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			curSession, curWindow, err := s.tmux.GetClientSessionWindow(ptsName)
-			if err != nil || curSession == "" {
-				continue
+	// 接続時の状態をベースラインにする（通知不要）
+	lastSession, lastWindow, err := s.tmux.GetClientSessionWindow(ptsName)
+	if err != nil {
+		lastSession = "" // 空文字 = ベースライン未確立
+	}
+	for w.wait(ctx) {
+		curSession, curWindow, err := s.tmux.GetClientSessionWindow(ptsName)
+		if err != nil || curSession == "" {
+			continue
+		}
+		if lastSession == "" {
+			// ベースライン確立（通知不要）
+			lastSession = curSession
+			lastWindow = curWindow
+			continue
+		}
+		if curSession != lastSession || curWindow != lastWindow {
+			lastSession = curSession
+			lastWindow = curWindow
+			msg := wsClientStatusMessage{
+				Type:    "client_status",
+				Session: curSession,
+				Window:  curWindow,
 			}
-			if lastSession == "" {
-				// ベースライン確立（通知不要）
-				lastSession = curSession
-				lastWindow = curWindow
+			data, err := json.Marshal(msg)
+			if err != nil {
 				continue
 			}
-			if curSession != lastSession || curWindow != lastWindow {
-				lastSession = curSession
-				lastWindow = curWindow
-				msg := wsClientStatusMessage{
-					Type:    "client_status",
-					Session: curSession,
-					Window:  curWindow,
-				}
-				data, err := json.Marshal(msg)
-				if err != nil {
-					continue
-				}
+			if err := writeWS(ctx, data); err != nil {
+				cleanup()
+				return
+			}
+		}
+	}
+}
+
+// watchActivePane はクライアントが表示しているウィンドウのアクティブ pane を監視し、
+// 接続直後と、変化を検知したときに pane メッセージを送信する。
+// 問い合わせるのは tmux のコントロールモードで pane・ウィンドウ・セッションの切替が通知されたときで、
+// コントロールモードが使えない場合は wsWatchActiveWindowInterval ごとに問い合わせる。
+func (s *Server) watchActivePane(
+	ctx context.Context,
+	writeWS func(context.Context, []byte) error,
+	ptsName string,
+	cleanup func(),
+) {
+	if ptsName == "" {
+		// pts 名を取得できない場合は監視不可
+		return
+	}
+
+	w := s.newTmuxWatch(tmux.EventResync, "window-pane-changed", "session-window-changed", "client-session-changed")
+	defer w.stop()
+
+	lastPane := ""
+	for {
+		pane, err := s.tmux.GetClientPane(ptsName)
+		if err == nil && pane != "" && pane != lastPane {
+			lastPane = pane
+			data, err := json.Marshal(wsPaneMessage{Type: "pane", Pane: pane})
+			if err == nil {
 				if err := writeWS(ctx, data); err != nil {
 					cleanup()
 					return
 				}
 			}
 		}
+
+		if !w.wait(ctx) {
+			return
+		}
 	}
 }
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// dialWSBinary は wsBinaryProtocol を要求して WebSocket 接続を確立し、最初の resume メッセージを読み捨てるヘルパー。
+func dialWSBinary(t *testing.T, tsURL, path, token string) (*websocket.Conn, context.Context, context.CancelFunc) {
+	t.Helper()
+
+	wsURL := "ws" + strings.TrimPrefix(tsURL, "http") + path
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{"Bearer " + token},
+		},
+		Subprotocols: []string{wsBinaryProtocol},
+	})
+	if err != nil {
+		cancel()
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	if got := conn.Subprotocol(); got != wsBinaryProtocol {
+		cancel()
+		t.Fatalf("negotiated subprotocol = %q, want %q", got, wsBinaryProtocol)
+	}
+	readResumeMessage(t, ctx, conn)
+
+	return conn, ctx, cancel
+}
+
+func TestHandleAttach_BinaryOutput(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWSBinary(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	// UTF-8 として不完全なシーケンス（"あ" の先頭 2 バイト）も加工せずに届く
+	want := []byte("\x1b[1mhi\x1b[0m \xe3\x81")
+	if _, err := pts.Write(want); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+
+	var got []byte
+	for len(got) < len(want) {
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("failed to read from websocket: %v", err)
+		}
+		if typ != websocket.MessageBinary {
+			t.Fatalf("message type = %v, want %v (data %q)", typ, websocket.MessageBinary, data)
+		}
+		got = append(got, data...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+}
+
+func TestHandleAttach_BinaryControlStaysText(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+	_ = pts
+
+	origInterval := wsPingInterval
+	wsPingInterval = 100 * time.Millisecond
+	defer func() { wsPingInterval = origInterval }()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWSBinary(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	typ, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("failed to read from websocket: %v", err)
+	}
+	if typ != websocket.MessageText {
+		t.Fatalf("message type = %v, want %v", typ, websocket.MessageText)
+	}
+	var msg wsTestMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if msg.Type != "ping" {
+		t.Errorf("message type = %q, want %q", msg.Type, "ping")
+	}
+}
+
+func TestHandleAttach_BinaryInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantRecv bool
+	}{
+		{name: "通常接続では pty に書き込まれる", query: "", wantRecv: true},
+		{name: "読み取り専用では破棄される", query: "?readonly=1", wantRecv: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pts, mock, cleanup := setupWSTest(t)
+			defer cleanup()
+
+			srv, token := newTestServerWithWS(t, mock)
+			ts := httptest.NewServer(srv.Handler())
+			defer ts.Close()
+
+			conn, ctx, cancel := dialWSBinary(t, ts.URL, "/api/sessions/main/windows/0/attach"+tt.query, token)
+			defer cancel()
+			defer conn.Close(websocket.StatusNormalClosure, "")
+
+			if err := conn.Write(ctx, websocket.MessageBinary, []byte("pwd\r")); err != nil {
+				t.Fatalf("failed to write to websocket: %v", err)
+			}
+
+			buf := make([]byte, 256)
+			if !tt.wantRecv {
+				pts.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+				if n, err := pts.Read(buf); err == nil {
+					t.Errorf("pts received %q in read-only mode, want nothing", buf[:n])
+				}
+				return
+			}
+
+			pts.SetReadDeadline(time.Now().Add(3 * time.Second))
+			n, err := pts.Read(buf)
+			if err != nil {
+				t.Fatalf("failed to read from pts: %v", err)
+			}
+			// pty の line discipline が \r を \n に変換する場合がある
+			if got := string(buf[:n]); got != "pwd\r" && got != "pwd\n" {
+				t.Errorf("pts received %q, want %q or %q", got, "pwd\r", "pwd\n")
+			}
+		})
+	}
+}
+
+func TestHandleAttach_LegacyClientGetsJSONOutput(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	if got := conn.Subprotocol(); got != "" {
+		t.Errorf("negotiated subprotocol = %q, want none", got)
+	}
+
+	if _, err := pts.Write([]byte("legacy")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	typ, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("failed to read from websocket: %v", err)
+	}
+	if typ != websocket.MessageText {
+		t.Fatalf("message type = %v, want %v", typ, websocket.MessageText)
+	}
+	var msg wsTestMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if msg.Type != "output" || msg.Data != "legacy" {
+		t.Errorf("got %+v, want output %q", msg, "legacy")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tjst-t/palmux/internal/tmux"
 	"nhooyr.io/websocket"
 )
 
@@ -30,10 +31,27 @@ type wsMock struct {
 
 	calledAttach      string
 	calledWindowIndex int
+	calledReadOnly    bool
 	mu                sync.Mutex
 
 	// getClientInfoFunc が設定されている場合、GetClientSessionWindow 呼び出し時に使用する
 	getClientInfoFunc func(tty string) (string, int, error)
+
+	// getClientPaneFunc が設定されている場合、GetClientPane 呼び出し時に使用する
+	getClientPaneFunc func(tty string) (string, error)
+
+	// eventsEnabled が true の場合、SubscribeEvents はコントロールモードが使える状態として振る舞う
+	eventsEnabled bool
+	eventSubs     []chan tmux.Event
+
+	refreshedClients []string // RefreshClient に渡された tty
+}
+
+func (m *wsMock) RefreshClient(tty string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshedClients = append(m.refreshedClients, tty)
+	return nil
 }
 
 func (m *wsMock) GetClientSessionWindow(tty string) (string, int, error) {
@@ -46,11 +64,61 @@ func (m *wsMock) GetClientSessionWindow(tty string) (string, int, error) {
 	return m.configurableMock.GetClientSessionWindow(tty)
 }
 
-func (m *wsMock) Attach(session string, windowIndex int) (*os.File, *exec.Cmd, error) {
+func (m *wsMock) GetClientPane(tty string) (string, error) {
+	m.mu.Lock()
+	fn := m.getClientPaneFunc
+	m.mu.Unlock()
+	if fn != nil {
+		return fn(tty)
+	}
+	return m.configurableMock.GetClientPane(tty)
+}
+
+func (m *wsMock) SubscribeEvents() chan tmux.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.eventsEnabled {
+		return nil
+	}
+	ch := make(chan tmux.Event, 16)
+	m.eventSubs = append(m.eventSubs, ch)
+	return ch
+}
+
+func (m *wsMock) UnsubscribeEvents(ch chan tmux.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.eventSubs {
+		if c == ch {
+			m.eventSubs = append(m.eventSubs[:i], m.eventSubs[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// publishEvent は全購読者に tmux の通知を送る。
+func (m *wsMock) publishEvent(ev tmux.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.eventSubs {
+		ch <- ev
+	}
+}
+
+// subscriberCount は購読者の数を返す。
+func (m *wsMock) subscriberCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.eventSubs)
+}
+
+func (m *wsMock) Attach(session string, windowIndex int, readOnly bool) (*os.File, *exec.Cmd, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.calledAttach = session
 	m.calledWindowIndex = windowIndex
+	m.calledReadOnly = readOnly
 	if m.attachErr != nil {
 		return nil, nil, m.attachErr
 	}
@@ -109,18 +177,14 @@ func setupWSTest(t *testing.T) (pts *os.File, mock *wsMock, cleanup func()) {
 }
 
 // newTestServerWithWS は WebSocket テスト用 Server を作成するヘルパー。
-func newTestServerWithWS(mock *wsMock) (*Server, string) {
-	const token = "test-token"
-	srv := NewServer(Options{
-		Tmux:     mock,
-		Token:    token,
-		BasePath: "/",
-	})
-	return srv, token
+// テスト終了時に Server を Shutdown し、attach の goroutine の終了を待つ（テストがパッケージ変数を戻す前に止める）。
+func newTestServerWithWS(t *testing.T, mock *wsMock) (*Server, string) {
+	return newTestServerWithWSAndMaxConn(t, mock, 0)
 }
 
 // newTestServerWithWSAndMaxConn は WebSocket テスト用 Server を MaxConnections 付きで作成するヘルパー。
-func newTestServerWithWSAndMaxConn(mock *wsMock, maxConn int) (*Server, string) {
+func newTestServerWithWSAndMaxConn(t *testing.T, mock *wsMock, maxConn int) (*Server, string) {
+	t.Helper()
 	const token = "test-token"
 	srv := NewServer(Options{
 		Tmux:           mock,
@@ -128,10 +192,23 @@ func newTestServerWithWSAndMaxConn(mock *wsMock, maxConn int) (*Server, string)
 		BasePath:       "/",
 		MaxConnections: maxConn,
 	})
+	shutdownOnCleanup(t, srv)
 	return srv, token
 }
 
-// dialWS は WebSocket 接続を確立するヘルパー。
+// shutdownOnCleanup はテスト終了時に srv を Shutdown する。
+func shutdownOnCleanup(t *testing.T, srv *Server) {
+	t.Helper()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+	})
+}
+
+// dialWS は WebSocket 接続を確立し、最初の resume メッセージを読み捨てるヘルパー。
 func dialWS(t *testing.T, tsURL, path, token string) (*websocket.Conn, context.Context, context.CancelFunc) {
 	t.Helper()
 
@@ -147,6 +224,7 @@ func dialWS(t *testing.T, tsURL, path, token string) (*websocket.Conn, context.C
 		cancel()
 		t.Fatalf("failed to dial websocket: %v", err)
 	}
+	readResumeMessage(t, ctx, conn)
 
 	return conn, ctx, cancel
 }
@@ -156,7 +234,7 @@ func TestHandleAttach_WebSocketConnect(t *testing.T) {
 	defer cleanup()
 	_ = pts
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -210,7 +288,7 @@ func TestHandleAttach_WindowIndex(t *testing.T) {
 			defer cleanup()
 			_ = pts
 
-			srv, token := newTestServerWithWS(mock)
+			srv, token := newTestServerWithWS(t, mock)
 			ts := httptest.NewServer(srv.Handler())
 			defer ts.Close()
 
@@ -239,7 +317,7 @@ func TestHandleAttach_InputMessage(t *testing.T) {
 	pts, mock, cleanup := setupWSTest(t)
 	defer cleanup()
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -278,7 +356,7 @@ func TestHandleAttach_OutputMessage(t *testing.T) {
 	pts, mock, cleanup := setupWSTest(t)
 	defer cleanup()
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -316,7 +394,7 @@ func TestHandleAttach_ResizeMessage(t *testing.T) {
 	pts, mock, cleanup := setupWSTest(t)
 	defer cleanup()
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -364,7 +442,7 @@ func TestHandleAttach_DisconnectCleanup(t *testing.T) {
 	pts, mock, cleanup := setupWSTest(t)
 	defer cleanup()
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -402,7 +480,7 @@ func TestHandleAttach_AttachError(t *testing.T) {
 		attachErr: io.ErrClosedPipe,
 	}
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -432,7 +510,7 @@ func TestHandleAttach_AttachError(t *testing.T) {
 func TestHandleAttach_AuthRequired(t *testing.T) {
 	mock := &wsMock{}
 
-	srv, _ := newTestServerWithWS(mock)
+	srv, _ := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -456,7 +534,7 @@ func TestHandleAttach_AuthRequired(t *testing.T) {
 func TestConnectionTracker_Add(t *testing.T) {
 	ct := newConnectionTracker(5)
 
-	id, err := ct.add("main", "127.0.0.1:12345")
+	id, err := ct.add("main", "127.0.0.1:12345", "alice@example.com")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -474,6 +552,9 @@ func TestConnectionTracker_Add(t *testing.T) {
 	if conns[0].RemoteIP != "127.0.0.1:12345" {
 		t.Errorf("remote_ip = %q, want %q", conns[0].RemoteIP, "127.0.0.1:12345")
 	}
+	if conns[0].User != "alice@example.com" {
+		t.Errorf("user = %q, want %q", conns[0].User, "alice@example.com")
+	}
 	if conns[0].Connected.IsZero() {
 		t.Error("connected time should not be zero")
 	}
@@ -482,7 +563,7 @@ func TestConnectionTracker_Add(t *testing.T) {
 func TestConnectionTracker_Remove(t *testing.T) {
 	ct := newConnectionTracker(5)
 
-	id, err := ct.add("main", "127.0.0.1:12345")
+	id, err := ct.add("main", "127.0.0.1:12345", "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -499,41 +580,76 @@ func TestConnectionTracker_MaxPerSession(t *testing.T) {
 	ct := newConnectionTracker(2)
 
 	// 同一セッションに2つの接続（上限）
-	id1, err := ct.add("main", "127.0.0.1:1")
+	id1, err := ct.add("main", "127.0.0.1:1", "")
 	if err != nil {
 		t.Fatalf("unexpected error on first add: %v", err)
 	}
-	_, err = ct.add("main", "127.0.0.1:2")
+	_, err = ct.add("main", "127.0.0.1:2", "")
 	if err != nil {
 		t.Fatalf("unexpected error on second add: %v", err)
 	}
 
 	// 3つ目は拒否される
-	_, err = ct.add("main", "127.0.0.1:3")
+	_, err = ct.add("main", "127.0.0.1:3", "")
 	if err == nil {
 		t.Fatal("expected error when exceeding max connections, got nil")
 	}
 
 	// 別のセッションは影響を受けない
-	_, err = ct.add("dev", "127.0.0.1:4")
+	_, err = ct.add("dev", "127.0.0.1:4", "")
 	if err != nil {
 		t.Fatalf("unexpected error on different session: %v", err)
 	}
 
 	// 1つ削除すれば再度追加可能
 	ct.remove(id1)
-	_, err = ct.add("main", "127.0.0.1:5")
+	_, err = ct.add("main", "127.0.0.1:5", "")
 	if err != nil {
 		t.Fatalf("unexpected error after removing a connection: %v", err)
 	}
 }
 
+func TestConnectionTracker_SpectatorsCountedSeparately(t *testing.T) {
+	ct := newConnectionTracker(1)
+	ct.maxSpectatorsPerSession = 2
+
+	if _, err := ct.add("main", "127.0.0.1:1", ""); err != nil {
+		t.Fatalf("unexpected error on add: %v", err)
+	}
+
+	// 通常接続が上限でも観戦接続は追加できる
+	for i := 0; i < 2; i++ {
+		if _, err := ct.addSpectator("main", "127.0.0.1:2", ""); err != nil {
+			t.Fatalf("unexpected error on spectator %d: %v", i, err)
+		}
+	}
+
+	// 観戦接続の上限を超えると拒否される
+	if _, err := ct.addSpectator("main", "127.0.0.1:3", ""); err == nil {
+		t.Error("expected error when exceeding max spectators, got nil")
+	}
+	// 観戦接続は通常接続の枠を消費しない（通常接続は引き続き上限で拒否される）
+	if _, err := ct.add("main", "127.0.0.1:4", ""); err == nil {
+		t.Error("expected error when exceeding max connections, got nil")
+	}
+
+	spectators := 0
+	for _, c := range ct.list() {
+		if c.Spectator {
+			spectators++
+		}
+	}
+	if spectators != 2 {
+		t.Errorf("spectators = %d, want 2", spectators)
+	}
+}
+
 func TestConnectionTracker_List(t *testing.T) {
 	ct := newConnectionTracker(5)
 
-	ct.add("main", "127.0.0.1:1")
-	ct.add("dev", "192.168.1.1:2")
-	ct.add("main", "10.0.0.1:3")
+	ct.add("main", "127.0.0.1:1", "")
+	ct.add("dev", "192.168.1.1:2", "")
+	ct.add("main", "10.0.0.1:3", "")
 
 	conns := ct.list()
 	if len(conns) != 3 {
@@ -562,7 +678,7 @@ func TestConnectionTracker_ConcurrentSafety(t *testing.T) {
 		wg.Add(3)
 		go func(i int) {
 			defer wg.Done()
-			id, _ := ct.add("session", "127.0.0.1:"+strings.Repeat("0", i%5))
+			id, _ := ct.add("session", "127.0.0.1:"+strings.Repeat("0", i%5), "")
 			if id != "" {
 				ct.remove(id)
 			}
@@ -573,7 +689,7 @@ func TestConnectionTracker_ConcurrentSafety(t *testing.T) {
 		}()
 		go func() {
 			defer wg.Done()
-			ct.add("other", "192.168.0.1:1")
+			ct.add("other", "192.168.0.1:1", "")
 		}()
 	}
 	wg.Wait()
@@ -584,7 +700,7 @@ func TestHandleAttach_MultipleConnectionsSameSession(t *testing.T) {
 		multiPty: true,
 	}
 
-	srv, token := newTestServerWithWSAndMaxConn(mock, 5)
+	srv, token := newTestServerWithWSAndMaxConn(t, mock, 5)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -614,7 +730,7 @@ func TestHandleAttach_TooManyConnections(t *testing.T) {
 	}
 
 	// maxConnections を 2 に設定
-	srv, token := newTestServerWithWSAndMaxConn(mock, 2)
+	srv, token := newTestServerWithWSAndMaxConn(t, mock, 2)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -657,12 +773,99 @@ func TestHandleAttach_TooManyConnections(t *testing.T) {
 	mock.mu.Unlock()
 }
 
+func TestHandleAttach_ReadOnlyDropsInput(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach?readonly=1", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	for _, msg := range []wsTestMessage{
+		{Type: "input", Data: "rm -rf /\r"},
+		{Type: "resize", Cols: 100, Rows: 30},
+	} {
+		data, _ := json.Marshal(msg)
+		if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
+			t.Fatalf("failed to write to websocket: %v", err)
+		}
+	}
+
+	// input は pty に書き込まれない
+	buf := make([]byte, 256)
+	pts.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if n, err := pts.Read(buf); err == nil {
+		t.Errorf("pts received %q in read-only mode, want nothing", buf[:n])
+	}
+
+	mock.mu.Lock()
+	readOnly := mock.calledReadOnly
+	mock.mu.Unlock()
+	if !readOnly {
+		t.Error("Attach should be called with readOnly = true")
+	}
+
+	// 出力は引き続き配信される
+	if _, err := pts.Write([]byte("building...")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	_, msgData, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("failed to read from websocket: %v", err)
+	}
+	var out wsTestMessage
+	if err := json.Unmarshal(msgData, &out); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if out.Type != "output" || out.Data != "building..." {
+		t.Errorf("got %+v, want output %q", out, "building...")
+	}
+}
+
+func TestHandleAttach_SpectatorBypassesMaxConnections(t *testing.T) {
+	mock := &wsMock{
+		multiPty: true,
+	}
+
+	srv, token := newTestServerWithWSAndMaxConn(t, mock, 1)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn1, _, cancel1 := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel1()
+	defer conn1.Close(websocket.StatusNormalClosure, "")
+
+	time.Sleep(100 * time.Millisecond)
+
+	// 通常接続が上限でも観戦接続は確立できる
+	conn2, _, cancel2 := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach?readonly=1", token)
+	defer cancel2()
+	defer conn2.Close(websocket.StatusNormalClosure, "")
+
+	time.Sleep(100 * time.Millisecond)
+
+	conns := srv.connTracker.list()
+	if len(conns) != 2 {
+		t.Fatalf("connections = %d, want 2", len(conns))
+	}
+
+	mock.mu.Lock()
+	for _, pts := range mock.ptsPairs {
+		pts.Close()
+	}
+	mock.mu.Unlock()
+}
+
 func TestHandleAttach_ConnectionRemovedAfterClose(t *testing.T) {
 	mock := &wsMock{
 		multiPty: true,
 	}
 
-	srv, token := newTestServerWithWSAndMaxConn(mock, 5)
+	srv, token := newTestServerWithWSAndMaxConn(t, mock, 5)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -702,7 +905,7 @@ func TestHandleListConnections(t *testing.T) {
 		multiPty: true,
 	}
 
-	srv, token := newTestServerWithWSAndMaxConn(mock, 5)
+	srv, token := newTestServerWithWSAndMaxConn(t, mock, 5)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -778,7 +981,7 @@ func TestHandleListConnections(t *testing.T) {
 
 func TestHandleListConnections_AuthRequired(t *testing.T) {
 	mock := &wsMock{}
-	srv, _ := newTestServerWithWS(mock)
+	srv, _ := newTestServerWithWS(t, mock)
 
 	rec := doRequest(t, srv.Handler(), http.MethodGet, "/api/connections", "", "")
 	if rec.Code != http.StatusUnauthorized {
@@ -790,7 +993,7 @@ func TestHandleAttach_PongMessage(t *testing.T) {
 	pts, mock, cleanup := setupWSTest(t)
 	defer cleanup()
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -841,7 +1044,7 @@ func TestHandleAttach_PingSent(t *testing.T) {
 	wsPingInterval = 100 * time.Millisecond
 	defer func() { wsPingInterval = origInterval }()
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -881,7 +1084,7 @@ func TestHandleAttach_DefaultMaxConnections(t *testing.T) {
 		multiPty: true,
 	}
 
-	srv, _ := newTestServerWithWS(mock)
+	srv, _ := newTestServerWithWS(t, mock)
 
 	// connTracker の maxPerSession がデフォルトの 5 であることを確認
 	if srv.connTracker.maxPerSession != 5 {
@@ -921,7 +1124,7 @@ func TestHandleAttach_ClientStatusSent_WindowChange(t *testing.T) {
 		return "main", 1, nil
 	}
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -989,7 +1192,7 @@ func TestHandleAttach_ClientStatusSent_SessionChange(t *testing.T) {
 		return "dev", 0, nil
 	}
 
-	srv, token := newTestServerWithWS(mock)
+	srv, token := newTestServerWithWS(t, mock)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -1032,6 +1235,152 @@ func TestHandleAttach_ClientStatusSent_SessionChange(t *testing.T) {
 	}
 }
 
+func TestHandleAttach_PaneSent(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	origInterval := wsWatchActiveWindowInterval
+	wsWatchActiveWindowInterval = 50 * time.Millisecond
+	defer func() { wsWatchActiveWindowInterval = origInterval }()
+
+	var callCount int
+	var callMu sync.Mutex
+
+	// 1〜2回目: %1、3回目以降: pane 切替（%3）
+	mock.getClientPaneFunc = func(tty string) (string, error) {
+		callMu.Lock()
+		defer callMu.Unlock()
+		callCount++
+		if callCount <= 2 {
+			return "%1", nil
+		}
+		return "%3", nil
+	}
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	// 接続直後のアクティブ pane と、変更後の pane が 1 回ずつ届く
+	var got []string
+	deadline := time.After(3 * time.Second)
+	for len(got) < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for pane messages, got %q", got)
+		default:
+		}
+
+		readCtx, readCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		_, msgData, err := conn.Read(readCtx)
+		readCancel()
+		if err != nil {
+			continue
+		}
+
+		var msg wsPaneMessage
+		if err := json.Unmarshal(msgData, &msg); err != nil {
+			continue
+		}
+		if msg.Type == "pane" {
+			got = append(got, msg.Pane)
+		}
+	}
+	if got[0] != "%1" || got[1] != "%3" {
+		t.Errorf("pane messages = %q, want [%%1 %%3]", got)
+	}
+}
+
+func TestHandleAttach_TmuxEvents(t *testing.T) {
+	_, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	// コントロールモードが使える場合はポーリングしない
+	origInterval := wsWatchActiveWindowInterval
+	wsWatchActiveWindowInterval = time.Hour
+	defer func() { wsWatchActiveWindowInterval = origInterval }()
+	origDelay := wsTmuxChangedDelay
+	wsTmuxChangedDelay = 10 * time.Millisecond
+	defer func() { wsTmuxChangedDelay = origDelay }()
+
+	var window int
+	var windowMu sync.Mutex
+	mock.eventsEnabled = true
+	mock.getClientInfoFunc = func(tty string) (string, int, error) {
+		windowMu.Lock()
+		defer windowMu.Unlock()
+		return "main", window, nil
+	}
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn, ctx, cancel := dialWS(t, ts.URL, "/api/sessions/main/windows/0/attach", token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	// アクティブウィンドウ・pane・一覧の変化の 3 つの監視が購読するまで待つ
+	deadline := time.Now().Add(3 * time.Second)
+	for mock.subscriberCount() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribers = %d, want 3", mock.subscriberCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// readType は指定した種類のメッセージを受信するまで読む
+	readType := func(typ string) map[string]any {
+		t.Helper()
+		deadline := time.After(3 * time.Second)
+		for {
+			select {
+			case <-deadline:
+				t.Fatalf("timed out waiting for %s message", typ)
+			default:
+			}
+			readCtx, readCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+			_, data, err := conn.Read(readCtx)
+			readCancel()
+			if err != nil {
+				continue
+			}
+			var msg map[string]any
+			if json.Unmarshal(data, &msg) == nil && msg["type"] == typ {
+				return msg
+			}
+		}
+	}
+
+	windowMu.Lock()
+	window = 1
+	windowMu.Unlock()
+	mock.publishEvent(tmux.Event{Type: "session-window-changed", Session: "$1", Window: "@3"})
+	if msg := readType("client_status"); msg["window"] != float64(1) {
+		t.Errorf("client_status = %v, want window 1", msg)
+	}
+
+	// 連続した通知は 1 つの tmux_changed にまとめる
+	mock.publishEvent(tmux.Event{Type: "window-add", Window: "@4"})
+	mock.publishEvent(tmux.Event{Type: "window-renamed", Window: "@4", Name: "vim"})
+	readType("tmux_changed")
+	readCtx, readCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer readCancel()
+	for {
+		_, data, err := conn.Read(readCtx)
+		if err != nil {
+			break
+		}
+		if strings.Contains(string(data), "tmux_changed") {
+			t.Errorf("got a second tmux_changed message for a burst of events")
+		}
+	}
+}
+
 func TestUtf8TruncIndex(t *testing.T) {
 	tests := []struct {
 		name string
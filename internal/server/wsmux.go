@@ -0,0 +1,410 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"nhooyr.io/websocket"
+)
+
+// wsMuxMaxChannels は 1 つの多重化接続で同時に開けるチャネルの上限。
+const wsMuxMaxChannels = 8
+
+// wsMuxHeaderSize は多重化接続のバイナリフレームの先頭に付けるチャネル ID（big endian の uint32）のバイト数。
+const wsMuxHeaderSize = 4
+
+// wsMuxRequest はクライアントから多重化接続に送る制御メッセージ。
+// open（チャネルを開いて attach する）、input（テキストの入力）、resize、close（チャネルを閉じる）、pong がある。
+type wsMuxRequest struct {
+	Type     string `json:"type"`
+	Channel  uint32 `json:"channel"`            // クライアントが選ぶ 0 以外のチャネル ID
+	Session  string `json:"session,omitempty"`  // open: attach するセッション
+	Window   *int   `json:"window,omitempty"`   // open: 表示するウィンドウ番号（省略時はセッションのアクティブウィンドウ）
+	ReadOnly bool   `json:"readonly,omitempty"` // open: 観戦モード
+	Data     string `json:"data,omitempty"`     // input: pty への入力
+	Cols     int    `json:"cols,omitempty"`     // open・resize: 画面サイズ
+	Rows     int    `json:"rows,omitempty"`
+}
+
+// wsMuxChannelMessage はチャネルの状態（opened、closed、error）を知らせるメッセージ。
+type wsMuxChannelMessage struct {
+	Type     string `json:"type"`
+	Channel  uint32 `json:"channel"`
+	Session  string `json:"session,omitempty"`
+	Window   *int   `json:"window,omitempty"`
+	ReadOnly bool   `json:"readonly,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// muxChannel は多重化接続の 1 チャネル（1 つの tmux attach）。
+type muxChannel struct {
+	id     uint32
+	key    muxSlotKey
+	a      *attachment
+	cancel context.CancelFunc
+	done   chan struct{} // チャネルの後始末が終わったら close される
+}
+
+// muxSlotKey は接続数の枠をまとめる単位（セッションと観戦かどうか）。
+type muxSlotKey struct {
+	session   string
+	spectator bool
+}
+
+// muxSlot は多重化接続が使っている接続数の枠。同じ枠のチャネルが全て閉じたら返す。
+type muxSlot struct {
+	connID string
+	refs   int
+}
+
+// wsMux は 1 つの多重化接続の状態。
+type wsMux struct {
+	s          *Server
+	r          *http.Request
+	p          Principal
+	ctx        context.Context
+	writeFrame func(context.Context, websocket.MessageType, []byte) error
+
+	mu       sync.Mutex
+	channels map[uint32]*muxChannel
+	slots    map[muxSlotKey]*muxSlot
+}
+
+// withChannel は JSON オブジェクトのメッセージ data の先頭に "channel" フィールドを加える。
+// 既存の監視（client_status・pane 等）のメッセージをチャネル付きで送るために使う。
+func withChannel(id uint32, data []byte) []byte {
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	out := make([]byte, 0, len(data)+24)
+	out = append(out, `{"channel":`...)
+	out = strconv.AppendUint(out, uint64(id), 10)
+	if len(data) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, data[1:]...)
+}
+
+// handleMux は GET /api/mux のハンドラ。
+// 1 つの WebSocket で複数の tmux attach（チャネル）を多重化する。タブレットで複数のウィンドウを並べる場合などに使う。
+// チャネルは接続中に open・close メッセージで開閉し、それぞれが独立した pty・グループセッション・画面サイズ・入力を持つ。
+// pty の出力と入力はチャネル ID（big endian の uint32）を先頭に付けたバイナリフレームで、
+// 制御メッセージは channel フィールド付きの JSON のテキストフレームで送受信する。
+// 接続数は同じ接続の同じセッションのチャネルをまとめて 1 つと数える（観戦は別枠）。
+// チャネルは再接続で引き継げず、接続が切れると全て閉じる。
+// Origin ヘッダーが許可されていない場合（--allowed-origins）は 403 Forbidden を、シャットダウン中は 503 を返す。
+func (s *Server) handleMux() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// クロスサイト WebSocket ハイジャック対策（アップグレードの前に検査する）
+		if !s.origins.allowed(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		if !s.beginAttach() {
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer s.attachWG.Done()
+
+		// Origin は s.origins で検査済みのため、websocket パッケージの同一オリジン検査は行わない
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			InsecureSkipVerify: true,
+			CompressionMode:    websocket.CompressionNoContextTakeover,
+		})
+		if err != nil {
+			log.Printf("websocket accept error: %v", err)
+			return
+		}
+		defer conn.Close(websocket.StatusInternalError, "internal error")
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// 全 WebSocket 書き込みをシリアライズする（concurrent writes 対策）
+		var wsMu sync.Mutex
+		writeFrame := func(ctx context.Context, typ websocket.MessageType, data []byte) error {
+			wsMu.Lock()
+			defer wsMu.Unlock()
+			return conn.Write(ctx, typ, data)
+		}
+		writeWS := func(ctx context.Context, data []byte) error {
+			return writeFrame(ctx, websocket.MessageText, data)
+		}
+
+		p, _ := PrincipalFromContext(r.Context())
+		m := &wsMux{
+			s:          s,
+			r:          r,
+			p:          p,
+			ctx:        ctx,
+			writeFrame: writeFrame,
+			channels:   make(map[uint32]*muxChannel),
+			slots:      make(map[muxSlotKey]*muxSlot),
+		}
+		// 接続ごとの goroutine は全チャネルを閉じた後に終了を待つ
+		var g connGoroutines
+		defer g.wait()
+
+		// 接続の終了時に全チャネルを閉じる（attachment の解放を待ってから Shutdown を進める）
+		defer func() {
+			cancel()
+			m.closeAll()
+		}()
+
+		g.spawn(func() { s.wsPing(ctx, writeWS, cancel) })
+		g.spawn(func() { s.watchTmuxChanged(ctx, writeWS, cancel) })
+		g.spawn(func() { s.watchNotifications(ctx, p, writeWS, cancel) })
+		g.spawn(func() { s.watchShutdown(ctx, writeWS, conn, cancel) })
+
+		// クライアント証明書で接続している場合は証明書の失効で切断する（接続の終了で全チャネルを閉じる）
+		if s.clientCerts != nil && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			g.spawn(func() { s.watchClientCert(ctx, r.TLS.PeerCertificates[0], conn, cancel) })
+		}
+
+		for {
+			typ, data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+
+			// バイナリフレームはチャネルの pty への生の入力
+			if typ == websocket.MessageBinary {
+				if len(data) < wsMuxHeaderSize {
+					continue
+				}
+				ch := m.channel(binary.BigEndian.Uint32(data))
+				if ch == nil || ch.a.readOnly {
+					continue
+				}
+				if _, err := ch.a.ptmx.Write(data[wsMuxHeaderSize:]); err != nil {
+					log.Printf("pty write error: %v", err)
+					ch.cancel()
+				}
+				continue
+			}
+
+			var req wsMuxRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				log.Printf("invalid ws message: %v", err)
+				continue
+			}
+			if err := m.handle(req); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// handle は制御メッセージを処理する。WebSocket への書き込みに失敗した場合はエラーを返す。
+func (m *wsMux) handle(req wsMuxRequest) error {
+	switch req.Type {
+	case "open":
+		if err := m.open(req); err != nil {
+			return m.send(wsMuxChannelMessage{Type: "error", Channel: req.Channel, Error: err.Error()})
+		}
+	case "input":
+		if ch := m.channel(req.Channel); ch != nil && !ch.a.readOnly {
+			if _, err := ch.a.ptmx.Write([]byte(req.Data)); err != nil {
+				log.Printf("pty write error: %v", err)
+				ch.cancel()
+			}
+		}
+	case "resize":
+		if ch := m.channel(req.Channel); ch != nil && req.Cols > 0 && req.Rows > 0 {
+			if err := ch.a.resize(req.Cols, req.Rows); err != nil {
+				log.Printf("pty resize error: %v", err)
+			}
+		}
+	case "close":
+		if ch := m.channel(req.Channel); ch != nil {
+			ch.cancel()
+		}
+	case "pong":
+		// クライアントからの生存確認に即 ping で応答
+		pingMsg, _ := json.Marshal(wsOutputMessage{Type: "ping"})
+		return m.writeFrame(m.ctx, websocket.MessageText, pingMsg)
+	default:
+		log.Printf("unknown message type: %q", req.Type)
+	}
+	return nil
+}
+
+// send は制御メッセージを送る。
+func (m *wsMux) send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return m.writeFrame(m.ctx, websocket.MessageText, data)
+}
+
+// channel は ID のチャネルを返す（開いていなければ nil）。
+func (m *wsMux) channel(id uint32) *muxChannel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.channels[id]
+}
+
+// open はチャネルを開いて tmux に attach し、出力の転送とウィンドウ・pane の監視を開始する。
+// 開けない場合（不正なチャネル ID、アクセス権がない、上限を超えた、attach の失敗）はエラーを返す。
+func (m *wsMux) open(req wsMuxRequest) error {
+	if req.Channel == 0 {
+		return fmt.Errorf("channel must not be 0")
+	}
+	if req.Session == "" {
+		return fmt.Errorf("session is required")
+	}
+	if !m.p.CanAccessSession(req.Session) {
+		return fmt.Errorf("forbidden")
+	}
+	windowIndex := -1
+	if req.Window != nil && *req.Window >= 0 {
+		windowIndex = *req.Window
+	}
+	readOnly := req.ReadOnly || m.p.ReadOnly()
+	key := muxSlotKey{session: req.Session, spectator: readOnly}
+
+	// チャネル ID と接続数の枠を予約する（attach の間に同じ ID で開かれないように）
+	m.mu.Lock()
+	if _, ok := m.channels[req.Channel]; ok {
+		m.mu.Unlock()
+		return fmt.Errorf("channel %d is already open", req.Channel)
+	}
+	if len(m.channels) >= wsMuxMaxChannels {
+		m.mu.Unlock()
+		return fmt.Errorf("too many channels (max %d)", wsMuxMaxChannels)
+	}
+	if err := m.acquireLocked(key); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	ch := &muxChannel{id: req.Channel, key: key, cancel: cancel, done: make(chan struct{})}
+	m.channels[req.Channel] = ch
+	m.mu.Unlock()
+
+	// 接続数の枠はチャネル側で管理するため、attachment には接続 ID を渡さない
+	a, err := m.s.attachNew(m.r, req.Session, windowIndex, readOnly, false, m.p, "")
+	if err != nil {
+		m.forget(ch)
+		cancel()
+		return fmt.Errorf("attach failed: %w", err)
+	}
+	ch.a = a
+	if req.Cols > 0 && req.Rows > 0 {
+		if err := a.resize(req.Cols, req.Rows); err != nil {
+			log.Printf("pty resize error: %v", err)
+		}
+	}
+
+	// pty の終了（attachment が閉じる）ときも kick でチャネルを閉じる
+	q, _, _, err := a.bind(0, false, m.r.RemoteAddr, cancel)
+	if err != nil {
+		m.forget(ch)
+		cancel()
+		return err
+	}
+
+	window := req.Window
+	if windowIndex < 0 {
+		window = nil
+	}
+	if err := m.send(wsMuxChannelMessage{Type: "opened", Channel: ch.id, Session: req.Session, Window: window, ReadOnly: readOnly}); err != nil {
+		cancel()
+	}
+
+	// チャネルのメッセージにはチャネル ID を付け、出力のバイナリフレームには先頭にチャネル ID を付ける
+	writeFrame := func(ctx context.Context, typ websocket.MessageType, data []byte) error {
+		if typ == websocket.MessageBinary {
+			frame := make([]byte, wsMuxHeaderSize+len(data))
+			binary.BigEndian.PutUint32(frame, ch.id)
+			copy(frame[wsMuxHeaderSize:], data)
+			return m.writeFrame(ctx, typ, frame)
+		}
+		return m.writeFrame(ctx, typ, withChannel(ch.id, data))
+	}
+	writeWS := func(ctx context.Context, data []byte) error {
+		return writeFrame(ctx, websocket.MessageText, data)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); m.s.flushOutput(ctx, writeFrame, q, a.ptsName, true, cancel) }()
+	go func() { defer wg.Done(); m.s.watchActiveWindow(ctx, writeWS, a.ptsName, cancel) }()
+	go func() { defer wg.Done(); m.s.watchActivePane(ctx, writeWS, a.ptsName, cancel) }()
+
+	go func() {
+		<-ctx.Done()
+		wg.Wait()
+		a.close()
+		m.forget(ch)
+		// 接続自体が終わっている場合は知らせない
+		if m.ctx.Err() == nil {
+			m.send(wsMuxChannelMessage{Type: "closed", Channel: ch.id})
+		}
+		close(ch.done)
+	}()
+	return nil
+}
+
+// acquireLocked は key の接続数の枠を使う。この接続ですでに使っている場合は参照を増やすだけで、新たには数えない。
+// 呼び出し側は m.mu を保持していること。
+func (m *wsMux) acquireLocked(key muxSlotKey) error {
+	if slot, ok := m.slots[key]; ok {
+		slot.refs++
+		return nil
+	}
+	var connID string
+	var err error
+	if key.spectator {
+		connID, err = m.s.connTracker.addSpectator(key.session, m.r.RemoteAddr, m.p.Name)
+	} else {
+		connID, err = m.s.connTracker.add(key.session, m.r.RemoteAddr, m.p.Name)
+	}
+	if err != nil {
+		return err
+	}
+	m.slots[key] = &muxSlot{connID: connID, refs: 1}
+	return nil
+}
+
+// forget はチャネルを登録から外し、接続数の枠の参照を返す（最後の参照なら枠を返す）。
+func (m *wsMux) forget(ch *muxChannel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.channels[ch.id] != ch {
+		return
+	}
+	delete(m.channels, ch.id)
+	if slot, ok := m.slots[ch.key]; ok {
+		slot.refs--
+		if slot.refs == 0 {
+			delete(m.slots, ch.key)
+			m.s.connTracker.remove(slot.connID)
+		}
+	}
+}
+
+// closeAll は全チャネルを閉じ、後始末が終わるまで待つ。
+func (m *wsMux) closeAll() {
+	m.mu.Lock()
+	var opened []*muxChannel
+	for _, ch := range m.channels {
+		if ch.a != nil {
+			opened = append(opened, ch)
+		}
+		ch.cancel()
+	}
+	m.mu.Unlock()
+
+	for _, ch := range opened {
+		<-ch.done
+	}
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"nhooyr.io/websocket"
+)
+
+func TestWithChannel(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "フィールドあり", data: `{"type":"pane","pane":"%3"}`, want: `{"channel":7,"type":"pane","pane":"%3"}`},
+		{name: "空のオブジェクト", data: `{}`, want: `{"channel":7}`},
+		{name: "オブジェクト以外はそのまま", data: `[1]`, want: `[1]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(withChannel(7, []byte(tt.data))); got != tt.want {
+				t.Errorf("withChannel = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// dialMux は多重化接続を確立するヘルパー。
+func dialMux(t *testing.T, tsURL, token string) (*websocket.Conn, context.Context, context.CancelFunc) {
+	t.Helper()
+
+	wsURL := "ws" + strings.TrimPrefix(tsURL, "http") + "/api/mux"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{"Bearer " + token},
+		},
+	})
+	if err != nil {
+		cancel()
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	return conn, ctx, cancel
+}
+
+// muxSend は制御メッセージを送るヘルパー。
+func muxSend(t *testing.T, ctx context.Context, conn *websocket.Conn, msg string) {
+	t.Helper()
+	if err := conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// muxReadControl は指定した種類の制御メッセージを受信するまで読む（出力等は読み捨てる）。
+func muxReadControl(t *testing.T, ctx context.Context, conn *websocket.Conn, typ string) wsMuxChannelMessage {
+	t.Helper()
+	for {
+		mt, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("timed out waiting for %s message: %v", typ, err)
+		}
+		if mt != websocket.MessageText {
+			continue
+		}
+		var msg wsMuxChannelMessage
+		if json.Unmarshal(data, &msg) == nil && msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+// muxReadOutput はチャネル channel の出力に want が含まれるまで読む。
+func muxReadOutput(t *testing.T, ctx context.Context, conn *websocket.Conn, channel uint32, want string) {
+	t.Helper()
+	var got strings.Builder
+	for !strings.Contains(got.String(), want) {
+		mt, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("timed out waiting for output %q on channel %d (got %q): %v", want, channel, got.String(), err)
+		}
+		if mt == websocket.MessageBinary && len(data) >= wsMuxHeaderSize && binary.BigEndian.Uint32(data) == channel {
+			got.Write(data[wsMuxHeaderSize:])
+		}
+	}
+}
+
+// readPts は pts から want が含まれるまで読む。
+func readPts(t *testing.T, pts *os.File, want string) {
+	t.Helper()
+	pts.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var got strings.Builder
+	buf := make([]byte, 256)
+	for !strings.Contains(got.String(), want) {
+		n, err := pts.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read %q from pts (got %q): %v", want, got.String(), err)
+		}
+		got.Write(buf[:n])
+	}
+}
+
+func TestHandleMux(t *testing.T) {
+	mock := &wsMock{multiPty: true}
+	srv, token := newTestServerWithWSAndMaxConn(t, mock, 1)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	defer func() {
+		mock.mu.Lock()
+		for _, pts := range mock.ptsPairs {
+			pts.Close()
+		}
+		mock.mu.Unlock()
+	}()
+
+	conn, ctx, cancel := dialMux(t, ts.URL, token)
+	defer cancel()
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	// 同じセッションの 2 つのウィンドウを開く（接続数の上限 1 でも 1 接続と数える）
+	muxSend(t, ctx, conn, `{"type":"open","channel":1,"session":"main","window":0,"cols":100,"rows":30}`)
+	if msg := muxReadControl(t, ctx, conn, "opened"); msg.Channel != 1 || msg.Session != "main" || msg.Window == nil || *msg.Window != 0 {
+		t.Errorf("opened = %+v, want channel 1 main:0", msg)
+	}
+	muxSend(t, ctx, conn, `{"type":"open","channel":2,"session":"main","window":1}`)
+	if msg := muxReadControl(t, ctx, conn, "opened"); msg.Channel != 2 || *msg.Window != 1 {
+		t.Errorf("opened = %+v, want channel 2 main:1", msg)
+	}
+	if n := len(srv.connTracker.list()); n != 1 {
+		t.Errorf("connections = %d, want 1", n)
+	}
+
+	mock.mu.Lock()
+	pts1, pts2 := mock.ptsPairs[0], mock.ptsPairs[1]
+	mock.mu.Unlock()
+
+	// open で指定した画面サイズ
+	if size, err := pty.GetsizeFull(pts1); err != nil || size.Cols != 100 || size.Rows != 30 {
+		t.Errorf("channel 1 size = %+v, err = %v, want 100x30", size, err)
+	}
+
+	// チャネルごとの出力
+	pts2.Write([]byte("from-two"))
+	muxReadOutput(t, ctx, conn, 2, "from-two")
+	pts1.Write([]byte("from-one"))
+	muxReadOutput(t, ctx, conn, 1, "from-one")
+
+	// チャネルごとの入力（バイナリフレームとテキストの input）
+	frame := binary.BigEndian.AppendUint32(nil, 2)
+	frame = append(frame, "to-two\n"...)
+	if err := conn.Write(ctx, websocket.MessageBinary, frame); err != nil {
+		t.Fatalf("write binary: %v", err)
+	}
+	readPts(t, pts2, "to-two")
+	muxSend(t, ctx, conn, `{"type":"input","channel":1,"data":"to-one\n"}`)
+	readPts(t, pts1, "to-one")
+
+	// チャネルごとのリサイズ
+	muxSend(t, ctx, conn, `{"type":"resize","channel":2,"cols":120,"rows":40}`)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		size, err := pty.GetsizeFull(pts2)
+		if err == nil && size.Cols == 120 && size.Rows == 40 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("channel 2 size = %+v, want 120x40", size)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 使用中のチャネル ID・不正な open
+	for _, msg := range []string{
+		`{"type":"open","channel":2,"session":"main"}`,
+		`{"type":"open","channel":0,"session":"main"}`,
+		`{"type":"open","channel":3}`,
+	} {
+		muxSend(t, ctx, conn, msg)
+		if got := muxReadControl(t, ctx, conn, "error"); got.Error == "" {
+			t.Errorf("%s: error = %+v", msg, got)
+		}
+	}
+
+	// 別のセッションは別の枠で、上限を超えると開けない（他の多重化接続も同様）
+	conn2, ctx2, cancel2 := dialMux(t, ts.URL, token)
+	defer cancel2()
+	defer conn2.Close(websocket.StatusNormalClosure, "")
+	muxSend(t, ctx2, conn2, `{"type":"open","channel":1,"session":"main"}`)
+	if got := muxReadControl(t, ctx2, conn2, "error"); !strings.Contains(got.Error, "too many connections") {
+		t.Errorf("error = %+v, want too many connections", got)
+	}
+
+	// チャネルを閉じても、同じセッションのチャネルが残っている間は枠を返さない
+	muxSend(t, ctx, conn, `{"type":"close","channel":1}`)
+	if msg := muxReadControl(t, ctx, conn, "closed"); msg.Channel != 1 {
+		t.Errorf("closed = %+v, want channel 1", msg)
+	}
+	if n := len(srv.connTracker.list()); n != 1 {
+		t.Errorf("connections = %d, want 1", n)
+	}
+	muxSend(t, ctx, conn, `{"type":"close","channel":2}`)
+	if msg := muxReadControl(t, ctx, conn, "closed"); msg.Channel != 2 {
+		t.Errorf("closed = %+v, want channel 2", msg)
+	}
+	if n := len(srv.connTracker.list()); n != 0 {
+		t.Errorf("connections = %d, want 0", n)
+	}
+
+	// 枠が空いたので他の接続から開ける
+	muxSend(t, ctx2, conn2, `{"type":"open","channel":1,"session":"main"}`)
+	if msg := muxReadControl(t, ctx2, conn2, "opened"); msg.Channel != 1 || msg.Window != nil {
+		t.Errorf("opened = %+v, want channel 1 without window", msg)
+	}
+}
+
+func TestHandleMux_CloseConnection(t *testing.T) {
+	mock := &wsMock{multiPty: true}
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	defer func() {
+		mock.mu.Lock()
+		for _, pts := range mock.ptsPairs {
+			pts.Close()
+		}
+		mock.mu.Unlock()
+	}()
+
+	conn, ctx, cancel := dialMux(t, ts.URL, token)
+	defer cancel()
+
+	muxSend(t, ctx, conn, `{"type":"open","channel":1,"session":"main"}`)
+	muxReadControl(t, ctx, conn, "opened")
+	muxSend(t, ctx, conn, `{"type":"open","channel":2,"session":"dev","readonly":true}`)
+	if msg := muxReadControl(t, ctx, conn, "opened"); !msg.ReadOnly {
+		t.Errorf("opened = %+v, want readonly", msg)
+	}
+	if n := len(srv.connTracker.list()); n != 2 {
+		t.Errorf("connections = %d, want 2", n)
+	}
+
+	// 接続を閉じると全チャネルの attach を終了する
+	conn.Close(websocket.StatusNormalClosure, "")
+	deadline := time.Now().Add(3 * time.Second)
+	for len(srv.connTracker.list()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connections = %d, want 0", len(srv.connTracker.list()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	srv.attachments.mu.Lock()
+	remaining := len(srv.attachments.m)
+	srv.attachments.mu.Unlock()
+	if remaining != 0 {
+		t.Errorf("attachments = %d, want 0", remaining)
+	}
+}
+
+func TestHandleMux_ReadScopeToken(t *testing.T) {
+	mock := &wsMock{multiPty: true}
+	ts, err := NewTokenStore("")
+	if err != nil {
+		t.Fatalf("NewTokenStore() error = %v", err)
+	}
+	_, readToken, _ := ts.Create("dashboard", ScopeRead)
+	srv := NewServer(Options{Tmux: mock, Token: "test-token", Tokens: ts, BasePath: "/"})
+	hs := httptest.NewServer(srv.Handler())
+	defer hs.Close()
+
+	// 閲覧用スコープのトークンは多重化接続を開けない（入力を送れない）
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(hs.URL, "http")+"/api/mux?token="+readToken, nil)
+	if err == nil {
+		t.Fatal("dial with read-scope token succeeded, want error")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("response = %v, want %d", resp, http.StatusForbidden)
+	}
+	mock.mu.Lock()
+	attached := len(mock.ptsPairs)
+	mock.mu.Unlock()
+	if attached != 0 {
+		t.Errorf("attached %d times, want 0", attached)
+	}
+}
+
+func TestHandleMux_ClientCertRevoked(t *testing.T) {
+	orig := revocationCheckInterval
+	revocationCheckInterval = 20 * time.Millisecond
+	defer func() { revocationCheckInterval = orig }()
+
+	pki := newTestPKI(t)
+	clientCert := pki.issue(t, "alice", 100)
+	crlPath := filepath.Join(t.TempDir(), "client.crl")
+	pki.writeCRL(t, crlPath)
+	certs, err := NewClientCertAuth(ClientCertConfig{CAFile: pki.caPath, CRLFile: crlPath})
+	if err != nil {
+		t.Fatalf("NewClientCertAuth() error = %v", err)
+	}
+
+	mock := &wsMock{multiPty: true}
+	srv := NewServer(Options{Tmux: mock, Token: "test-token", ClientCerts: certs, BasePath: "/"})
+	shutdownOnCleanup(t, srv)
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.TLS = certs.TLSConfig()
+	ts.StartTLS()
+	defer ts.Close()
+	defer func() {
+		mock.mu.Lock()
+		for _, pts := range mock.ptsPairs {
+			pts.Close()
+		}
+		mock.mu.Unlock()
+	}()
+
+	client := ts.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "wss"+strings.TrimPrefix(ts.URL, "https")+"/api/mux", &websocket.DialOptions{HTTPClient: client})
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	defer conn.CloseNow()
+
+	muxSend(t, ctx, conn, `{"type":"open","channel":1,"session":"main"}`)
+	muxReadControl(t, ctx, conn, "opened")
+	muxSend(t, ctx, conn, `{"type":"open","channel":2,"session":"dev"}`)
+	muxReadControl(t, ctx, conn, "opened")
+
+	// 証明書を失効させると接続ごと閉じ、全チャネルの attach を終了する
+	pki.writeCRL(t, crlPath, 100)
+	for {
+		if _, _, err := conn.Read(ctx); err != nil {
+			if got := websocket.CloseStatus(err); got != websocket.StatusPolicyViolation {
+				t.Errorf("close status = %v, want %v (err = %v)", got, websocket.StatusPolicyViolation, err)
+			}
+			break
+		}
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for len(srv.connTracker.list()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connections = %d, want 0", len(srv.connTracker.list()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	srv.attachments.mu.Lock()
+	remaining := len(srv.attachments.m)
+	srv.attachments.mu.Unlock()
+	if remaining != 0 {
+		t.Errorf("attachments = %d, want 0", remaining)
+	}
+}
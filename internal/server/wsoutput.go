@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// wsOutputInterval は pty 出力をまとめて 1 フレームで送る最小間隔。
+// cat で大きなログを流したときなどにフレーム数（と JSON・圧縮のフレームごとのオーバーヘッド）を抑える。
+var wsOutputInterval = 16 * time.Millisecond
+
+// wsOutputBufferLimit は 1 接続あたりの送信待ち pty 出力の上限（バイト）。
+// クライアントが追いつけずに上限を超えた場合は溜まった出力を破棄し、tmux に画面全体を再描画させる。
+var wsOutputBufferLimit = 1 << 20
+
+// wsOutputReadSize は pty から一度に読み取るサイズ。
+const wsOutputReadSize = 32 * 1024
+
+// wsOutputResync は出力を破棄した直後に送るシーケンス。
+// 途中で切れたエスケープシーケンスを CAN で打ち切り、文字属性をリセットする。
+const wsOutputResync = "\x18\x1b[0m"
+
+// outputQueue は 1 接続分の送信待ち pty 出力を保持する。
+// pty の読み取りは WebSocket への書き込みを待たないため、遅いクライアントが tmux の出力を止めることはない。
+type outputQueue struct {
+	mu      sync.Mutex
+	buf     []byte
+	limit   int
+	end     int64         // push された出力（破棄した分を含む）の末尾のストリームオフセット
+	dropped bool          // 上限を超えて出力を破棄した（次の take まで以降の出力も破棄する）
+	ready   chan struct{} // 送信待ちの出力があることを通知する（容量 1）
+}
+
+// newOutputQueue は上限 limit バイトの outputQueue を生成する。
+// offset は最初に push される出力のストリームオフセット。
+func newOutputQueue(limit int, offset int64) *outputQueue {
+	return &outputQueue{
+		limit: limit,
+		end:   offset,
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// push は pty 出力を追加する。上限を超える場合は送信待ちの出力ごと破棄する。
+func (q *outputQueue) push(p []byte) {
+	q.mu.Lock()
+	q.end += int64(len(p))
+	switch {
+	case q.dropped:
+		// 送信側が追いつくまで破棄し続ける（追いついた時点で画面全体を再描画させる）
+	case len(q.buf)+len(p) > q.limit:
+		q.buf = q.buf[:0]
+		q.dropped = true
+	default:
+		q.buf = append(q.buf, p...)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// drop は送信待ちの出力を破棄し、次の take で再描画を促す。
+// 再送できない位置から再接続された場合に使う。
+func (q *outputQueue) drop() {
+	q.mu.Lock()
+	q.buf = q.buf[:0]
+	q.dropped = true
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take は送信待ちの出力を dst にコピーして返し、キューを空にする。
+// end は data の末尾のストリームオフセット。
+// dropped は前回の take 以降に出力を破棄したかどうかを表し、破棄状態は解除される。
+func (q *outputQueue) take(dst []byte) (data []byte, end int64, dropped bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	data = append(dst[:0], q.buf...)
+	q.buf = q.buf[:0]
+	end = q.end
+	dropped = q.dropped
+	q.dropped = false
+	return data, end, dropped
+}
+
+// flushOutput は outputQueue に溜まった出力を WebSocket に送る。
+// binary の場合はバイト列をそのままバイナリフレームで送る（UTF-8 の境界はクライアントが扱う）。
+// JSON の場合は UTF-8 のマルチバイト文字がフレーム境界で分断されないよう、
+// 不完全なシーケンスは次回の送信に繰り越す。
+// JSON の output メッセージには送信後のストリームオフセットを付ける（バイナリではクライアントがバイト数を数える）。
+// 出力が破棄されていた場合は wsOutputResync を送り、ptsName のクライアントを tmux に再描画させる。
+// 破棄した分だけストリームオフセットが飛ぶため、バイナリでは続けて offset メッセージで現在位置を知らせる。
+func (s *Server) flushOutput(ctx context.Context, writeFrame func(context.Context, websocket.MessageType, []byte) error, q *outputQueue, ptsName string, binary bool, cleanup func()) {
+	var data, pending []byte
+	var lastFlush time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.ready:
+		}
+
+		// 前回の送信から wsOutputInterval 経つまで待ち、その間の出力をまとめる
+		if wait := wsOutputInterval - time.Since(lastFlush); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		var end int64
+		var dropped bool
+		data, end, dropped = q.take(data)
+		if dropped {
+			pending = pending[:0]
+			data = append(data[:0], wsOutputResync...)
+			// 再描画の出力はキューに入り、次回の送信で resync の後に届く
+			if ptsName != "" {
+				if err := s.tmux.RefreshClient(ptsName); err != nil {
+					log.Printf("refresh client %s: %v", ptsName, err)
+				}
+			}
+		}
+
+		typ := websocket.MessageBinary
+		if !binary {
+			pending = append(pending, data...)
+			sendEnd := utf8TruncIndex(pending)
+			msg := wsOutputMessage{
+				Type:   "output",
+				Data:   string(pending[:sendEnd]),
+				Offset: end - int64(len(pending)-sendEnd),
+			}
+			// 不完全バイトを先頭に繰り越す
+			pending = append(pending[:0], pending[sendEnd:]...)
+			if msg.Data == "" {
+				continue
+			}
+			encoded, err := json.Marshal(msg)
+			if err != nil {
+				log.Printf("json marshal error: %v", err)
+				continue
+			}
+			data = encoded
+			typ = websocket.MessageText
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		lastFlush = time.Now()
+		if err := writeFrame(ctx, typ, data); err != nil {
+			// WebSocket 書き込みエラー（クライアント切断など）
+			cleanup()
+			return
+		}
+		if dropped && binary {
+			msg, _ := json.Marshal(wsOutputMessage{Type: "offset", Offset: end})
+			if err := writeFrame(ctx, websocket.MessageText, msg); err != nil {
+				cleanup()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+func TestOutputQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		pushes      []string
+		wantData    string
+		wantDropped bool
+	}{
+		{name: "上限以内はまとめて返す", pushes: []string{"ab", "cd", "ef"}, wantData: "abcdef"},
+		{name: "上限ちょうどは破棄しない", pushes: []string{"abcd", "efgh"}, wantData: "abcdefgh"},
+		{name: "上限を超えたら溜まった出力ごと破棄する", pushes: []string{"abcd", "efghi"}, wantDropped: true},
+		{name: "破棄後の出力も take まで破棄する", pushes: []string{"abcdefghi", "j"}, wantDropped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newOutputQueue(8, 100)
+			wantEnd := int64(100)
+			for _, p := range tt.pushes {
+				q.push([]byte(p))
+				wantEnd += int64(len(p))
+			}
+			data, end, dropped := q.take(nil)
+			if string(data) != tt.wantData {
+				t.Errorf("data = %q, want %q", data, tt.wantData)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+			// 破棄した出力もストリームオフセットには数える
+			if end != wantEnd {
+				t.Errorf("end = %d, want %d", end, wantEnd)
+			}
+
+			// take 後は破棄状態が解除され、再び出力を溜める
+			q.push([]byte("next"))
+			data, end, dropped = q.take(data)
+			if string(data) != "next" || dropped || end != wantEnd+4 {
+				t.Errorf("after take: data = %q, end = %d, dropped = %v, want %q, %d, false", data, end, dropped, "next", wantEnd+4)
+			}
+		})
+	}
+}
+
+// startTestOutput は ptmx の attachment を生成し、その出力を write に送る flushOutput を開始するテスト用ヘルパー。
+// 返り値の stop は flushOutput を停止し、終了するまで待つ（テストがパッケージ変数を戻す前に呼ぶ）。
+func startTestOutput(t *testing.T, srv *Server, ptmx *os.File, binary bool, write func(context.Context, websocket.MessageType, []byte) error) (stop func()) {
+	t.Helper()
+
+	a, err := srv.newAttachment("main", 0, "", false, ptmx, nil, func() {})
+	if err != nil {
+		t.Fatalf("newAttachment() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q, _, _, err := a.bind(0, false, "", cancel)
+	if err != nil {
+		t.Fatalf("bind() error = %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.flushOutput(ctx, write, q, a.ptsName, binary, cancel)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// frameRecorder は flushOutput に渡す writeFrame を記録するテスト用ヘルパー。
+// block が nil でなければ最初の書き込みで block が閉じられるまで待つ（遅いクライアントの模倣）。
+type frameRecorder struct {
+	mu      sync.Mutex
+	frames  [][]byte
+	types   []websocket.MessageType
+	block   chan struct{}
+	blocked chan struct{} // 最初の書き込みで閉じられる
+}
+
+func newFrameRecorder(block chan struct{}) *frameRecorder {
+	return &frameRecorder{block: block, blocked: make(chan struct{})}
+}
+
+func (fr *frameRecorder) write(ctx context.Context, typ websocket.MessageType, data []byte) error {
+	fr.mu.Lock()
+	first := len(fr.frames) == 0
+	fr.frames = append(fr.frames, append([]byte(nil), data...))
+	fr.types = append(fr.types, typ)
+	fr.mu.Unlock()
+
+	if first {
+		close(fr.blocked)
+		if fr.block != nil {
+			select {
+			case <-fr.block:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+func (fr *frameRecorder) snapshot() ([][]byte, []websocket.MessageType) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return append([][]byte(nil), fr.frames...), append([]websocket.MessageType(nil), fr.types...)
+}
+
+func TestPtyToWS_CoalescesOutput(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	origInterval := wsOutputInterval
+	wsOutputInterval = 200 * time.Millisecond
+	defer func() { wsOutputInterval = origInterval }()
+
+	srv, _ := newTestServerWithWS(t, mock)
+	fr := newFrameRecorder(nil)
+	stop := startTestOutput(t, srv, mock.attachPty, true, fr.write)
+	defer stop()
+
+	// 最初の出力は即座に送られ、その後の連続した出力は 1 フレームにまとまる
+	if _, err := pts.Write([]byte("first")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	select {
+	case <-fr.blocked:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for first frame")
+	}
+	const chunks = 20
+	for i := 0; i < chunks; i++ {
+		if _, err := pts.Write([]byte("chunk")); err != nil {
+			t.Fatalf("failed to write to pts: %v", err)
+		}
+	}
+
+	want := "first" + strings.Repeat("chunk", chunks)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		frames, _ := fr.snapshot()
+		if got := string(bytes.Join(frames, nil)); got == want {
+			if len(frames) > 3 {
+				t.Errorf("sent %d frames, want output coalesced into at most 3", len(frames))
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %q, want %q", bytes.Join(frames, nil), want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestPtyToWS_SlowClientDropsToRedraw(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	origLimit := wsOutputBufferLimit
+	wsOutputBufferLimit = 4096
+	defer func() { wsOutputBufferLimit = origLimit }()
+
+	srv, _ := newTestServerWithWS(t, mock)
+	release := make(chan struct{})
+	fr := newFrameRecorder(release)
+	stop := startTestOutput(t, srv, mock.attachPty, true, fr.write)
+	defer stop()
+
+	// 最初のフレームの送信でクライアントが詰まる
+	if _, err := pts.Write([]byte("start")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	select {
+	case <-fr.blocked:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for first frame")
+	}
+
+	// クライアントが詰まっていても pty への出力（= tmux）は止まらない
+	flood := bytes.Repeat([]byte("x"), 256*1024)
+	done := make(chan error, 1)
+	go func() {
+		_, err := pts.Write(flood)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to write to pts: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("pty output stalled behind a slow client")
+	}
+
+	close(release)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		frames, _ := fr.snapshot()
+		if len(frames) >= 2 {
+			if got := string(frames[1]); got != wsOutputResync {
+				t.Errorf("frame after overflow = %q, want resync %q", got, wsOutputResync)
+			}
+			total := 0
+			for _, f := range frames {
+				total += len(f)
+			}
+			if total >= len(flood) {
+				t.Errorf("sent %d bytes, want overflowed output to be dropped", total)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d frames, want resync after overflow", len(frames))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if name := getPTSName(mock.attachPty); name != "" {
+		mock.mu.Lock()
+		refreshed := append([]string(nil), mock.refreshedClients...)
+		mock.mu.Unlock()
+		if len(refreshed) != 1 || refreshed[0] != name {
+			t.Errorf("RefreshClient calls = %v, want [%s]", refreshed, name)
+		}
+	}
+}
+
+func TestPtyToWS_JSONKeepsUTF8Boundary(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+
+	srv, _ := newTestServerWithWS(t, mock)
+	fr := newFrameRecorder(nil)
+	stop := startTestOutput(t, srv, mock.attachPty, false, fr.write)
+	defer stop()
+
+	// "あ" (e3 81 82) を 2 回に分けて書き込む
+	if _, err := pts.Write([]byte("a\xe3\x81")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := pts.Write([]byte("\x82")); err != nil {
+		t.Fatalf("failed to write to pts: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		frames, types := fr.snapshot()
+		var got string
+		for i, f := range frames {
+			if types[i] != websocket.MessageText {
+				t.Fatalf("frame %d type = %v, want text", i, types[i])
+			}
+			var msg wsTestMessage
+			if err := json.Unmarshal(f, &msg); err != nil {
+				t.Fatalf("failed to unmarshal %q: %v", f, err)
+			}
+			got += msg.Data
+		}
+		if got == "aあ" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %q, want %q", got, "aあ")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestHandleAttach_NegotiatesCompression(t *testing.T) {
+	pts, mock, cleanup := setupWSTest(t)
+	defer cleanup()
+	_ = pts
+
+	srv, token := newTestServerWithWS(t, mock)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/sessions/main/windows/0/attach"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, resp, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+		HTTPHeader:      http.Header{"Authorization": []string{"Bearer " + token}},
+		CompressionMode: websocket.CompressionNoContextTakeover,
+	})
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Errorf("Sec-WebSocket-Extensions = %q, want permessage-deflate", ext)
+	}
+}
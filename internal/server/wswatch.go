@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/tjst-t/palmux/internal/tmux"
+)
+
+// wsTmuxChangedDelay は tmux_changed メッセージを送る前に後続の通知をまとめる時間。
+// セッションの作成等では通知が連続するため、まとめて 1 回だけ送る。テスト時に上書き可能。
+var wsTmuxChangedDelay = 100 * time.Millisecond
+
+// tmuxChangedEvents はセッション・ウィンドウの一覧を変える tmux の通知。
+var tmuxChangedEvents = []string{
+	tmux.EventResync, "sessions-changed", "session-renamed",
+	"window-add", "window-close", "window-renamed",
+}
+
+// wsTmuxChangedMessage はセッション・ウィンドウの一覧が変わったことの通知メッセージ。
+// クライアントはドロワーやタブバーの一覧を取り直す。
+type wsTmuxChangedMessage struct {
+	Type string `json:"type"`
+}
+
+// tmuxWatch は attach 中のクライアントの状態を確認するきっかけを待つ。
+// コントロールモードが使える場合は指定した種類の tmux の通知を待ち、
+// 使えない場合（購読できない、または購読が終わった場合）は wsWatchActiveWindowInterval ごとのポーリングになる。
+type tmuxWatch struct {
+	s      *Server
+	events chan tmux.Event
+	types  []string
+	ticker *time.Ticker
+}
+
+// newTmuxWatch は types のいずれかの通知を待つ tmuxWatch を作成する。使用後は stop を呼ぶ。
+func (s *Server) newTmuxWatch(types ...string) *tmuxWatch {
+	w := &tmuxWatch{s: s, events: s.tmux.SubscribeEvents(), types: types}
+	if w.events == nil {
+		w.ticker = time.NewTicker(wsWatchActiveWindowInterval)
+	}
+	return w
+}
+
+// polling はポーリングで確認しているかどうかを返す。
+func (w *tmuxWatch) polling() bool {
+	return w.ticker != nil
+}
+
+// wait は状態を確認するきっかけ（対象の通知かポーリングの間隔）まで待つ。ctx が終わった場合は false を返す。
+func (w *tmuxWatch) wait(ctx context.Context) bool {
+	var tick <-chan time.Time
+	for {
+		if w.ticker != nil {
+			tick = w.ticker.C
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-tick:
+			return true
+		case ev, ok := <-w.events:
+			if !ok {
+				// 購読が終わった場合はポーリングに切り替える
+				w.events = nil
+				w.ticker = time.NewTicker(wsWatchActiveWindowInterval)
+				return true
+			}
+			if slices.Contains(w.types, ev.Type) {
+				return true
+			}
+		}
+	}
+}
+
+// stop は購読を解除し、ポーリングのタイマーを止める。
+func (w *tmuxWatch) stop() {
+	if w.events != nil {
+		w.s.tmux.UnsubscribeEvents(w.events)
+	}
+	if w.ticker != nil {
+		w.ticker.Stop()
+	}
+}
+
+// watchTmuxChanged はセッション・ウィンドウの作成・終了・リネームの通知を受けるたびに、
+// 短い間隔でまとめて tmux_changed メッセージを送信する。
+// コントロールモードが使えない場合は何もしない（クライアントは従来通り一覧を取得しに来る）。
+func (s *Server) watchTmuxChanged(
+	ctx context.Context,
+	writeWS func(context.Context, []byte) error,
+	cleanup func(),
+) {
+	events := s.tmux.SubscribeEvents()
+	if events == nil {
+		return
+	}
+	w := &tmuxWatch{s: s, events: events, types: tmuxChangedEvents}
+	defer w.stop()
+
+	msg, _ := json.Marshal(wsTmuxChangedMessage{Type: "tmux_changed"})
+	for w.wait(ctx) {
+		if w.polling() {
+			return
+		}
+		// 続けて届く通知をまとめる
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wsTmuxChangedDelay):
+		}
+		for len(w.events) > 0 {
+			<-w.events
+		}
+		if err := writeWS(ctx, msg); err != nil {
+			cleanup()
+			return
+		}
+	}
+}
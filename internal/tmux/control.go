@@ -0,0 +1,227 @@
+package tmux
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event はコントロールモード（tmux -C）の通知を表す。
+// 各 ID は tmux サーバー内で一意の ID（セッション $1、ウィンドウ @2、pane %5）で、名前やインデックスではない。
+type Event struct {
+	Type    string `json:"type"`              // 通知名（先頭の % と unlinked- を除いたもの。例: "window-add"）
+	Session string `json:"session,omitempty"` // セッション ID
+	Window  string `json:"window,omitempty"`  // ウィンドウ ID
+	Pane    string `json:"pane,omitempty"`    // pane ID
+	Client  string `json:"client,omitempty"`  // クライアント名（attach した tty のパス）
+	Name    string `json:"name,omitempty"`    // セッション名・ウィンドウ名
+}
+
+// EventResync はコントロールモードのクライアントが（再）接続したとき、または購読者のチャネルがあふれたときに
+// 配信する擬似的な通知の Type。切断中・あふれた間の通知は失われるため、購読者は状態を取り直す。
+const EventResync = "resync"
+
+// controlSession はコントロールモードのクライアントが attach する Palmux 専用のセッション名。
+// GroupedSessionPrefix が付いているため、セッション一覧には表示されず、起動時の掃除の対象にもなる。
+const controlSession = GroupedSessionPrefix + "control"
+
+// コントロールモードのクライアントが終了した場合の再起動間隔（最小・最大）。
+// 最大間隔より長く動いていた場合は最小間隔に戻す。
+var (
+	controlRestartMin = time.Second
+	controlRestartMax = 30 * time.Second
+)
+
+// eventHub はコントロールモードの通知を購読者に配信する。
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan Event]bool // 購読者のチャネルと、あふれて EventResync を積んだ後かどうか
+}
+
+// subscribe はイベントチャネルを作成し、購読者として登録する。
+func (h *eventHub) subscribe() chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, 64)
+	h.subs[ch] = false
+	return ch
+}
+
+// unsubscribe は購読者を解除し、チャネルをクローズする。
+func (h *eventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// publish は全購読者に通知を送る。配信は購読者を待たない。
+// チャネルが一杯の購読者は、最も古い通知を捨てて EventResync を積み、あふれた状態にする（捨てた通知の代わりに状態を取り直させる）。
+// あふれた状態の間は、積んだ EventResync がまだ読まれていないため通知を捨てる。次に通知を送れた時点で元に戻す。
+func (h *eventHub) publish(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch, overflowed := range h.subs {
+		select {
+		case ch <- ev:
+			h.subs[ch] = false
+			continue
+		default:
+		}
+		if overflowed {
+			continue
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- Event{Type: EventResync}:
+			h.subs[ch] = true
+		default:
+		}
+	}
+}
+
+// read は r からコントロールモードの出力を読み、通知を購読者に配信する。%exit を受けるか r が終わると返る。
+// %begin から %end（%error）まではコマンドの出力なので通知として扱わない。%output（pane の出力）は配信しない。
+func (h *eventHub) read(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	inBlock := false
+	for sc.Scan() {
+		line := sc.Text()
+		if inBlock {
+			if strings.HasPrefix(line, "%end ") || strings.HasPrefix(line, "%error ") {
+				inBlock = false
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "%begin ") {
+			inBlock = true
+			continue
+		}
+
+		ev, ok := ParseControlLine(line)
+		if !ok {
+			continue
+		}
+		switch ev.Type {
+		case "exit":
+			return nil
+		case "output", "extended-output":
+			continue
+		}
+		h.publish(ev)
+	}
+	return sc.Err()
+}
+
+// StartEvents はコントロールモードのクライアントを起動し、tmux の通知の配信を開始する。
+// クライアントは Palmux 専用のセッション（controlSession）に attach し、全セッションのセッション・ウィンドウ・pane の
+// 変化を通知として受け取る。クライアントが終了した場合は ctx が終わるまで間隔を空けて再起動する。
+// StartEvents を呼ばない場合、SubscribeEvents は nil を返す。
+func (m *Manager) StartEvents(ctx context.Context) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	if m.events != nil {
+		return
+	}
+	m.events = &eventHub{subs: make(map[chan Event]bool)}
+	go m.runControl(ctx, m.events)
+}
+
+// SubscribeEvents は tmux の通知を受け取るチャネルを作成し、購読者として登録する。
+// StartEvents を呼んでいない場合は nil を返す（呼び出し元はポーリングで状態を確認する）。
+func (m *Manager) SubscribeEvents() chan Event {
+	m.eventsMu.Lock()
+	hub := m.events
+	m.eventsMu.Unlock()
+	if hub == nil {
+		return nil
+	}
+	return hub.subscribe()
+}
+
+// UnsubscribeEvents は購読者を解除し、チャネルをクローズする。ch が nil の場合は何もしない。
+func (m *Manager) UnsubscribeEvents(ch chan Event) {
+	m.eventsMu.Lock()
+	hub := m.events
+	m.eventsMu.Unlock()
+	if hub == nil || ch == nil {
+		return
+	}
+	hub.unsubscribe(ch)
+}
+
+// runControl はコントロールモードのクライアントを ctx が終わるまで動かし続ける。
+func (m *Manager) runControl(ctx context.Context, hub *eventHub) {
+	delay := controlRestartMin
+	for {
+		started := time.Now()
+		if err := m.control(ctx, hub); err != nil && ctx.Err() == nil {
+			log.Printf("tmux control mode: %v", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > controlRestartMax {
+			delay = controlRestartMin
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, controlRestartMax)
+	}
+}
+
+// control はコントロールモードのクライアントを 1 回起動し、終了するまで通知を配信する。
+// セッションには destroy-unattached を設定し、クライアントの終了とともに破棄させる。
+func (m *Manager) control(ctx context.Context, hub *eventHub) error {
+	cmd := exec.Command(m.tmuxBin(), "-C",
+		"new-session", "-A", "-s", controlSession, ";",
+		"set-option", "-t", controlSession, "destroy-unattached", "on")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+
+	// 標準入力を閉じるとコントロールモードのクライアントは %exit を出力して終了する
+	stop := context.AfterFunc(ctx, func() { stdin.Close() })
+	defer stop()
+
+	hub.publish(Event{Type: EventResync})
+	err = hub.read(stdout)
+	stdin.Close()
+	if err != nil {
+		// 読み取りをやめたので出力が詰まらないように強制終了する
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return fmt.Errorf("exited")
+}
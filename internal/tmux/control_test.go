@@ -0,0 +1,118 @@
+package tmux
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEventHub_Read(t *testing.T) {
+	hub := &eventHub{subs: make(map[chan Event]bool)}
+	ch := hub.subscribe()
+
+	input := strings.Join([]string{
+		"%begin 1792135537 263 0",
+		"%window-add @9", // コマンドの出力の中の行は通知ではない
+		"%end 1792135537 263 0",
+		"%sessions-changed",
+		"%output %1 hello\\015\\012",
+		"%unlinked-window-renamed @2 vim",
+		"%begin 1792135537 264 0",
+		"%error 1792135537 264 0",
+		"%session-window-changed $0 @2",
+		"%exit",
+		"%window-add @3", // %exit の後は読まない
+	}, "\n")
+	if err := hub.read(strings.NewReader(input)); err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	hub.unsubscribe(ch)
+
+	var got []Event
+	for ev := range ch {
+		got = append(got, ev)
+	}
+	want := []Event{
+		{Type: "sessions-changed"},
+		{Type: "window-renamed", Window: "@2", Name: "vim"},
+		{Type: "session-window-changed", Session: "$0", Window: "@2"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("events[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEventHub_PublishDoesNotBlock(t *testing.T) {
+	hub := &eventHub{subs: make(map[chan Event]bool)}
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+
+	// 読まれない購読者がいても配信は止まらない
+	for i := 0; i < cap(ch)+10; i++ {
+		hub.publish(Event{Type: "window-add"})
+	}
+	if len(ch) != cap(ch) {
+		t.Errorf("len(ch) = %d, want %d", len(ch), cap(ch))
+	}
+}
+
+func TestEventHub_PublishOverflowResyncs(t *testing.T) {
+	hub := &eventHub{subs: make(map[chan Event]bool)}
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+
+	// あふれた購読者には捨てた通知の代わりに EventResync が 1 回だけ届く
+	for i := 0; i < cap(ch)+10; i++ {
+		hub.publish(Event{Type: "window-add", Window: fmt.Sprintf("@%d", i)})
+	}
+	var got []Event
+	for len(ch) > 0 {
+		got = append(got, <-ch)
+	}
+	resyncs := 0
+	for _, ev := range got {
+		if ev.Type == EventResync {
+			resyncs++
+		}
+	}
+	if resyncs != 1 || got[len(got)-1].Type != EventResync {
+		t.Errorf("events = %+v, want a single trailing %s", got, EventResync)
+	}
+
+	// 読み終えた後の通知は通常通り届く
+	hub.publish(Event{Type: "window-close", Window: "@1"})
+	select {
+	case ev := <-ch:
+		if ev.Type != "window-close" {
+			t.Errorf("event = %+v, want window-close", ev)
+		}
+	default:
+		t.Error("event after overflow was not delivered")
+	}
+
+	// 再びあふれた場合も EventResync が届く
+	for i := 0; i < cap(ch)+1; i++ {
+		hub.publish(Event{Type: "window-add"})
+	}
+	var last Event
+	for len(ch) > 0 {
+		last = <-ch
+	}
+	if last.Type != EventResync {
+		t.Errorf("last event = %+v, want %s", last, EventResync)
+	}
+}
+
+func TestManager_SubscribeEvents_NotStarted(t *testing.T) {
+	m := &Manager{Exec: &mockExecutor{}}
+	ch := m.SubscribeEvents()
+	if ch != nil {
+		t.Errorf("SubscribeEvents() = %v, want nil before StartEvents", ch)
+	}
+	m.UnsubscribeEvents(ch)
+}
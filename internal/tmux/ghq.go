@@ -230,20 +230,7 @@ func (g *GhqResolver) CloneRepo(url string) (*GhqRepo, error) {
 	}
 
 	// URL からリポジトリパスを推定して検索
-	// URL 例: https://github.com/alice/utils → github.com/alice/utils
-	urlPath := url
-	// プロトコルを除去
-	for _, prefix := range []string{"https://", "http://", "git://", "ssh://"} {
-		urlPath = strings.TrimPrefix(urlPath, prefix)
-	}
-	// .git サフィックスを除去
-	urlPath = strings.TrimSuffix(urlPath, ".git")
-	// user@host:path 形式を host/path に変換
-	if idx := strings.Index(urlPath, "@"); idx != -1 {
-		urlPath = urlPath[idx+1:]
-		urlPath = strings.Replace(urlPath, ":", "/", 1)
-	}
-
+	urlPath := GhqRepoPath(url)
 	for _, repo := range repos {
 		if repo.Path == urlPath {
 			return &repo, nil
@@ -263,6 +250,24 @@ func (g *GhqResolver) CloneRepo(url string) (*GhqRepo, error) {
 	return nil, fmt.Errorf("cloned repository not found in ghq list")
 }
 
+// GhqRepoPath はクローン元の URL から ghq root 配下のリポジトリパスを推定する。
+// URL 例: https://github.com/alice/utils → github.com/alice/utils
+func GhqRepoPath(url string) string {
+	urlPath := url
+	// プロトコルを除去
+	for _, prefix := range []string{"https://", "http://", "git://", "ssh://"} {
+		urlPath = strings.TrimPrefix(urlPath, prefix)
+	}
+	// .git サフィックスを除去
+	urlPath = strings.TrimSuffix(urlPath, ".git")
+	// user@host:path 形式を host/path に変換
+	if idx := strings.Index(urlPath, "@"); idx != -1 {
+		urlPath = urlPath[idx+1:]
+		urlPath = strings.Replace(urlPath, ":", "/", 1)
+	}
+	return urlPath
+}
+
 // GwqWorktree は gwq list --json の1エントリ。
 type GwqWorktree struct {
 	Path       string `json:"path"`
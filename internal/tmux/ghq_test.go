@@ -526,6 +526,27 @@ func TestGhqResolver_GetRoot(t *testing.T) {
 	}
 }
 
+func TestGhqRepoPath(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "https", url: "https://github.com/alice/utils", want: "github.com/alice/utils"},
+		{name: ".git サフィックス", url: "https://github.com/alice/utils.git", want: "github.com/alice/utils"},
+		{name: "scp 形式", url: "git@github.com:alice/utils.git", want: "github.com/alice/utils"},
+		{name: "プロトコルなし", url: "github.com/alice/utils", want: "github.com/alice/utils"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GhqRepoPath(tt.url); got != tt.want {
+				t.Errorf("GhqRepoPath(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGhqResolver_CloneRepo(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -23,6 +23,22 @@ type Window struct {
 	Active bool   `json:"active"`
 }
 
+// Pane は tmux pane の情報を表す。
+// ID（%12 の形式）は tmux サーバー内で一意で、pane が移動・入れ替えられても変わらない。
+type Pane struct {
+	ID      string `json:"id"`
+	Index   int    `json:"index"`
+	Active  bool   `json:"active"`
+	Left    int    `json:"left"`
+	Top     int    `json:"top"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Zoomed  bool   `json:"zoomed"` // pane のウィンドウがズーム中か
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	Cwd     string `json:"cwd"`
+}
+
 // ParseSessions は tmux list-sessions の出力をパースして Session スライスを返す。
 // フォーマット: #{session_name}\t#{session_windows}\t#{session_attached}\t#{session_created}\t#{session_activity}
 func ParseSessions(data []byte) ([]Session, error) {
@@ -99,6 +115,115 @@ func ParseWindows(data []byte) ([]Window, error) {
 	return windows, nil
 }
 
+// ParsePanes は tmux list-panes の出力をパースして Pane スライスを返す。
+// フォーマット: #{pane_id}\t#{pane_index}\t#{pane_active}\t#{pane_left}\t#{pane_top}\t#{pane_width}\t#{pane_height}\t
+// #{window_zoomed_flag}\t#{pane_pid}\t#{pane_current_command}\t#{pane_current_path}
+// 最後のフィールド（カレントパス）はタブを含んでもよい。
+func ParsePanes(data []byte) ([]Pane, error) {
+	lines := splitLines(data)
+	panes := make([]Pane, 0, len(lines))
+
+	for _, line := range lines {
+		fields := strings.SplitN(line, "\t", 11)
+		if len(fields) != 11 {
+			return nil, fmt.Errorf("invalid pane line: expected 11 fields, got %d: %q", len(fields), line)
+		}
+
+		id, err := ParsePaneID(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		// pane_index から pane_pid までは数値
+		names := []string{"index", "active", "left", "top", "width", "height", "zoomed", "pid"}
+		nums := make([]int, len(names))
+		for i, name := range names {
+			n, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid pane %s %q: %w", name, fields[i+1], err)
+			}
+			nums[i] = n
+		}
+
+		panes = append(panes, Pane{
+			ID:      id,
+			Index:   nums[0],
+			Active:  nums[1] != 0,
+			Left:    nums[2],
+			Top:     nums[3],
+			Width:   nums[4],
+			Height:  nums[5],
+			Zoomed:  nums[6] != 0,
+			PID:     nums[7],
+			Command: fields[9],
+			Cwd:     fields[10],
+		})
+	}
+
+	return panes, nil
+}
+
+// ParsePaneID は pane ID を "%12" の形式に正規化して返す。
+// 先頭の % は省略できる（URL のパスで % をエスケープせずに渡せるように）。
+func ParsePaneID(s string) (string, error) {
+	n := strings.TrimPrefix(s, "%")
+	if n == "" || strings.TrimLeft(n, "0123456789") != "" {
+		return "", fmt.Errorf("invalid pane id %q", s)
+	}
+	return "%" + n, nil
+}
+
+// ParseControlLine はコントロールモード（tmux -C）の出力の 1 行を通知としてパースする。
+// % で始まらない行（コマンドの出力）は ok = false を返す。
+// unlinked-window-add 等の unlinked- 付きの通知は、コントロールモードのクライアントが attach していない
+// セッションのウィンドウについての同じ通知なので、unlinked- を除いた名前にする。
+// 既知の通知は ID と名前を各フィールドに入れ、未知の通知は Type だけを入れて返す。
+func ParseControlLine(line string) (ev Event, ok bool) {
+	if !strings.HasPrefix(line, "%") {
+		return Event{}, false
+	}
+	name, rest, _ := strings.Cut(line[1:], " ")
+	ev.Type = strings.TrimPrefix(name, "unlinked-")
+
+	// arg は rest の先頭の引数を取り出す
+	arg := func() string {
+		var a string
+		a, rest, _ = strings.Cut(rest, " ")
+		return a
+	}
+
+	switch ev.Type {
+	case "session-changed", "session-renamed":
+		// %session-changed $1 main（名前は空白を含みうる）
+		ev.Session = arg()
+		ev.Name = rest
+	case "session-window-changed":
+		// %session-window-changed $1 @2
+		ev.Session = arg()
+		ev.Window = arg()
+	case "client-session-changed":
+		// %client-session-changed /dev/pts/5 $1 main
+		ev.Client = arg()
+		ev.Session = arg()
+		ev.Name = rest
+	case "client-detached":
+		ev.Client = arg()
+	case "window-add", "window-close", "layout-change":
+		ev.Window = arg()
+	case "window-renamed":
+		// %window-renamed @2 vim
+		ev.Window = arg()
+		ev.Name = rest
+	case "window-pane-changed":
+		// %window-pane-changed @2 %5
+		ev.Window = arg()
+		ev.Pane = arg()
+	case "pane-mode-changed":
+		ev.Pane = arg()
+	}
+	return ev, true
+}
+
 // splitLines は入力バイト列を行に分割し、空行を除外する。
 func splitLines(data []byte) []string {
 	s := strings.TrimSpace(string(data))
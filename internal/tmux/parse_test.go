@@ -2,6 +2,7 @@ package tmux
 
 import (
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -354,3 +355,117 @@ func TestParseWindows_Testdata(t *testing.T) {
 		}
 	})
 }
+
+func TestParsePanes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []Pane
+		wantErr bool
+	}{
+		{
+			name:  "複数 pane のパース",
+			input: []byte("%0\t0\t0\t0\t0\t40\t24\t1\t100\tbash\t/home/user\n%2\t1\t1\t41\t0\t39\t24\t1\t200\tvim\t/home/user/my\tdir\n"),
+			want: []Pane{
+				{ID: "%0", Index: 0, Width: 40, Height: 24, Zoomed: true, PID: 100, Command: "bash", Cwd: "/home/user"},
+				{ID: "%2", Index: 1, Active: true, Left: 41, Width: 39, Height: 24, Zoomed: true, PID: 200, Command: "vim", Cwd: "/home/user/my\tdir"},
+			},
+		},
+		{
+			name:  "空出力の場合は空スライスを返す",
+			input: []byte(""),
+			want:  []Pane{},
+		},
+		{
+			name:    "フィールド数が不足している場合はエラー",
+			input:   []byte("%0\t0\t1\t0\t0\t80\t24\n"),
+			wantErr: true,
+		},
+		{
+			name:    "pane ID が不正な場合はエラー",
+			input:   []byte("x\t0\t1\t0\t0\t80\t24\t0\t100\tbash\t/\n"),
+			wantErr: true,
+		},
+		{
+			name:    "数値フィールドが不正な場合はエラー",
+			input:   []byte("%0\t0\t1\t0\t0\twide\t24\t0\t100\tbash\t/\n"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePanes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePanes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePanes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePaneID(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "%12", want: "%12"},
+		{input: "12", want: "%12"},
+		{input: "", wantErr: true},
+		{input: "%", wantErr: true},
+		{input: "%1a", wantErr: true},
+		{input: "main:1.%2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePaneID(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePaneID(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePaneID(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseControlLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   Event
+		wantOK bool
+	}{
+		{line: "%sessions-changed", want: Event{Type: "sessions-changed"}, wantOK: true},
+		{line: "%session-renamed $2 my project", want: Event{Type: "session-renamed", Session: "$2", Name: "my project"}, wantOK: true},
+		{line: "%session-window-changed $0 @2", want: Event{Type: "session-window-changed", Session: "$0", Window: "@2"}, wantOK: true},
+		{
+			line:   "%client-session-changed /dev/pts/5 $1 main",
+			want:   Event{Type: "client-session-changed", Client: "/dev/pts/5", Session: "$1", Name: "main"},
+			wantOK: true,
+		},
+		{line: "%window-add @1", want: Event{Type: "window-add", Window: "@1"}, wantOK: true},
+		{line: "%unlinked-window-close @4", want: Event{Type: "window-close", Window: "@4"}, wantOK: true},
+		{line: "%unlinked-window-renamed @2 foo bar", want: Event{Type: "window-renamed", Window: "@2", Name: "foo bar"}, wantOK: true},
+		{line: "%window-pane-changed @0 %3", want: Event{Type: "window-pane-changed", Window: "@0", Pane: "%3"}, wantOK: true},
+		{line: "%layout-change @0 b25d,80x24,0,0,0 b25d,80x24,0,0,0 *", want: Event{Type: "layout-change", Window: "@0"}, wantOK: true},
+		{line: "%paste-buffer-changed buffer0", want: Event{Type: "paste-buffer-changed"}, wantOK: true},
+		{line: "command output", wantOK: false},
+		{line: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok := ParseControlLine(tt.line)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseControlLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
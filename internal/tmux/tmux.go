@@ -36,6 +36,10 @@ type Manager struct {
 	// EnsureClaudeWindow がプロセス起動前に bash を検出して窓を再作成するレースを防ぐ。
 	claudeGrace   map[string]time.Time
 	claudeGraceMu sync.Mutex
+
+	// events はコントロールモードの通知の配信先。StartEvents を呼ぶまでは nil。
+	events   *eventHub
+	eventsMu sync.Mutex
 }
 
 // claudeGracePeriod は claude ウィンドウ作成後にシェル検出を無視する期間。
@@ -62,6 +66,21 @@ const sessionFormat = "#{session_name}\t#{session_windows}\t#{session_attached}\
 // windowFormat は list-windows / new-window の出力フォーマット。
 const windowFormat = "#{window_index}\t#{window_name}\t#{window_active}"
 
+// paneFormat は list-panes / split-window の出力フォーマット。
+const paneFormat = "#{pane_id}\t#{pane_index}\t#{pane_active}\t#{pane_left}\t#{pane_top}\t#{pane_width}\t#{pane_height}\t" +
+	"#{window_zoomed_flag}\t#{pane_pid}\t#{pane_current_command}\t#{pane_current_path}"
+
+// paneTarget は pane を指す tmux のターゲットを返す。
+// pane が空の場合はウィンドウ（のアクティブ pane）を指す。
+// pane ID はサーバー内で一意だが、ウィンドウを含めて指定することで他のセッション・ウィンドウの pane を操作できないようにする
+// （tmux は pane がそのウィンドウに属していない場合はエラーにする）。
+func paneTarget(session string, index int, pane string) string {
+	if pane == "" {
+		return fmt.Sprintf("%s:%d", session, index)
+	}
+	return fmt.Sprintf("%s:%d.%s", session, index, pane)
+}
+
 // ErrSessionNotFound はセッションが見つからない場合のエラー。
 var ErrSessionNotFound = errors.New("session not found")
 
@@ -224,9 +243,10 @@ func (m *Manager) KillWindow(session string, index int) error {
 }
 
 // SendKeys は指定セッションの指定インデックスのウィンドウにキーを送信する。
-func (m *Manager) SendKeys(session string, index int, key string) error {
-	target := fmt.Sprintf("%s:%d", session, index)
-	_, err := m.Exec.Run("send-keys", "-t", target, key)
+// pane（%12 の形式）を指定した場合はその pane に、空の場合はアクティブ pane に送る。
+func (m *Manager) SendKeys(session string, index int, pane string, keys ...string) error {
+	args := append([]string{"send-keys", "-t", paneTarget(session, index, pane)}, keys...)
+	_, err := m.Exec.Run(args...)
 	if err != nil {
 		return fmt.Errorf("send keys: %w", err)
 	}
@@ -287,6 +307,15 @@ func (m *Manager) GetClientSessionWindow(tty string) (string, int, error) {
 	return sessionName, winIndex, nil
 }
 
+// RefreshClient は指定した tty のクライアントの画面全体を tmux に再描画させる。
+// tty には pts のデバイスパス（例: /dev/pts/5）を渡す。
+func (m *Manager) RefreshClient(tty string) error {
+	if _, err := m.Exec.Run("refresh-client", "-t", tty); err != nil {
+		return fmt.Errorf("refresh client: %w", err)
+	}
+	return nil
+}
+
 // GetSessionProjectDir はセッションの ghq プロジェクトディレクトリを返す。
 // Ghq が設定されていてセッション名に対応するリポジトリが存在する場合はそのパスを返す。
 // それ以外の場合はアクティブ pane のカレントパスにフォールバックする。
@@ -356,21 +385,21 @@ func randomHex(n int) string {
 
 // Attach は tmux attach-session を pty 内で実行し、pty のマスター側ファイルと exec.Cmd を返す。
 // windowIndex が 0 以上の場合、接続後に指定ウィンドウを選択する。
+// readOnly が true の場合は読み取り専用クライアント（-r）として接続し、キー入力は tmux 側でも無視される。
 // 呼び出し元は返されたファイルを通じて pty と双方向に通信できる。
 // 使用後は呼び出し元がファイルの Close とプロセスの Kill/Wait を行う必要がある。
-func (m *Manager) Attach(session string, windowIndex int) (*os.File, *exec.Cmd, error) {
-	tmuxBin := "tmux"
-	if re, ok := m.Exec.(*RealExecutor); ok && re.TmuxBin != "" {
-		tmuxBin = re.TmuxBin
+func (m *Manager) Attach(session string, windowIndex int, readOnly bool) (*os.File, *exec.Cmd, error) {
+	args := []string{"attach-session"}
+	if readOnly {
+		args = append(args, "-r")
 	}
-
-	args := []string{"attach-session", "-t", session}
+	args = append(args, "-t", session)
 	if windowIndex >= 0 {
 		target := fmt.Sprintf("%s:%d", session, windowIndex)
 		args = append(args, ";", "select-window", "-t", target)
 	}
 
-	cmd := exec.Command(tmuxBin, args...)
+	cmd := exec.Command(m.tmuxBin(), args...)
 	// xterm.js は xterm 互換ターミナルなので TERM=xterm-256color を設定する。
 	// これにより tmux が外側ターミナルの OSC 52 サポートを正しく検出し、
 	// クリップボード同期（set-clipboard）が機能する。
@@ -383,6 +412,14 @@ func (m *Manager) Attach(session string, windowIndex int) (*os.File, *exec.Cmd,
 	return ptmx, cmd, nil
 }
 
+// tmuxBin は pty 内やパイプ経由で直接起動する tmux のパスを返す。
+func (m *Manager) tmuxBin() string {
+	if re, ok := m.Exec.(*RealExecutor); ok && re.TmuxBin != "" {
+		return re.TmuxBin
+	}
+	return "tmux"
+}
+
 // IsGhqSession はセッション名が ghq リポジトリに対応するかを返す。
 // Ghq が未設定の場合は常に false を返す。
 func (m *Manager) IsGhqSession(session string) bool {
@@ -417,7 +454,7 @@ func (m *Manager) replaceClaudeWindowLocked(session, name, command string) (*Win
 		if w.Name == name {
 			// グレースフル終了: Ctrl+C を送信してプロセスに終了の機会を与える
 			// SendKeys が失敗しても KillWindow で確実に終了させる
-			_ = m.SendKeys(session, w.Index, "C-c")
+			_ = m.SendKeys(session, w.Index, "", "C-c")
 
 			if err := m.KillWindow(session, w.Index); err != nil {
 				return nil, fmt.Errorf("replace claude window: %w", err)
@@ -453,6 +490,159 @@ func (m *Manager) GetPaneCommand(session string, windowIndex int) (string, error
 	return strings.TrimSpace(string(out)), nil
 }
 
+// GetPaneSize は指定セッション・ウィンドウのアクティブ pane の大きさ（列数・行数）を返す。
+func (m *Manager) GetPaneSize(session string, windowIndex int) (int, int, error) {
+	target := fmt.Sprintf("%s:%d", session, windowIndex)
+	out, err := m.Exec.Run("display-message", "-p", "-t", target, "#{pane_width} #{pane_height}")
+	if err != nil {
+		return 0, 0, fmt.Errorf("get pane size: %w", err)
+	}
+	var cols, rows int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "%d %d", &cols, &rows); err != nil {
+		return 0, 0, fmt.Errorf("get pane size: unexpected output %q", out)
+	}
+	return cols, rows, nil
+}
+
+// PipePane は指定セッション・ウィンドウのアクティブ pane の出力を command の標準入力に流す（pipe-pane）。
+// command はシェル経由で実行され、既存のパイプは置き換えられる。
+// command が空の場合はパイプを閉じる。pane が終了した場合も tmux がパイプを閉じる。
+func (m *Manager) PipePane(session string, windowIndex int, command string) error {
+	target := fmt.Sprintf("%s:%d", session, windowIndex)
+	args := []string{"pipe-pane", "-t", target}
+	if command != "" {
+		args = append(args, command)
+	}
+	if _, err := m.Exec.Run(args...); err != nil {
+		return fmt.Errorf("pipe pane: %w", err)
+	}
+	return nil
+}
+
+// CapturePane は指定セッション・ウィンドウの pane の内容を返す（capture-pane）。
+// pane（%12 の形式）が空の場合はアクティブ pane の内容を返す。
+// escapes が true の場合は文字の色と装飾をエスケープシーケンスで含める。
+// history が正の場合は表示中の画面に加えて、スクロールバックの直近 history 行も含める。負の場合はスクロールバック全体を含める。
+func (m *Manager) CapturePane(session string, windowIndex int, pane string, escapes bool, history int) (string, error) {
+	args := []string{"capture-pane", "-p", "-t", paneTarget(session, windowIndex, pane)}
+	if escapes {
+		args = append(args, "-e")
+	}
+	switch {
+	case history > 0:
+		args = append(args, "-S", strconv.Itoa(-history))
+	case history < 0:
+		args = append(args, "-S", "-")
+	}
+	out, err := m.Exec.Run(args...)
+	if err != nil {
+		return "", fmt.Errorf("capture pane: %w", err)
+	}
+	return string(out), nil
+}
+
+// ListPanes は指定セッション・ウィンドウの pane 一覧を返す。
+func (m *Manager) ListPanes(session string, windowIndex int) ([]Pane, error) {
+	out, err := m.Exec.Run("list-panes", "-t", paneTarget(session, windowIndex, ""), "-F", paneFormat)
+	if err != nil {
+		return nil, fmt.Errorf("list panes: %w", err)
+	}
+
+	panes, err := ParsePanes(out)
+	if err != nil {
+		return nil, fmt.Errorf("list panes: %w", err)
+	}
+
+	return panes, nil
+}
+
+// SplitPane は pane（空の場合はアクティブ pane）を分割して新しい pane を作成し、その情報を返す。
+// horizontal が true の場合は左右に、false の場合は上下に分割する。
+// 新しい pane は分割元の pane のカレントディレクトリで command（空の場合はデフォルトシェル）を実行する。
+func (m *Manager) SplitPane(session string, windowIndex int, pane string, horizontal bool, command string) (*Pane, error) {
+	direction := "-v"
+	if horizontal {
+		direction = "-h"
+	}
+	args := []string{"split-window", "-t", paneTarget(session, windowIndex, pane), direction,
+		"-c", "#{pane_current_path}", "-P", "-F", paneFormat}
+	if command != "" {
+		args = append(args, command)
+	}
+	out, err := m.Exec.Run(args...)
+	if err != nil {
+		return nil, fmt.Errorf("split pane: %w", err)
+	}
+
+	panes, err := ParsePanes(out)
+	if err != nil {
+		return nil, fmt.Errorf("split pane: %w", err)
+	}
+	if len(panes) == 0 {
+		return nil, fmt.Errorf("split pane: no output from tmux")
+	}
+
+	return &panes[0], nil
+}
+
+// SelectPane は pane をウィンドウのアクティブ pane にする。
+func (m *Manager) SelectPane(session string, windowIndex int, pane string) error {
+	if _, err := m.Exec.Run("select-pane", "-t", paneTarget(session, windowIndex, pane)); err != nil {
+		return fmt.Errorf("select pane: %w", err)
+	}
+	return nil
+}
+
+// KillPane は pane を終了する。ウィンドウの最後の pane の場合はウィンドウも閉じる。
+func (m *Manager) KillPane(session string, windowIndex int, pane string) error {
+	if _, err := m.Exec.Run("kill-pane", "-t", paneTarget(session, windowIndex, pane)); err != nil {
+		return fmt.Errorf("kill pane: %w", err)
+	}
+	return nil
+}
+
+// ZoomPane は pane のズーム（ウィンドウ全体に広げる）を切り替える。
+func (m *Manager) ZoomPane(session string, windowIndex int, pane string) error {
+	if _, err := m.Exec.Run("resize-pane", "-Z", "-t", paneTarget(session, windowIndex, pane)); err != nil {
+		return fmt.Errorf("zoom pane: %w", err)
+	}
+	return nil
+}
+
+// ResizePane は pane の大きさを変える。width・height が 0 の方向は変えない。
+func (m *Manager) ResizePane(session string, windowIndex int, pane string, width, height int) error {
+	args := []string{"resize-pane", "-t", paneTarget(session, windowIndex, pane)}
+	if width > 0 {
+		args = append(args, "-x", strconv.Itoa(width))
+	}
+	if height > 0 {
+		args = append(args, "-y", strconv.Itoa(height))
+	}
+	if _, err := m.Exec.Run(args...); err != nil {
+		return fmt.Errorf("resize pane: %w", err)
+	}
+	return nil
+}
+
+// SwapPane は同じウィンドウの 2 つの pane の位置を入れ替える。
+func (m *Manager) SwapPane(session string, windowIndex int, src, dst string) error {
+	_, err := m.Exec.Run("swap-pane", "-s", paneTarget(session, windowIndex, src), "-t", paneTarget(session, windowIndex, dst))
+	if err != nil {
+		return fmt.Errorf("swap pane: %w", err)
+	}
+	return nil
+}
+
+// GetClientPane は指定した tty のクライアントが表示しているウィンドウのアクティブ pane の ID を返す。
+// tty には pts のデバイスパス（例: /dev/pts/5）を渡す。
+func (m *Manager) GetClientPane(tty string) (string, error) {
+	out, err := m.Exec.Run("display-message", "-p", "-t", tty, "#{pane_id}")
+	if err != nil {
+		return "", fmt.Errorf("get client pane: %w", err)
+	}
+	return ParsePaneID(strings.TrimSpace(string(out)))
+}
+
 // isShellCommand はコマンド名が一般的なシェルかどうかを判定する。
 func isShellCommand(cmd string) bool {
 	switch cmd {
@@ -1587,7 +1587,7 @@ func TestManager_SendKeys(t *testing.T) {
 		mock := &mockExecutor{}
 		m := &Manager{Exec: mock}
 
-		err := m.SendKeys("mysession", 1, "C-c")
+		err := m.SendKeys("mysession", 1, "", "C-c")
 		if err != nil {
 			t.Fatalf("SendKeys() unexpected error: %v", err)
 		}
@@ -1597,11 +1597,21 @@ func TestManager_SendKeys(t *testing.T) {
 		}
 	})
 
+	t.Run("正常系: pane を指定して複数のキーを送信する", func(t *testing.T) {
+		mock := &mockExecutor{}
+		m := &Manager{Exec: mock}
+
+		if err := m.SendKeys("mysession", 1, "%7", "make", "Enter"); err != nil {
+			t.Fatalf("SendKeys() unexpected error: %v", err)
+		}
+		assertArgs(t, mock, []string{"send-keys", "-t", "mysession:1.%7", "make", "Enter"})
+	})
+
 	t.Run("異常系: tmux エラー", func(t *testing.T) {
 		mock := &mockExecutor{err: errors.New("pane not found")}
 		m := &Manager{Exec: mock}
 
-		err := m.SendKeys("mysession", 0, "C-c")
+		err := m.SendKeys("mysession", 0, "", "C-c")
 		if err == nil {
 			t.Fatal("SendKeys() expected error, got nil")
 		}
@@ -1681,6 +1691,338 @@ func TestManager_GetClientSessionWindow(t *testing.T) {
 	}
 }
 
+func TestManager_RefreshClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "正常系: refresh-client を実行する"},
+		{name: "エラー系: tmux エラー", err: fmt.Errorf("can't find client: /dev/pts/5"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecutor{err: tt.err}
+			m := &Manager{Exec: mock}
+
+			err := m.RefreshClient("/dev/pts/5")
+
+			assertArgs(t, mock, []string{"refresh-client", "-t", "/dev/pts/5"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RefreshClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManager_GetPaneSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   []byte
+		err      error
+		wantCols int
+		wantRows int
+		wantErr  bool
+	}{
+		{name: "正常系: 列数と行数を返す", output: []byte("120 40\n"), wantCols: 120, wantRows: 40},
+		{name: "エラー系: tmux エラー", err: fmt.Errorf("can't find window: 9"), wantErr: true},
+		{name: "エラー系: 不正な出力", output: []byte("\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecutor{output: tt.output, err: tt.err}
+			m := &Manager{Exec: mock}
+
+			cols, rows, err := m.GetPaneSize("main", 1)
+
+			assertArgs(t, mock, []string{"display-message", "-p", "-t", "main:1", "#{pane_width} #{pane_height}"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPaneSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cols != tt.wantCols || rows != tt.wantRows {
+				t.Errorf("GetPaneSize() = %d, %d, want %d, %d", cols, rows, tt.wantCols, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestManager_PipePane(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		err      error
+		wantArgs []string
+		wantErr  bool
+	}{
+		{
+			name:     "正常系: コマンドにパイプする",
+			command:  "cat > /tmp/out",
+			wantArgs: []string{"pipe-pane", "-t", "main:1", "cat > /tmp/out"},
+		},
+		{
+			name:     "正常系: コマンドが空の場合はパイプを閉じる",
+			wantArgs: []string{"pipe-pane", "-t", "main:1"},
+		},
+		{
+			name:     "エラー系: tmux エラー",
+			command:  "cat > /tmp/out",
+			err:      fmt.Errorf("can't find window: 1"),
+			wantArgs: []string{"pipe-pane", "-t", "main:1", "cat > /tmp/out"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecutor{err: tt.err}
+			m := &Manager{Exec: mock}
+
+			err := m.PipePane("main", 1, tt.command)
+
+			assertArgs(t, mock, tt.wantArgs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PipePane() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManager_CapturePane(t *testing.T) {
+	tests := []struct {
+		name     string
+		pane     string
+		escapes  bool
+		history  int
+		output   []byte
+		err      error
+		wantArgs []string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "正常系: 表示中の画面をテキストで返す",
+			output:   []byte("$ ls\nfile1\n"),
+			wantArgs: []string{"capture-pane", "-p", "-t", "main:1"},
+			want:     "$ ls\nfile1\n",
+		},
+		{
+			name:     "正常系: エスケープシーケンスとスクロールバックを含める",
+			escapes:  true,
+			history:  500,
+			output:   []byte("\x1b[31merror\x1b[39m\n"),
+			wantArgs: []string{"capture-pane", "-p", "-t", "main:1", "-e", "-S", "-500"},
+			want:     "\x1b[31merror\x1b[39m\n",
+		},
+		{
+			name:     "正常系: pane を指定する",
+			pane:     "%3",
+			output:   []byte("vim\n"),
+			wantArgs: []string{"capture-pane", "-p", "-t", "main:1.%3"},
+			want:     "vim\n",
+		},
+		{
+			name:     "正常系: history が負の場合はスクロールバック全体",
+			history:  -1,
+			output:   []byte("old\nnew\n"),
+			wantArgs: []string{"capture-pane", "-p", "-t", "main:1", "-S", "-"},
+			want:     "old\nnew\n",
+		},
+		{
+			name:     "エラー系: tmux エラー",
+			err:      fmt.Errorf("can't find window: 1"),
+			wantArgs: []string{"capture-pane", "-p", "-t", "main:1"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecutor{output: tt.output, err: tt.err}
+			m := &Manager{Exec: mock}
+
+			got, err := m.CapturePane("main", 1, tt.pane, tt.escapes, tt.history)
+
+			assertArgs(t, mock, tt.wantArgs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CapturePane() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CapturePane() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_ListPanes(t *testing.T) {
+	t.Run("正常系: pane 一覧を返す", func(t *testing.T) {
+		mock := &mockExecutor{output: []byte("%1\t0\t1\t0\t0\t80\t12\t0\t1234\tvim\t/home/user/src\n%4\t1\t0\t0\t13\t80\t11\t0\t1300\tbash\t/tmp\n")}
+		m := &Manager{Exec: mock}
+
+		panes, err := m.ListPanes("main", 2)
+		if err != nil {
+			t.Fatalf("ListPanes() error = %v", err)
+		}
+		assertArgs(t, mock, []string{"list-panes", "-t", "main:2", "-F", paneFormat})
+		want := []Pane{
+			{ID: "%1", Index: 0, Active: true, Width: 80, Height: 12, PID: 1234, Command: "vim", Cwd: "/home/user/src"},
+			{ID: "%4", Index: 1, Top: 13, Width: 80, Height: 11, PID: 1300, Command: "bash", Cwd: "/tmp"},
+		}
+		if !reflect.DeepEqual(panes, want) {
+			t.Errorf("ListPanes() = %+v, want %+v", panes, want)
+		}
+	})
+
+	t.Run("異常系: tmux エラー", func(t *testing.T) {
+		mock := &mockExecutor{err: errors.New("can't find window: 9")}
+		m := &Manager{Exec: mock}
+
+		if _, err := m.ListPanes("main", 9); err == nil || !strings.Contains(err.Error(), "list panes") {
+			t.Errorf("ListPanes() error = %v, want list panes error", err)
+		}
+	})
+}
+
+func TestManager_SplitPane(t *testing.T) {
+	tests := []struct {
+		name       string
+		pane       string
+		horizontal bool
+		command    string
+		output     []byte
+		err        error
+		wantArgs   []string
+		wantID     string
+		wantErr    bool
+	}{
+		{
+			name:     "正常系: アクティブ pane を上下に分割する",
+			output:   []byte("%9\t1\t1\t0\t13\t80\t11\t0\t2000\tbash\t/home/user\n"),
+			wantArgs: []string{"split-window", "-t", "main:1", "-v", "-c", "#{pane_current_path}", "-P", "-F", paneFormat},
+			wantID:   "%9",
+		},
+		{
+			name:       "正常系: pane を指定して左右に分割しコマンドを実行する",
+			pane:       "%3",
+			horizontal: true,
+			command:    "htop",
+			output:     []byte("%10\t1\t1\t40\t0\t39\t24\t0\t2001\thtop\t/home/user\n"),
+			wantArgs:   []string{"split-window", "-t", "main:1.%3", "-h", "-c", "#{pane_current_path}", "-P", "-F", paneFormat, "htop"},
+			wantID:     "%10",
+		},
+		{
+			name:     "異常系: 分割する余地がない",
+			err:      errors.New("no space for new pane"),
+			wantArgs: []string{"split-window", "-t", "main:1", "-v", "-c", "#{pane_current_path}", "-P", "-F", paneFormat},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecutor{output: tt.output, err: tt.err}
+			m := &Manager{Exec: mock}
+
+			pane, err := m.SplitPane("main", 1, tt.pane, tt.horizontal, tt.command)
+
+			assertArgs(t, mock, tt.wantArgs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitPane() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && pane.ID != tt.wantID {
+				t.Errorf("SplitPane() = %+v, want ID %s", pane, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestManager_PaneCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(m *Manager) error
+		wantArgs []string
+	}{
+		{
+			name:     "SelectPane",
+			call:     func(m *Manager) error { return m.SelectPane("main", 1, "%3") },
+			wantArgs: []string{"select-pane", "-t", "main:1.%3"},
+		},
+		{
+			name:     "KillPane",
+			call:     func(m *Manager) error { return m.KillPane("main", 1, "%3") },
+			wantArgs: []string{"kill-pane", "-t", "main:1.%3"},
+		},
+		{
+			name:     "ZoomPane",
+			call:     func(m *Manager) error { return m.ZoomPane("main", 1, "%3") },
+			wantArgs: []string{"resize-pane", "-Z", "-t", "main:1.%3"},
+		},
+		{
+			name:     "ResizePane: 幅と高さ",
+			call:     func(m *Manager) error { return m.ResizePane("main", 1, "%3", 100, 30) },
+			wantArgs: []string{"resize-pane", "-t", "main:1.%3", "-x", "100", "-y", "30"},
+		},
+		{
+			name:     "ResizePane: 高さのみ",
+			call:     func(m *Manager) error { return m.ResizePane("main", 1, "%3", 0, 30) },
+			wantArgs: []string{"resize-pane", "-t", "main:1.%3", "-y", "30"},
+		},
+		{
+			name:     "SwapPane",
+			call:     func(m *Manager) error { return m.SwapPane("main", 1, "%3", "%5") },
+			wantArgs: []string{"swap-pane", "-s", "main:1.%3", "-t", "main:1.%5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecutor{}
+			m := &Manager{Exec: mock}
+			if err := tt.call(m); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			assertArgs(t, mock, tt.wantArgs)
+
+			mock.err = errors.New("can't find pane: %3")
+			if err := tt.call(m); err == nil {
+				t.Error("expected error when tmux fails")
+			}
+		})
+	}
+}
+
+func TestManager_GetClientPane(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  []byte
+		err     error
+		want    string
+		wantErr bool
+	}{
+		{name: "正常系: アクティブ pane の ID を返す", output: []byte("%12\n"), want: "%12"},
+		{name: "エラー系: tmux エラー", err: errors.New("can't find client"), wantErr: true},
+		{name: "エラー系: 不正な出力", output: []byte("\n"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockExecutor{output: tt.output, err: tt.err}
+			m := &Manager{Exec: mock}
+
+			got, err := m.GetClientPane("/dev/pts/5")
+
+			assertArgs(t, mock, []string{"display-message", "-p", "-t", "/dev/pts/5", "#{pane_id}"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetClientPane() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetClientPane() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestManager_CreateGroupedSession(t *testing.T) {
 	t.Run("正常系: グループセッション作成後にステータスバーを無効化する", func(t *testing.T) {
 		mock := &sequentialMockExecutor{
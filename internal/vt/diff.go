@@ -0,0 +1,228 @@
+package vt
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Diff は prev の状態を表示しているクライアント側の端末を next の状態にするシーケンスを返す。
+// 変化した行だけを書き直し、クライアント側のモード・カーソル・タイトルも next に合わせる。
+// prev が nil の場合（クライアント側の端末の状態が分からない場合）は、すべてのモードを明示的に設定して画面全体を描き直す。
+// 画面サイズか代替スクリーンの使用が変わった場合も画面全体を描き直す。
+// 最後に next.Passthrough を付ける。変化がなければ nil を返す。
+func Diff(prev, next *Frame) []byte {
+	d := &differ{cols: next.Cols, cx: -1, cy: -1}
+	explicit := prev == nil
+	if explicit {
+		prev = &Frame{CursorVisible: true}
+	}
+	full := explicit || prev.Cols != next.Cols || prev.Rows != next.Rows || prev.AltScreen != next.AltScreen
+
+	// モード（入力の形式・マウス報告等）
+	for i, mode := range clientModes {
+		bit := uint32(1) << i
+		if explicit || prev.modes&bit != next.modes&bit {
+			d.mode(mode, next.modes&bit != 0)
+		}
+	}
+	if explicit || prev.keypad != next.keypad {
+		if next.keypad {
+			d.buf.WriteString("\x1b=")
+		} else {
+			d.buf.WriteString("\x1b>")
+		}
+	}
+	if explicit || prev.CursorStyle != next.CursorStyle {
+		d.csi(strconv.Itoa(next.CursorStyle), " q")
+	}
+	if (explicit && next.Title != "") || prev.Title != next.Title {
+		d.buf.WriteString("\x1b]2;")
+		d.buf.WriteString(next.Title)
+		d.buf.WriteString("\x07")
+	}
+
+	// 画面の内容
+	cursorHidden := !prev.CursorVisible
+	hide := func() {
+		if !cursorHidden {
+			d.buf.WriteString("\x1b[?25l")
+			cursorHidden = true
+		}
+	}
+	prevCells := prev.Cells
+	if full {
+		hide()
+		if explicit || prev.AltScreen != next.AltScreen {
+			d.mode(1049, next.AltScreen)
+		}
+		d.buf.WriteString("\x1b[0m\x1b[H\x1b[2J")
+		d.pen = Attr{}
+		prevCells = newGrid(next.Cols, next.Rows, Attr{})
+	}
+	for y := range next.Cells {
+		if d.line(y, prevCells[y], next.Cells[y], hide) {
+			d.cx = -1
+		}
+	}
+
+	// カーソル
+	if d.pen != (Attr{}) {
+		d.buf.WriteString("\x1b[0m")
+	}
+	if d.buf.Len() > 0 || prev.CursorX != next.CursorX || prev.CursorY != next.CursorY {
+		if d.cx != next.CursorX || d.cy != next.CursorY {
+			d.cup(next.CursorX, next.CursorY)
+		}
+	}
+	switch {
+	case next.CursorVisible && cursorHidden:
+		d.buf.WriteString("\x1b[?25h")
+	case !next.CursorVisible && !cursorHidden:
+		d.buf.WriteString("\x1b[?25l")
+	}
+
+	d.buf.Write(next.Passthrough)
+	if d.buf.Len() == 0 {
+		return nil
+	}
+	return d.buf.Bytes()
+}
+
+// differ は Diff の出力と、出力中のクライアント側の端末の状態（文字属性・カーソル位置）を保持する。
+type differ struct {
+	buf    bytes.Buffer
+	cols   int
+	pen    Attr
+	cx, cy int // 出力後のカーソル位置（-1 は不明）
+}
+
+// csi は CSI シーケンスを書き込む。
+func (d *differ) csi(params, final string) {
+	d.buf.WriteString("\x1b[")
+	d.buf.WriteString(params)
+	d.buf.WriteString(final)
+}
+
+// mode は DEC プライベートモードを設定・解除するシーケンスを書き込む。
+func (d *differ) mode(mode int, on bool) {
+	if on {
+		d.csi("?"+strconv.Itoa(mode), "h")
+	} else {
+		d.csi("?"+strconv.Itoa(mode), "l")
+	}
+}
+
+// cup はカーソルを (x, y) に移動するシーケンスを書き込む。
+func (d *differ) cup(x, y int) {
+	d.csi(strconv.Itoa(y+1)+";"+strconv.Itoa(x+1), "H")
+	d.cx, d.cy = x, y
+}
+
+// setPen は文字属性を a にするシーケンスを書き込む（すでに a なら何もしない）。
+func (d *differ) setPen(a Attr) {
+	if d.pen == a {
+		return
+	}
+	d.pen = a
+	d.buf.WriteString("\x1b[0")
+	for _, f := range []struct {
+		flag AttrFlag
+		sgr  string
+	}{
+		{Bold, ";1"}, {Faint, ";2"}, {Italic, ";3"}, {Underline, ";4"},
+		{Blink, ";5"}, {Inverse, ";7"}, {Invisible, ";8"}, {Strikethrough, ";9"},
+	} {
+		if a.Flags&f.flag != 0 {
+			d.buf.WriteString(f.sgr)
+		}
+	}
+	d.color(a.Fg, 30, 90, "38")
+	d.color(a.Bg, 40, 100, "48")
+	d.buf.WriteByte('m')
+}
+
+// color は SGR の色パラメータを書き込む。base・brightBase は 16 色の場合の基準値、ext は拡張色の番号。
+func (d *differ) color(c Color, base, brightBase int, ext string) {
+	if i, ok := c.Indexed(); ok {
+		switch {
+		case i < 8:
+			d.buf.WriteString(";" + strconv.Itoa(base+int(i)))
+		case i < 16:
+			d.buf.WriteString(";" + strconv.Itoa(brightBase+int(i)-8))
+		default:
+			d.buf.WriteString(";" + ext + ";5;" + strconv.Itoa(int(i)))
+		}
+		return
+	}
+	if r, g, b, ok := c.RGB(); ok {
+		d.buf.WriteString(";" + ext + ";2;" + strconv.Itoa(int(r)) + ";" + strconv.Itoa(int(g)) + ";" + strconv.Itoa(int(b)))
+	}
+}
+
+// line は y 行目を old から cur に書き換えるシーケンスを書き込む。
+// 変化した範囲だけを書き、行末の空白は EL で消去する。書き換える前に hide を呼ぶ。
+// 最終列まで書き込んだ（カーソル位置が不定になった）場合は true を返す。
+func (d *differ) line(y int, old, cur []Cell, hide func()) bool {
+	cols := len(cur)
+	start := 0
+	for start < cols && start < len(old) && old[start] == cur[start] {
+		start++
+	}
+	if start == cols {
+		return false
+	}
+	end := cols - 1
+	for end > start && end < len(old) && old[end] == cur[end] {
+		end--
+	}
+	// 全角文字の途中から書き始めたり、途中で書き終えたりしない
+	if start > 0 && (cur[start].Width == 0 || (start < len(old) && old[start].Width == 0)) {
+		start--
+	}
+	if end+1 < cols && (cur[end].Width == 2 || (end < len(old) && old[end].Width == 2)) {
+		end++
+	}
+
+	// 行末の空白の連続は EL で消去する
+	blankFrom := cols
+	if last := cur[cols-1]; last.isBlank() {
+		for blankFrom > 0 && cur[blankFrom-1] == last {
+			blankFrom--
+		}
+	}
+
+	hide()
+	if d.cx != start || d.cy != y {
+		d.cup(start, y)
+	}
+	if end < blankFrom {
+		return d.cells(cur, start, end)
+	}
+	wrapped := false
+	if start < blankFrom {
+		wrapped = d.cells(cur, start, blankFrom-1)
+	}
+	d.setPen(cur[cols-1].Attr)
+	d.csi("", "K")
+	return wrapped
+}
+
+// cells は line の [from, to] のセルを書き込む。最終列まで書き込んだ場合は true を返す。
+func (d *differ) cells(line []Cell, from, to int) bool {
+	for x := from; x <= to; x++ {
+		c := line[x]
+		switch {
+		case c.Width == 0 && x > from && line[x-1].Width == 2:
+			// 直前の全角文字の 2 セル目（書き込み済み）
+			continue
+		case c.Width == 0 || (c.Width == 2 && (x+1 >= len(line) || line[x+1].Width != 0)):
+			// 対になる片側がない全角文字は空白で埋める
+			c = Cell{Rune: ' ', Width: 1, Attr: c.Attr}
+		}
+		d.setPen(c.Attr)
+		d.buf.WriteRune(c.Rune)
+		d.buf.WriteString(c.Comb)
+		d.cx += int(c.Width)
+	}
+	return d.cx >= len(line)
+}
@@ -0,0 +1,138 @@
+package vt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assertSameScreen は client の画面が want と同じ状態かどうかを検査する。
+func assertSameScreen(t *testing.T, client, want *Frame) {
+	t.Helper()
+
+	if !reflect.DeepEqual(client.Cells, want.Cells) {
+		t.Errorf("client screen = %q, want %q", frameText(client), frameText(want))
+	}
+	if client.CursorX != want.CursorX || client.CursorY != want.CursorY || client.CursorVisible != want.CursorVisible {
+		t.Errorf("client cursor = (%d, %d, visible %v), want (%d, %d, visible %v)",
+			client.CursorX, client.CursorY, client.CursorVisible, want.CursorX, want.CursorY, want.CursorVisible)
+	}
+	if client.AltScreen != want.AltScreen || client.modes != want.modes || client.keypad != want.keypad ||
+		client.CursorStyle != want.CursorStyle || client.Title != want.Title {
+		t.Errorf("client state = %+v, want %+v", client, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string // 各ステップの出力の後に差分を取ってクライアントに適用する
+	}{
+		{
+			name:  "文字の追記",
+			steps: []string{"$ ", "ls", "\r\nfile1  file2\r\n$ "},
+		},
+		{
+			name:  "色と装飾",
+			steps: []string{"\x1b[1;31merror\x1b[m: \x1b[38;2;10;20;30mdetail\x1b[m", "\x1b[1;1H\x1b[7mwarn \x1b[m"},
+		},
+		{
+			name:  "背景色付きの消去",
+			steps: []string{"abc\x1b[44m\x1b[K\x1b[m", "\x1b[2;1H\x1b[41m\x1b[2K\x1b[m"},
+		},
+		{
+			name:  "全角文字の書き換え",
+			steps: []string{"日本語テキスト", "\x1b[1;3Hx", "\x1b[1;1Hab漢字"},
+		},
+		{
+			name:  "スクロール",
+			steps: []string{"1\r\n2\r\n3\r\n4", "\r\n5\r\n6", "\x1b[2;3r\x1b[3;1H\n\n7\x1b[r"},
+		},
+		{
+			name:  "代替スクリーンの出入り",
+			steps: []string{"shell$ ", "\x1b[?1049h\x1b[Hvim", "\x1b[2;1H~", "\x1b[?1049lshell$ "},
+		},
+		{
+			name:  "最終列への書き込み",
+			steps: []string{"\x1b[1;10Hx", "\x1b[4;10Hy", "z"},
+		},
+		{
+			name:  "モードとカーソル",
+			steps: []string{"\x1b[?1h\x1b=\x1b[?1000h\x1b[?1006h", "\x1b[?25l\x1b[3 q", "\x1b[?1000l\x1b[?25h\x1b]2;vim\x07"},
+		},
+		{
+			name:  "結合文字",
+			steps: []string{"e\u0301", "\x1b[1;1Ha"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(10, 4)
+			client := New(10, 4)
+			var prev *Frame
+			for _, step := range tt.steps {
+				server.Write([]byte(step))
+				next := server.Snapshot()
+				client.Write(Diff(prev, next))
+				assertSameScreen(t, client.Snapshot(), next)
+				prev = next
+			}
+
+			// 状態の分からないクライアントには全体を送る
+			fresh := New(10, 4)
+			fresh.Write([]byte("garbage\x1b[?2004h\x1b[?1049h"))
+			next := server.Snapshot()
+			fresh.Write(Diff(nil, next))
+			assertSameScreen(t, fresh.Snapshot(), next)
+		})
+	}
+}
+
+func TestDiff_Resize(t *testing.T) {
+	server := New(10, 4)
+	client := New(10, 4)
+	server.Write([]byte("hello\r\nworld"))
+	prev := server.Snapshot()
+	client.Write(Diff(nil, prev))
+
+	server.Resize(6, 3)
+	client.Resize(6, 3)
+	server.Write([]byte("\x1b[H\x1b[2Jresized"))
+	next := server.Snapshot()
+	client.Write(Diff(prev, next))
+	assertSameScreen(t, client.Snapshot(), next)
+}
+
+func TestDiff_OnlyChanges(t *testing.T) {
+	s := New(80, 24)
+	s.Write([]byte(strings.Repeat("0123456789", 8*24)))
+	prev := s.Snapshot()
+
+	if d := Diff(prev, s.Snapshot()); d != nil {
+		t.Errorf("Diff of unchanged screen = %q, want nil", d)
+	}
+
+	s.Write([]byte("\x1b[5;10HX"))
+	d := Diff(prev, s.Snapshot())
+	want := "\x1b[?25l\x1b[5;10HX\x1b[?25h" // 書き込み後のカーソル位置はそのまま使う
+	if string(d) != want {
+		t.Errorf("Diff of one changed cell = %q, want %q", d, want)
+	}
+
+	// カーソル移動だけ
+	prev = s.Snapshot()
+	s.Write([]byte("\x1b[1;1H"))
+	if d := Diff(prev, s.Snapshot()); string(d) != "\x1b[1;1H" {
+		t.Errorf("Diff of cursor move = %q, want %q", d, "\x1b[1;1H")
+	}
+}
+
+func TestDiff_Passthrough(t *testing.T) {
+	s := New(10, 2)
+	prev := s.Snapshot()
+	s.Write([]byte("\x1b[6n"))
+	if d := Diff(prev, s.Snapshot()); string(d) != "\x1b[6n" {
+		t.Errorf("Diff = %q, want the query passed through", d)
+	}
+}
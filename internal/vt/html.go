@@ -0,0 +1,201 @@
+package vt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// HTML の既定の前景色・背景色（xterm のデフォルトに合わせる）。
+const (
+	htmlDefaultFg = "#e5e5e5"
+	htmlDefaultBg = "#000000"
+)
+
+// htmlPalette は 16 色のパレット（xterm のデフォルト）。
+var htmlPalette = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// HTML は SGR 付きのテキスト（tmux capture-pane -e の出力等）を、色と装飾をインラインスタイルにした
+// <pre> 要素に変換する。テキストはすべてエスケープし、SGR 以外のエスケープシーケンスと制御文字（改行・タブ以外）は捨てる。
+// 出力に含まれる属性値は色と装飾から生成したものだけなので、信頼できない出力をそのまま埋め込める。
+func HTML(text []byte) []byte {
+	h := &htmlWriter{}
+	h.buf.WriteString(`<pre class="palmux-snapshot" style="background-color:` + htmlDefaultBg + `;color:` + htmlDefaultFg + `">`)
+	for i := 0; i < len(text); {
+		b := text[i]
+		switch {
+		case b == 0x1b:
+			i = h.escape(text, i+1)
+			continue
+		case b == '\n' || b == '\t':
+			h.buf.WriteByte(b)
+		case b < 0x20 || b == 0x7f:
+			// その他の制御文字は捨てる
+		default:
+			r, n := utf8.DecodeRune(text[i:])
+			h.text(r)
+			i += n
+			continue
+		}
+		i++
+	}
+	h.setAttr(Attr{})
+	h.buf.WriteString("</pre>")
+	return h.buf.Bytes()
+}
+
+// htmlWriter は HTML の出力と現在の属性を持つ。
+type htmlWriter struct {
+	buf  bytes.Buffer
+	attr Attr
+	span bool // <span> を開いているか
+}
+
+// escape は text[i:]（ESC の次のバイトから）のエスケープシーケンスを処理し、シーケンスの次の位置を返す。
+// CSI の SGR だけを解釈する。
+func (h *htmlWriter) escape(text []byte, i int) int {
+	if i >= len(text) {
+		return i
+	}
+	switch text[i] {
+	case '[':
+		start := i + 1
+		for j := start; j < len(text); j++ {
+			if c := text[j]; c >= 0x40 && c <= 0x7e {
+				raw := string(text[start:j])
+				if c == 'm' && !strings.ContainsAny(raw, "<=>? !\"#$%&'()*+,-./") {
+					h.setAttr(applySGR(h.attr, parseParams(raw)))
+				}
+				return j + 1
+			}
+		}
+		return len(text)
+	case ']', 'P', 'X', '^', '_':
+		// OSC・DCS 等の文字列は BEL か ST（ESC \）まで捨てる
+		for j := i + 1; j < len(text); j++ {
+			if text[j] == 0x07 {
+				return j + 1
+			}
+			if text[j] == 0x1b && j+1 < len(text) && text[j+1] == '\\' {
+				return j + 2
+			}
+		}
+		return len(text)
+	}
+	// その他の ESC シーケンス（中間バイト + 終端バイト）
+	for i < len(text) && text[i] >= 0x20 && text[i] <= 0x2f {
+		i++
+	}
+	return min(i+1, len(text))
+}
+
+// text は 1 文字を HTML エスケープして書き込む。
+func (h *htmlWriter) text(r rune) {
+	switch r {
+	case '&':
+		h.buf.WriteString("&amp;")
+	case '<':
+		h.buf.WriteString("&lt;")
+	case '>':
+		h.buf.WriteString("&gt;")
+	case '"':
+		h.buf.WriteString("&#34;")
+	case '\'':
+		h.buf.WriteString("&#39;")
+	default:
+		h.buf.WriteRune(r)
+	}
+}
+
+// setAttr は属性を切り替え、必要に応じて <span> を閉じて開き直す。
+func (h *htmlWriter) setAttr(attr Attr) {
+	if attr == h.attr {
+		return
+	}
+	h.attr = attr
+	if h.span {
+		h.buf.WriteString("</span>")
+		h.span = false
+	}
+	if style := htmlStyle(attr); style != "" {
+		h.buf.WriteString(`<span style="` + style + `">`)
+		h.span = true
+	}
+}
+
+// htmlStyle は属性をインラインスタイルにする。デフォルトの属性の場合は空文字を返す。
+func htmlStyle(attr Attr) string {
+	fg, bg := htmlColor(attr.Fg), htmlColor(attr.Bg)
+	if attr.Flags&Inverse != 0 {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = htmlDefaultBg
+		}
+		if bg == "" {
+			bg = htmlDefaultFg
+		}
+	}
+	if attr.Flags&Invisible != 0 {
+		fg = "transparent"
+	}
+
+	var style []string
+	if fg != "" {
+		style = append(style, "color:"+fg)
+	}
+	if bg != "" {
+		style = append(style, "background-color:"+bg)
+	}
+	if attr.Flags&Bold != 0 {
+		style = append(style, "font-weight:bold")
+	}
+	if attr.Flags&Faint != 0 {
+		style = append(style, "opacity:0.5")
+	}
+	if attr.Flags&Italic != 0 {
+		style = append(style, "font-style:italic")
+	}
+	var deco []string
+	if attr.Flags&Underline != 0 {
+		deco = append(deco, "underline")
+	}
+	if attr.Flags&Strikethrough != 0 {
+		deco = append(deco, "line-through")
+	}
+	if len(deco) > 0 {
+		style = append(style, "text-decoration:"+strings.Join(deco, " "))
+	}
+	return strings.Join(style, ";")
+}
+
+// htmlColor は色を CSS の色にする。デフォルト色の場合は空文字を返す。
+func htmlColor(c Color) string {
+	if r, g, b, ok := c.RGB(); ok {
+		return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+	}
+	i, ok := c.Indexed()
+	switch {
+	case !ok:
+		return ""
+	case i < 16:
+		return htmlPalette[i]
+	case i < 232:
+		// 6x6x6 のカラーキューブ
+		level := func(v uint8) uint8 {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		i -= 16
+		return fmt.Sprintf("#%02x%02x%02x", level(i/36), level(i/6%6), level(i%6))
+	default:
+		// グレースケール
+		v := 8 + (i-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
@@ -0,0 +1,78 @@
+package vt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string // <pre> の中身
+	}{
+		{
+			name:  "プレーンテキスト",
+			input: "$ ls\nfile1\tfile2\n",
+			want:  "$ ls\nfile1\tfile2\n",
+		},
+		{
+			name:  "HTML のエスケープ",
+			input: `<script>alert("x")</script> & 'y'`,
+			want:  "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; &#39;y&#39;",
+		},
+		{
+			name:  "16 色と装飾",
+			input: "\x1b[1;31merror\x1b[0m: \x1b[4;92mok\x1b[24m!\x1b[m",
+			want: `<span style="color:#cd0000;font-weight:bold">error</span>: ` +
+				`<span style="color:#00ff00;text-decoration:underline">ok</span>` +
+				`<span style="color:#00ff00">!</span>`,
+		},
+		{
+			name:  "256 色と 24 ビットカラー",
+			input: "\x1b[38;5;196ma\x1b[48;5;244mb\x1b[38:2::1:2:3mc\x1b[m",
+			want: `<span style="color:#ff0000">a</span>` +
+				`<span style="color:#ff0000;background-color:#808080">b</span>` +
+				`<span style="color:#010203;background-color:#808080">c</span>`,
+		},
+		{
+			name:  "反転と非表示",
+			input: "\x1b[7msel\x1b[27;8msecret\x1b[m",
+			want: `<span style="color:#000000;background-color:#e5e5e5">sel</span>` +
+				`<span style="color:transparent">secret</span>`,
+		},
+		{
+			name:  "属性は改行をまたいで続く",
+			input: "\x1b[32mline1\nline2\x1b[39m\n",
+			want:  `<span style="color:#00cd00">line1` + "\n" + `line2</span>` + "\n",
+		},
+		{
+			name:  "SGR 以外のシーケンスと制御文字は捨てる",
+			input: "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x07\x1b[2J\x1b[?25l\x1b(0q\r\x00\x08end",
+			want:  "linkqend",
+		},
+		{
+			name:  "プライベートパラメータ付きの m は SGR ではない",
+			input: "\x1b[>4;1mtext",
+			want:  "text",
+		},
+		{
+			name:  "途中で切れたシーケンスと不正な UTF-8",
+			input: "日本\xff語\x1b[31",
+			want:  "日本�語",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(HTML([]byte(tt.input)))
+			const open = `<pre class="palmux-snapshot" style="background-color:#000000;color:#e5e5e5">`
+			if !strings.HasPrefix(got, open) || !strings.HasSuffix(got, "</pre>") {
+				t.Fatalf("HTML() = %q, want a <pre> element", got)
+			}
+			if body := strings.TrimSuffix(strings.TrimPrefix(got, open), "</pre>"); body != tt.want {
+				t.Errorf("HTML() body = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,605 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parserState はエスケープシーケンスの解析状態。
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateCSI
+	stateOSC
+	stateOSCEscape // OSC 中の ESC（ST の 1 バイト目）
+	stateDCS
+	stateDCSEscape // DCS 中の ESC（ST の 1 バイト目）
+)
+
+// maxCSILen・maxOSCLen・maxDCSLen は CSI のパラメータ・OSC・DCS の文字列として保持する最大長（バイト）。
+// 超えた部分は捨てる（OSC 52 のクリップボードで大きなテキストを扱えるよう OSC は大きめにする）。
+const (
+	maxCSILen = 256
+	maxOSCLen = 1 << 20
+	maxDCSLen = 4096
+)
+
+// parser はバイト列をエスケープシーケンスと文字に分解する状態機械。
+// Write をまたいで途中のシーケンスと不完全な UTF-8 を持ち越す。
+type parser struct {
+	state parserState
+	utf8  []byte // 途中で切れた UTF-8 シーケンス
+	inter []byte // ESC・CSI の中間バイト
+	buf   []byte // CSI のパラメータ、OSC・DCS の文字列
+}
+
+// Write は端末への出力 p を解釈して画面の状態を更新する。常に len(p), nil を返す。
+func (s *Screen) Write(p []byte) (int, error) {
+	n := len(p)
+	ps := &s.parser
+	if k := len(ps.utf8); k > 0 {
+		// 前回の末尾で切れた UTF-8 シーケンスの続き
+		buf := append(ps.utf8, p[:min(len(p), utf8.UTFMax-k)]...)
+		if !utf8.FullRune(buf) {
+			ps.utf8 = buf
+			return n, nil
+		}
+		r, size := utf8.DecodeRune(buf)
+		ps.utf8 = ps.utf8[:0]
+		s.print(r)
+		p = p[max(size-k, 0):]
+	}
+
+	for len(p) > 0 {
+		b := p[0]
+		if ps.state == stateGround && b >= 0x80 {
+			if !utf8.FullRune(p) {
+				ps.utf8 = append(ps.utf8[:0], p...)
+				return n, nil
+			}
+			r, size := utf8.DecodeRune(p)
+			s.print(r)
+			p = p[size:]
+			continue
+		}
+		if ps.state == stateGround && b >= 0x20 && b < 0x7F {
+			// 印字可能な ASCII の連続はまとめて処理する
+			i := 1
+			for i < len(p) && p[i] >= 0x20 && p[i] < 0x7F {
+				i++
+			}
+			for _, c := range p[:i] {
+				s.print(rune(c))
+			}
+			p = p[i:]
+			continue
+		}
+		s.step(b)
+		p = p[1:]
+	}
+	return n, nil
+}
+
+// step は ASCII・制御文字・シーケンス中の 1 バイトを処理する。
+func (s *Screen) step(b byte) {
+	ps := &s.parser
+	switch ps.state {
+	case stateOSC:
+		switch b {
+		case 0x07:
+			s.dispatchOSC("\x07")
+			ps.state = stateGround
+		case 0x1B:
+			ps.state = stateOSCEscape
+		case 0x18, 0x1A:
+			ps.state = stateGround
+		default:
+			if len(ps.buf) < maxOSCLen {
+				ps.buf = append(ps.buf, b)
+			}
+		}
+		return
+	case stateOSCEscape:
+		if b == '\\' {
+			s.dispatchOSC("\x1b\\")
+			ps.state = stateGround
+			return
+		}
+		s.dispatchOSC("\x1b\\")
+		ps.state = stateGround
+		s.step(0x1B)
+		s.step(b)
+		return
+	case stateDCS:
+		switch b {
+		case 0x1B:
+			ps.state = stateDCSEscape
+		case 0x18, 0x1A:
+			ps.state = stateGround
+		default:
+			if len(ps.buf) < maxDCSLen {
+				ps.buf = append(ps.buf, b)
+			}
+		}
+		return
+	case stateDCSEscape:
+		s.dispatchDCS()
+		ps.state = stateGround
+		if b != '\\' {
+			s.step(0x1B)
+			s.step(b)
+		}
+		return
+	}
+
+	// C0 制御文字はシーケンスの途中でも実行する
+	if b < 0x20 || b == 0x7F {
+		switch b {
+		case 0x1B:
+			ps.state = stateEscape
+			ps.inter = ps.inter[:0]
+		case 0x18, 0x1A:
+			ps.state = stateGround
+		default:
+			s.execute(b)
+		}
+		return
+	}
+
+	switch ps.state {
+	case stateGround:
+		s.print(rune(b))
+	case stateEscape:
+		switch {
+		case b >= 0x20 && b <= 0x2F:
+			ps.inter = append(ps.inter, b)
+		case b == '[' && len(ps.inter) == 0:
+			ps.state = stateCSI
+			ps.buf = ps.buf[:0]
+		case b == ']' && len(ps.inter) == 0:
+			ps.state = stateOSC
+			ps.buf = ps.buf[:0]
+		case (b == 'P' || b == 'X' || b == '^' || b == '_') && len(ps.inter) == 0:
+			// DCS と、無視する SOS・PM・APC
+			ps.state = stateDCS
+			ps.buf = append(ps.buf[:0], b)
+		default:
+			ps.state = stateGround
+			s.dispatchESC(string(ps.inter), b)
+		}
+	case stateCSI:
+		switch {
+		case b >= 0x30 && b <= 0x3F:
+			if len(ps.inter) > 0 {
+				// 中間バイトの後のパラメータは不正なシーケンス
+				ps.inter = append(ps.inter[:0], 0xFF)
+			}
+			if len(ps.buf) < maxCSILen {
+				ps.buf = append(ps.buf, b)
+			}
+		case b >= 0x20 && b <= 0x2F:
+			ps.inter = append(ps.inter, b)
+		default:
+			ps.state = stateGround
+			s.dispatchCSI(string(ps.buf), string(ps.inter), b)
+		}
+	}
+}
+
+// execute は C0 制御文字を実行する。
+func (s *Screen) execute(b byte) {
+	switch b {
+	case 0x07: // BEL
+		s.passthroughSeq("\x07")
+	case 0x08: // BS
+		if s.x > 0 {
+			s.x--
+		}
+		s.pendingWrap = false
+	case 0x09: // HT
+		s.tab(1)
+	case 0x0A, 0x0B, 0x0C: // LF・VT・FF
+		s.index()
+		s.pendingWrap = false
+	case 0x0D: // CR
+		s.x = 0
+		s.pendingWrap = false
+	case 0x0E: // SO
+		s.shifted = true
+	case 0x0F: // SI
+		s.shifted = false
+	}
+}
+
+// dispatchESC は ESC シーケンスを実行する。
+func (s *Screen) dispatchESC(inter string, final byte) {
+	switch inter {
+	case "":
+		switch final {
+		case '7':
+			s.saveCursor()
+		case '8':
+			s.restoreCursor()
+		case 'D':
+			s.index()
+			s.pendingWrap = false
+		case 'E':
+			s.x = 0
+			s.index()
+			s.pendingWrap = false
+		case 'H':
+			s.tabs[s.x] = true
+		case 'M':
+			s.reverseIndex()
+			s.pendingWrap = false
+		case 'c':
+			s.reset(s.cols, s.rows)
+		case '=':
+			s.keypad = true
+		case '>':
+			s.keypad = false
+		}
+	case "(", ")":
+		g := 0
+		if inter == ")" {
+			g = 1
+		}
+		s.charsets[g] = final == '0'
+	case "#":
+		if final == '8' {
+			// DECALN: 画面を E で埋める
+			for _, line := range s.grid {
+				for x := range line {
+					line[x] = Cell{Rune: 'E', Width: 1}
+				}
+			}
+			s.moveTo(0, 0)
+		}
+	}
+}
+
+// parseParams は CSI のパラメータ文字列を数値の列に分解する。
+// 省略されたパラメータは -1 になる。サブパラメータ（: 区切り）は各要素の 2 番目以降に入る。
+func parseParams(raw string) [][]int {
+	if raw == "" {
+		return nil
+	}
+	groups := strings.Split(raw, ";")
+	params := make([][]int, len(groups))
+	for i, g := range groups {
+		subs := strings.Split(g, ":")
+		params[i] = make([]int, len(subs))
+		for j, sub := range subs {
+			v, err := strconv.Atoi(sub)
+			if err != nil || v < 0 {
+				v = -1
+			}
+			params[i][j] = min(v, 65535)
+		}
+	}
+	return params
+}
+
+// param は i 番目のパラメータを返す。省略されている場合や 0 の場合（min が 1 のとき）は def を返す。
+func param(params [][]int, i, def int) int {
+	if i >= len(params) || params[i][0] < 0 {
+		return def
+	}
+	if params[i][0] == 0 && def > 0 {
+		return def
+	}
+	return params[i][0]
+}
+
+// dispatchCSI は CSI シーケンスを実行する。
+func (s *Screen) dispatchCSI(raw, inter string, final byte) {
+	private := byte(0)
+	if raw != "" && raw[0] >= '<' && raw[0] <= '?' {
+		private = raw[0]
+		raw = raw[1:]
+	}
+
+	// 端末への問い合わせはクライアント側の端末に応答させる
+	switch {
+	case final == 'c' && inter == "", // DA
+		final == 'n' && inter == "",                   // DSR
+		final == 'p' && inter == "$",                  // DECRQM
+		final == 'q' && inter == "" && private == '>': // XTVERSION
+		seq := "\x1b["
+		if private != 0 {
+			seq += string(private)
+		}
+		s.passthroughSeq(seq, raw, inter, string(final))
+		return
+	}
+
+	params := parseParams(raw)
+	if inter == " " && final == 'q' {
+		// DECSCUSR: カーソルの形状
+		s.cursorStyle = param(params, 0, 0)
+		return
+	}
+	if inter != "" {
+		return
+	}
+	if private != 0 {
+		if private == '?' && (final == 'h' || final == 'l') {
+			for _, p := range params {
+				s.setMode(p[0], true, final == 'h')
+			}
+		}
+		return
+	}
+
+	n := param(params, 0, 1)
+	switch final {
+	case '@': // ICH
+		s.insertCells(n)
+	case 'A': // CUU
+		s.moveRel(0, -n)
+	case 'B', 'e': // CUD・VPR
+		s.moveRel(0, n)
+	case 'C', 'a': // CUF・HPR
+		s.moveRel(n, 0)
+	case 'D': // CUB
+		s.moveRel(-n, 0)
+	case 'E': // CNL
+		s.moveRel(0, n)
+		s.x = 0
+	case 'F': // CPL
+		s.moveRel(0, -n)
+		s.x = 0
+	case 'G', '`': // CHA・HPA
+		s.x = min(n, s.cols) - 1
+		s.pendingWrap = false
+	case 'H', 'f': // CUP・HVP
+		s.moveTo(param(params, 1, 1)-1, n-1)
+	case 'I': // CHT
+		s.tab(n)
+	case 'J': // ED
+		switch param(params, 0, 0) {
+		case 0:
+			s.eraseCells(s.y, s.x, s.cols)
+			s.eraseLines(s.y+1, s.rows)
+		case 1:
+			s.eraseLines(0, s.y)
+			s.eraseCells(s.y, 0, s.x+1)
+		case 2, 3:
+			s.eraseLines(0, s.rows)
+		}
+	case 'K': // EL
+		switch param(params, 0, 0) {
+		case 0:
+			s.eraseCells(s.y, s.x, s.cols)
+		case 1:
+			s.eraseCells(s.y, 0, s.x+1)
+		case 2:
+			s.eraseCells(s.y, 0, s.cols)
+		}
+	case 'L': // IL
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollLines(s.y, s.bottom, -n)
+			s.x = 0
+			s.pendingWrap = false
+		}
+	case 'M': // DL
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollLines(s.y, s.bottom, n)
+			s.x = 0
+			s.pendingWrap = false
+		}
+	case 'P': // DCH
+		s.deleteCells(n)
+		s.pendingWrap = false
+	case 'S': // SU
+		s.scrollLines(s.top, s.bottom, n)
+	case 'T': // SD
+		if len(params) <= 1 {
+			s.scrollLines(s.top, s.bottom, -n)
+		}
+	case 'X': // ECH
+		s.eraseCells(s.y, s.x, s.x+n)
+		s.pendingWrap = false
+	case 'Z': // CBT
+		s.tab(-n)
+	case 'b': // REP
+		if s.x > 0 || s.pendingWrap {
+			x := s.x
+			if !s.pendingWrap {
+				x--
+			}
+			c := s.grid[s.y][x]
+			if c.Width == 0 && x > 0 {
+				c = s.grid[s.y][x-1]
+			}
+			for i := 0; i < min(n, s.cols*s.rows); i++ {
+				s.print(c.Rune)
+			}
+		}
+	case 'd': // VPA
+		s.moveTo(s.x, n-1)
+	case 'g': // TBC
+		switch param(params, 0, 0) {
+		case 0:
+			s.tabs[s.x] = false
+		case 3:
+			for x := range s.tabs {
+				s.tabs[x] = false
+			}
+		}
+	case 'h', 'l': // SM・RM
+		for _, p := range params {
+			s.setMode(p[0], false, final == 'h')
+		}
+	case 'm': // SGR
+		s.selectGraphicRendition(params)
+	case 'r': // DECSTBM
+		top, bottom := param(params, 0, 1)-1, param(params, 1, s.rows)-1
+		bottom = min(bottom, s.rows-1)
+		if top < bottom {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's': // SCOSC
+		s.saveCursor()
+	case 'u': // SCORC
+		s.restoreCursor()
+	}
+}
+
+// selectGraphicRendition は SGR で文字属性を設定する。
+func (s *Screen) selectGraphicRendition(params [][]int) {
+	s.attr = applySGR(s.attr, params)
+}
+
+// applySGR は SGR のパラメータを attr に適用した属性を返す。
+func applySGR(attr Attr, params [][]int) Attr {
+	if len(params) == 0 {
+		return Attr{}
+	}
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch v := p[0]; {
+		case v <= 0:
+			attr = Attr{}
+		case v == 1:
+			attr.Flags |= Bold
+		case v == 2:
+			attr.Flags |= Faint
+		case v == 3:
+			attr.Flags |= Italic
+		case v == 4:
+			if len(p) > 1 && p[1] == 0 {
+				attr.Flags &^= Underline
+			} else {
+				attr.Flags |= Underline
+			}
+		case v == 5 || v == 6:
+			attr.Flags |= Blink
+		case v == 7:
+			attr.Flags |= Inverse
+		case v == 8:
+			attr.Flags |= Invisible
+		case v == 9:
+			attr.Flags |= Strikethrough
+		case v == 21:
+			attr.Flags |= Underline
+		case v == 22:
+			attr.Flags &^= Bold | Faint
+		case v == 23:
+			attr.Flags &^= Italic
+		case v == 24:
+			attr.Flags &^= Underline
+		case v == 25:
+			attr.Flags &^= Blink
+		case v == 27:
+			attr.Flags &^= Inverse
+		case v == 28:
+			attr.Flags &^= Invisible
+		case v == 29:
+			attr.Flags &^= Strikethrough
+		case v >= 30 && v <= 37:
+			attr.Fg = IndexedColor(uint8(v - 30))
+		case v == 38, v == 48, v == 58:
+			var c Color
+			var ok bool
+			if len(p) > 1 {
+				// コロン区切りの形式（38:5:n、38:2::r:g:b）
+				c, ok = extendedColor(p[1:], true)
+			} else {
+				var used int
+				c, ok, used = extendedColorArgs(params[i+1:])
+				i += used
+			}
+			switch {
+			case !ok:
+			case v == 38:
+				attr.Fg = c
+			case v == 48:
+				attr.Bg = c
+			}
+		case v == 39:
+			attr.Fg = DefaultColor
+		case v >= 40 && v <= 47:
+			attr.Bg = IndexedColor(uint8(v - 40))
+		case v == 49:
+			attr.Bg = DefaultColor
+		case v >= 90 && v <= 97:
+			attr.Fg = IndexedColor(uint8(v - 90 + 8))
+		case v >= 100 && v <= 107:
+			attr.Bg = IndexedColor(uint8(v - 100 + 8))
+		}
+	}
+	return attr
+}
+
+// extendedColor はコロン区切りの拡張色（5:n、2:[色空間]:r:g:b）を解釈する。
+func extendedColor(sub []int, colon bool) (Color, bool) {
+	switch {
+	case len(sub) >= 2 && sub[0] == 5:
+		return IndexedColor(uint8(max(sub[1], 0))), sub[1] >= 0 && sub[1] <= 255
+	case len(sub) >= 4 && sub[0] == 2:
+		rgb := sub[1:4]
+		if colon && len(sub) >= 5 {
+			rgb = sub[2:5] // 色空間 ID を含む形式
+		}
+		for _, v := range rgb {
+			if v < 0 || v > 255 {
+				return 0, false
+			}
+		}
+		return RGBColor(uint8(rgb[0]), uint8(rgb[1]), uint8(rgb[2])), true
+	}
+	return 0, false
+}
+
+// extendedColorArgs はセミコロン区切りの拡張色（38;5;n、38;2;r;g;b）を解釈し、消費したパラメータ数を返す。
+func extendedColorArgs(rest [][]int) (Color, bool, int) {
+	if len(rest) == 0 {
+		return 0, false, 0
+	}
+	n := 0
+	switch rest[0][0] {
+	case 5:
+		n = 2
+	case 2:
+		n = 4
+	default:
+		return 0, false, 1
+	}
+	if len(rest) < n {
+		return 0, false, len(rest)
+	}
+	sub := make([]int, n)
+	for i := range sub {
+		sub[i] = rest[i][0]
+	}
+	c, ok := extendedColor(sub, false)
+	return c, ok, n
+}
+
+// dispatchOSC は OSC シーケンスを実行する。terminator は元の終端（BEL か ST）。
+// ウィンドウタイトルは画面の状態として保持し、クリップボード（52）と色の設定・問い合わせ（4・10〜12・104・110〜112）は
+// クライアント側の端末に渡す。ハイパーリンク等のその他の OSC は捨てる。
+func (s *Screen) dispatchOSC(terminator string) {
+	data := string(s.parser.buf)
+	cmd, arg, _ := strings.Cut(data, ";")
+	switch cmd {
+	case "0", "2":
+		s.title = arg
+	case "4", "10", "11", "12", "52", "104", "110", "111", "112":
+		s.passthroughSeq("\x1b]", data, terminator)
+	}
+}
+
+// dispatchDCS は DCS シーケンスを実行する。
+// 設定・機能の問い合わせ（DECRQSS、XTGETTCAP）だけをクライアント側の端末に渡し、それ以外は捨てる。
+func (s *Screen) dispatchDCS() {
+	data := string(s.parser.buf)
+	if strings.HasPrefix(data, "P$q") || strings.HasPrefix(data, "P+q") {
+		s.passthroughSeq("\x1b", data, "\x1b\\")
+	}
+}
@@ -0,0 +1,647 @@
+package vt
+
+// Color はセルの前景色・背景色。
+// 0 はデフォルト色で、インデックスカラー（256 色）と RGB カラーは上位バイトで区別する。
+type Color uint32
+
+const (
+	// DefaultColor は端末のデフォルト色。
+	DefaultColor Color = 0
+
+	colorIndexed Color = 1 << 24
+	colorRGB     Color = 2 << 24
+	colorKind    Color = 0xFF << 24
+)
+
+// IndexedColor はパレットのインデックス（0〜255）の色を返す。
+func IndexedColor(i uint8) Color {
+	return colorIndexed | Color(i)
+}
+
+// RGBColor は 24 ビットカラーを返す。
+func RGBColor(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// Indexed はインデックスカラーの場合にパレットのインデックスを返す。
+func (c Color) Indexed() (uint8, bool) {
+	return uint8(c), c&colorKind == colorIndexed
+}
+
+// RGB は RGB カラーの場合に各成分を返す。
+func (c Color) RGB() (r, g, b uint8, ok bool) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c), c&colorKind == colorRGB
+}
+
+// AttrFlag は文字の装飾（SGR）のビットフラグ。
+type AttrFlag uint16
+
+const (
+	Bold AttrFlag = 1 << iota
+	Faint
+	Italic
+	Underline
+	Blink
+	Inverse
+	Invisible
+	Strikethrough
+)
+
+// Attr はセルの表示属性。
+type Attr struct {
+	Fg    Color
+	Bg    Color
+	Flags AttrFlag
+}
+
+// Cell は画面の 1 セル。
+// 全角文字は 2 セルを占め、2 セル目は Width が 0 の継続セルになる。
+type Cell struct {
+	Rune  rune
+	Comb  string // Rune に重ねて表示する結合文字・ゼロ幅文字
+	Width uint8
+	Attr  Attr
+}
+
+// blankCell は attr の背景色で消去したセルを返す（背景色消去: BCE）。
+func blankCell(attr Attr) Cell {
+	return Cell{Rune: ' ', Width: 1, Attr: Attr{Bg: attr.Bg}}
+}
+
+// isBlank は c が消去されたセル（空白で、背景色以外の属性がない）かどうかを返す。
+func (c Cell) isBlank() bool {
+	return c.Rune == ' ' && c.Width == 1 && c.Comb == "" && c.Attr.Fg == DefaultColor && c.Attr.Flags == 0
+}
+
+// clientModes はクライアント側の端末に反映する必要があるモード（DEC プライベートモード番号）。
+// カーソルキーのモード・マウス報告・ブラケットペースト等、入力や表示方法を変えるもので、
+// Diff は変化があったときにこれらを設定するシーケンスを出力する。
+var clientModes = []int{1, 5, 12, 1000, 1002, 1003, 1004, 1005, 1006, 1015, 2004}
+
+// clientModeBit は DEC プライベートモード番号に対応する Frame.modes のビットを返す（対象外は 0）。
+func clientModeBit(mode int) uint32 {
+	for i, m := range clientModes {
+		if m == mode {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+// savedCursor は DECSC で保存するカーソルの状態。
+type savedCursor struct {
+	x, y        int
+	attr        Attr
+	pendingWrap bool
+	originMode  bool
+	charsets    [2]bool
+	shifted     bool
+}
+
+// Screen はヘッドレスの VT 端末エミュレーター。
+// Write で受け取った出力を解釈して表示中の画面の状態を保持し、Snapshot でその時点の状態を返す。
+// 端末への問い合わせ（DA・DSR 等）とクリップボード操作は解釈せず、
+// Snapshot の Passthrough としてクライアント側の端末に渡す。
+// Screen は並行に使用できない（呼び出し側で排他すること）。
+type Screen struct {
+	cols, rows int
+
+	main, alt [][]Cell
+	grid      [][]Cell // 表示中のバッファ（main か alt）
+	altScreen bool
+
+	x, y        int
+	pendingWrap bool // 最終列に書き込んだ直後（次の文字の前に折り返す）
+	attr        Attr
+
+	top, bottom int // スクロール領域（両端を含む）
+	tabs        []bool
+
+	originMode    bool
+	autoWrap      bool
+	insertMode    bool
+	cursorVisible bool
+	cursorStyle   int
+	keypad        bool
+	modes         uint32
+
+	charsets [2]bool // G0・G1 が DEC 特殊図形文字セットかどうか
+	shifted  bool    // SO で G1 を選択中
+
+	saved    savedCursor
+	altSaved savedCursor
+
+	title       string
+	passthrough []byte
+
+	parser parser
+}
+
+// New は cols 列 rows 行の Screen を生成する。
+func New(cols, rows int) *Screen {
+	s := &Screen{}
+	s.reset(cols, rows)
+	return s
+}
+
+// reset は端末を初期状態（RIS）に戻す。
+func (s *Screen) reset(cols, rows int) {
+	if cols < 1 {
+		cols = 1
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	*s = Screen{
+		cols:          cols,
+		rows:          rows,
+		autoWrap:      true,
+		cursorVisible: true,
+		passthrough:   s.passthrough,
+		parser:        s.parser,
+	}
+	s.main = newGrid(cols, rows, Attr{})
+	s.alt = newGrid(cols, rows, Attr{})
+	s.grid = s.main
+	s.bottom = rows - 1
+	s.resetTabs()
+}
+
+// newGrid は attr の背景色で消去した cols 列 rows 行のバッファを生成する。
+func newGrid(cols, rows int, attr Attr) [][]Cell {
+	g := make([][]Cell, rows)
+	for y := range g {
+		g[y] = newLine(cols, attr)
+	}
+	return g
+}
+
+// newLine は attr の背景色で消去した 1 行を生成する。
+func newLine(cols int, attr Attr) []Cell {
+	line := make([]Cell, cols)
+	blank := blankCell(attr)
+	for x := range line {
+		line[x] = blank
+	}
+	return line
+}
+
+// resetTabs は 8 列ごとのデフォルトのタブストップを設定する。
+func (s *Screen) resetTabs() {
+	s.tabs = make([]bool, s.cols)
+	for x := 8; x < s.cols; x += 8 {
+		s.tabs[x] = true
+	}
+}
+
+// Size は画面の列数と行数を返す。
+func (s *Screen) Size() (cols, rows int) {
+	return s.cols, s.rows
+}
+
+// Resize は画面サイズを変更する。
+// 行数が減ってカーソルが画面外に出る場合は上の行を捨て、列数が減った場合は右側を切り詰める。
+// スクロール領域は画面全体に戻る（リサイズ後はアプリケーション側が再描画する前提）。
+func (s *Screen) Resize(cols, rows int) {
+	if cols < 1 || rows < 1 || (cols == s.cols && rows == s.rows) {
+		return
+	}
+	resize := func(g [][]Cell, cursorY int) [][]Cell {
+		if drop := cursorY - (rows - 1); drop > 0 {
+			g = g[drop:]
+		}
+		if len(g) > rows {
+			g = g[:rows]
+		}
+		out := make([][]Cell, rows)
+		for y := range out {
+			if y < len(g) {
+				line := g[y]
+				if len(line) > cols {
+					line = line[:cols]
+					if line[cols-1].Width == 2 {
+						// 2 セル目を切り詰めた全角文字
+						line[cols-1] = blankCell(line[cols-1].Attr)
+					}
+				}
+				for len(line) < cols {
+					line = append(line, blankCell(Attr{}))
+				}
+				out[y] = line
+			} else {
+				out[y] = newLine(cols, Attr{})
+			}
+		}
+		return out
+	}
+
+	// 表示中でないバッファはカーソル位置を考慮せず下側を切り詰める
+	mainY, altY := s.y, 0
+	if s.altScreen {
+		mainY, altY = 0, s.y
+	}
+	s.main = resize(s.main, mainY)
+	s.alt = resize(s.alt, altY)
+	if s.altScreen {
+		s.grid = s.alt
+	} else {
+		s.grid = s.main
+	}
+	if drop := s.y - (rows - 1); drop > 0 {
+		s.y -= drop
+	}
+
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.resetTabs()
+	s.x = min(s.x, cols-1)
+	s.y = min(s.y, rows-1)
+	s.pendingWrap = false
+	s.saved.x, s.saved.y = min(s.saved.x, cols-1), min(s.saved.y, rows-1)
+	s.altSaved.x, s.altSaved.y = min(s.altSaved.x, cols-1), min(s.altSaved.y, rows-1)
+}
+
+// Frame は Snapshot 時点の表示中の画面の状態。
+type Frame struct {
+	Cols, Rows    int
+	Cells         [][]Cell // Cells[y][x]
+	CursorX       int
+	CursorY       int
+	CursorVisible bool
+	CursorStyle   int // DECSCUSR のパラメータ（0 はクライアントのデフォルト）
+	AltScreen     bool
+	Title         string
+
+	// Passthrough は前回の Snapshot 以降に受け取った、クライアント側の端末に渡すシーケンス。
+	Passthrough []byte
+
+	modes  uint32
+	keypad bool
+}
+
+// Snapshot は現在の画面の状態を返し、溜まっている Passthrough を引き渡す。
+// 返した Frame は Screen と独立しており、以降の Write の影響を受けない。
+func (s *Screen) Snapshot() *Frame {
+	cells := make([][]Cell, s.rows)
+	for y, line := range s.grid {
+		cells[y] = append([]Cell(nil), line...)
+	}
+	f := &Frame{
+		Cols:          s.cols,
+		Rows:          s.rows,
+		Cells:         cells,
+		CursorX:       s.x,
+		CursorY:       s.y,
+		CursorVisible: s.cursorVisible,
+		CursorStyle:   s.cursorStyle,
+		AltScreen:     s.altScreen,
+		Title:         s.title,
+		modes:         s.modes,
+		keypad:        s.keypad,
+	}
+	if len(s.passthrough) > 0 {
+		f.Passthrough = s.passthrough
+		s.passthrough = nil
+	}
+	return f
+}
+
+// maxPassthrough は Snapshot までに溜めておく Passthrough の上限（バイト）。
+// 超えた分は捨てる（取りこぼしてもクライアントの画面は崩れない）。
+const maxPassthrough = 1 << 20
+
+// passthroughSeq はクライアント側の端末に渡すシーケンスを追加する。
+func (s *Screen) passthroughSeq(parts ...string) {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	if len(s.passthrough)+n > maxPassthrough {
+		return
+	}
+	for _, p := range parts {
+		s.passthrough = append(s.passthrough, p...)
+	}
+}
+
+// decGraphics は DEC 特殊図形文字セットの罫線素片等を Unicode に対応付ける。
+var decGraphics = map[rune]rune{
+	'`': '◆', 'a': '▒', 'b': '␉', 'c': '␌', 'd': '␍', 'e': '␊', 'f': '°', 'g': '±',
+	'h': '␤', 'i': '␋', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼', 'o': '⎺',
+	'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·',
+}
+
+// print は文字 r をカーソル位置に書き込み、カーソルを進める。
+func (s *Screen) print(r rune) {
+	g := 0
+	if s.shifted {
+		g = 1
+	}
+	if s.charsets[g] {
+		if m, ok := decGraphics[r]; ok {
+			r = m
+		}
+	}
+
+	w := RuneWidth(r)
+	if w == 0 {
+		s.combine(r)
+		return
+	}
+	if w > s.cols {
+		return
+	}
+
+	if s.pendingWrap {
+		s.pendingWrap = false
+		if s.autoWrap {
+			s.x = 0
+			s.index()
+		}
+	}
+	if s.x+w > s.cols {
+		// 全角文字が最終列に収まらない: 折り返すか、収まる位置に書き込む
+		if s.autoWrap {
+			s.eraseCells(s.y, s.x, s.cols)
+			s.x = 0
+			s.index()
+		} else {
+			s.x = s.cols - w
+		}
+	}
+
+	line := s.grid[s.y]
+	if s.insertMode {
+		s.insertCells(w)
+	}
+	s.splitWide(s.y, s.x)
+	s.splitWide(s.y, s.x+w-1)
+	line[s.x] = Cell{Rune: r, Width: uint8(w), Attr: s.attr}
+	if w == 2 {
+		line[s.x+1] = Cell{Width: 0, Attr: s.attr}
+	}
+
+	if s.x+w >= s.cols {
+		s.x = s.cols - 1
+		s.pendingWrap = s.autoWrap
+	} else {
+		s.x += w
+	}
+}
+
+// combine は結合文字・ゼロ幅文字を直前に書き込んだセルに重ねる。
+func (s *Screen) combine(r rune) {
+	x := s.x
+	if !s.pendingWrap {
+		x--
+	}
+	if x < 0 {
+		return
+	}
+	line := s.grid[s.y]
+	if line[x].Width == 0 && x > 0 {
+		x--
+	}
+	if len(line[x].Comb) < 32 {
+		line[x].Comb += string(r)
+	}
+}
+
+// splitWide は (x, y) のセルが全角文字の一部の場合、その全角文字を空白にする。
+// 全角文字の片側だけが上書き・移動されて対になる片側のないセルが残らないようにする。
+func (s *Screen) splitWide(y, x int) {
+	if x < 0 || x >= s.cols {
+		return
+	}
+	line := s.grid[y]
+	switch {
+	case line[x].Width == 0 && x > 0:
+		line[x-1] = blankCell(line[x-1].Attr)
+		line[x] = blankCell(line[x].Attr)
+	case line[x].Width == 2 && x+1 < s.cols:
+		line[x] = blankCell(line[x].Attr)
+		line[x+1] = blankCell(line[x+1].Attr)
+	}
+}
+
+// eraseCells は y 行目の [from, to) を現在の背景色で消去する。
+func (s *Screen) eraseCells(y, from, to int) {
+	from = max(from, 0)
+	to = min(to, s.cols)
+	if from >= to {
+		return
+	}
+	s.splitWide(y, from)
+	s.splitWide(y, to-1)
+	blank := blankCell(s.attr)
+	line := s.grid[y]
+	for x := from; x < to; x++ {
+		line[x] = blank
+	}
+}
+
+// eraseLines は [from, to) 行を現在の背景色で消去する。
+func (s *Screen) eraseLines(from, to int) {
+	for y := max(from, 0); y < min(to, s.rows); y++ {
+		s.eraseCells(y, 0, s.cols)
+	}
+}
+
+// insertCells はカーソル位置に n 個の空白を挿入し、右側を押し出す（ICH）。
+func (s *Screen) insertCells(n int) {
+	line := s.grid[s.y]
+	n = min(n, s.cols-s.x)
+	s.splitWide(s.y, s.x)
+	copy(line[s.x+n:], line[s.x:s.cols-n])
+	blank := blankCell(s.attr)
+	for x := s.x; x < s.x+n; x++ {
+		line[x] = blank
+	}
+	if line[s.cols-1].Width == 2 {
+		// 2 セル目が押し出された全角文字
+		line[s.cols-1] = blank
+	}
+}
+
+// deleteCells はカーソル位置から n 個のセルを削除し、右側を詰める（DCH）。
+func (s *Screen) deleteCells(n int) {
+	line := s.grid[s.y]
+	n = min(n, s.cols-s.x)
+	s.splitWide(s.y, s.x)
+	s.splitWide(s.y, s.x+n-1)
+	copy(line[s.x:], line[s.x+n:])
+	blank := blankCell(s.attr)
+	for x := s.cols - n; x < s.cols; x++ {
+		line[x] = blank
+	}
+}
+
+// scrollLines は [top, bottom] の行を n 行上（負なら下）にずらし、空いた行を消去する。
+func (s *Screen) scrollLines(top, bottom, n int) {
+	if top > bottom {
+		return
+	}
+	height := bottom - top + 1
+	region := s.grid[top : bottom+1]
+	switch {
+	case n >= height || -n >= height:
+		for y := range region {
+			region[y] = newLine(s.cols, s.attr)
+		}
+	case n > 0:
+		copy(region, region[n:])
+		for y := height - n; y < height; y++ {
+			region[y] = newLine(s.cols, s.attr)
+		}
+	case n < 0:
+		n = -n
+		copy(region[n:], region[:height-n])
+		for y := 0; y < n; y++ {
+			region[y] = newLine(s.cols, s.attr)
+		}
+	}
+}
+
+// index はカーソルを 1 行下げる。スクロール領域の下端ではスクロールする（IND）。
+func (s *Screen) index() {
+	switch {
+	case s.y == s.bottom:
+		s.scrollLines(s.top, s.bottom, 1)
+	case s.y < s.rows-1:
+		s.y++
+	}
+}
+
+// reverseIndex はカーソルを 1 行上げる。スクロール領域の上端ではスクロールする（RI）。
+func (s *Screen) reverseIndex() {
+	switch {
+	case s.y == s.top:
+		s.scrollLines(s.top, s.bottom, -1)
+	case s.y > 0:
+		s.y--
+	}
+}
+
+// moveTo はカーソルを (x, y) に移動する。オリジンモードでは y をスクロール領域からの相対位置として扱う。
+func (s *Screen) moveTo(x, y int) {
+	minY, maxY := 0, s.rows-1
+	if s.originMode {
+		y += s.top
+		minY, maxY = s.top, s.bottom
+	}
+	s.x = max(0, min(x, s.cols-1))
+	s.y = max(minY, min(y, maxY))
+	s.pendingWrap = false
+}
+
+// moveRel はカーソルを相対移動する。上下の移動はスクロール領域内ではその端で止まる。
+func (s *Screen) moveRel(dx, dy int) {
+	minY, maxY := 0, s.rows-1
+	if s.y >= s.top && s.y <= s.bottom {
+		minY, maxY = s.top, s.bottom
+	}
+	s.x = max(0, min(s.x+dx, s.cols-1))
+	s.y = max(minY, min(s.y+dy, maxY))
+	s.pendingWrap = false
+}
+
+// tab はカーソルを n 個先（負なら前）のタブストップに移動する。
+func (s *Screen) tab(n int) {
+	for ; n > 0 && s.x < s.cols-1; n-- {
+		s.x++
+		for s.x < s.cols-1 && !s.tabs[s.x] {
+			s.x++
+		}
+	}
+	for ; n < 0 && s.x > 0; n++ {
+		s.x--
+		for s.x > 0 && !s.tabs[s.x] {
+			s.x--
+		}
+	}
+	s.pendingWrap = false
+}
+
+// saveCursor はカーソルの状態を保存する（DECSC）。
+func (s *Screen) saveCursor() {
+	s.saved = savedCursor{
+		x: s.x, y: s.y, attr: s.attr, pendingWrap: s.pendingWrap,
+		originMode: s.originMode, charsets: s.charsets, shifted: s.shifted,
+	}
+}
+
+// restoreCursor は保存したカーソルの状態を復元する（DECRC）。
+func (s *Screen) restoreCursor() {
+	c := s.saved
+	s.x, s.y = min(c.x, s.cols-1), min(c.y, s.rows-1)
+	s.attr, s.pendingWrap = c.attr, c.pendingWrap
+	s.originMode, s.charsets, s.shifted = c.originMode, c.charsets, c.shifted
+}
+
+// setAltScreen は代替スクリーンとの切り替えを行う。
+// 代替スクリーンとメインスクリーンはそれぞれ保存したカーソルを持つ。
+func (s *Screen) setAltScreen(on bool) {
+	if on == s.altScreen {
+		return
+	}
+	s.saved, s.altSaved = s.altSaved, s.saved
+	s.altScreen = on
+	if on {
+		s.grid = s.alt
+	} else {
+		s.grid = s.main
+	}
+}
+
+// setMode は SM・RM（private は DEC プライベートモード）を処理する。
+func (s *Screen) setMode(mode int, private, on bool) {
+	if !private {
+		if mode == 4 {
+			s.insertMode = on
+		}
+		return
+	}
+	switch mode {
+	case 6:
+		s.originMode = on
+		s.moveTo(0, 0)
+	case 7:
+		s.autoWrap = on
+		if !on {
+			s.pendingWrap = false
+		}
+	case 25:
+		s.cursorVisible = on
+	case 47, 1047:
+		if !on && s.altScreen && mode == 1047 {
+			s.eraseLines(0, s.rows)
+		}
+		s.setAltScreen(on)
+	case 1048:
+		if on {
+			s.saveCursor()
+		} else {
+			s.restoreCursor()
+		}
+	case 1049:
+		if on {
+			s.saveCursor()
+			s.setAltScreen(true)
+			s.saveCursor()
+			s.attr = Attr{}
+			s.eraseLines(0, s.rows)
+		} else {
+			s.setAltScreen(false)
+			s.restoreCursor()
+		}
+	default:
+		if bit := clientModeBit(mode); bit != 0 {
+			if on {
+				s.modes |= bit
+			} else {
+				s.modes &^= bit
+			}
+		}
+	}
+}
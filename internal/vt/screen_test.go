@@ -0,0 +1,267 @@
+package vt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// frameText は Frame の各行を文字列にして返す（全角文字の 2 セル目は飛ばし、行末の空白は削る）。
+func frameText(f *Frame) []string {
+	lines := make([]string, len(f.Cells))
+	for y, line := range f.Cells {
+		var b strings.Builder
+		for _, c := range line {
+			if c.Width == 0 {
+				continue
+			}
+			b.WriteRune(c.Rune)
+			b.WriteString(c.Comb)
+		}
+		lines[y] = strings.TrimRight(b.String(), " ")
+	}
+	return lines
+}
+
+func TestScreenWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		cols, rows int
+		input      string
+		want       []string
+		wantX      int
+		wantY      int
+	}{
+		{
+			name: "改行と復帰", cols: 10, rows: 3,
+			input: "abc\r\ndef",
+			want:  []string{"abc", "def", ""}, wantX: 3, wantY: 1,
+		},
+		{
+			name: "行末で折り返す", cols: 4, rows: 3,
+			input: "abcdef",
+			want:  []string{"abcd", "ef", ""}, wantX: 2, wantY: 1,
+		},
+		{
+			name: "最終列に書いた直後は折り返さない", cols: 4, rows: 3,
+			input: "abcd",
+			want:  []string{"abcd", "", ""}, wantX: 3, wantY: 0,
+		},
+		{
+			name: "最下行で改行するとスクロールする", cols: 4, rows: 2,
+			input: "a\r\nb\r\nc",
+			want:  []string{"b", "c"}, wantX: 1, wantY: 1,
+		},
+		{
+			name: "全角文字は 2 セルを占める", cols: 10, rows: 2,
+			input: "日本語a",
+			want:  []string{"日本語a", ""}, wantX: 7, wantY: 0,
+		},
+		{
+			name: "最終列に収まらない全角文字は次の行に書く", cols: 5, rows: 2,
+			input: "abcd日",
+			want:  []string{"abcd", "日"}, wantX: 2, wantY: 1,
+		},
+		{
+			name: "全角文字の片側を上書きすると残りは空白になる", cols: 10, rows: 1,
+			input: "日本\x1b[1;2Hx",
+			want:  []string{" x本"}, wantX: 2, wantY: 0,
+		},
+		{
+			name: "結合文字は直前の文字に重ねる", cols: 10, rows: 1,
+			input: "e\u0301x",
+			want:  []string{"e\u0301x"}, wantX: 2, wantY: 0,
+		},
+		{
+			name: "カーソル移動と行末までの消去", cols: 10, rows: 2,
+			input: "abcdef\x1b[1;3H\x1b[K\x1b[2;5Hx",
+			want:  []string{"ab", "    x"}, wantX: 5, wantY: 1,
+		},
+		{
+			name: "画面の消去", cols: 10, rows: 2,
+			input: "abc\r\ndef\x1b[2J",
+			want:  []string{"", ""}, wantX: 3, wantY: 1,
+		},
+		{
+			name: "スクロール領域内でスクロールする", cols: 4, rows: 4,
+			input: "top\r\na\r\nb\r\nbot\x1b[2;3r\x1b[3;1H\nc",
+			want:  []string{"top", "b", "c", "bot"}, wantX: 1, wantY: 2,
+		},
+		{
+			name: "行の挿入と削除", cols: 4, rows: 3,
+			input: "a\r\nb\r\nc\x1b[2;1H\x1b[L\x1b[1;1H\x1b[M",
+			want:  []string{"", "b", ""}, wantX: 0, wantY: 0,
+		},
+		{
+			name: "文字の挿入と削除", cols: 6, rows: 1,
+			input: "abcdef\x1b[1;2H\x1b[2@\x1b[1;5H\x1b[P",
+			want:  []string{"a  bd"}, wantX: 4, wantY: 0,
+		},
+		{
+			name: "タブ", cols: 20, rows: 1,
+			input: "a\tb",
+			want:  []string{"a       b"}, wantX: 9, wantY: 0,
+		},
+		{
+			name: "代替スクリーンから戻るとメインスクリーンとカーソルが戻る", cols: 10, rows: 2,
+			input: "main\x1b[?1049hALT\x1b[?1049l",
+			want:  []string{"main", ""}, wantX: 4, wantY: 0,
+		},
+		{
+			name: "DEC 特殊図形文字セット", cols: 10, rows: 1,
+			input: "\x1b(0lqk\x1b(Bq",
+			want:  []string{"┌─┐q"}, wantX: 4, wantY: 0,
+		},
+		{
+			name: "直前の文字の繰り返し", cols: 10, rows: 1,
+			input: "-\x1b[4b",
+			want:  []string{"-----"}, wantX: 5, wantY: 0,
+		},
+		{
+			name: "カーソルの保存と復元", cols: 10, rows: 2,
+			input: "ab\x1b7\r\ncd\x1b8x",
+			want:  []string{"abx", "cd"}, wantX: 3, wantY: 0,
+		},
+		{
+			name: "OSC と DCS は表示しない", cols: 10, rows: 1,
+			input: "a\x1b]8;;http://example.com\x1b\\b\x1bP1$r0m\x1b\\c",
+			want:  []string{"abc"}, wantX: 3, wantY: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(tt.cols, tt.rows)
+			s.Write([]byte(tt.input))
+			f := s.Snapshot()
+			if got := frameText(f); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("screen = %q, want %q", got, tt.want)
+			}
+			if f.CursorX != tt.wantX || f.CursorY != tt.wantY {
+				t.Errorf("cursor = (%d, %d), want (%d, %d)", f.CursorX, f.CursorY, tt.wantX, tt.wantY)
+			}
+
+			// 1 バイトずつ書き込んでも（シーケンスや UTF-8 が途中で切れても）同じ結果になる
+			s2 := New(tt.cols, tt.rows)
+			for i := 0; i < len(tt.input); i++ {
+				s2.Write([]byte{tt.input[i]})
+			}
+			f2 := s2.Snapshot()
+			if !reflect.DeepEqual(f2.Cells, f.Cells) || f2.CursorX != f.CursorX || f2.CursorY != f.CursorY {
+				t.Errorf("byte-by-byte screen = %q, want %q", frameText(f2), frameText(f))
+			}
+		})
+	}
+}
+
+func TestScreenSGR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Attr
+	}{
+		{name: "デフォルト", input: "x", want: Attr{}},
+		{name: "太字と下線", input: "\x1b[1;4mx", want: Attr{Flags: Bold | Underline}},
+		{name: "16 色", input: "\x1b[31;102mx", want: Attr{Fg: IndexedColor(1), Bg: IndexedColor(10)}},
+		{name: "256 色", input: "\x1b[38;5;200;48;5;17mx", want: Attr{Fg: IndexedColor(200), Bg: IndexedColor(17)}},
+		{name: "24 ビットカラー", input: "\x1b[38;2;1;2;3mx", want: Attr{Fg: RGBColor(1, 2, 3)}},
+		{name: "コロン区切りの 24 ビットカラー", input: "\x1b[48:2::4:5:6mx", want: Attr{Bg: RGBColor(4, 5, 6)}},
+		{name: "拡張色の後のパラメータも解釈する", input: "\x1b[38;5;1;1mx", want: Attr{Fg: IndexedColor(1), Flags: Bold}},
+		{name: "リセット", input: "\x1b[1;31m\x1b[mx", want: Attr{}},
+		{name: "個別の解除", input: "\x1b[1;3;7m\x1b[22;27mx", want: Attr{Flags: Italic}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(10, 1)
+			s.Write([]byte(tt.input))
+			if got := s.Snapshot().Cells[0][0].Attr; got != tt.want {
+				t.Errorf("attr = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreenState(t *testing.T) {
+	s := New(10, 2)
+	s.Write([]byte("\x1b]2;title\x07\x1b[?1h\x1b[?2004h\x1b=\x1b[?25l\x1b[5 q\x1b[c\x1b]52;c;YQ==\x07\a"))
+	f := s.Snapshot()
+
+	if f.Title != "title" {
+		t.Errorf("title = %q, want %q", f.Title, "title")
+	}
+	if f.CursorVisible {
+		t.Error("cursor visible, want hidden")
+	}
+	if f.CursorStyle != 5 {
+		t.Errorf("cursor style = %d, want 5", f.CursorStyle)
+	}
+	if !f.keypad || f.modes != clientModeBit(1)|clientModeBit(2004) {
+		t.Errorf("keypad = %v, modes = %b, want application keypad with modes 1 and 2004", f.keypad, f.modes)
+	}
+	wantPassthrough := "\x1b[c\x1b]52;c;YQ==\x07\a"
+	if string(f.Passthrough) != wantPassthrough {
+		t.Errorf("passthrough = %q, want %q", f.Passthrough, wantPassthrough)
+	}
+	if f2 := s.Snapshot(); f2.Passthrough != nil {
+		t.Errorf("passthrough after snapshot = %q, want none", f2.Passthrough)
+	}
+}
+
+func TestScreenResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		cols, rows int
+		want       []string
+		wantX      int
+		wantY      int
+	}{
+		{name: "拡大", input: "ab\r\ncd", cols: 6, rows: 4, want: []string{"ab", "cd", "", ""}, wantX: 2, wantY: 1},
+		{name: "カーソルが画面外に出る場合は上の行を捨てる", input: "a\r\nb\r\nc", cols: 4, rows: 2, want: []string{"b", "c"}, wantX: 1, wantY: 1},
+		{name: "カーソルより下の行は捨てる", input: "a\r\nb\r\nc\x1b[1;1H", cols: 4, rows: 2, want: []string{"a", "b"}, wantX: 0, wantY: 0},
+		{name: "列を切り詰める", input: "abcd", cols: 2, rows: 3, want: []string{"ab", "", ""}, wantX: 1, wantY: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(4, 3)
+			s.Write([]byte(tt.input))
+			s.Resize(tt.cols, tt.rows)
+			if cols, rows := s.Size(); cols != tt.cols || rows != tt.rows {
+				t.Fatalf("size = %dx%d, want %dx%d", cols, rows, tt.cols, tt.rows)
+			}
+			f := s.Snapshot()
+			if got := frameText(f); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("screen = %q, want %q", got, tt.want)
+			}
+			if f.CursorX != tt.wantX || f.CursorY != tt.wantY {
+				t.Errorf("cursor = (%d, %d), want (%d, %d)", f.CursorX, f.CursorY, tt.wantX, tt.wantY)
+			}
+		})
+	}
+}
+
+func TestRuneWidth(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want int
+	}{
+		{'a', 1},
+		{'é', 1},
+		{'─', 1},
+		{'日', 2},
+		{'ア', 2},
+		{'ｱ', 1},
+		{'한', 2},
+		{'😀', 2},
+		{'\u0301', 0},
+		{'\u200d', 0},
+		{'\ufe0f', 0},
+	}
+	for _, tt := range tests {
+		if got := RuneWidth(tt.r); got != tt.want {
+			t.Errorf("RuneWidth(%q) = %d, want %d", tt.r, got, tt.want)
+		}
+	}
+}
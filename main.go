@@ -4,17 +4,25 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/tjst-t/palmux/internal/config"
+	"github.com/tjst-t/palmux/internal/grep"
 	"github.com/tjst-t/palmux/internal/lsp"
 	"github.com/tjst-t/palmux/internal/server"
 	"github.com/tjst-t/palmux/internal/tmux"
@@ -22,18 +30,14 @@ import (
 
 var version = "dev"
 
+// shutdownTimeout はシャットダウン時に接続のクリーンアップを待つ最大時間。
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	showVersion := flag.Bool("version", false, "Show version and exit")
 	v := flag.Bool("v", false, "Show version and exit (shorthand)")
-	port := flag.Int("port", 8080, "Listen port")
-	host := flag.String("host", "0.0.0.0", "Listen address")
-	tmuxBin := flag.String("tmux", "tmux", "tmux binary path")
-	claudePath := flag.String("claude-path", "claude", "claude command path or wrapper script")
-	tlsCert := flag.String("tls-cert", "", "TLS certificate file")
-	tlsKey := flag.String("tls-key", "", "TLS private key file")
-	token := flag.String("token", "", "Fixed auth token (auto-generated if empty)")
-	basePath := flag.String("base-path", "/", "Base path")
-	maxConnections := flag.Int("max-connections", 5, "Max simultaneous connections per session")
+	configPath := flag.String("config", config.DefaultPath(), "Config file (TOML); command-line flags take precedence")
+	config.Default().RegisterFlags(flag.CommandLine)
 
 	flag.Parse()
 
@@ -42,21 +46,29 @@ func main() {
 		return
 	}
 
+	// 設定ファイルを読み込み、コマンドラインで明示したフラグで上書きする
+	overrides := config.Overrides(flag.CommandLine)
+	cfg, err := config.Load(*configPath, overrides)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// tmux の存在チェック
-	tmuxPath, err := exec.LookPath(*tmuxBin)
+	tmuxPath, err := exec.LookPath(cfg.Tmux.Bin)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: tmux not found: %s\n", *tmuxBin)
+		fmt.Fprintf(os.Stderr, "Error: tmux not found: %s\n", cfg.Tmux.Bin)
 		os.Exit(1)
 	}
 
-	// TLS フラグの検証: 片方だけ指定はエラー
-	if (*tlsCert == "") != (*tlsKey == "") {
-		fmt.Fprintf(os.Stderr, "Error: both --tls-cert and --tls-key must be specified together\n")
+	runtimeSettings, err := runtimeSettingsFrom(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	// トークン生成（未指定時）
-	authToken := *token
+	authToken := cfg.Server.Token
 	if authToken == "" {
 		tokenBytes := make([]byte, 32)
 		if _, err := rand.Read(tokenBytes); err != nil {
@@ -66,6 +78,91 @@ func main() {
 		authToken = hex.EncodeToString(tokenBytes)
 	}
 
+	// 名前付き API トークンを読み込み、Hook スクリプト用の通知専用トークンを発行する。
+	// Hook 用トークンは永続化せず、起動ごとに env ファイルへ書き出し直す。
+	tokenStore, err := server.NewTokenStore(configFilePath("tokens.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	_, hookToken, err := tokenStore.CreateEphemeral("claude-hooks", server.ScopeNotify)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to generate hook token: %v\n", err)
+		os.Exit(1)
+	}
+
+	// ユーザーアカウント（ロールと表示可能なセッションの制限）を読み込む
+	userStore, err := server.NewUserStore(configFilePath("users.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// リバースプロキシ（Cloudflare Access 等）が付与する JWT による認証
+	var jwtAuth *server.JWTAuth
+	if cfg.JWT.JWKS != "" {
+		jwtAuth, err = server.NewJWTAuth(server.JWTConfig{
+			Header:    cfg.JWT.Header,
+			JWKS:      cfg.JWT.JWKS,
+			Audience:  cfg.JWT.Audience,
+			Issuer:    cfg.JWT.Issuer,
+			UserClaim: cfg.JWT.UserClaim,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// 相互 TLS: 登録済みの端末のクライアント証明書のみ接続を受け付ける
+	var clientCerts *server.ClientCertAuth
+	if cfg.TLS.ClientCA != "" {
+		clientCerts, err = server.NewClientCertAuth(server.ClientCertConfig{
+			CAFile:       cfg.TLS.ClientCA,
+			CRLFile:      cfg.TLS.ClientCRL,
+			DenylistFile: cfg.TLS.ClientDenylist,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// 自動 TLS: ローカル CA と LAN IP・ホスト名を含むサーバー証明書を生成・再利用する
+	var autoTLS *server.AutoTLS
+	if cfg.TLS.Auto {
+		dir := configFilePath("tls")
+		if dir == "" {
+			fmt.Fprintf(os.Stderr, "Error: --tls-auto requires a home directory to store certificates\n")
+			os.Exit(1)
+		}
+		autoTLS, err = server.NewAutoTLS(dir, server.AutoTLSHosts(cfg.Server.Host))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// 状態を変更する API 呼び出しと attach/detach を記録する監査ログ
+	var auditLog *server.AuditLog
+	if cfg.Audit.Path != "" {
+		auditLog, err = server.OpenAuditLog(cfg.Audit.Path, cfg.Audit.MaxSizeMB<<20, cfg.Audit.MaxBackups)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// attach とウィンドウの録画（asciicast v2）の保存先
+	var recordings *server.RecordingStore
+	if cfg.Recordings.Dir != "" {
+		recordings, err = server.OpenRecordingStore(cfg.Recordings.Dir, cfg.Recordings.Retention, cfg.Recordings.MaxSizeMB<<20)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// フロントエンド FS を準備（embed.FS からサブディレクトリを取得）
 	frontFS, err := fs.Sub(frontendFS, "frontend/build")
 	if err != nil {
@@ -90,8 +187,16 @@ func main() {
 		log.Printf("Cleaned up %d stale grouped session(s)", cleaned)
 	}
 
-	// LSP サービスを初期化（言語サーバーを自動検出）
-	lspConfigs := lsp.DetectServers()
+	// tmux のコントロールモードでセッション・ウィンドウの変化を監視する（グループセッションの掃除の後に起動する）
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	mgr.StartEvents(eventsCtx)
+
+	// LSP サービスを初期化（言語サーバーの自動検出結果に設定ファイルの指定を重ねる）
+	var detected []lsp.ServerConfig
+	if cfg.LSP.AutoDetect {
+		detected = lsp.DetectServers()
+	}
+	lspConfigs := cfg.LSPServers(detected)
 	var lspService lsp.LSPService
 	if len(lspConfigs) > 0 {
 		lspService = lsp.NewService(lspConfigs)
@@ -99,34 +204,113 @@ func main() {
 		for i, c := range lspConfigs {
 			names[i] = c.Command
 		}
-		log.Printf("LSP: detected %d language server(s): %v", len(lspConfigs), names)
+		log.Printf("LSP: %d language server(s): %v", len(lspConfigs), names)
 	} else {
-		log.Printf("LSP: no language servers detected")
+		log.Printf("LSP: no language servers configured or detected")
 	}
 
+	// 設定ファイルの再読み込み（SIGHUP と POST /api/config/reload で共用）
+	reloader := &configReloader{path: *configPath, overrides: overrides, started: cfg}
+
 	// サーバーを生成
-	normalizedBasePath := server.NormalizeBasePath(*basePath)
+	normalizedBasePath := server.NormalizeBasePath(cfg.Server.BasePath)
 	srv := server.NewServer(server.Options{
 		Tmux:           mgr,
 		LSP:            lspService,
 		Token:          authToken,
+		Password:       cfg.Server.Password,
+		SessionTTL:     cfg.Server.SessionTTL,
+		SessionSecret:  configFilePath("session.key"),
+		Tokens:         tokenStore,
+		Users:          userStore,
+		JWT:            jwtAuth,
+		ClientCerts:    clientCerts,
+		AutoTLS:        autoTLS,
+		Audit:          auditLog,
+		Recordings:     recordings,
 		BasePath:       normalizedBasePath,
-		ClaudePath:     *claudePath,
+		PublicURL:      cfg.PublicURL(),
+		ClaudePath:     cfg.Tmux.ClaudePath,
 		Frontend:       frontFS,
-		MaxConnections: *maxConnections,
+		Searcher:       runtimeSettings.Searcher,
+		MaxConnections: cfg.Server.MaxConnections,
+		MaxSpectators:  cfg.Server.MaxSpectators,
+		AllowedOrigins: cfg.Server.AllowedOrigins,
+		TrustedProxies: cfg.Server.TrustedProxies,
 		Version:        version,
+		Reload:         func() ([]string, error) { return reloader.reload() },
 	})
+	srv.ApplySettings(runtimeSettings)
+	reloader.srv = srv
 
-	addr := fmt.Sprintf("%s:%d", *host, *port)
+	// TLS 証明書ファイルの存在チェック
+	if cfg.TLS.Cert != "" {
+		if _, err := os.Stat(cfg.TLS.Cert); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: TLS certificate file not found: %s\n", cfg.TLS.Cert)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(cfg.TLS.Key); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: TLS key file not found: %s\n", cfg.TLS.Key)
+			os.Exit(1)
+		}
+	}
 
-	// Hook スクリプト用の env ファイルを書き出す（ポート番号ごとに分離）
-	envPath := writeEnvFile(*port, authToken, normalizedBasePath)
+	// 待ち受けソケット: systemd のソケットアクティベーションで渡されていればそれを使い、
+	// なければ --listen（未指定時は --host / --port）で待ち受ける
+	listeners, err := server.SystemdListeners()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(listeners) == 0 {
+		ln, err := server.Listen(cfg.ListenAddr(), cfg.SocketFileMode())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		listeners = []net.Listener{ln}
+	}
+	addrs := make([]string, len(listeners))
+	for i, ln := range listeners {
+		addrs[i] = server.ListenerAddr(ln)
+	}
 
-	// シグナルハンドラ: 終了時に env ファイルを削除し LSP サーバーを停止
+	// Hook スクリプト用の env ファイルを書き出す（待ち受けポート・ソケットごとに分離）
+	// PALMUX_TOKEN には通知 API のみ操作できる Hook 用トークンを書き出す
+	envPath := writeEnvFile(listeners[0].Addr(), hookToken, normalizedBasePath)
+
+	// SIGHUP で設定ファイルを再読み込みする
+	go func() {
+		hupCh := make(chan os.Signal, 1)
+		signal.Notify(hupCh, syscall.SIGHUP)
+		for range hupCh {
+			if _, err := reloader.reload(); err != nil {
+				log.Printf("config reload failed (keeping current settings): %v", err)
+			}
+		}
+	}()
+
+	// シグナルハンドラ: 新しい接続の受け付けを止め、WebSocket 接続（tmux attach とグループセッション）の
+	// クリーンアップと処理中のリクエストの完了を待ってから LSP サーバーを停止して終了する。
+	// 待機中に再度シグナルを受けた場合は即座に終了する。
+	shutdownDone := make(chan struct{})
 	go func() {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		<-sigCh
+		log.Printf("Shutting down (waiting up to %s for connections to close)...", shutdownTimeout)
+		go func() {
+			<-sigCh
+			log.Printf("Forced shutdown")
+			os.Exit(1)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown error: %v", err)
+		}
+		cancel()
+		stopEvents()
 		if lspService != nil {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
@@ -137,35 +321,128 @@ func main() {
 		if envPath != "" {
 			os.Remove(envPath)
 		}
-		os.Exit(0)
+		auditLog.Close()
+		close(shutdownDone)
 	}()
 
-	if *tlsCert != "" {
-		// TLS 証明書ファイルの存在チェック
-		if _, err := os.Stat(*tlsCert); os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "Error: TLS certificate file not found: %s\n", *tlsCert)
-			os.Exit(1)
+	mode := ""
+	if autoTLS != nil {
+		mode = " (TLS, auto)"
+	} else if cfg.TLS.Cert != "" {
+		mode = " (TLS)"
+	}
+	fmt.Printf("Palmux started on %s%s (base path: %s)\n", strings.Join(addrs, ", "), mode, normalizedBasePath)
+	fmt.Printf("Auth token: %s\n", authToken)
+	if autoTLS != nil {
+		if tcpAddr, ok := listeners[0].Addr().(*net.TCPAddr); ok {
+			fmt.Printf("Local CA: %s (download: https://%s:%d%sapi/tls/ca.crt)\n", autoTLS.CAPath(), displayHost(cfg.Server.Host), tcpAddr.Port, normalizedBasePath)
+		} else {
+			fmt.Printf("Local CA: %s\n", autoTLS.CAPath())
 		}
-		if _, err := os.Stat(*tlsKey); os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "Error: TLS key file not found: %s\n", *tlsKey)
-			os.Exit(1)
+	}
+
+	serve := func(ln net.Listener) error {
+		if autoTLS != nil {
+			return srv.ServeTLS(ln, "", "")
+		}
+		if cfg.TLS.Cert != "" {
+			return srv.ServeTLS(ln, cfg.TLS.Cert, cfg.TLS.Key)
 		}
+		return srv.Serve(ln)
+	}
+	errCh := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			errCh <- serve(ln)
+		}(ln)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+}
 
-		fmt.Printf("Palmux started on %s (TLS) (base path: %s)\n", addr, normalizedBasePath)
-		fmt.Printf("Auth token: %s\n", authToken)
-		log.Fatal(srv.ListenAndServeTLS(addr, *tlsCert, *tlsKey))
-	} else {
-		fmt.Printf("Palmux started on %s (base path: %s)\n", addr, normalizedBasePath)
-		fmt.Printf("Auth token: %s\n", authToken)
-		log.Fatal(srv.ListenAndServe(addr))
+// runtimeSettingsFrom は cfg から稼働中に変更できる設定を組み立てる。
+func runtimeSettingsFrom(cfg *config.Config) (server.RuntimeSettings, error) {
+	searcher, err := grep.NewSearcherByName(cfg.Grep.Engine)
+	if err != nil {
+		return server.RuntimeSettings{}, err
 	}
+	return server.RuntimeSettings{
+		MaxConnections:  cfg.Server.MaxConnections,
+		MaxSpectators:   cfg.Server.MaxSpectators,
+		AllowedOrigins:  cfg.Server.AllowedOrigins,
+		Searcher:        searcher,
+		GrepMaxResults:  cfg.Grep.MaxResults,
+		NotificationTTL: cfg.Notifications.TTL,
+		MaxUploadSize:   cfg.Upload.MaxSizeMB << 20,
+	}, nil
 }
 
-// writeEnvFile は ~/.config/palmux/env.<port> にサーバー情報を書き出す。
-// ポート番号ごとにファイルを分離し、複数インスタンスの同時起動に対応する。
-// Claude Code の Hook スクリプトが全 env.* ファイルを source して利用する。
+// configReloader は設定ファイルを再読み込みして稼働中のサーバーに反映する。
+// コマンドラインで明示したフラグは再読み込み後も優先する。
+type configReloader struct {
+	mu        sync.Mutex
+	path      string
+	overrides map[string]string
+	started   *config.Config // 起動時の設定
+	srv       *server.Server
+}
+
+// reload は設定ファイルを読み直し、再読み込み可能な設定を反映する。
+// 再起動しないと反映されない変更があった場合はそのキーを返す。
+// 設定ファイルが不正な場合はエラーを返し、現在の設定を維持する。
+func (cr *configReloader) reload() ([]string, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	next, err := config.Load(cr.path, cr.overrides)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := runtimeSettingsFrom(next)
+	if err != nil {
+		return nil, err
+	}
+	cr.srv.ApplySettings(rs)
+
+	// 再起動が必要な項目は反映されないため、常に起動時の設定と比較する
+	restartRequired := config.RestartRequired(cr.started, next)
+	log.Printf("config reloaded from %s", cr.path)
+	if len(restartRequired) > 0 {
+		log.Printf("config: restart required to apply %s", strings.Join(restartRequired, ", "))
+	}
+	return restartRequired, nil
+}
+
+// displayHost は起動メッセージに表示するホスト名を返す。
+// 全インターフェースで待ち受ける場合はマシンのホスト名を使う。
+func displayHost(host string) string {
+	if host != "0.0.0.0" && host != "::" && host != "" {
+		return host
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "localhost"
+}
+
+// configFilePath は ~/.config/palmux/<name> のパスを返す。
+// ホームディレクトリが取得できない場合は空文字列を返し、呼び出し側はメモリ上でのみ状態を保持する。
+func configFilePath(name string) string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".config", "palmux", name)
+}
+
+// writeEnvFile は ~/.config/palmux/env.<port>（Unix ソケットの場合は env.sock-<name>）にサーバー情報を書き出す。
+// 待ち受けごとにファイルを分離し、複数インスタンスの同時起動に対応する。
+// Claude Code の Hook スクリプトが全 env.* ファイルを source して利用するため、
+// 前のファイルの値が残らないよう PALMUX_PORT と PALMUX_SOCKET は常に両方書き出す。
 // 書き出したファイルパスを返す（エラー時は空文字列）。
-func writeEnvFile(port int, token, basePath string) string {
+func writeEnvFile(addr net.Addr, token, basePath string) string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		log.Printf("Warning: cannot determine home directory for env file: %v", err)
@@ -178,9 +455,22 @@ func writeEnvFile(port int, token, basePath string) string {
 		return ""
 	}
 
-	envPath := filepath.Join(dir, fmt.Sprintf("env.%d", port))
-	content := fmt.Sprintf("export PALMUX_PORT=%d\nexport PALMUX_TOKEN=%s\nexport PALMUX_BASE_PATH=%s\n",
-		port, token, basePath)
+	var name, port, socket string
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		port = strconv.Itoa(a.Port)
+		name = port
+	case *net.UnixAddr:
+		socket = a.Name
+		name = "sock-" + strings.TrimSuffix(filepath.Base(a.Name), filepath.Ext(a.Name))
+	default:
+		log.Printf("Warning: unsupported listen address for env file: %s", addr)
+		return ""
+	}
+
+	envPath := filepath.Join(dir, "env."+name)
+	content := fmt.Sprintf("export PALMUX_PORT=%s\nexport PALMUX_SOCKET=%s\nexport PALMUX_TOKEN=%s\nexport PALMUX_BASE_PATH=%s\n",
+		port, socket, token, basePath)
 
 	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
 		log.Printf("Warning: cannot write env file %s: %v", envPath, err)